@@ -0,0 +1,296 @@
+package yt_stats
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults and limits of chat analytics. Live chats are analysed over a rolling window of their newest events, and
+// timelines that would have too many buckets have their interval doubled until they fit.
+const (
+	defaultChatWindow   = 5 * time.Minute
+	defaultChatInterval = time.Minute
+	defaultTopChatters  = 10
+	maxTimelineBuckets  = 1440
+)
+
+// Event types counting as messages written by chatters.
+var chatMessageTypes = map[string]bool{
+	"message":   true,
+	"superchat": true,
+}
+
+// A chat event as kept for the timeline, with the ID of its author if it is a message.
+type analyzedChatEvent struct {
+	time    time.Time
+	message bool
+	chatter string
+}
+
+// Statistics on the events of a chat, gathered one event at a time. Chatters already known from before the analysed
+// events, either earlier in the same chat or in other chats, count as returning chatters.
+type chatStats struct {
+	known             map[string]bool
+	events            []analyzedChatEvent
+	messages          int
+	memberMessages    int
+	moderatorMessages int
+	bans              int
+	deletions         int
+	chatters          map[string]*ChatterCount
+	order             []string
+}
+
+// Creates empty chat statistics with the given chatters already known.
+func newChatStats(known map[string]bool) *chatStats {
+	if known == nil {
+		known = make(map[string]bool)
+	}
+	return &chatStats{known: known, chatters: make(map[string]*ChatterCount)}
+}
+
+// Gives the author of a chat event if it is a message.
+func chatMessageAuthor(eventType string, event interface{}) (ChatUser, bool) {
+	if !chatMessageTypes[eventType] {
+		return ChatUser{}, false
+	}
+	author, ok := chatEventAuthor(event)
+	return author, ok && author.UserId != ""
+}
+
+// Marks the author of a chat event from before the analysed events as known, without counting the event.
+func (s *chatStats) know(eventType string, event interface{}) {
+	if author, ok := chatMessageAuthor(eventType, event); ok {
+		s.known[author.UserId] = true
+	}
+}
+
+// Counts a chat event parsed by ChatParser.
+func (s *chatStats) add(eventTime time.Time, eventType string, event interface{}) {
+	analyzed := analyzedChatEvent{time: eventTime}
+	switch eventType {
+	case "ban":
+		s.bans++
+	case "message_deleted":
+		s.deletions++
+	}
+	if author, ok := chatMessageAuthor(eventType, event); ok {
+		analyzed.message = true
+		analyzed.chatter = author.UserId
+		s.messages++
+		if author.Member {
+			s.memberMessages++
+		}
+		if author.Moderator {
+			s.moderatorMessages++
+		}
+		chatter, ok := s.chatters[author.UserId]
+		if !ok {
+			chatter = &ChatterCount{}
+			s.chatters[author.UserId] = chatter
+			s.order = append(s.order, author.UserId)
+		}
+		chatter.Chatter = author
+		chatter.Messages++
+	}
+	s.events = append(s.events, analyzed)
+}
+
+// Gives the statistics between two times, which default to the times of the first and last events counted. Rates are
+// per minute of that time range, counting at least one minute. The timeline has one bucket per interval, and the top
+// chatters are limited to the given amount, with ties ordered by who wrote first. Events do not need to be counted in
+// chronological order, as archives keep them in the order they were received.
+func (s *chatStats) outbound(start time.Time, end time.Time, interval time.Duration,
+	limit int) ChatAnalyticsOutbound {
+	sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].time.Before(s.events[j].time) })
+	s.order = s.order[:0]
+	ordered := make(map[string]bool)
+	for _, event := range s.events {
+		if event.message && !ordered[event.chatter] {
+			ordered[event.chatter] = true
+			s.order = append(s.order, event.chatter)
+		}
+	}
+	outbound := ChatAnalyticsOutbound{
+		Events:         len(s.events),
+		Messages:       s.messages,
+		UniqueChatters: len(s.chatters),
+		Bans:           s.bans,
+		Deletions:      s.deletions,
+		TopChatters:    []ChatterCount{},
+		Timeline:       []ChatActivityBucket{},
+	}
+	for _, id := range s.order {
+		if s.known[id] {
+			outbound.ReturningChatters++
+		} else {
+			outbound.NewChatters++
+		}
+		outbound.TopChatters = append(outbound.TopChatters, *s.chatters[id])
+	}
+	sort.SliceStable(outbound.TopChatters, func(i, j int) bool {
+		return outbound.TopChatters[i].Messages > outbound.TopChatters[j].Messages
+	})
+	if len(outbound.TopChatters) > limit {
+		outbound.TopChatters = outbound.TopChatters[:limit]
+	}
+	if s.messages > 0 {
+		outbound.MemberShare = float64(s.memberMessages) / float64(s.messages)
+		outbound.ModeratorShare = float64(s.moderatorMessages) / float64(s.messages)
+	}
+	if len(s.events) > 0 && start.IsZero() {
+		start = s.events[0].time
+	}
+	if len(s.events) > 0 && end.IsZero() {
+		end = s.events[len(s.events)-1].time
+	}
+	if start.IsZero() || end.Before(start) {
+		return outbound
+	}
+	outbound.StartTime = start.UTC().Format(time.RFC3339)
+	outbound.EndTime = end.UTC().Format(time.RFC3339)
+	minutes := end.Sub(start).Minutes()
+	if minutes < 1 {
+		minutes = 1
+	}
+	outbound.MessagesPerMinute = float64(s.messages) / minutes
+
+	// Count the events into buckets aligned to the interval.
+	first, interval, buckets := alignTimeline(start, end, interval)
+	outbound.Interval = int(interval.Seconds())
+	outbound.Timeline = make([]ChatActivityBucket, buckets)
+	chatters := make([]map[string]bool, len(outbound.Timeline))
+	for i := range outbound.Timeline {
+		outbound.Timeline[i].Time = first.Add(time.Duration(i) * interval).Format(time.RFC3339)
+		chatters[i] = make(map[string]bool)
+	}
+	for _, event := range s.events {
+		i := int(event.time.Sub(first) / interval)
+		if event.time.Before(first) || i >= len(outbound.Timeline) {
+			continue
+		}
+		outbound.Timeline[i].Events++
+		if event.message {
+			outbound.Timeline[i].Messages++
+			chatters[i][event.chatter] = true
+		}
+	}
+	for i := range outbound.Timeline {
+		outbound.Timeline[i].Chatters = len(chatters[i])
+	}
+	return outbound
+}
+
+// Aligns a timeline between two times to its interval, doubling the interval until there are few enough buckets.
+// Gives back the start of the first bucket, the interval, and the amount of buckets.
+func alignTimeline(start time.Time, end time.Time, interval time.Duration) (time.Time, time.Duration, int) {
+	for end.Sub(start)/interval >= maxTimelineBuckets {
+		interval *= 2
+	}
+	first := start.UTC().Truncate(interval)
+	return first, interval, int(end.Sub(first)/interval) + 1
+}
+
+// Analyses the recorded chat of a stream between two times, with the chatters of all other recorded chats known.
+// Events before the time range only make their chatters known. Gives back false if the stream was never recorded.
+func (rec *Recorder) analyze(videoId string, since time.Time, until time.Time, interval time.Duration,
+	limit int) (ChatAnalyticsOutbound, bool, error) {
+	recording, found, err := rec.readRecording(videoId)
+	if err != nil || !found {
+		return ChatAnalyticsOutbound{}, found, err
+	}
+	known, err := rec.chatters(videoId, recording.ChatId)
+	if err != nil {
+		return ChatAnalyticsOutbound{}, true, err
+	}
+	stats := newChatStats(known)
+	_, err = rec.readArchive(videoId, func(event archivedChatEvent) error {
+		if !until.IsZero() && event.Time.After(until) {
+			return nil
+		}
+		chatEvent, err := decodeChatEvent(event.Type, event.Event)
+		if err != nil {
+			return err
+		}
+		if event.Time.Before(since) {
+			stats.know(event.Type, chatEvent)
+		} else {
+			stats.add(event.Time, event.Type, chatEvent)
+		}
+		return nil
+	})
+	if err != nil {
+		return ChatAnalyticsOutbound{}, true, err
+	}
+	outbound := stats.outbound(time.Time{}, time.Time{}, interval, limit)
+	outbound.Id = videoId
+	outbound.Source = "archive"
+	return outbound, true, nil
+}
+
+// Gives the IDs of the users who wrote messages in the recorded chats of all streams except the given one, skipping
+// recordings of the given chat as well. The users kept along with each recording are joined, rather than reading
+// every archive.
+func (rec *Recorder) chatters(videoId string, chatId string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	paths, err := filepath.Glob(filepath.Join(rec.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		id, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil || id == videoId {
+			continue
+		}
+		recording, found, err := rec.readRecording(id)
+		if err != nil {
+			return nil, err
+		}
+		if !found || (chatId != "" && recording.ChatId == chatId) {
+			continue
+		}
+		rec.mutex.Lock()
+		chatters, err := rec.readChatters(id)
+		rec.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		for chatter := range chatters {
+			known[chatter] = true
+		}
+	}
+	return known, nil
+}
+
+// Analyses the newest events relayed from a live chat within a window ending now, with the given chatters known.
+// Events before the window only make their chatters known. Gives back false if the chat is not currently polled.
+func (r *Relay) analyze(id string, window time.Duration, interval time.Duration, limit int,
+	known map[string]bool) (ChatAnalyticsOutbound, bool) {
+	history, found := r.history(id)
+	if !found {
+		return ChatAnalyticsOutbound{}, false
+	}
+	end := time.Now().UTC()
+	start := end.Add(-window)
+	stats := newChatStats(known)
+	for _, event := range history {
+		if event.Type == relayErrorEvent {
+			continue
+		}
+		if event.Time.Before(start) {
+			stats.know(event.Type, event.Event)
+			continue
+		}
+		if event.Time.After(end) {
+			end = event.Time
+		}
+		stats.add(event.Time, event.Type, event.Event)
+	}
+	outbound := stats.outbound(start, end, interval, limit)
+	outbound.Id = id
+	outbound.Source = "live"
+	return outbound, true
+}
@@ -2,15 +2,15 @@ package yt_stats
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ChannelHandler is the handler for the channel endpoint. /ytstats/v1/channel/
-// Provides statistics for up to 50 channels.
+// Provides statistics for up to 50 channels, and optionally additional parts of their information.
 func ChannelHandler(input Inputs) http.Handler {
 	channel := func(w http.ResponseWriter, r *http.Request) {
 		quota := 0
@@ -18,8 +18,6 @@ func ChannelHandler(input Inputs) http.Handler {
 		case http.MethodGet:
 
 			// Check user input and fail if input is incorrect or missing.
-			var youtubeStatus StatusCodeOutbound
-			var channelInbound ChannelInbound
 			key := getKey(r)
 			if key == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
@@ -34,29 +32,26 @@ func ChannelHandler(input Inputs) http.Handler {
 				sendStatusCode(w, quota, http.StatusBadRequest, "tooManyItems")
 				return
 			}
-
-			// Query youtube and check response for errors.
-			resp, err := http.Get(fmt.Sprintf("%s&id=%s&key=%s", input.ChannelsRoot, url.QueryEscape(ids), key))
-			if err != nil {
-				sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
+			parts, ok := parseChannelParts(r.URL.Query().Get("parts"))
+			if !ok {
+				sendStatusCode(w, quota, http.StatusBadRequest, "partInvalid")
 				return
 			}
-			defer resp.Body.Close()
-			quota++
-			youtubeStatus = ErrorParser(resp.Body, &channelInbound)
+
+			// Query youtube and check response for errors.
+			channelInbound, youtubeStatus, cost := queryChannels(input, ids, key, parts)
+			quota += cost
 			if youtubeStatus.StatusCode != http.StatusOK {
-				if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-					quota--
-				}
 				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
 				return
 			}
 
 			// Process and provide response.
 			channelOutbound := ChannelParser(channelInbound)
+			ChannelPartsParser(channelInbound, &channelOutbound, parts)
 			channelOutbound.QuotaUsage = quota
 			w.Header().Set("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(channelOutbound)
+			err := json.NewEncoder(w).Encode(channelOutbound)
 			if err != nil {
 				log.Println("Failed to respond to channel endpoint.")
 			}
@@ -68,3 +63,632 @@ func ChannelHandler(input Inputs) http.Handler {
 	}
 	return http.HandlerFunc(channel)
 }
+
+// ChannelVideosHandler is the handler for the channel videos endpoint. /ytstats/v1/channel/{id}/videos/
+// Provides all videos uploaded by a channel, optionally limited to a publishing date range or an amount of videos,
+// and statistics on them. Pagination stops as early as possible to save quota.
+func ChannelVideosHandler(input Inputs) http.Handler {
+	channelVideos := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			statsFlag := strings.ToLower(r.URL.Query().Get("stats"))
+			if statsFlag != "" && statsFlag != "true" && statsFlag != "false" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "flagInvalid")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			limit := 0
+			if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+				limit, err = strconv.Atoi(limitParam)
+				if err != nil || limit < 1 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "limitInvalid")
+					return
+				}
+			}
+
+			// Query youtube channels endpoint for the uploads playlist of the channel.
+			channelInbound, youtubeStatus, cost := queryChannels(input, id, key, nil)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+			channels := ChannelParser(channelInbound).Channels
+			if len(channels) == 0 {
+				sendStatusCode(w, quota, http.StatusNotFound, "channelNotFound")
+				return
+			}
+
+			// Walk uploads playlist, which lists newest uploads first, until the limit or start of the range is reached.
+			// Videos are placed by when they were published rather than uploaded, as scheduled videos are uploaded
+			// before they are published.
+			var videoIds []string
+			uploads := channels[0].UploadsPlaylist
+			youtubeStatus, cost = walkPlaylistItems(input, uploads, key, func(page PlaylistItemsInbound) bool {
+				for _, item := range page.Items {
+					published, err := time.Parse(time.RFC3339, item.ContentDetails.VideoPublishedAt)
+					if err == nil && !until.IsZero() && published.After(until) {
+						continue
+					}
+					if err == nil && !since.IsZero() && published.Before(since) {
+						return false
+					}
+					videoIds = append(videoIds, item.Snippet.ResourceId.VideoId)
+					if limit != 0 && len(videoIds) >= limit {
+						return false
+					}
+				}
+				return true
+			})
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+
+			// Query youtube videos endpoint, and keep only videos actually published in the requested range.
+			videoInbound, youtubeStatus, cost := queryVideoPages(input, chunkIds(videoIds, 50), key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+			for i, page := range videoInbound {
+				filtered := page.Items[:0:0]
+				for _, video := range page.Items {
+					published, err := time.Parse(time.RFC3339, video.Snippet.PublishedAt)
+					inRange := (since.IsZero() || !published.Before(since)) && (until.IsZero() || !published.After(until))
+					if err != nil || inRange {
+						filtered = append(filtered, video)
+					}
+				}
+				videoInbound[i].Items = filtered
+			}
+
+			// Parse videos and statistics, and provide response.
+			var tempPlaylistObject Playlist
+			err = VideoParser(videoInbound, &tempPlaylistObject, statsFlag != "false", true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedParsingYouTubeResponse")
+				return
+			}
+			channelVideosOutbound := ChannelVideosOutbound{
+				QuotaUsage:      quota,
+				ChannelId:       channels[0].Id,
+				UploadsPlaylist: channels[0].UploadsPlaylist,
+				VideoStats:      tempPlaylistObject.VideoStats,
+				Videos:          tempPlaylistObject.Videos,
+			}
+			if channelVideosOutbound.Videos == nil {
+				channelVideosOutbound.Videos = []Video{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(channelVideosOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel videos endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelVideos)
+}
+
+// ChannelPlaylistsHandler is the handler for the channel playlists endpoint. /ytstats/v1/channel/{id}/playlists/
+// Provides all public playlists of a channel, optionally with videos and statistics on each playlist.
+func ChannelPlaylistsHandler(input Inputs) http.Handler {
+	channelPlaylists := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			videosFlag := strings.ToLower(r.URL.Query().Get("videos"))
+			if videosFlag != "" && videosFlag != "true" && videosFlag != "false" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "flagInvalid")
+				return
+			}
+			statsFlag := strings.ToLower(r.URL.Query().Get("stats"))
+			if statsFlag != "" && statsFlag != "true" && statsFlag != "false" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "flagInvalid")
+				return
+			}
+
+			// Query youtube playlists endpoint for all pages of playlists owned by the channel.
+			playlistInbound, youtubeStatus, cost := queryChannelPlaylists(input, id, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+			playlistOutbound := PlaylistTopLevelParser(playlistInbound)
+
+			// Videos and statistics are opt-in here, as they cost quota for every playlist of the channel.
+			if videosFlag == "true" || statsFlag == "true" {
+				for i := range playlistOutbound.Playlists {
+					youtubeStatus, cost = queryPlaylistVideos(input, key, &playlistOutbound.Playlists[i],
+						statsFlag == "true", videosFlag == "true")
+					quota += cost
+					if youtubeStatus.StatusCode != http.StatusOK {
+						sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+						return
+					}
+				}
+			}
+
+			// Provide response.
+			channelPlaylistsOutbound := ChannelPlaylistsOutbound{
+				QuotaUsage: quota,
+				ChannelId:  id,
+				Playlists:  playlistOutbound.Playlists,
+			}
+			if channelPlaylistsOutbound.Playlists == nil {
+				channelPlaylistsOutbound.Playlists = []Playlist{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(channelPlaylistsOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel playlists endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelPlaylists)
+}
+
+// ChannelSectionsHandler is the handler for the channel sections endpoint. /ytstats/v1/channel/{id}/sections/
+// Provides the sections shown on the home page of a channel, with the playlists and channels they contain.
+func ChannelSectionsHandler(input Inputs) http.Handler {
+	channelSections := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+
+			// Query youtube and check response for errors.
+			sectionsInbound, youtubeStatus, cost := querySections(input, id, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+
+			// Process and provide response.
+			sectionsOutbound := SectionsParser(sectionsInbound, id)
+			sectionsOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(sectionsOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel sections endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelSections)
+}
+
+// FeaturedChannelsHandler is the handler for the featured channels endpoint. /ytstats/v1/channel/{id}/featured/
+// Provides statistics for all channels featured in the sections of a channel, in the order they are featured,
+// and optionally additional parts of their information.
+func FeaturedChannelsHandler(input Inputs) http.Handler {
+	featuredChannels := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			parts, ok := parseChannelParts(r.URL.Query().Get("parts"))
+			if !ok {
+				sendStatusCode(w, quota, http.StatusBadRequest, "partInvalid")
+				return
+			}
+
+			// Query youtube channel sections endpoint and collect featured channels without duplicates.
+			sectionsInbound, youtubeStatus, cost := querySections(input, id, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+			var channelIds []string
+			seen := make(map[string]bool)
+			for _, section := range SectionsParser(sectionsInbound, id).Sections {
+				for _, channelId := range section.Channels {
+					if !seen[channelId] {
+						seen[channelId] = true
+						channelIds = append(channelIds, channelId)
+					}
+				}
+			}
+
+			// Query youtube channels endpoint in batches of 50, and restore the featured order.
+			featuredChannelsOutbound := FeaturedChannelsOutbound{ChannelId: id, Channels: []Channel{}}
+			channelsById := make(map[string]Channel)
+			for _, chunk := range chunkIds(channelIds, 50) {
+				channelInbound, youtubeStatus, cost := queryChannels(input, strings.Join(chunk, ","), key, parts)
+				quota += cost
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				channelOutbound := ChannelParser(channelInbound)
+				ChannelPartsParser(channelInbound, &channelOutbound, parts)
+				for _, channel := range channelOutbound.Channels {
+					channelsById[channel.Id] = channel
+				}
+			}
+			for _, channelId := range channelIds {
+				if channel, ok := channelsById[channelId]; ok {
+					featuredChannelsOutbound.Channels = append(featuredChannelsOutbound.Channels, channel)
+				}
+			}
+
+			// Provide response.
+			featuredChannelsOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(featuredChannelsOutbound)
+			if err != nil {
+				log.Println("Failed to respond to featured channels endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(featuredChannels)
+}
+
+// ChannelHistoryHandler is the handler for the channel history endpoint. /ytstats/v1/channel/{id}/history/
+// Provides snapshots of the statistics of a tracked channel over time, optionally downsampled and with deltas.
+// Tracking of a channel is started with POST, which takes the first snapshot, and stopped with DELETE.
+func ChannelHistoryHandler(input Inputs) http.Handler {
+	channelHistory := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			if input.Tracker == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			deltasFlag := strings.ToLower(r.URL.Query().Get("deltas"))
+			if deltasFlag != "" && deltasFlag != "true" && deltasFlag != "false" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "flagInvalid")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			var interval time.Duration
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval <= 0 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+
+			// Start or stop tracking the channel. Starting takes a snapshot to make sure the channel exists.
+			switch r.Method {
+			case http.MethodPost:
+				youtubeStatus, cost, found, err := input.Tracker.TrackChannel(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "channelNotFound")
+					return
+				}
+			case http.MethodDelete:
+				untracked, err := input.Tracker.UntrackChannel(id, key)
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if !untracked {
+					sendStatusCode(w, quota, http.StatusNotFound, "channelNotTracked")
+					return
+				}
+			}
+
+			// Read the history from the store.
+			tracked, err := input.Tracker.ChannelTracked(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			history, err := input.Tracker.ChannelHistory(id, since, until, interval, deltasFlag == "true")
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if r.Method == http.MethodGet && !tracked && len(history) == 0 {
+				sendStatusCode(w, quota, http.StatusNotFound, "channelNotTracked")
+				return
+			}
+
+			// Provide response.
+			channelHistoryOutbound := ChannelHistoryOutbound{
+				QuotaUsage: quota,
+				ChannelId:  id,
+				Tracked:    tracked,
+				History:    history,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(channelHistoryOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel history endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelHistory)
+}
+
+// ChannelLiveHandler is the handler for the channel live endpoint. /ytstats/v1/channel/{id}/live/
+// Gives the scheduled and live streams of a channel with GET, and starts or stops watching the channel for streams
+// with POST and DELETE. Watched channels are checked for new, rescheduled, started and ended streams periodically.
+func ChannelLiveHandler(input Inputs) http.Handler {
+	channelLive := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			if input.Tracker == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+
+			// Start or stop watching the channel. Starting checks the channel for streams right away.
+			switch r.Method {
+			case http.MethodPost:
+				youtubeStatus, cost, found, err := input.Tracker.WatchChannelLive(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "channelNotFound")
+					return
+				}
+			case http.MethodDelete:
+				unwatched, err := input.Tracker.UnwatchChannelLive(id, key)
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if !unwatched {
+					sendStatusCode(w, quota, http.StatusNotFound, "channelNotWatched")
+					return
+				}
+			}
+
+			// Read the streams from the store.
+			watched, err := input.Tracker.ChannelLiveWatched(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			streams, err := input.Tracker.ChannelStreams(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if r.Method == http.MethodGet && !watched && len(streams) == 0 {
+				sendStatusCode(w, quota, http.StatusNotFound, "channelNotWatched")
+				return
+			}
+
+			// Provide response.
+			channelLiveOutbound := ChannelLiveOutbound{
+				QuotaUsage: quota,
+				ChannelId:  id,
+				Watched:    watched,
+				Streams:    streams,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(channelLiveOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel live endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelLive)
+}
+
+// ChannelModerationHandler is the handler for the channel moderation endpoint. /ytstats/v1/channel/{id}/moderation/
+// Gives the log of bans, timeouts, message deletions and member only mode changes in the live chats of a channel
+// with GET, optionally only those on or by one user, and within a time range. Logging the chat of the current live
+// stream of the channel is started with POST, and stopped with DELETE, keeping the log.
+func ChannelModerationHandler(input Inputs) http.Handler {
+	channelModeration := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/channel/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "channelIdMissing")
+				return
+			}
+			if input.Moderation == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+
+			// Start or stop following the chat of the channel. Starting looks up the current live stream.
+			switch r.Method {
+			case http.MethodPost:
+				youtubeStatus, cost, err := input.Moderation.Follow(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+			case http.MethodDelete:
+				found, err := input.Moderation.Stop(id, key)
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "channelNotModerated")
+					return
+				}
+			}
+
+			// Read the log from the store.
+			moderationLogOutbound, found, err := input.Moderation.Log(id, r.URL.Query().Get("user"), since, until)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "channelNotModerated")
+				return
+			}
+
+			// Provide response.
+			moderationLogOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(moderationLogOutbound)
+			if err != nil {
+				log.Println("Failed to respond to channel moderation endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(channelModeration)
+}
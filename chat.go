@@ -5,59 +5,98 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ChatHandler is the handler for the chat endpoint. /ytstats/v1/chat/
-// Lists messages of ongoing live streams. Only works on currently active streams.
+// Lists messages of ongoing live streams. Only works on currently active streams. The chat is given by its ID, or
+// looked up from a video or the current live stream of a channel, in which case the viewers of the stream are given.
+// Events can be filtered via filters in request body, which is why POST is accepted as well as GET.
 func ChatHandler(input Inputs) http.Handler {
 	stats := func(w http.ResponseWriter, r *http.Request) {
 		quota := 0
 		switch r.Method {
-		case http.MethodGet:
+		case http.MethodGet, http.MethodPost:
 
 			// Check user input and fail if input is incorrect or missing.
-			var youtubeStatus StatusCodeOutbound
-			var chatInbound ChatInbound
 			key := getKey(r)
 			if key == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
 				return
 			}
 			id := r.URL.Query().Get("id")
-			if id == "" {
+			videoId := r.URL.Query().Get("video")
+			channelId := r.URL.Query().Get("channel")
+			if id == "" && videoId == "" && channelId == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
 				return
 			}
-			if len(strings.Split(id, ",")) > 1 {
+			given := 0
+			for _, value := range []string{id, videoId, channelId} {
+				if value != "" {
+					given++
+				}
+			}
+			if given > 1 || strings.Contains(id+videoId+channelId, ",") {
 				sendStatusCode(w, quota, http.StatusBadRequest, "tooManyItems")
 				return
 			}
 			page := r.URL.Query().Get("page")
-
-			// Query youtube and check response for errors.
-			resp, err := http.Get(fmt.Sprintf("%s&liveChatId=%s&key=%s&pageToken=%s", input.ChatRoot, url.QueryEscape(id), key, page))
-			if err != nil {
-				sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
+			searches, code, msg := readFilters(w, r)
+			if msg == "" {
+				code, msg = http.StatusBadRequest, validateChatFilters(searches)
+			}
+			if msg != "" {
+				sendStatusCode(w, quota, code, msg)
 				return
 			}
-			defer resp.Body.Close()
-			quota += 5
-			youtubeStatus = ErrorParser(resp.Body, &chatInbound)
+
+			// Look up the live chat of the video, or of the current live stream of the channel.
+			var stream liveChat
+			if id == "" {
+				var youtubeStatus StatusCodeOutbound
+				var cost int
+				if videoId != "" {
+					stream, youtubeStatus, cost = input.Resolver.video(input, videoId, key)
+				} else {
+					stream, youtubeStatus, cost = input.Resolver.channel(input, channelId, key)
+				}
+				quota += cost
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				id = stream.chatId
+			}
+
+			// Query youtube and check response for errors. A chat looked up that can no longer be read is forgotten,
+			// as its stream has most likely ended.
+			chatInbound, youtubeStatus, cost := queryChat(input, id, key, page)
+			quota += cost
 			if youtubeStatus.StatusCode != http.StatusOK {
-				if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-					quota -= 5
+				if stream.videoId != "" {
+					input.Resolver.forget(stream.videoId)
 				}
 				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
 				return
 			}
 
-			// Process and provide response.
+			// Process, filter and provide response.
 			chatOutbound := ChatParser(chatInbound, id)
 			chatOutbound.QuotaUsage = quota
+			_, chatOutbound.ChatEvents = ChatFilter(searches, chatOutbound.ChatEvents)
+			if chatOutbound.ChatEvents == nil {
+				chatOutbound.ChatEvents = []interface{}{}
+			}
+			if stream.videoId != "" {
+				chatOutbound.VideoId = stream.videoId
+				chatOutbound.ConcurrentViewers = &stream.viewers
+			}
 			w.Header().Set("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(chatOutbound)
+			err := json.NewEncoder(w).Encode(chatOutbound)
 			if err != nil {
 				log.Println("Failed to respond to chat endpoint.")
 			}
@@ -69,3 +108,431 @@ func ChatHandler(input Inputs) http.Handler {
 	}
 	return http.HandlerFunc(stats)
 }
+
+// Writes a relayed chat event as a Server-Sent Event, with the type and ID of the chat event as the event name and ID.
+func writeServerSentEvent(w http.ResponseWriter, event relayedEvent) error {
+	if event.Id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.Id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+	return err
+}
+
+// ChatStreamHandler is the handler for the chat stream endpoint. /ytstats/v1/chat/{id}/stream/
+// Streams the events of a live chat as Server-Sent Events, polling the chat on the server as often as YouTube
+// suggests. All clients streaming the same chat share one poller. Events can be filtered with a JSON list of filters
+// in the filters parameter, which work like the filters of the comments endpoint. The stream closes after the
+// chat_ended event, which is never filtered, or after an error event if polling fails.
+func ChatStreamHandler(input Inputs) http.Handler {
+	relay := input.Relay
+	if relay == nil {
+		relay = NewRelay(input)
+	}
+	chatStream := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/chat/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+				return
+			}
+			var searches []Filter
+			if filters := r.URL.Query().Get("filters"); filters != "" {
+				if json.Unmarshal([]byte(filters), &searches) != nil {
+					sendStatusCode(w, quota, http.StatusBadRequest, "filterInvalid")
+					return
+				}
+				if msg := validateChatFilters(searches); msg != "" {
+					sendStatusCode(w, quota, http.StatusBadRequest, msg)
+					return
+				}
+			}
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "streamingUnsupported")
+				return
+			}
+
+			// Subscribe to the chat and stream its events until it ends or the client leaves.
+			subscription := relay.subscribe(id, key, "", r.Header.Get("Last-Event-ID"))
+			defer subscription.close()
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+			heartbeat := time.NewTicker(chatHeartbeatInterval)
+			defer heartbeat.Stop()
+			for {
+				var err error
+				select {
+				case <-r.Context().Done():
+					return
+				case <-heartbeat.C:
+					_, err = fmt.Fprint(w, ": heartbeat\n\n")
+				case event, ok := <-subscription.events:
+					if !ok {
+						return
+					}
+					if event.Type != "chat_ended" && event.Type != relayErrorEvent {
+						if _, kept := ChatFilter(searches, []interface{}{event.Event}); len(kept) == 0 {
+							continue
+						}
+					}
+					err = writeServerSentEvent(w, event)
+				}
+				if err != nil {
+					log.Println("Failed to respond to chat stream endpoint.")
+					return
+				}
+				flusher.Flush()
+			}
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(chatStream)
+}
+
+// ChatAnalyticsHandler is the handler for the chat analytics endpoint. /ytstats/v1/chat/{id}/analytics/
+// Provides statistics on a live chat over a rolling window of its newest events, in the same form as the stream
+// analytics endpoint. Only works on chats currently polled on the server, such as chats being streamed or recorded.
+func ChatAnalyticsHandler(input Inputs) http.Handler {
+	relay := input.Relay
+	if relay == nil {
+		relay = NewRelay(input)
+	}
+	chatAnalytics := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/chat/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+				return
+			}
+			var err error
+			window := defaultChatWindow
+			if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+				window, err = ParseInterval(windowParam)
+				if err != nil || window <= 0 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "windowInvalid")
+					return
+				}
+			}
+			interval := defaultChatInterval
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval < time.Second {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+			limit := defaultTopChatters
+			if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+				limit, err = strconv.Atoi(limitParam)
+				if err != nil || limit < 1 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "limitInvalid")
+					return
+				}
+			}
+
+			// Analyse the newest events of the chat, knowing the chatters of recorded chats if there are any.
+			var known map[string]bool
+			if input.Recorder != nil {
+				known, err = input.Recorder.chatters("", id)
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+					return
+				}
+			}
+			chatAnalyticsOutbound, found := relay.analyze(id, window, interval, limit, known)
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "chatNotRelayed")
+				return
+			}
+
+			// Provide response.
+			chatAnalyticsOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(chatAnalyticsOutbound)
+			if err != nil {
+				log.Println("Failed to respond to chat analytics endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(chatAnalytics)
+}
+
+// Decodes the JSON of a chat event of the given type, as encoded from an event parsed by ChatParser, back into it.
+func decodeChatEvent(eventType string, data []byte) (interface{}, error) {
+	decode := func(event interface{}) (interface{}, error) {
+		err := json.Unmarshal(data, event)
+		return reflect.ValueOf(event).Elem().Interface(), err
+	}
+	switch eventType {
+	case "message":
+		return decode(&ChatMessage{})
+	case "superchat":
+		return decode(&ChatSuperChat{})
+	case "supersticker":
+		return decode(&ChatSuperSticker{})
+	case "new_member":
+		return decode(&ChatNewMember{})
+	case "membership_milestone":
+		return decode(&ChatMemberMilestone{})
+	case "memberships_gifted":
+		return decode(&ChatMembershipGifting{})
+	case "gift_membership_received":
+		return decode(&ChatMembershipGiftReceived{})
+	case "message_deleted":
+		return decode(&ChatMessageDeleted{})
+	case "ban":
+		return decode(&ChatUserBanned{})
+	case "member_only_on":
+		return decode(&ChatMemberOnlyModeStarted{})
+	case "member_only_off":
+		return decode(&ChatMemberOnlyModeEnded{})
+	case "tombstone":
+		return decode(&ChatTombstone{})
+	case "chat_ended":
+		return decode(&ChatEnded{})
+	}
+	return decode(&ChatUnknownEvent{})
+}
+
+// Gives the user who caused a chat event parsed by ChatParser, and whether the event has one.
+func chatEventAuthor(event interface{}) (ChatUser, bool) {
+	switch e := event.(type) {
+	case ChatMessage:
+		return e.Author, true
+	case ChatSuperChat:
+		return e.SentBy, true
+	case ChatSuperSticker:
+		return e.SentBy, true
+	case ChatNewMember:
+		return e.NewMember, true
+	case ChatMemberMilestone:
+		return e.Member, true
+	case ChatMembershipGifting:
+		return e.GiftedBy, true
+	case ChatMembershipGiftReceived:
+		return e.Recipient, true
+	case ChatMessageDeleted:
+		return e.DeletedBy, true
+	case ChatUserBanned:
+		return e.BannedBy, true
+	case ChatMemberOnlyModeStarted:
+		return e.StartedBy, true
+	case ChatMemberOnlyModeEnded:
+		return e.EndedBy, true
+	}
+	return ChatUser{}, false
+}
+
+// Gives the text written by the user in a chat event parsed by ChatParser, or "" if the event has none.
+func chatEventMessage(event interface{}) string {
+	switch e := event.(type) {
+	case ChatMessage:
+		return e.Message
+	case ChatSuperChat:
+		return e.Message
+	case ChatMemberMilestone:
+		return e.UserComment
+	}
+	return ""
+}
+
+// Sends triggers as the response of the chat triggers endpoint.
+func sendChatTriggers(w http.ResponseWriter, quota int, chatId string, watching bool, triggers []ChatTrigger) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(ChatTriggersOutbound{
+		QuotaUsage: quota,
+		ChatId:     chatId,
+		Watching:   watching,
+		Triggers:   triggers,
+	})
+	if err != nil {
+		log.Println("Failed to respond to chat triggers endpoint.")
+	}
+}
+
+// ChatTriggersHandler is the handler for the chat triggers endpoint. /ytstats/v1/chat/{id}/triggers/
+// Lists and creates keyword, command, super chat and membership triggers on a live chat with GET and POST, and deletes
+// the trigger given by the trigger parameter with DELETE. Creating a trigger starts following the chat on the server
+// with the key used, firing chat.trigger webhooks and notifications. Triggers are only visible when using the key used
+// to create them.
+func ChatTriggersHandler(input Inputs) http.Handler {
+	chatTriggers := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+
+		// Check user input and fail if input is incorrect or missing.
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+		key := getKey(r)
+		if key == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+			return
+		}
+		id := getPathId(r, "/ytstats/v1/chat/")
+		if id == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+			return
+		}
+		if input.Triggers == nil {
+			sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+			return
+		}
+
+		// Create or delete the trigger and provide response.
+		switch r.Method {
+		case http.MethodPost:
+			var trigger ChatTrigger
+			r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+			triggerErr := json.NewDecoder(r.Body).Decode(&trigger)
+			if triggerErr != nil && triggerErr.Error() == "http: request body too large" {
+				sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "triggerBodyTooLarge")
+				return
+			} else if triggerErr != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "triggerBodyInvalid")
+				return
+			}
+			trigger, msg, err := input.Triggers.CreateTrigger(id, trigger, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+			sendChatTriggers(w, quota, id, true, []ChatTrigger{trigger})
+		case http.MethodDelete:
+			triggerId := r.URL.Query().Get("trigger")
+			if triggerId == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "triggerIdMissing")
+				return
+			}
+			trigger, found, err := input.Triggers.DeleteTrigger(id, triggerId, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "triggerNotFound")
+				return
+			}
+			_, watching, err := input.Triggers.ChatTriggers(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			sendChatTriggers(w, quota, id, watching, []ChatTrigger{trigger})
+		default:
+			triggers, watching, err := input.Triggers.ChatTriggers(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			sendChatTriggers(w, quota, id, watching, triggers)
+		}
+	}
+	return http.HandlerFunc(chatTriggers)
+}
+
+// ChatNotificationsHandler is the handler for the chat notifications endpoint. /ytstats/v1/chat/{id}/notifications/
+// Streams the triggers fired on a live chat as Server-Sent Events named trigger, for the triggers created with the key
+// used. Only works on chats followed for their triggers. The stream closes once the chat is no longer followed.
+func ChatNotificationsHandler(input Inputs) http.Handler {
+	notifications := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/chat/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+				return
+			}
+			if input.Triggers == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "streamingUnsupported")
+				return
+			}
+			listener, ok := input.Triggers.listen(id, key)
+			if !ok {
+				sendStatusCode(w, quota, http.StatusNotFound, "chatNotTriggered")
+				return
+			}
+			defer input.Triggers.unlisten(id, listener)
+
+			// Stream fired triggers until the chat is no longer followed or the client leaves.
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+			heartbeat := time.NewTicker(chatHeartbeatInterval)
+			defer heartbeat.Stop()
+			for {
+				var err error
+				select {
+				case <-r.Context().Done():
+					return
+				case <-heartbeat.C:
+					_, err = fmt.Fprint(w, ": heartbeat\n\n")
+				case event, ok := <-listener.events:
+					if !ok {
+						return
+					}
+					err = writeServerSentEvent(w, event)
+				}
+				if err != nil {
+					log.Println("Failed to respond to chat notifications endpoint.")
+					return
+				}
+				flusher.Flush()
+			}
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(notifications)
+}
@@ -10,21 +10,6 @@ import (
 	"yt_stats"
 )
 
-// Handler for api root endpoint. /ytstats/v1/
-// Provides basic info about the API's purpose.
-func defaultHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			http.ServeFile(w, r, "html/ytstats.v1.html")
-			break
-		default:
-			http.Error(w, "Request type not supported.", http.StatusNotImplemented)
-		}
-	})
-}
-
 func runInProduction(mux *http.ServeMux) {
 	// Setup Automated Certificate Management Environment (ACME)
 	certManager := autocert.Manager{
@@ -75,22 +60,166 @@ func main() {
 		CommentsRoot:      "https://www.googleapis.com/youtube/v3/commentThreads?part=snippet,replies&maxResults=100&textFormat=plainText",
 		ChannelsRoot:      "https://www.googleapis.com/youtube/v3/channels?part=id,snippet,contentDetails,statistics&maxResults=50",
 		PlaylistsRoot:     "https://www.googleapis.com/youtube/v3/playlists?part=snippet,contentDetails&maxResults=50",
-		PlaylistItemsRoot: "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&maxResults=50",
+		PlaylistItemsRoot: "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet,contentDetails&maxResults=50",
+		SectionsRoot:      "https://www.googleapis.com/youtube/v3/channelSections?part=snippet,contentDetails",
 		VideosRoot:        "https://www.googleapis.com/youtube/v3/videos?part=snippet,contentDetails,statistics&maxResults=50",
 		StreamRoot:        "https://www.googleapis.com/youtube/v3/videos?part=id,liveStreamingDetails&maxResults=50",
 		ChatRoot:          "https://www.googleapis.com/youtube/v3/liveChat/messages?part=id,snippet,authorDetails&maxResults=2000",
 	}
 
+	// Setup tracking of statistics over time, scheduled collection jobs and webhooks, if a store is configured.
+	var store yt_stats.Store
+	if storeDescription := os.Getenv("store"); storeDescription != "" {
+		var err error
+		store, err = yt_stats.OpenStore(storeDescription)
+		if err != nil {
+			log.Fatalf("Failed to open store: %v", err)
+		}
+		watchAge := 7 * 24 * time.Hour
+		if watchAgeSetting := os.Getenv("watch_age"); watchAgeSetting != "" {
+			watchAge, err = yt_stats.ParseInterval(watchAgeSetting)
+			if err != nil || watchAge < 0 {
+				log.Fatalf("Invalid watch age: %s", watchAgeSetting)
+			}
+		}
+		inputs.Dispatcher = yt_stats.NewDispatcher(store, os.Getenv("webhook_private_addresses") == "true")
+		inputs.Tracker = yt_stats.NewTracker(inputs, store, watchAge)
+		inputs.Scheduler = yt_stats.NewScheduler(inputs.Tracker)
+		if trackingKey := os.Getenv("tracking_key"); trackingKey != "" {
+			interval := os.Getenv("tracking_interval")
+			if interval == "" {
+				interval = "1h"
+			}
+			err = inputs.Scheduler.EnsureJob(yt_stats.Job{
+				Id:       "tracked",
+				Type:     "tracked",
+				Schedule: "@every " + interval,
+			}, trackingKey)
+			if err != nil {
+				log.Fatalf("Failed to schedule snapshots of tracked items: %v", err)
+			}
+			viewersInterval := os.Getenv("viewers_interval")
+			if viewersInterval == "" {
+				viewersInterval = "1m"
+			}
+			err = inputs.Scheduler.EnsureJob(yt_stats.Job{
+				Id:       "viewers",
+				Type:     "viewers",
+				Schedule: "@every " + viewersInterval,
+			}, trackingKey)
+			if err != nil {
+				log.Fatalf("Failed to schedule sampling of stream viewers: %v", err)
+			}
+		} else {
+			log.Print("No tracking key set, tracked items will only be updated when tracking is requested.")
+		}
+		go inputs.Scheduler.Run()
+		go inputs.Dispatcher.Run()
+	}
+
+	// Setup lookups of live chats by video and channel, polling of live chats, shared by all streaming clients, and
+	// recording of chats if an archive is set.
+	inputs.Resolver = yt_stats.NewChatResolver()
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	if archive := os.Getenv("chat_archive"); archive != "" {
+		recorder, err := yt_stats.NewRecorder(inputs.Relay, archive)
+		if err != nil {
+			log.Fatalf("Failed to open chat archive: %v", err)
+		}
+		inputs.Recorder = recorder
+		err = inputs.Recorder.Resume()
+		if err != nil {
+			log.Fatalf("Failed to resume chat recordings: %v", err)
+		}
+	} else {
+		log.Print("No chat archive set, recording chats is disabled.")
+	}
+
+	// Setup conversion of revenue between currencies, if exchange rates are supplied.
+	if ratesFile := os.Getenv("exchange_rates"); ratesFile != "" {
+		rates, err := yt_stats.NewExchangeRates(ratesFile)
+		if err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+		inputs.Rates = rates
+	}
+
+	// Setup triggers, giveaways, polls and moderation logs on live chats, if a store is configured.
+	if store != nil {
+		inputs.Triggers = yt_stats.NewTriggers(inputs, store)
+		err := inputs.Triggers.Resume()
+		if err != nil {
+			log.Fatalf("Failed to resume chat triggers: %v", err)
+		}
+		inputs.Giveaways = yt_stats.NewGiveaways(inputs, store)
+		err = inputs.Giveaways.Resume()
+		if err != nil {
+			log.Fatalf("Failed to resume giveaways: %v", err)
+		}
+		inputs.Moderation = yt_stats.NewModerationLog(inputs, store)
+		err = inputs.Moderation.Resume()
+		if err != nil {
+			log.Fatalf("Failed to resume moderation logs: %v", err)
+		}
+		go inputs.Moderation.Run()
+	}
+
 	// Setup handlers.
 	mux := http.NewServeMux()
-	mux.Handle("/ytstats/v1/", logIncoming(defaultHandler()))
+	mux.Handle("/ytstats/v1/", logIncoming(yt_stats.DashboardHandler(inputs)))
+	mux.Handle("/ytstats/v1/openapi.json", logIncoming(yt_stats.OpenAPIHandler(inputs)))
 	mux.Handle("/ytstats/v1/status/", logIncoming(yt_stats.StatusHandler(inputs)))
-	mux.Handle("/ytstats/v1/channel/", logIncoming(yt_stats.ChannelHandler(inputs)))
+	mux.Handle("/ytstats/v1/channel/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/channel/",
+		yt_stats.ChannelHandler(inputs), map[string]http.Handler{
+			"videos":     yt_stats.ChannelVideosHandler(inputs),
+			"playlists":  yt_stats.ChannelPlaylistsHandler(inputs),
+			"sections":   yt_stats.ChannelSectionsHandler(inputs),
+			"featured":   yt_stats.FeaturedChannelsHandler(inputs),
+			"history":    yt_stats.ChannelHistoryHandler(inputs),
+			"live":       yt_stats.ChannelLiveHandler(inputs),
+			"moderation": yt_stats.ChannelModerationHandler(inputs),
+		})))
 	mux.Handle("/ytstats/v1/playlist/", logIncoming(yt_stats.PlaylistHandler(inputs)))
-	mux.Handle("/ytstats/v1/video/", logIncoming(yt_stats.VideoHandler(inputs)))
+	mux.Handle("/ytstats/v1/video/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/video/",
+		yt_stats.VideoHandler(inputs), map[string]http.Handler{
+			"history": yt_stats.VideoHistoryHandler(inputs),
+			"emotes":  yt_stats.VideoEmotesHandler(inputs),
+		})))
 	mux.Handle("/ytstats/v1/comments/", logIncoming(yt_stats.CommentsHandler(inputs)))
-	mux.Handle("/ytstats/v1/stream/", logIncoming(yt_stats.StreamHandler(inputs)))
-	mux.Handle("/ytstats/v1/chat/", logIncoming(yt_stats.ChatHandler(inputs)))
+	mux.Handle("/ytstats/v1/stream/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/stream/",
+		yt_stats.StreamHandler(inputs), map[string]http.Handler{
+			"viewers":   yt_stats.StreamViewersHandler(inputs),
+			"recording": yt_stats.StreamRecordingHandler(inputs),
+			"replay":    yt_stats.StreamReplayHandler(inputs),
+			"analytics": yt_stats.StreamAnalyticsHandler(inputs),
+			"revenue":   yt_stats.StreamRevenueHandler(inputs),
+			"emotes":    yt_stats.StreamEmotesHandler(inputs),
+		})))
+	mux.Handle("/ytstats/v1/chat/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/chat/",
+		yt_stats.ChatHandler(inputs), map[string]http.Handler{
+			"stream":        yt_stats.ChatStreamHandler(inputs),
+			"socket":        yt_stats.ChatSocketHandler(inputs),
+			"analytics":     yt_stats.ChatAnalyticsHandler(inputs),
+			"triggers":      yt_stats.ChatTriggersHandler(inputs),
+			"notifications": yt_stats.ChatNotificationsHandler(inputs),
+		})))
+	mux.Handle("/ytstats/v1/feed/", logIncoming(yt_stats.ChatFeedHandler(inputs)))
+	mux.Handle("/ytstats/v1/giveaways/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/giveaways/",
+		yt_stats.GiveawaysHandler(inputs), map[string]http.Handler{
+			"close": yt_stats.GiveawayCloseHandler(inputs),
+		})))
+	mux.Handle("/ytstats/v1/rates/", logIncoming(yt_stats.RatesHandler(inputs)))
+	mux.Handle("/ytstats/v1/graphql/", logIncoming(yt_stats.GraphQLHandler(inputs)))
+	mux.Handle("/ytstats/v1/jobs/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/jobs/",
+		yt_stats.JobsHandler(inputs), map[string]http.Handler{
+			"pause":  yt_stats.JobPauseHandler(inputs),
+			"resume": yt_stats.JobResumeHandler(inputs),
+		})))
+	mux.Handle("/ytstats/v1/webhooks/", logIncoming(yt_stats.SubResourceRouter("/ytstats/v1/webhooks/",
+		yt_stats.WebhooksHandler(inputs), map[string]http.Handler{
+			"deliveries": yt_stats.WebhookDeliveriesHandler(inputs),
+			"ping":       yt_stats.WebhookPingHandler(inputs),
+		})))
 
 	if os.Getenv("tls_address") != "" {
 		log.Print("Running in production mode...")
@@ -3,7 +3,6 @@ package yt_stats
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"sort"
@@ -58,46 +57,7 @@ func searchContent(substrings []string, message string, caseSensitive bool) (boo
 // CommentFilter houses the logic used to filter through comments and replies based on multiple searches.
 // Returns a bool on if the filtering succeeded, and the result. Cannot check for nil result since empty results exist.
 func CommentFilter(searches []Filter, comments []interface{}) (bool, []interface{}) {
-	if searches == nil {
-		return true, comments
-	}
-	var matches []interface{}
-	var source []interface{}
-	for _, search := range searches {
-		var match []interface{}
-		var remains []interface{}
-		if search.Reductive { // Reductive filter, all non-matches stay.
-			source = matches
-			remains = comments
-		} else { // Additive filter, all matches stay.
-			source = comments
-			match = matches
-		}
-		for _, item := range source {
-			var msg string
-			var name string
-			switch com := item.(type) {
-			case Comment:
-				msg = com.Message
-				name = com.AuthorName
-			case Reply:
-				msg = com.Message
-				name = com.AuthorName
-			default:
-				return false, nil
-			}
-			anyContent, allContent := searchContent(search.Content, msg, search.CaseSensitive)
-			anyUser, allUser := searchContent(search.Users, name, search.CaseSensitive)
-			if (search.MatchAny && (anyContent || anyUser)) || allContent && allUser {
-				match = append(match, item)
-			} else {
-				remains = append(remains, item)
-			}
-		}
-		matches = match
-		comments = remains
-	}
-	return true, matches
+	return applyFilters(searches, comments, describeComment)
 }
 
 // Worker function that gets replies for comments from a channel of comment IDs. Handles pagination of replies.
@@ -148,12 +108,12 @@ func worker(in <-chan string, c *[]interface{}, r chan<- StatusCodeOutbound, m *
 
 // CommentsHandler is the handler for the comments endpoint. /ytstats/v1/comments/
 // Provides a list of all comments and replies of a video. Can be extensively filtered via filters in request body.
+// Accepts POST as well as GET, since browsers cannot send a request body with GET requests.
 func CommentsHandler(input Inputs) http.Handler {
-	workers := 10
 	comments := func(w http.ResponseWriter, r *http.Request) {
 		quota := 0
 		switch r.Method {
-		case http.MethodGet:
+		case http.MethodGet, http.MethodPost:
 
 			// Check user input and fail if input is incorrect or missing.
 			key := getKey(r)
@@ -166,81 +126,20 @@ func CommentsHandler(input Inputs) http.Handler {
 				sendStatusCode(w, quota, http.StatusBadRequest, "videoIdMissing")
 				return
 			}
-			var searches []Filter
-			if r.Body != nil {
-				r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
-				searchErr := json.NewDecoder(r.Body).Decode(&searches)
-				if searchErr != nil && searchErr.Error() == "http: request body too large" {
-					sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "searchBodyTooLarge")
-					return
-				} else if searchErr != nil && searchErr != io.EOF {
-					sendStatusCode(w, quota, http.StatusBadRequest, "searchBodyInvalid")
-					return
-				}
+			searches, code, msg := readFilters(w, r)
+			if msg != "" {
+				sendStatusCode(w, quota, code, msg)
+				return
 			}
 
-			// Query hand handle pagination for youtube comment threads endpoint.
+			// Query youtube for all comments and replies, and check responses for errors.
 			var commentsOutbound CommentOutbound
 			commentsOutbound.VideoId = id
-			var comments []interface{}
-			var needReplies []string
-			pageToken := ""
-			for hasNextPage := true; hasNextPage; hasNextPage = pageToken != "" {
-				var youtubeStatus StatusCodeOutbound
-				var commentsInbound CommentsInbound
-				ok := func() bool { // Internal function for deferring the closing of response bodies inside loop.
-					resp, err := http.Get(fmt.Sprintf("%s&videoId=%s&key=%s&pageToken=%s",
-						input.CommentsRoot, id, key, pageToken))
-					if err != nil {
-						sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-						return false
-					}
-					defer resp.Body.Close()
-					quota++
-					youtubeStatus = ErrorParser(resp.Body, &commentsInbound)
-					if youtubeStatus.StatusCode != http.StatusOK {
-						if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-							quota--
-						}
-						sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
-						return false
-					}
-					CommentsParser(commentsInbound, &comments, &needReplies)
-					pageToken = commentsInbound.NextPageToken
-					return true
-				}
-				if !ok() {
-					return
-				}
-			}
-
-			// Starts workers querying and handling pagination for all needed replies.
-			replyIds := make(chan string, len(needReplies))
-			for _, comId := range needReplies {
-				replyIds <- comId
-			}
-			close(replyIds)
-			var wg sync.WaitGroup
-			var mut sync.Mutex
-			var add sync.Mutex
-			workerResponses := make(chan StatusCodeOutbound, workers)
-			wg.Add(workers)
-			for i := 0; i < workers; i++ { // Launch workers.
-				go func() {
-					n := worker(replyIds, &comments, workerResponses, &mut, input, key)
-					add.Lock()
-					quota += n
-					add.Unlock()
-					wg.Done()
-				}()
-			}
-			wg.Wait()
-			close(workerResponses)
-			for response := range workerResponses {
-				if response.StatusCode != http.StatusOK {
-					sendStatusCode(w, quota, response.StatusCode, response.StatusMessage)
-					return
-				}
+			comments, youtubeStatus, cost := queryComments(input, id, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
 			}
 
 			// Filter comments and replies, and provide response.
@@ -0,0 +1,34 @@
+package yt_stats
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+// The web dashboard, embedded so the binary can be deployed on its own.
+//
+//go:embed html
+var dashboardFiles embed.FS
+
+// DashboardHandler is the handler for the api root endpoint. /ytstats/v1/
+// Provides the web dashboard, which only uses the API itself to look up channels, playlists, comments and streams.
+func DashboardHandler(input Inputs) http.Handler {
+	files, err := fs.Sub(dashboardFiles, "html")
+	if err != nil {
+		log.Fatalf("Failed to load dashboard files: %v", err)
+	}
+	fileServer := http.StripPrefix("/ytstats/v1/", http.FileServer(http.FS(files)))
+	dashboard := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fileServer.ServeHTTP(w, r)
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(dashboard)
+}
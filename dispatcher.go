@@ -0,0 +1,558 @@
+package yt_stats
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Store collections used by the dispatcher. Deliveries are kept in one collection per webhook.
+const (
+	webhooksCollection      = "webhooks"
+	webhookDeliveriesPrefix = "webhook_deliveries_"
+)
+
+// Limits of deliveries. Each retry waits twice as long as the last, and finished deliveries beyond the log size are
+// pruned, oldest first.
+const (
+	maxDeliveryAttempts = 8
+	deliveryRetryDelay  = 30 * time.Second
+	deliveryLogSize     = 100
+	deliveryTimeout     = 10 * time.Second
+)
+
+// Headers sent with each delivery.
+const (
+	webhookSignatureHeader = "X-YTStats-Signature"
+	webhookEventHeader     = "X-YTStats-Event"
+	webhookDeliveryHeader  = "X-YTStats-Delivery"
+)
+
+// Event type of comments containing a keyword, which is only delivered to webhooks with a matching keyword.
+const keywordCommentEvent = "comment.keyword"
+
+// Event types webhooks can subscribe to. Ping events are only sent on request, to the pinged webhook.
+var webhookEvents = map[string]bool{
+	"channel.milestone":  true,
+	"video.uploaded":     true,
+	"stream.scheduled":   true,
+	"stream.rescheduled": true,
+	"stream.live":        true,
+	"stream.ended":       true,
+	keywordCommentEvent:  true,
+	chatTriggerEvent:     true,
+}
+
+// Shared address space used by carrier-grade NAT, which webhooks are not delivered to along with other addresses
+// that are not public.
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// Dispatcher delivers events to the webhooks subscribed to them. Deliveries are queued in the store, signed with
+// the secret of the webhook, and retried with exponential backoff until they succeed or run out of attempts.
+// Webhooks are managed with the API key they were created with, and are only visible to requests using that key.
+type Dispatcher struct {
+	mutex        sync.Mutex
+	running      sync.Mutex
+	store        Store
+	client       *http.Client
+	allowPrivate bool
+}
+
+// A webhook as stored by the dispatcher, including the key managing it and its secret, which are never sent back.
+type storedWebhook struct {
+	Webhook Webhook `json:"webhook"`
+	Key     string  `json:"key"`
+	Secret  string  `json:"secret"`
+}
+
+// NewDispatcher creates a dispatcher persisting webhooks and deliveries in the given store. Unless private addresses
+// are allowed, webhooks are only delivered to public addresses, so they cannot be used to reach the server itself,
+// its network or the metadata service of its cloud provider.
+func NewDispatcher(store Store, allowPrivate bool) *Dispatcher {
+	return &Dispatcher{store: store, client: webhookClient(allowPrivate), allowPrivate: allowPrivate}
+}
+
+// Tells whether an address is not public, as it belongs to the server itself, a private or link-local network, or
+// is a multicast or unspecified address.
+func privateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// Gives the client deliveries are sent with. Unless private addresses are allowed, every connection is checked
+// after the host name of the webhook was resolved, which also covers redirects and host names resolving to another
+// address than when the webhook was created. Proxies are not used then, as they would connect on their own.
+func webhookClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout: deliveryTimeout,
+			Control: func(network string, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || privateAddress(ip) {
+					return fmt.Errorf("webhook address %s is not public", host)
+				}
+				return nil
+			},
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{Timeout: deliveryTimeout, Transport: transport}
+}
+
+// Gives a random hex string of the given amount of bytes.
+func randomHex(size int) (string, error) {
+	idBytes := make([]byte, size)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(idBytes), nil
+}
+
+// Gives a new ID for a delivery or event. IDs sort in the order they were created.
+func newDeliveryId(now time.Time) (string, error) {
+	suffix, err := randomHex(4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%019d%s", now.UnixNano(), suffix), nil
+}
+
+// Signs a delivery body with the secret of a webhook, as sent in the signature header.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Checks whether a webhook should receive an event. Webhooks with targets only receive events about one of them,
+// and keyword events only when their text contains one of the keywords of the webhook. Gives the matched keywords.
+func (w Webhook) matches(eventType string, subjects []string, text string) (bool, []string) {
+	subscribed := false
+	for _, event := range w.Events {
+		subscribed = subscribed || event == eventType
+	}
+	if !subscribed {
+		return false, nil
+	}
+	if len(w.Targets) > 0 {
+		targeted := false
+		for _, target := range w.Targets {
+			for _, subject := range subjects {
+				targeted = targeted || target == subject
+			}
+		}
+		if !targeted {
+			return false, nil
+		}
+	}
+	if eventType != keywordCommentEvent {
+		return true, nil
+	}
+	var matched []string
+	lowerText := strings.ToLower(text)
+	for _, keyword := range w.Keywords {
+		if strings.Contains(lowerText, strings.ToLower(keyword)) {
+			matched = append(matched, keyword)
+		}
+	}
+	return len(matched) > 0, matched
+}
+
+// Gives all stored webhooks. Must be called with the mutex held.
+func (d *Dispatcher) storedWebhooks() ([]storedWebhook, error) {
+	ids, err := d.store.Keys(webhooksCollection)
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []storedWebhook
+	for _, id := range ids {
+		var stored storedWebhook
+		found, err := d.store.Get(webhooksCollection, id, &stored)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			webhooks = append(webhooks, stored)
+		}
+	}
+	return webhooks, nil
+}
+
+// Subscribed checks whether any webhook is subscribed to an event type, so events costing quota to detect can be
+// skipped when nobody would receive them. A nil dispatcher has no subscribers.
+func (d *Dispatcher) Subscribed(eventType string) bool {
+	if d == nil {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	webhooks, err := d.storedWebhooks()
+	if err != nil {
+		return false
+	}
+	for _, stored := range webhooks {
+		for _, event := range stored.Webhook.Events {
+			if event == eventType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Emit queues an event for delivery to all webhooks subscribed to it. The subjects are the IDs of the channel or video
+// the event is about, the first of which is sent as the subject of the event, and are matched against the targets of
+// webhooks. The text is matched against the keywords of webhooks. A nil dispatcher drops the event.
+func (d *Dispatcher) Emit(eventType string, subjects []string, data interface{}, text string) error {
+	return d.emit(eventType, "", subjects, data, text)
+}
+
+// Queues an event for delivery to the webhooks subscribed to it, like Emit. If a key is given, the event is only
+// delivered to webhooks managed with that key, for events about things only visible to it.
+func (d *Dispatcher) emit(eventType string, key string, subjects []string, data interface{}, text string) error {
+	if d == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	eventId, err := newDeliveryId(now)
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	webhooks, err := d.storedWebhooks()
+	if err != nil {
+		return err
+	}
+	for _, stored := range webhooks {
+		if key != "" && stored.Key != key {
+			continue
+		}
+		matches, keywords := stored.Webhook.matches(eventType, subjects, text)
+		if !matches {
+			continue
+		}
+		event := WebhookEvent{
+			Id:       eventId,
+			Type:     eventType,
+			Time:     now.Format(time.RFC3339),
+			Subject:  subjects[0],
+			Keywords: keywords,
+			Data:     data,
+		}
+		if _, err := d.enqueue(stored.Webhook.Id, event, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Queues a delivery of an event to a webhook, and prunes the oldest finished deliveries beyond the log size.
+// Must be called with the mutex held.
+func (d *Dispatcher) enqueue(webhookId string, event WebhookEvent, now time.Time) (WebhookDelivery, error) {
+	deliveryId, err := newDeliveryId(now)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	delivery := WebhookDelivery{
+		Id:          deliveryId,
+		Event:       event.Type,
+		Status:      "pending",
+		CreatedAt:   now.Format(time.RFC3339),
+		NextAttempt: now.Format(time.RFC3339),
+		Payload:     event,
+	}
+	collection := webhookDeliveriesPrefix + webhookId
+	if err := d.store.Put(collection, deliveryId, delivery); err != nil {
+		return delivery, err
+	}
+	ids, err := d.store.Keys(collection)
+	if err != nil {
+		return delivery, err
+	}
+	for i := 0; i < len(ids)-deliveryLogSize; i++ {
+		var old WebhookDelivery
+		found, err := d.store.Get(collection, ids[i], &old)
+		if err != nil {
+			return delivery, err
+		}
+		if found && old.Status != "pending" {
+			if err := d.store.Delete(collection, ids[i]); err != nil {
+				return delivery, err
+			}
+		}
+	}
+	return delivery, nil
+}
+
+// Run delivers due deliveries every 5 seconds. Never returns.
+func (d *Dispatcher) Run() {
+	for now := range time.Tick(5 * time.Second) {
+		d.DeliverDue(now)
+	}
+}
+
+// DeliverDue attempts all pending deliveries due at the given time, one after another.
+func (d *Dispatcher) DeliverDue(now time.Time) {
+	d.running.Lock()
+	defer d.running.Unlock()
+	type dueDelivery struct {
+		webhook  storedWebhook
+		delivery WebhookDelivery
+	}
+	var due []dueDelivery
+	d.mutex.Lock()
+	webhooks, err := d.storedWebhooks()
+	if err != nil {
+		d.mutex.Unlock()
+		log.Printf("Failed to read webhooks: %v", err)
+		return
+	}
+	for _, stored := range webhooks {
+		collection := webhookDeliveriesPrefix + stored.Webhook.Id
+		ids, err := d.store.Keys(collection)
+		if err != nil {
+			log.Printf("Failed to read deliveries of webhook %s: %v", stored.Webhook.Id, err)
+			continue
+		}
+		for _, id := range ids {
+			var delivery WebhookDelivery
+			found, err := d.store.Get(collection, id, &delivery)
+			if err != nil || !found || delivery.Status != "pending" {
+				continue
+			}
+			nextAttempt, err := time.Parse(time.RFC3339, delivery.NextAttempt)
+			if err == nil && !nextAttempt.After(now) {
+				due = append(due, dueDelivery{webhook: stored, delivery: delivery})
+			}
+		}
+	}
+	d.mutex.Unlock()
+	for _, item := range due {
+		d.attempt(item.webhook, item.delivery, now)
+	}
+}
+
+// Attempts a delivery and records the outcome. Failed attempts are retried with exponential backoff.
+func (d *Dispatcher) attempt(stored storedWebhook, delivery WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	delivery.LastAttempt = now.UTC().Format(time.RFC3339)
+	delivery.ResponseCode = 0
+	delivery.LastError = ""
+	body, err := json.Marshal(delivery.Payload)
+	var req *http.Request
+	if err == nil {
+		req, err = http.NewRequest(http.MethodPost, stored.Webhook.Url, bytes.NewReader(body))
+	}
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "yt_stats-webhooks")
+		req.Header.Set(webhookEventHeader, delivery.Event)
+		req.Header.Set(webhookDeliveryHeader, delivery.Id)
+		req.Header.Set(webhookSignatureHeader, signWebhookBody(stored.Secret, body))
+		var resp *http.Response
+		resp, err = d.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			delivery.ResponseCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("webhook responded with %d", resp.StatusCode)
+			}
+		}
+	}
+	switch {
+	case err == nil:
+		delivery.Status = "delivered"
+		delivery.NextAttempt = ""
+	case delivery.Attempts >= maxDeliveryAttempts:
+		delivery.Status = "failed"
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = ""
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = now.Add(deliveryRetryDelay << uint(delivery.Attempts-1)).UTC().Format(time.RFC3339)
+	}
+
+	// Save the outcome, unless the webhook was deleted while delivering.
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var current storedWebhook
+	found, err := d.store.Get(webhooksCollection, stored.Webhook.Id, &current)
+	if err != nil || !found {
+		return
+	}
+	if err := d.store.Put(webhookDeliveriesPrefix+stored.Webhook.Id, delivery.Id, delivery); err != nil {
+		log.Printf("Failed to save delivery %s: %v", delivery.Id, err)
+	}
+}
+
+// Checks the definition of a webhook, giving back the status message describing what is wrong with it, or "". Host
+// names are only checked for private addresses when delivering, but addresses in the URL are rejected straight away.
+func validateWebhook(webhook Webhook, allowPrivate bool) string {
+	u, err := url.Parse(webhook.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "webhookUrlInvalid"
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !allowPrivate && privateAddress(ip) {
+		return "webhookAddressForbidden"
+	}
+	if len(webhook.Events) == 0 {
+		return "webhookEventsInvalid"
+	}
+	keywordEvents := false
+	for _, event := range webhook.Events {
+		if !webhookEvents[event] {
+			return "webhookEventsInvalid"
+		}
+		keywordEvents = keywordEvents || event == keywordCommentEvent
+	}
+	if keywordEvents && len(webhook.Keywords) == 0 {
+		return "webhookKeywordsMissing"
+	}
+	return ""
+}
+
+// CreateWebhook validates and stores a new webhook managed with the given key. If no secret is given a random one
+// is generated. Gives back the webhook including its secret, or a status message describing why it is invalid.
+func (d *Dispatcher) CreateWebhook(webhook Webhook, key string) (Webhook, string, error) {
+	if msg := validateWebhook(webhook, d.allowPrivate); msg != "" {
+		return webhook, msg, nil
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return webhook, "", err
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = randomHex(32)
+		if err != nil {
+			return webhook, "", err
+		}
+	}
+	webhook.Id = id
+	webhook.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	stored := storedWebhook{Webhook: webhook, Key: key, Secret: webhook.Secret}
+	stored.Webhook.Secret = ""
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return webhook, "", d.store.Put(webhooksCollection, id, stored)
+}
+
+// Webhooks gives all webhooks managed with the given key.
+func (d *Dispatcher) Webhooks(key string) ([]Webhook, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	stored, err := d.storedWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	webhooks := []Webhook{}
+	for _, webhook := range stored {
+		if webhook.Key == key {
+			webhooks = append(webhooks, webhook.Webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+// Gives a stored webhook managed with the given key, reporting whether it exists. Must be called with the mutex held.
+func (d *Dispatcher) storedWebhook(id string, key string) (storedWebhook, bool, error) {
+	var stored storedWebhook
+	found, err := d.store.Get(webhooksCollection, id, &stored)
+	if err != nil || !found || stored.Key != key {
+		return storedWebhook{}, false, err
+	}
+	return stored, true, nil
+}
+
+// Webhook gives a webhook managed with the given key, reporting whether it exists.
+func (d *Dispatcher) Webhook(id string, key string) (Webhook, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	stored, found, err := d.storedWebhook(id, key)
+	return stored.Webhook, found, err
+}
+
+// DeleteWebhook deletes a webhook managed with the given key along with its deliveries, reporting whether it existed.
+func (d *Dispatcher) DeleteWebhook(id string, key string) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, found, err := d.storedWebhook(id, key)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := d.store.Delete(webhooksCollection, id); err != nil {
+		return true, err
+	}
+	ids, err := d.store.Keys(webhookDeliveriesPrefix + id)
+	if err != nil {
+		return true, err
+	}
+	for _, deliveryId := range ids {
+		if err := d.store.Delete(webhookDeliveriesPrefix+id, deliveryId); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Deliveries gives the deliveries of a webhook managed with the given key, newest first, reporting whether the
+// webhook exists.
+func (d *Dispatcher) Deliveries(id string, key string) ([]WebhookDelivery, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, found, err := d.storedWebhook(id, key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	ids, err := d.store.Keys(webhookDeliveriesPrefix + id)
+	if err != nil {
+		return nil, true, err
+	}
+	deliveries := make([]WebhookDelivery, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		var delivery WebhookDelivery
+		found, err := d.store.Get(webhookDeliveriesPrefix+id, ids[i], &delivery)
+		if err != nil {
+			return nil, true, err
+		}
+		if found {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, true, nil
+}
+
+// Ping queues a ping event to a webhook managed with the given key, reporting whether the webhook exists.
+func (d *Dispatcher) Ping(id string, key string) (WebhookDelivery, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, found, err := d.storedWebhook(id, key)
+	if err != nil || !found {
+		return WebhookDelivery{}, false, err
+	}
+	now := time.Now().UTC()
+	eventId, err := newDeliveryId(now)
+	if err != nil {
+		return WebhookDelivery{}, true, err
+	}
+	event := WebhookEvent{Id: eventId, Type: "ping", Time: now.Format(time.RFC3339), Data: map[string]string{}}
+	delivery, err := d.enqueue(id, event, now)
+	return delivery, true, err
+}
@@ -0,0 +1,359 @@
+package yt_stats
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kinds of tokens messages are split into.
+const (
+	wordToken  = "word"
+	emojiToken = "emoji"
+	emoteToken = "emote"
+)
+
+// Default amount of words, emojis and emotes given in each frequency table.
+const defaultTopTokens = 20
+
+// Emote shortcodes, such as :_emoteName: for the emotes of a channel and :face-blue-smiling: for those of YouTube.
+var emoteShortcode = regexp.MustCompile(`^:_?[A-Za-z][A-Za-z0-9_-]*:`)
+
+// Ranges of characters that are shown as emoji on their own. Characters in textEmojiRanges are only shown as emoji
+// when followed by the emoji variation selector.
+var (
+	emojiRanges = [][2]rune{
+		{0x231A, 0x231B}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+		{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1}, {0x26AA, 0x26AB}, {0x26BD, 0x26BE},
+		{0x26C4, 0x26C5}, {0x26CE, 0x26CE}, {0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+		{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B}, {0x2728, 0x2728}, {0x274C, 0x274C},
+		{0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+		{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+		{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F1E6, 0x1F1FF}, {0x1F201, 0x1F251}, {0x1F300, 0x1F64F},
+		{0x1F680, 0x1F6FF}, {0x1F7E0, 0x1F7EB}, {0x1F90C, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+	}
+	textEmojiRanges = [][2]rune{
+		{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049}, {0x2122, 0x2122}, {0x2139, 0x2139},
+		{0x2194, 0x2199}, {0x21A9, 0x21AA}, {0x2328, 0x2328}, {0x23CF, 0x23CF}, {0x23ED, 0x23EF}, {0x23F1, 0x23F2},
+		{0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB}, {0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FC},
+		{0x2600, 0x27BF}, {0x2934, 0x2935}, {0x2B05, 0x2B07}, {0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297},
+		{0x3299, 0x3299}, {0x1F170, 0x1F171}, {0x1F17E, 0x1F17F}, {0x1F321, 0x1F321},
+	}
+)
+
+// A word, emoji or emote in a message.
+type messageToken struct {
+	kind string
+	text string
+}
+
+// Gives whether a character is in one of the given ranges.
+func inRanges(r rune, ranges [][2]rune) bool {
+	for _, bounds := range ranges {
+		if r >= bounds[0] && r <= bounds[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Gives whether a character is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// Gives whether the character at the start of the given characters begins an emoji.
+func startsEmoji(runes []rune) bool {
+	switch {
+	case inRanges(runes[0], emojiRanges):
+		return true
+	case len(runes) > 1 && runes[1] == 0xFE0F && inRanges(runes[0], textEmojiRanges):
+		return true
+	case len(runes) > 1 && strings.ContainsRune("0123456789#*", runes[0]):
+		return runes[1] == 0x20E3 || (len(runes) > 2 && runes[1] == 0xFE0F && runes[2] == 0x20E3)
+	}
+	return false
+}
+
+// Gives the length of the emoji at the start of the given characters, including its skin tone, keycap, tags, and the
+// emojis joined to it into one. Flags are made of pairs of regional indicators.
+func emojiLength(runes []rune) int {
+	if runes[0] >= 0x1F1E6 && runes[0] <= 0x1F1FF {
+		if len(runes) > 1 && runes[1] >= 0x1F1E6 && runes[1] <= 0x1F1FF {
+			return 2
+		}
+		return 1
+	}
+	i := 1
+	for i < len(runes) {
+		switch r := runes[i]; {
+		case r == 0xFE0E || r == 0xFE0F || r == 0x20E3:
+			i++
+		case r >= 0x1F3FB && r <= 0x1F3FF:
+			i++
+		case r >= 0xE0020 && r <= 0xE007F:
+			i++
+		case r == 0x200D && i+1 < len(runes) && (startsEmoji(runes[i+1:]) || inRanges(runes[i+1], textEmojiRanges)):
+			i += 2
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// Splits a message into words, Unicode emoji and emote shortcodes, in the order they appear. Words are made of
+// letters, digits and the apostrophes between them, and are lowercased. Emojis are given without variation selectors,
+// so that the same emoji is always given the same way.
+func tokenizeMessage(message string) []messageToken {
+	var tokens []messageToken
+	runes := []rune(message)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ':':
+			code := emoteShortcode.FindString(string(runes[i:]))
+			if code == "" {
+				i++
+				continue
+			}
+			tokens = append(tokens, messageToken{kind: emoteToken, text: code})
+			i += len([]rune(code))
+		case startsEmoji(runes[i:]):
+			length := emojiLength(runes[i:])
+			emoji := strings.NewReplacer("\uFE0E", "", "\uFE0F", "").Replace(string(runes[i : i+length]))
+			tokens = append(tokens, messageToken{kind: emojiToken, text: emoji})
+			i += length
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (isWordRune(runes[i]) ||
+				(strings.ContainsRune("'’", runes[i]) && i+1 < len(runes) && unicode.IsLetter(runes[i+1]))) {
+				i++
+			}
+			tokens = append(tokens, messageToken{kind: wordToken, text: strings.ToLower(string(runes[start:i]))})
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// Counts of tokens of one kind, along with the order they were first used in.
+type tokenCounter struct {
+	total  int
+	counts map[string]int
+	order  []string
+}
+
+// Counts one use of a token.
+func (c *tokenCounter) add(token string) {
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	if _, ok := c.counts[token]; !ok {
+		c.order = append(c.order, token)
+	}
+	c.counts[token]++
+	c.total++
+}
+
+// Gives the most used tokens, limited to the given amount, with ties ordered by which was used first.
+func (c *tokenCounter) top(limit int) []TokenCount {
+	table := make([]TokenCount, len(c.order))
+	for i, token := range c.order {
+		table[i] = TokenCount{Token: token, Count: c.counts[token]}
+	}
+	sort.SliceStable(table, func(i, j int) bool { return table[i].Count > table[j].Count })
+	if len(table) > limit {
+		table = table[:limit]
+	}
+	return table
+}
+
+// Frequencies of the words, emojis and emotes in messages.
+type tokenTable struct {
+	messages int
+	words    tokenCounter
+	emojis   tokenCounter
+	emotes   tokenCounter
+}
+
+// Counts the tokens of a message.
+func (t *tokenTable) add(tokens []messageToken) {
+	t.messages++
+	for _, token := range tokens {
+		switch token.kind {
+		case wordToken:
+			t.words.add(token.text)
+		case emojiToken:
+			t.emojis.add(token.text)
+		case emoteToken:
+			t.emotes.add(token.text)
+		}
+	}
+}
+
+// A message as kept for the timeline, split into its tokens.
+type tokenizedMessage struct {
+	time   time.Time
+	tokens []messageToken
+}
+
+// Frequencies of the words, emojis and emotes in messages, gathered one message at a time.
+type emoteStats struct {
+	table    tokenTable
+	messages []tokenizedMessage
+}
+
+// Counts a message written at the given time.
+func (s *emoteStats) add(messageTime time.Time, message string) {
+	tokens := tokenizeMessage(message)
+	s.table.add(tokens)
+	s.messages = append(s.messages, tokenizedMessage{time: messageTime, tokens: tokens})
+}
+
+// Gives the frequency tables of all messages counted, limited to the given amount of tokens each. If an interval is
+// given, the timeline has the frequency tables of the messages within each interval, between the first and last
+// message. Messages do not need to be counted in chronological order, as archives keep them in the order they were
+// received.
+func (s *emoteStats) outbound(interval time.Duration, limit int) EmotesOutbound {
+	outbound := EmotesOutbound{
+		Messages:    s.table.messages,
+		TotalWords:  s.table.words.total,
+		TotalEmojis: s.table.emojis.total,
+		TotalEmotes: s.table.emotes.total,
+		Words:       s.table.words.top(limit),
+		Emojis:      s.table.emojis.top(limit),
+		Emotes:      s.table.emotes.top(limit),
+		Timeline:    []EmoteBucket{},
+	}
+	sort.SliceStable(s.messages, func(i, j int) bool { return s.messages[i].time.Before(s.messages[j].time) })
+	if len(s.messages) == 0 {
+		return outbound
+	}
+	start, end := s.messages[0].time, s.messages[len(s.messages)-1].time
+	outbound.StartTime = start.UTC().Format(time.RFC3339)
+	outbound.EndTime = end.UTC().Format(time.RFC3339)
+	if interval <= 0 || end.Before(start) {
+		return outbound
+	}
+
+	// Count the messages into buckets aligned to the interval.
+	first, interval, buckets := alignTimeline(start, end, interval)
+	outbound.Interval = int(interval.Seconds())
+	tables := make([]tokenTable, buckets)
+	for _, message := range s.messages {
+		i := int(message.time.Sub(first) / interval)
+		if message.time.Before(first) || i >= len(tables) {
+			continue
+		}
+		tables[i].add(message.tokens)
+	}
+	outbound.Timeline = make([]EmoteBucket, buckets)
+	for i, table := range tables {
+		outbound.Timeline[i] = EmoteBucket{
+			Time:     first.Add(time.Duration(i) * interval).Format(time.RFC3339),
+			Messages: table.messages,
+			Words:    table.words.top(limit),
+			Emojis:   table.emojis.top(limit),
+			Emotes:   table.emotes.top(limit),
+		}
+	}
+	return outbound
+}
+
+// Parses the time range, interval and limit of the stream emotes and video emotes endpoints. Gives back the status
+// message of the first invalid parameter, or "" if all are valid. The interval is zero if not given.
+func parseEmotesQuery(r *http.Request) (time.Time, time.Time, time.Duration, int, string) {
+	since, err := parseDate(r.URL.Query().Get("since"), false)
+	if err != nil {
+		return since, time.Time{}, 0, 0, "dateInvalid"
+	}
+	until, err := parseDate(r.URL.Query().Get("until"), true)
+	if err != nil {
+		return since, until, 0, 0, "dateInvalid"
+	}
+	var interval time.Duration
+	if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+		interval, err = ParseInterval(intervalParam)
+		if err != nil || interval < time.Second {
+			return since, until, interval, 0, "intervalInvalid"
+		}
+	}
+	limit := defaultTopTokens
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return since, until, interval, limit, "limitInvalid"
+		}
+	}
+	return since, until, interval, limit, ""
+}
+
+// Tabulates the words, emojis and emotes in the messages and super chats of the recorded chat of a stream between
+// two times. Gives back false if the stream was never recorded.
+func (rec *Recorder) emotes(videoId string, since time.Time, until time.Time, interval time.Duration,
+	limit int) (EmotesOutbound, bool, error) {
+	_, found, err := rec.readRecording(videoId)
+	if err != nil || !found {
+		return EmotesOutbound{}, found, err
+	}
+	var stats emoteStats
+	_, err = rec.readArchive(videoId, func(event archivedChatEvent) error {
+		if !chatMessageTypes[event.Type] || event.Time.Before(since) || (!until.IsZero() && event.Time.After(until)) {
+			return nil
+		}
+		chatEvent, err := decodeChatEvent(event.Type, event.Event)
+		if err != nil {
+			return err
+		}
+		stats.add(event.Time, chatEventMessage(chatEvent))
+		return nil
+	})
+	if err != nil {
+		return EmotesOutbound{}, true, err
+	}
+	outbound := stats.outbound(interval, limit)
+	outbound.VideoId = videoId
+	outbound.Source = "chat"
+	return outbound, true, nil
+}
+
+// Tabulates the words, emojis and emotes in comments and replies published between two times. Comments are counted
+// in the order they were published, and those without a valid publishing time are left out.
+func commentEmotes(comments []interface{}, since time.Time, until time.Time, interval time.Duration,
+	limit int) EmotesOutbound {
+	type publishedComment struct {
+		time    time.Time
+		message string
+	}
+	var published []publishedComment
+	for _, comment := range comments {
+		var publishedAt, message string
+		switch c := comment.(type) {
+		case Comment:
+			publishedAt, message = c.PublishedAt, c.Message
+		case Reply:
+			publishedAt, message = c.PublishedAt, c.Message
+		default:
+			continue
+		}
+		commentTime, err := time.Parse(time.RFC3339, publishedAt)
+		if err != nil || commentTime.Before(since) || (!until.IsZero() && commentTime.After(until)) {
+			continue
+		}
+		published = append(published, publishedComment{time: commentTime.UTC(), message: message})
+	}
+	sort.SliceStable(published, func(i, j int) bool { return published[i].time.Before(published[j].time) })
+	var stats emoteStats
+	for _, comment := range published {
+		stats.add(comment.time, comment.message)
+	}
+	outbound := stats.outbound(interval, limit)
+	outbound.Source = "comments"
+	return outbound
+}
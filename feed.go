@@ -0,0 +1,244 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Largest amount of chats merged into one feed, and how long events are held back by default to order them by the
+// time they were published, which is how long YouTube usually asks to wait between polls.
+const (
+	maxFeedSources   = 10
+	defaultFeedDelay = defaultChatPollInterval
+)
+
+// A chat merged into a feed, along with the ID it was requested by, and the subscription to it if it was found.
+type feedSource struct {
+	id           string
+	videoId      string
+	chatId       string
+	subscription *chatSubscription
+}
+
+// An event received from a source of a feed and when it was received, or the end of the source if closed is set.
+type feedEvent struct {
+	source   *feedSource
+	event    relayedEvent
+	received time.Time
+	closed   bool
+}
+
+// Gives the IDs in the given query parameter of a comma separated list, skipping empty IDs.
+func feedIds(param string) []string {
+	var ids []string
+	for _, id := range strings.Split(param, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Sends the events of a source to a feed until the source ends, followed by the end of the source, unless the feed is
+// done first.
+func forwardFeedSource(source *feedSource, events chan<- feedEvent, done <-chan struct{}) {
+	for event := range source.subscription.events {
+		select {
+		case events <- feedEvent{source: source, event: event, received: time.Now()}:
+		case <-done:
+			return
+		}
+	}
+	select {
+	case events <- feedEvent{source: source, closed: true}:
+	case <-done:
+	}
+}
+
+// Inserts an event among the events held back, keeping them ordered by the time they were published. Events published
+// at the same time are kept in the order they were received.
+func holdFeedEvent(held []feedEvent, event feedEvent) []feedEvent {
+	i := sort.Search(len(held), func(i int) bool { return held[i].event.Time.After(event.event.Time) })
+	held = append(held, feedEvent{})
+	copy(held[i+1:], held[i:])
+	held[i] = event
+	return held
+}
+
+// Gives the form of an event of a source streamed by the feed, carrying the chat event or the status of the error,
+// tagged with the source.
+func feedServerSentEvent(source *feedSource, event relayedEvent) (relayedEvent, error) {
+	outbound := ChatFeedEvent{Source: source.id, VideoId: source.videoId, ChatId: source.chatId}
+	if status, ok := event.Event.(StatusCodeOutbound); ok && event.Type == relayErrorEvent {
+		outbound.Status = &status
+	} else {
+		outbound.Event = json.RawMessage(event.Data)
+	}
+	data, err := json.Marshal(outbound)
+	return relayedEvent{Id: event.Id, Type: event.Type, Data: data}, err
+}
+
+// ChatFeedHandler is the handler for the chat feed endpoint. /ytstats/v1/feed/
+// Streams the events of several live chats merged into one feed as Server-Sent Events, each polled on the server as
+// often as YouTube suggests for it. The chats are given by their IDs, or looked up from videos or the current live
+// streams of channels, and every event is tagged with the source it came from. Events are held back for a delay to
+// order them by the time they were published across chats. A source that cannot be found or fails sends an error
+// event of its own, and the feed goes on with the other sources until all of them have ended.
+func ChatFeedHandler(input Inputs) http.Handler {
+	relay := input.Relay
+	if relay == nil {
+		relay = NewRelay(input)
+	}
+	chatFeed := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			chatIds := feedIds(r.URL.Query().Get("id"))
+			videoIds := feedIds(r.URL.Query().Get("video"))
+			channelIds := feedIds(r.URL.Query().Get("channel"))
+			amount := len(chatIds) + len(videoIds) + len(channelIds)
+			if amount == 0 {
+				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+				return
+			}
+			if amount > maxFeedSources {
+				sendStatusCode(w, quota, http.StatusBadRequest, "tooManyItems")
+				return
+			}
+			var searches []Filter
+			if filters := r.URL.Query().Get("filters"); filters != "" {
+				if json.Unmarshal([]byte(filters), &searches) != nil {
+					sendStatusCode(w, quota, http.StatusBadRequest, "filterInvalid")
+					return
+				}
+				if msg := validateChatFilters(searches); msg != "" {
+					sendStatusCode(w, quota, http.StatusBadRequest, msg)
+					return
+				}
+			}
+			delay := defaultFeedDelay
+			if delayParam := r.URL.Query().Get("delay"); delayParam != "" {
+				var err error
+				delay, err = ParseInterval(delayParam)
+				if err != nil || delay < 0 || delay > time.Minute {
+					sendStatusCode(w, quota, http.StatusBadRequest, "delayInvalid")
+					return
+				}
+			}
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "streamingUnsupported")
+				return
+			}
+
+			// Look up the live chats of the videos and channels. Sources that cannot be found are reported as errors
+			// at the start of the feed.
+			var sources []*feedSource
+			var failures []relayedEvent
+			for _, id := range chatIds {
+				sources = append(sources, &feedSource{id: id, chatId: id})
+			}
+			for i, id := range append(append([]string{}, videoIds...), channelIds...) {
+				var stream liveChat
+				var youtubeStatus StatusCodeOutbound
+				if i < len(videoIds) {
+					stream, youtubeStatus, _ = input.Resolver.video(input, id, key)
+				} else {
+					stream, youtubeStatus, _ = input.Resolver.channel(input, id, key)
+				}
+				source := &feedSource{id: id, videoId: stream.videoId, chatId: stream.chatId}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					failure, _ := feedServerSentEvent(source,
+						relayedEvent{Type: relayErrorEvent, Event: youtubeStatus})
+					failures = append(failures, failure)
+					continue
+				}
+				sources = append(sources, source)
+			}
+
+			// Subscribe to every chat found, and forward their events into the feed until the client leaves.
+			events := make(chan feedEvent)
+			done := make(chan struct{})
+			defer close(done)
+			for _, source := range sources {
+				source.subscription = relay.subscribe(source.chatId, key, "", "")
+				defer source.subscription.close()
+				go forwardFeedSource(source, events, done)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			for _, failure := range failures {
+				if err := writeServerSentEvent(w, failure); err != nil {
+					log.Println("Failed to respond to chat feed endpoint.")
+					return
+				}
+			}
+			flusher.Flush()
+
+			// Stream the events held back for the delay in the order they were published, until all sources have
+			// ended and every event is sent.
+			heartbeat := time.NewTicker(chatHeartbeatInterval)
+			defer heartbeat.Stop()
+			open := len(sources)
+			var held []feedEvent
+			var release <-chan time.Time
+			for open > 0 || len(held) > 0 {
+				if len(held) > 0 && release == nil {
+					release = time.After(time.Until(held[0].received.Add(delay)))
+				}
+				var err error
+				select {
+				case <-r.Context().Done():
+					return
+				case <-heartbeat.C:
+					_, err = fmt.Fprint(w, ": heartbeat\n\n")
+				case event := <-events:
+					if event.closed {
+						open--
+						continue
+					}
+					if event.event.Type != "chat_ended" && event.event.Type != relayErrorEvent {
+						if _, kept := ChatFilter(searches, []interface{}{event.event.Event}); len(kept) == 0 {
+							continue
+						}
+					}
+					held = holdFeedEvent(held, event)
+					continue
+				case <-release:
+					release = nil
+					for len(held) > 0 && !time.Now().Before(held[0].received.Add(delay)) && err == nil {
+						var event relayedEvent
+						event, err = feedServerSentEvent(held[0].source, held[0].event)
+						if err == nil {
+							err = writeServerSentEvent(w, event)
+						}
+						held = held[1:]
+					}
+				}
+				if err != nil {
+					log.Println("Failed to respond to chat feed endpoint.")
+					return
+				}
+				flusher.Flush()
+			}
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(chatFeed)
+}
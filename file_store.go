@@ -0,0 +1,205 @@
+package yt_stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store backed by flat files in a directory. Each collection is one JSON file holding all of its
+// documents, and each series is one file per key with one JSON line per value, appended in chronological order.
+type FileStore struct {
+	mutex sync.Mutex
+	dir   string
+}
+
+// A line of a series file.
+type fileStoreEntry struct {
+	Time  time.Time       `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewFileStore creates a store in the given directory, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(filepath.Join(dir, "series"), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Gives the path of a collection file.
+func (s *FileStore) collectionPath(collection string) string {
+	return filepath.Join(s.dir, url.PathEscape(collection)+".json")
+}
+
+// Gives the path of a series file.
+func (s *FileStore) seriesPath(series string, key string) string {
+	return filepath.Join(s.dir, "series", url.PathEscape(series), url.PathEscape(key)+".jsonl")
+}
+
+// Reads all documents of a collection. A missing file is an empty collection.
+func (s *FileStore) readCollection(collection string) (map[string]json.RawMessage, error) {
+	documents := make(map[string]json.RawMessage)
+	raw, err := ioutil.ReadFile(s.collectionPath(collection))
+	if os.IsNotExist(err) {
+		return documents, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return documents, json.Unmarshal(raw, &documents)
+}
+
+// Writes all documents of a collection, replacing the file atomically.
+func (s *FileStore) writeCollection(collection string, documents map[string]json.RawMessage) error {
+	raw, err := json.Marshal(documents)
+	if err != nil {
+		return err
+	}
+	path := s.collectionPath(collection)
+	err = ioutil.WriteFile(path+".tmp", raw, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Put stores a document, replacing any existing document with the same key.
+func (s *FileStore) Put(collection string, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	documents, err := s.readCollection(collection)
+	if err != nil {
+		return err
+	}
+	documents[key] = raw
+	return s.writeCollection(collection, documents)
+}
+
+// Get reads a document into the provided value, reporting whether it exists.
+func (s *FileStore) Get(collection string, key string, value interface{}) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	documents, err := s.readCollection(collection)
+	if err != nil {
+		return false, err
+	}
+	raw, ok := documents[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, value)
+}
+
+// Delete removes a document. Deleting a document that does not exist is not an error.
+func (s *FileStore) Delete(collection string, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	documents, err := s.readCollection(collection)
+	if err != nil {
+		return err
+	}
+	if _, ok := documents[key]; !ok {
+		return nil
+	}
+	delete(documents, key)
+	return s.writeCollection(collection, documents)
+}
+
+// Keys lists the keys of all documents in a collection, sorted.
+func (s *FileStore) Keys(collection string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	documents, err := s.readCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range documents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Append adds a value to a series at the given time.
+func (s *FileStore) Append(series string, key string, t time.Time, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(fileStoreEntry{Time: t, Value: raw})
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	path := s.seriesPath(series, key)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Range reads the values of a series within a time range in chronological order. Zero times leave the range open.
+func (s *FileStore) Range(series string, key string, since time.Time, until time.Time) ([]json.RawMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := []json.RawMessage{}
+	file, err := os.Open(s.seriesPath(series, key))
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []fileStoreEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry fileStoreEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if inTimeRange(entry.Time, since, until) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i int, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	for _, entry := range entries {
+		values = append(values, entry.Value)
+	}
+	return values, nil
+}
+
+// Close does nothing, as files are only kept open while in use.
+func (s *FileStore) Close() error {
+	return nil
+}
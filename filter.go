@@ -0,0 +1,160 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// The parts of a comment, reply or chat event that filters search: its text, the name and ID of its author, its
+// type, and the roles of its author.
+type filterItem struct {
+	message  string
+	userName string
+	userId   string
+	itemType string
+	roles    map[string]bool
+}
+
+// Searches the author of an item for one or more users, each matching part of the name or the whole ID.
+func searchUsers(users []string, item filterItem, caseSensitive bool) (bool, bool) {
+	any := false
+	all := true
+	for _, user := range users {
+		anyName, _ := searchContent([]string{user}, item.userName, caseSensitive)
+		if anyName || (user != "" && user == item.userId) {
+			any = true
+		} else {
+			all = false
+		}
+	}
+	return any, all
+}
+
+// Checks whether a filter matches an item. Items match if they contain all of the content, are by all of the users,
+// have one of the types, and are by an author with all of the roles, or with match_any if they match any of them.
+func (search Filter) matches(item filterItem) bool {
+	anyContent, allContent := searchContent(search.Content, item.message, search.CaseSensitive)
+	anyUser, allUser := searchUsers(search.Users, item, search.CaseSensitive)
+	anyType := false
+	for _, itemType := range search.Types {
+		anyType = anyType || itemType == item.itemType
+	}
+	allType := anyType || len(search.Types) == 0
+	anyRole := false
+	allRole := true
+	for _, role := range search.Roles {
+		anyRole = anyRole || item.roles[role]
+		allRole = allRole && item.roles[role]
+	}
+	return (search.MatchAny && (anyContent || anyUser || anyType || anyRole)) ||
+		allContent && allUser && allType && allRole
+}
+
+// Applies multiple searches to items one after another. Additive searches add the matching items to the result,
+// while reductive searches reduce the result to the items matching them. Without searches, all items are kept, while
+// an empty list of searches keeps none, as nothing is added to the result.
+// Returns a bool on if the filtering succeeded, which fails on items that cannot be described, and the result.
+func applyFilters(searches []Filter, items []interface{},
+	describe func(item interface{}) (filterItem, bool)) (bool, []interface{}) {
+	if searches == nil {
+		return true, items
+	}
+	var matches []interface{}
+	var source []interface{}
+	for _, search := range searches {
+		var match []interface{}
+		var remains []interface{}
+		if search.Reductive { // Reductive filter, all non-matches stay.
+			source = matches
+			remains = items
+		} else { // Additive filter, all matches stay.
+			source = items
+			match = matches
+		}
+		for _, item := range source {
+			described, ok := describe(item)
+			if !ok {
+				return false, nil
+			}
+			if search.matches(described) {
+				match = append(match, item)
+			} else {
+				remains = append(remains, item)
+			}
+		}
+		matches = match
+		items = remains
+	}
+	return true, matches
+}
+
+// Describes a comment or reply for filtering. Comments have no author roles.
+func describeComment(item interface{}) (filterItem, bool) {
+	switch com := item.(type) {
+	case Comment:
+		return filterItem{message: com.Message, userName: com.AuthorName, userId: com.AuthorId,
+			itemType: com.Type}, true
+	case Reply:
+		return filterItem{message: com.Message, userName: com.AuthorName, userId: com.AuthorId,
+			itemType: com.Type}, true
+	}
+	return filterItem{}, false
+}
+
+// Describes a chat event parsed by ChatParser for filtering, by the text written and the user who caused it.
+func describeChatEvent(item interface{}) (filterItem, bool) {
+	value := reflect.ValueOf(item)
+	if value.Kind() != reflect.Struct || value.FieldByName("Type").Kind() != reflect.String {
+		return filterItem{}, false
+	}
+	described := filterItem{
+		message:  chatEventMessage(item),
+		itemType: value.FieldByName("Type").String(),
+		roles:    make(map[string]bool),
+	}
+	if author, ok := chatEventAuthor(item); ok {
+		described.userName = author.UserName
+		described.userId = author.UserId
+		for role, has := range chatUserRoles {
+			described.roles[role] = has(author)
+		}
+	}
+	return described, true
+}
+
+// ChatFilter filters chat events parsed by ChatParser with the same searches as CommentFilter, searching the text
+// written, the name and ID of the user who caused each event, the event type, and the roles of the user.
+// Returns a bool on if the filtering succeeded, and the result.
+func ChatFilter(searches []Filter, events []interface{}) (bool, []interface{}) {
+	return applyFilters(searches, events, describeChatEvent)
+}
+
+// Checks chat filters for unknown event types and roles. Gives back the status message if they are invalid.
+func validateChatFilters(searches []Filter) string {
+	for _, search := range searches {
+		msg := validateChatSocketFilter(ChatSocketFilter{Types: search.Types, Roles: search.Roles})
+		if msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// Reads the searches in the body of a request, which may be empty. Gives back the status code and message if the
+// body is too large or invalid.
+func readFilters(w http.ResponseWriter, r *http.Request) ([]Filter, int, string) {
+	var searches []Filter
+	if r.Body == nil {
+		return nil, http.StatusOK, ""
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+	searchErr := json.NewDecoder(r.Body).Decode(&searches)
+	if searchErr != nil && searchErr.Error() == "http: request body too large" {
+		return nil, http.StatusRequestEntityTooLarge, "searchBodyTooLarge"
+	} else if searchErr != nil && searchErr != io.EOF {
+		return nil, http.StatusBadRequest, "searchBodyInvalid"
+	}
+	return searches, http.StatusOK, ""
+}
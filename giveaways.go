@@ -0,0 +1,577 @@
+package yt_stats
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store collection of giveaways and polls.
+const giveawaysCollection = "giveaways"
+
+// Types of giveaways. Giveaways collect entrants writing the keyword and draw a winner among them when closed, while
+// polls collect one vote for one of the options from each user.
+var giveawayTypes = map[string]bool{
+	"giveaway": true,
+	"poll":     true,
+}
+
+// Giveaways collects the entrants of giveaways and the votes of polls held in live chats. Each chat with an open
+// giveaway or poll is followed through the relay using the key of the newest of them, until the chat ends or its
+// last giveaway or poll is closed. Each user enters once, with the first message that counts as an entry. Entries
+// are saved in batches, whenever all events received from the chat so far are collected.
+// Winners are drawn from a seed committed to by its hash when the giveaway opens, and published when it closes, so
+// that anyone can check the draw. Giveaways are managed with the API key they were opened with, and are only visible
+// to requests using that key.
+type Giveaways struct {
+	mutex    sync.Mutex
+	input    Inputs
+	store    Store
+	open     map[string]*storedGiveaway
+	unsaved  map[string]bool
+	watchers map[string]*chatSubscription
+}
+
+// A giveaway or poll as stored, including the key managing it, when it opened, and its seed, which is only sent back
+// once it is closed. The IDs of its entrants are kept apart once it collects entries, to find users who entered.
+type storedGiveaway struct {
+	Giveaway Giveaway  `json:"giveaway"`
+	Key      string    `json:"key"`
+	Seed     string    `json:"seed"`
+	Opened   time.Time `json:"opened"`
+	entered  map[string]bool
+}
+
+// NewGiveaways creates giveaways persisted in the given store, following chats through the relay of the inputs.
+func NewGiveaways(input Inputs, store Store) *Giveaways {
+	return &Giveaways{
+		input:    input,
+		store:    store,
+		open:     make(map[string]*storedGiveaway),
+		unsaved:  make(map[string]bool),
+		watchers: make(map[string]*chatSubscription),
+	}
+}
+
+// Checks the definition of a giveaway or poll, giving back the status message describing what is wrong with it,
+// or "". Giveaways need a keyword, while polls need at least two different options and may have a keyword.
+func validateGiveaway(giveaway Giveaway) string {
+	if giveaway.ChatId == "" {
+		return "chatIdMissing"
+	}
+	if !giveawayTypes[giveaway.Type] {
+		return "giveawayTypeInvalid"
+	}
+	if len(strings.Fields(giveaway.Keyword)) > 1 || (giveaway.Type == "giveaway" && giveaway.Keyword == "") {
+		return "giveawayKeywordInvalid"
+	}
+	if giveaway.Type == "giveaway" && len(giveaway.Options) > 0 {
+		return "giveawayOptionsInvalid"
+	}
+	if giveaway.Type == "poll" && len(giveaway.Options) < 2 {
+		return "giveawayOptionsInvalid"
+	}
+	seen := make(map[string]bool)
+	for _, option := range giveaway.Options {
+		if option == "" || seen[strings.ToLower(option)] {
+			return "giveawayOptionsInvalid"
+		}
+		seen[strings.ToLower(option)] = true
+	}
+	return ""
+}
+
+// Gives the option of a poll a vote is for, or "" if it is for none of them. Votes are either an option, ignoring
+// case, or its number counting from 1.
+func pollVote(options []string, vote string) string {
+	vote = strings.TrimSpace(vote)
+	if number, err := strconv.Atoi(vote); err == nil && number >= 1 && number <= len(options) {
+		return options[number-1]
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, vote) {
+			return option
+		}
+	}
+	return ""
+}
+
+// Gives the hex encoded SHA-256 hash of a seed, published while a giveaway is open.
+func hashGiveawaySeed(seed string) string {
+	hash := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(hash[:])
+}
+
+// Draws the winner among the entrants of a giveaway, giving back their index. The winner is the entrant at the index
+// given by the first 8 bytes of the SHA-256 hash of the seed followed by the user IDs of the entrants, each on a new
+// line, read as a big endian integer, modulo the amount of entrants.
+func drawWinner(seed string, entrants []GiveawayEntrant) int {
+	lines := []string{seed}
+	for _, entrant := range entrants {
+		lines = append(lines, entrant.User.UserId)
+	}
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return int(binary.BigEndian.Uint64(hash[:8]) % uint64(len(entrants)))
+}
+
+// Enters the user who caused a relayed chat event into a giveaway or poll, if the event is a message counting as an
+// entry. Only messages published after the giveaway opened count, by users who have not entered yet and who meet the
+// restrictions of the giveaway. Gives back whether the user entered.
+func (s *storedGiveaway) enter(event relayedEvent) bool {
+	giveaway := &s.Giveaway
+	if !chatMessageTypes[event.Type] || event.Time.Before(s.Opened) {
+		return false
+	}
+	author, ok := chatEventAuthor(event.Event)
+	if !ok || author.UserId == "" || (giveaway.MembersOnly && !author.Member) ||
+		(giveaway.ExcludeModerators && author.Moderator) {
+		return false
+	}
+	if s.entered == nil {
+		s.entered = make(map[string]bool)
+		for _, entrant := range giveaway.Entrants {
+			s.entered[entrant.User.UserId] = true
+		}
+	}
+	if s.entered[author.UserId] {
+		return false
+	}
+	words := strings.Fields(chatEventMessage(event.Event))
+	if giveaway.Keyword != "" {
+		if len(words) == 0 || !strings.EqualFold(words[0], giveaway.Keyword) {
+			return false
+		}
+		words = words[1:]
+	}
+	vote := ""
+	if giveaway.Type == "poll" {
+		vote = pollVote(giveaway.Options, strings.Join(words, " "))
+		if vote == "" {
+			return false
+		}
+		for i := range giveaway.Votes {
+			if giveaway.Votes[i].Option == vote {
+				giveaway.Votes[i].Votes++
+			}
+		}
+	}
+	s.entered[author.UserId] = true
+	giveaway.Entrants = append(giveaway.Entrants, GiveawayEntrant{
+		User: author,
+		Vote: vote,
+		Time: event.Time.Format(time.RFC3339),
+	})
+	giveaway.Entries++
+	return true
+}
+
+// Gives the newest open giveaway or poll on a chat, or nil if there is none. Must be called with the mutex held.
+func (g *Giveaways) newest(chatId string) *storedGiveaway {
+	var newest *storedGiveaway
+	for _, stored := range g.open {
+		if stored.Giveaway.ChatId == chatId && (newest == nil || stored.Giveaway.Id > newest.Giveaway.Id) {
+			newest = stored
+		}
+	}
+	return newest
+}
+
+// Starts following a chat for its open giveaways and polls using the key of the newest of them, or switches to that
+// key if the chat is already followed. Stops following the chat if none of its giveaways and polls are open anymore.
+// Must be called with the mutex held.
+func (g *Giveaways) watch(chatId string) {
+	newest := g.newest(chatId)
+	subscription, ok := g.watchers[chatId]
+	switch {
+	case newest == nil && ok:
+		delete(g.watchers, chatId)
+		subscription.close()
+	case newest != nil && ok:
+		subscription.useKey(newest.Key)
+	case newest != nil:
+		subscription = g.input.Relay.subscribe(chatId, newest.Key, "", "")
+		g.watchers[chatId] = subscription
+		go g.run(chatId, subscription)
+	}
+}
+
+// Saves the open giveaways and polls that collected entries since they were last saved. Must be called with the
+// mutex held.
+func (g *Giveaways) save() {
+	for id := range g.unsaved {
+		delete(g.unsaved, id)
+		stored, ok := g.open[id]
+		if !ok {
+			continue
+		}
+		if err := g.store.Put(giveawaysCollection, id, stored); err != nil {
+			log.Printf("Failed to store entries of giveaway %s: %v", id, err)
+		}
+	}
+}
+
+// Enters the users writing in a followed chat into its open giveaways and polls until the chat ends, polling fails,
+// or the chat is no longer followed. If the relay drops the subscription for falling behind, the chat is followed
+// again from the last event collected. Giveaways and polls stay open after the chat ends until they are closed.
+func (g *Giveaways) run(chatId string, subscription *chatSubscription) {
+	ended := false
+	var position chatPosition
+	for {
+		event, ok := <-subscription.events
+		if !ok {
+			g.mutex.Lock()
+			newest := g.newest(chatId)
+			dropped := !ended && newest != nil && g.watchers[chatId] == subscription
+			if dropped {
+				log.Printf("Following chat %s again for giveaway entries after falling behind.", chatId)
+				subscription = g.input.Relay.subscribe(chatId, newest.Key, position.page, position.lastEventId)
+				g.watchers[chatId] = subscription
+			}
+			g.mutex.Unlock()
+			if dropped {
+				continue
+			}
+			break
+		}
+		if event.Type == relayErrorEvent {
+			status, _ := event.Event.(StatusCodeOutbound)
+			log.Printf("Stopped collecting giveaway entries on chat %s: %s", chatId, status.StatusMessage)
+			break
+		}
+		ended = ended || event.Type == "chat_ended"
+		position.advance(event)
+		g.mutex.Lock()
+		for id, stored := range g.open {
+			if stored.Giveaway.ChatId == chatId && stored.enter(event) {
+				g.unsaved[id] = true
+			}
+		}
+		if len(subscription.events) == 0 {
+			g.save()
+		}
+		g.mutex.Unlock()
+	}
+	subscription.close()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.save()
+	if g.watchers[chatId] == subscription {
+		delete(g.watchers, chatId)
+	}
+}
+
+// Resume starts following all chats with open giveaways and polls, using the key of the newest of them on each chat.
+// Entries published while the server was down are not collected.
+func (g *Giveaways) Resume() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	ids, err := g.store.Keys(giveawaysCollection)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		stored := &storedGiveaway{}
+		found, err := g.store.Get(giveawaysCollection, id, stored)
+		if err != nil {
+			return err
+		}
+		if found && stored.Giveaway.Status == "open" {
+			g.open[id] = stored
+		}
+	}
+	for _, stored := range g.open {
+		g.watch(stored.Giveaway.ChatId)
+	}
+	return nil
+}
+
+// Open validates and stores a new giveaway or poll managed with the given key, and follows its chat with the key.
+// Giveaways get a new seed, of which only the hash is sent back until the giveaway is closed. Gives back the
+// giveaway, or a status message describing why it is invalid.
+func (g *Giveaways) Open(giveaway Giveaway, key string) (Giveaway, string, error) {
+	giveaway.Keyword = strings.TrimSpace(giveaway.Keyword)
+	for i, option := range giveaway.Options {
+		giveaway.Options[i] = strings.TrimSpace(option)
+	}
+	if msg := validateGiveaway(giveaway); msg != "" {
+		return giveaway, msg, nil
+	}
+	now := time.Now().UTC()
+	id, err := newDeliveryId(now)
+	if err != nil {
+		return giveaway, "", err
+	}
+	stored := &storedGiveaway{Key: key, Opened: now}
+	giveaway.Id = id
+	giveaway.Status = "open"
+	giveaway.OpenedAt = now.Format(time.RFC3339)
+	giveaway.ClosedAt = ""
+	giveaway.Entries = 0
+	giveaway.Entrants = nil
+	giveaway.Votes = nil
+	giveaway.Seed = ""
+	giveaway.SeedHash = ""
+	giveaway.Winner = nil
+	for _, option := range giveaway.Options {
+		giveaway.Votes = append(giveaway.Votes, PollVotes{Option: option})
+	}
+	if giveaway.Type == "giveaway" {
+		stored.Seed, err = randomHex(32)
+		if err != nil {
+			return giveaway, "", err
+		}
+		giveaway.SeedHash = hashGiveawaySeed(stored.Seed)
+	}
+	stored.Giveaway = giveaway
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	err = g.store.Put(giveawaysCollection, id, stored)
+	if err != nil {
+		return giveaway, "", err
+	}
+	g.open[id] = stored
+	g.watch(giveaway.ChatId)
+	return giveaway, "", nil
+}
+
+// Gives a stored giveaway or poll managed with the given key. Must be called with the mutex held.
+func (g *Giveaways) storedGiveaway(id string, key string) (*storedGiveaway, bool, error) {
+	if stored, ok := g.open[id]; ok {
+		return stored, stored.Key == key, nil
+	}
+	stored := &storedGiveaway{}
+	found, err := g.store.Get(giveawaysCollection, id, stored)
+	if err != nil || !found || stored.Key != key {
+		return nil, false, err
+	}
+	return stored, true, nil
+}
+
+// Giveaways gives the giveaways and polls managed with the given key, of all chats or only of the given chat, in the
+// order they were opened. Their entrants are left out.
+func (g *Giveaways) Giveaways(chatId string, key string) ([]Giveaway, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	ids, err := g.store.Keys(giveawaysCollection)
+	if err != nil {
+		return nil, err
+	}
+	giveaways := []Giveaway{}
+	for _, id := range ids {
+		stored, found, err := g.storedGiveaway(id, key)
+		if err != nil {
+			return nil, err
+		}
+		if found && (chatId == "" || stored.Giveaway.ChatId == chatId) {
+			giveaway := stored.Giveaway
+			giveaway.Entrants = nil
+			giveaways = append(giveaways, giveaway)
+		}
+	}
+	return giveaways, nil
+}
+
+// Giveaway gives a giveaway or poll managed with the given key, including its entrants in the order they entered.
+func (g *Giveaways) Giveaway(id string, key string) (Giveaway, bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	stored, found, err := g.storedGiveaway(id, key)
+	if err != nil || !found {
+		return Giveaway{}, found, err
+	}
+	return stored.Giveaway, true, nil
+}
+
+// Close stops collecting entries of a giveaway or poll managed with the given key. Closing a giveaway draws its
+// winner, if anyone entered, and publishes its seed. Closing a closed giveaway or poll gives it back unchanged.
+func (g *Giveaways) Close(id string, key string) (Giveaway, bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	stored, found, err := g.storedGiveaway(id, key)
+	if err != nil || !found {
+		return Giveaway{}, found, err
+	}
+	if stored.Giveaway.Status != "open" {
+		return stored.Giveaway, true, nil
+	}
+	closed := *stored
+	closed.Giveaway.Status = "closed"
+	closed.Giveaway.ClosedAt = time.Now().UTC().Format(time.RFC3339)
+	if closed.Giveaway.Type == "giveaway" {
+		closed.Giveaway.Seed = closed.Seed
+		if len(closed.Giveaway.Entrants) > 0 {
+			winner := closed.Giveaway.Entrants[drawWinner(closed.Seed, closed.Giveaway.Entrants)].User
+			closed.Giveaway.Winner = &winner
+		}
+	}
+	err = g.store.Put(giveawaysCollection, id, closed)
+	if err != nil {
+		return stored.Giveaway, true, err
+	}
+	delete(g.open, id)
+	delete(g.unsaved, id)
+	g.watch(closed.Giveaway.ChatId)
+	return closed.Giveaway, true, nil
+}
+
+// Delete deletes a giveaway or poll managed with the given key, reporting whether it existed. Its chat is no longer
+// followed once none of its giveaways and polls are open.
+func (g *Giveaways) Delete(id string, key string) (Giveaway, bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	stored, found, err := g.storedGiveaway(id, key)
+	if err != nil || !found {
+		return Giveaway{}, found, err
+	}
+	err = g.store.Delete(giveawaysCollection, id)
+	if err != nil {
+		return stored.Giveaway, true, err
+	}
+	delete(g.open, id)
+	delete(g.unsaved, id)
+	g.watch(stored.Giveaway.ChatId)
+	return stored.Giveaway, true, nil
+}
+
+// Sends giveaways and polls as the response of the giveaways endpoints.
+func sendGiveaways(w http.ResponseWriter, giveaways []Giveaway) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(GiveawaysOutbound{Giveaways: giveaways})
+	if err != nil {
+		log.Println("Failed to respond to giveaways endpoint.")
+	}
+}
+
+// GiveawaysHandler is the handler for the giveaways endpoint. /ytstats/v1/giveaways/
+// Lists and opens giveaways and polls on live chats with GET and POST, and gives or deletes one giveaway or poll with
+// GET and DELETE on /ytstats/v1/giveaways/{id}/. Giveaways and polls are only visible when using the key used to open
+// them.
+func GiveawaysHandler(input Inputs) http.Handler {
+	giveaways := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+
+		// Check user input and fail if input is incorrect or missing.
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+		key := getKey(r)
+		if key == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+			return
+		}
+		if input.Giveaways == nil {
+			sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+			return
+		}
+		id := getPathId(r, "/ytstats/v1/giveaways/")
+
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			giveaways, err := input.Giveaways.Giveaways(r.URL.Query().Get("chat"), key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			sendGiveaways(w, giveaways)
+		case r.Method == http.MethodGet:
+			giveaway, found, err := input.Giveaways.Giveaway(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "giveawayNotFound")
+				return
+			}
+			sendGiveaways(w, []Giveaway{giveaway})
+		case r.Method == http.MethodPost && id == "":
+			var giveaway Giveaway
+			r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+			giveawayErr := json.NewDecoder(r.Body).Decode(&giveaway)
+			if giveawayErr != nil && giveawayErr.Error() == "http: request body too large" {
+				sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "giveawayBodyTooLarge")
+				return
+			} else if giveawayErr != nil && giveawayErr != io.EOF {
+				sendStatusCode(w, quota, http.StatusBadRequest, "giveawayBodyInvalid")
+				return
+			}
+			giveaway, msg, err := input.Giveaways.Open(giveaway, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+			sendGiveaways(w, []Giveaway{giveaway})
+		case r.Method == http.MethodDelete && id != "":
+			giveaway, found, err := input.Giveaways.Delete(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "giveawayNotFound")
+				return
+			}
+			sendGiveaways(w, []Giveaway{giveaway})
+		case r.Method == http.MethodDelete:
+			sendStatusCode(w, quota, http.StatusBadRequest, "giveawayIdMissing")
+		default:
+			unsupportedRequestType(w)
+		}
+	}
+	return http.HandlerFunc(giveaways)
+}
+
+// GiveawayCloseHandler is the handler for the giveaway close endpoint. /ytstats/v1/giveaways/{id}/close/
+// Closes a giveaway or poll with POST, drawing the winner of a giveaway and publishing the seed it was drawn with.
+func GiveawayCloseHandler(input Inputs) http.Handler {
+	closing := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodPost:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			if input.Giveaways == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/giveaways/")
+
+			// Close the giveaway and provide response.
+			giveaway, found, err := input.Giveaways.Close(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "giveawayNotFound")
+				return
+			}
+			sendGiveaways(w, []Giveaway{giveaway})
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(closing)
+}
@@ -0,0 +1,611 @@
+package yt_stats
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Key used to store the per request graphqlLoader in the GraphQL execution context.
+type graphqlLoaderKey struct{}
+
+// Batches IDs requested by resolvers, and queries them in batches of up to 50 once the first result is needed.
+type graphqlBatch struct {
+	query   func(ids string) (map[string]interface{}, StatusCodeOutbound, int)
+	pending []string
+	results map[string]interface{}
+	failed  map[string]StatusCodeOutbound
+}
+
+// Holds the batches and caches of one GraphQL request, and the quota spent on all queries made for it.
+type graphqlLoader struct {
+	mut           sync.Mutex
+	input         Inputs
+	key           string
+	quota         int
+	channels      *graphqlBatch
+	playlists     *graphqlBatch
+	videos        *graphqlBatch
+	streams       *graphqlBatch
+	playlistItems map[string][]string
+	comments      map[string][]interface{}
+	replies       map[string][]Reply
+}
+
+// Creates a loader for one GraphQL request, querying YouTube using the same queries as the REST handlers.
+func newGraphqlLoader(input Inputs, key string) *graphqlLoader {
+	l := &graphqlLoader{
+		input:         input,
+		key:           key,
+		playlistItems: make(map[string][]string),
+		comments:      make(map[string][]interface{}),
+		replies:       make(map[string][]Reply),
+	}
+	l.channels = newGraphqlBatch(func(ids string) (map[string]interface{}, StatusCodeOutbound, int) {
+		// All optional parts are queried, as they cost no extra quota and only selected fields are sent.
+		parts := make(map[string]bool)
+		for part := range channelParts {
+			parts[part] = true
+		}
+		inbound, youtubeStatus, quota := queryChannels(input, ids, key, parts)
+		results := make(map[string]interface{})
+		outbound := ChannelParser(inbound)
+		ChannelPartsParser(inbound, &outbound, parts)
+		for _, channel := range outbound.Channels {
+			results[channel.Id] = channel
+		}
+		return results, youtubeStatus, quota
+	})
+	l.playlists = newGraphqlBatch(func(ids string) (map[string]interface{}, StatusCodeOutbound, int) {
+		inbound, youtubeStatus, quota := queryPlaylists(input, ids, key)
+		results := make(map[string]interface{})
+		for _, playlist := range PlaylistTopLevelParser(inbound).Playlists {
+			results[playlist.Id] = playlist
+		}
+		return results, youtubeStatus, quota
+	})
+	l.videos = newGraphqlBatch(func(ids string) (map[string]interface{}, StatusCodeOutbound, int) {
+		inbound, youtubeStatus, quota := queryVideos(input, ids, key)
+		results := make(map[string]interface{})
+		for i := range inbound.Items { // Raw videos are kept so statistics can be calculated over any selection.
+			results[inbound.Items[i].Id] = VideoInbound{Items: inbound.Items[i : i+1]}
+		}
+		return results, youtubeStatus, quota
+	})
+	l.streams = newGraphqlBatch(func(ids string) (map[string]interface{}, StatusCodeOutbound, int) {
+		inbound, youtubeStatus, quota := queryStreams(input, ids, key)
+		results := make(map[string]interface{})
+		for _, stream := range StreamParser(inbound).Streams {
+			switch s := stream.(type) {
+			case LiveStream:
+				results[s.Id] = s
+			case Stream:
+				results[s.Id] = s
+			}
+		}
+		return results, youtubeStatus, quota
+	})
+	return l
+}
+
+func newGraphqlBatch(query func(ids string) (map[string]interface{}, StatusCodeOutbound, int)) *graphqlBatch {
+	return &graphqlBatch{
+		query:   query,
+		results: make(map[string]interface{}),
+		failed:  make(map[string]StatusCodeOutbound),
+	}
+}
+
+// Registers an ID with a batch and returns a thunk that resolves it, querying all pending IDs on first use.
+func (l *graphqlLoader) load(b *graphqlBatch, id string) func() (interface{}, error) {
+	l.mut.Lock()
+	if _, ok := b.results[id]; !ok {
+		b.pending = append(b.pending, id)
+	}
+	l.mut.Unlock()
+	return func() (interface{}, error) {
+		l.mut.Lock()
+		defer l.mut.Unlock()
+		if _, ok := b.results[id]; !ok {
+			l.flush(b)
+		}
+		if youtubeStatus, ok := b.failed[id]; ok {
+			return nil, graphqlError(youtubeStatus)
+		}
+		return b.results[id], nil
+	}
+}
+
+// Queries all pending IDs of a batch in groups of 50. Must be called with the loader locked.
+func (l *graphqlLoader) flush(b *graphqlBatch) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range b.pending {
+		if _, ok := b.results[id]; !ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	b.pending = nil
+	for _, chunk := range chunkIds(ids, 50) {
+		results, youtubeStatus, quota := b.query(strings.Join(chunk, ","))
+		l.quota += quota
+		for _, id := range chunk {
+			if youtubeStatus.StatusCode != http.StatusOK {
+				b.failed[id] = youtubeStatus
+			}
+			b.results[id] = results[id] // Missing IDs are cached as nil so they are not queried again.
+		}
+	}
+}
+
+// Returns a thunk resolving a video ID to a Video struct.
+func (l *graphqlLoader) video(id string) func() (interface{}, error) {
+	thunk := l.load(l.videos, id)
+	return func() (interface{}, error) {
+		raw, err := thunk()
+		if err != nil || raw == nil {
+			return nil, err
+		}
+		var tempPlaylistObject Playlist
+		err = VideoParser([]VideoInbound{raw.(VideoInbound)}, &tempPlaylistObject, false, true)
+		if err != nil {
+			return nil, graphqlError(StatusCodeOutbound{StatusMessage: "failedParsingYouTubeResponse"})
+		}
+		return tempPlaylistObject.Videos[0], nil
+	}
+}
+
+// Returns a thunk resolving a list of video IDs to a VideoStats struct.
+func (l *graphqlLoader) videoStats(ids []string) func() (interface{}, error) {
+	thunks := make([]func() (interface{}, error), len(ids))
+	for i, id := range ids {
+		thunks[i] = l.load(l.videos, id)
+	}
+	return func() (interface{}, error) {
+		var videoInbound []VideoInbound
+		for _, thunk := range thunks {
+			raw, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			if raw != nil {
+				videoInbound = append(videoInbound, raw.(VideoInbound))
+			}
+		}
+		if len(videoInbound) == 0 {
+			return nil, nil
+		}
+		var tempPlaylistObject Playlist
+		err := VideoParser(videoInbound, &tempPlaylistObject, true, false)
+		if err != nil {
+			return nil, graphqlError(StatusCodeOutbound{StatusMessage: "failedParsingYouTubeResponse"})
+		}
+		return tempPlaylistObject.VideoStats, nil
+	}
+}
+
+// Returns the video IDs of a playlist, querying all pages of the playlist the first time it is needed.
+func (l *graphqlLoader) playlistVideoIds(id string) ([]string, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if ids, ok := l.playlistItems[id]; ok {
+		return ids, nil
+	}
+	pages, youtubeStatus, quota := queryPlaylistItems(l.input, id, l.key)
+	l.quota += quota
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return nil, graphqlError(youtubeStatus)
+	}
+	var ids []string
+	for _, page := range pages {
+		ids = append(ids, page...)
+	}
+	l.playlistItems[id] = ids
+	return ids, nil
+}
+
+// Returns all comments and replies of a video, querying them the first time they are needed.
+func (l *graphqlLoader) videoComments(id string) ([]interface{}, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if comments, ok := l.comments[id]; ok {
+		return comments, nil
+	}
+	comments, youtubeStatus, quota := queryComments(l.input, id, l.key)
+	l.quota += quota
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return nil, graphqlError(youtubeStatus)
+	}
+	SortComments(&comments)
+	var topLevel []interface{}
+	for _, item := range comments {
+		switch com := item.(type) {
+		case Comment:
+			topLevel = append(topLevel, com)
+		case Reply:
+			l.replies[com.ParentId] = append(l.replies[com.ParentId], com)
+		}
+	}
+	l.comments[id] = topLevel
+	return topLevel, nil
+}
+
+// Error returned from resolvers, the message is the same status message the REST endpoints would use.
+type graphqlStatusError struct {
+	status StatusCodeOutbound
+}
+
+func (e graphqlStatusError) Error() string {
+	return e.status.StatusMessage
+}
+
+func graphqlError(status StatusCodeOutbound) error {
+	return graphqlStatusError{status: status}
+}
+
+// Gets the loader of the request currently being executed.
+func getLoader(p graphql.ResolveParams) *graphqlLoader {
+	return p.Context.Value(graphqlLoaderKey{}).(*graphqlLoader)
+}
+
+// Converts a list argument into a slice of strings.
+func stringList(arg interface{}) []string {
+	var out []string
+	if list, ok := arg.([]interface{}); ok {
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// Builds GraphQL object types mirroring the outbound structs, using the JSON names of their fields.
+type graphqlTypeBuilder struct {
+	objects map[reflect.Type]*graphql.Object
+}
+
+// Returns the GraphQL object for a struct, creating it from the struct's fields if needed. Extra fields are added to,
+// or override, the mirrored fields. Fields without a GraphQL equivalent, such as interface slices, must be provided.
+func (b *graphqlTypeBuilder) object(name string, v interface{}, extra graphql.Fields) *graphql.Object {
+	t := reflect.TypeOf(v)
+	if obj, ok := b.objects[t]; ok {
+		return obj
+	}
+	fields := graphql.Fields{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+		if outputType := b.outputType(name+field.Name, field.Type); outputType != nil {
+			fields[jsonName] = &graphql.Field{Type: outputType}
+		}
+	}
+	for fieldName, field := range extra {
+		fields[fieldName] = field
+	}
+	obj := graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+	b.objects[t] = obj
+	return obj
+}
+
+// Maps a Go type to a GraphQL output type. Returns nil for types without an equivalent.
+func (b *graphqlTypeBuilder) outputType(name string, t reflect.Type) graphql.Output {
+	switch t.Kind() {
+	case reflect.String:
+		return graphql.String
+	case reflect.Int, reflect.Int64:
+		return graphql.Int
+	case reflect.Float64:
+		return graphql.Float
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Ptr:
+		return b.outputType(name, t.Elem())
+	case reflect.Slice:
+		if elem := b.outputType(name, t.Elem()); elem != nil {
+			return graphql.NewList(elem)
+		}
+	case reflect.Struct:
+		if t.Name() != "" {
+			name = t.Name()
+		}
+		return b.object(name, reflect.New(t).Elem().Interface(), nil)
+	}
+	return nil
+}
+
+// Creates a union of the given objects, resolving the runtime type from the Go type of the value.
+func (b *graphqlTypeBuilder) union(name string, values ...interface{}) *graphql.Union {
+	var types []*graphql.Object
+	for _, v := range values {
+		types = append(types, b.object(reflect.TypeOf(v).Name(), v, nil))
+	}
+	return graphql.NewUnion(graphql.UnionConfig{
+		Name:  name,
+		Types: types,
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			return b.objects[reflect.TypeOf(p.Value)]
+		},
+	})
+}
+
+// Builds the GraphQL schema. Channels, playlists, videos and streams are resolved through batched loaders.
+func graphqlSchema() (graphql.Schema, error) {
+	b := &graphqlTypeBuilder{objects: make(map[reflect.Type]*graphql.Object)}
+	idList := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))
+
+	// Streams and chat events are returned as different structs depending on their type.
+	streamUnion := b.union("StreamItem", LiveStream{}, Stream{})
+	b.object("ChatUnknownEvent", ChatUnknownEvent{}, graphql.Fields{
+		"event": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The unparsed event as a JSON string.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				raw, err := json.Marshal(p.Source.(ChatUnknownEvent).Event)
+				return string(raw), err
+			},
+		},
+	})
+	chatEventUnion := b.union("ChatEvent", ChatEnded{}, ChatMessageDeleted{}, ChatNewMember{},
+		ChatMembershipGifting{}, ChatMembershipGiftReceived{}, ChatMemberMilestone{}, ChatMemberOnlyModeEnded{},
+		ChatMemberOnlyModeStarted{}, ChatSuperChat{}, ChatSuperSticker{}, ChatMessage{}, ChatTombstone{},
+		ChatUserBanned{}, ChatUnknownEvent{})
+	chatType := b.object("Chat", ChatOutbound{}, graphql.Fields{
+		"chat_events": &graphql.Field{Type: graphql.NewList(chatEventUnion)},
+	})
+
+	// Comments link to their replies, which are retrieved together with the comments.
+	replyType := b.object("Reply", Reply{}, nil)
+	commentType := b.object("Comment", Comment{}, graphql.Fields{
+		"replies": &graphql.Field{
+			Type: graphql.NewList(replyType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				l := getLoader(p)
+				l.mut.Lock()
+				defer l.mut.Unlock()
+				return l.replies[p.Source.(Comment).Id], nil
+			},
+		},
+	})
+
+	// Channels, playlists and videos reference each other, so the fields linking them are added after creation.
+	videoStatsType := b.object("VideoStats", VideoStats{}, nil)
+	channelType := b.object("Channel", Channel{}, nil)
+	videoType := b.object("Video", Video{}, graphql.Fields{
+		"comments": &graphql.Field{
+			Type: graphql.NewList(commentType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return getLoader(p).videoComments(p.Source.(Video).Id)
+			},
+		},
+		"stream": &graphql.Field{
+			Type: streamUnion,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				l := getLoader(p)
+				return l.load(l.streams, p.Source.(Video).Id), nil
+			},
+		},
+	})
+	playlistType := b.object("Playlist", Playlist{}, nil)
+	videoType.AddFieldConfig("channel", &graphql.Field{
+		Type: channelType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			l := getLoader(p)
+			return l.load(l.channels, p.Source.(Video).ChannelId), nil
+		},
+	})
+	channelType.AddFieldConfig("uploads", &graphql.Field{
+		Type: playlistType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			l := getLoader(p)
+			return l.load(l.playlists, p.Source.(Channel).UploadsPlaylist), nil
+		},
+	})
+	playlistType.AddFieldConfig("channel", &graphql.Field{
+		Type: channelType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			l := getLoader(p)
+			return l.load(l.channels, p.Source.(Playlist).ChannelInfo.ChannelId), nil
+		},
+	})
+	playlistType.AddFieldConfig("videos", &graphql.Field{
+		Type: graphql.NewList(videoType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			l := getLoader(p)
+			id := p.Source.(Playlist).Id
+			return func() (interface{}, error) {
+				ids, err := l.playlistVideoIds(id)
+				if err != nil {
+					return nil, err
+				}
+				videos := make([]interface{}, len(ids))
+				for i, videoId := range ids {
+					videos[i] = l.video(videoId)
+				}
+				return videos, nil
+			}, nil
+		},
+	})
+	playlistType.AddFieldConfig("video_stats", &graphql.Field{
+		Type: videoStatsType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			l := getLoader(p)
+			id := p.Source.(Playlist).Id
+			return func() (interface{}, error) {
+				ids, err := l.playlistVideoIds(id)
+				if err != nil {
+					return nil, err
+				}
+				return l.videoStats(ids)()
+			}, nil
+		},
+	})
+
+	// Root query, each field mirrors one of the REST endpoints.
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"channels": &graphql.Field{
+				Type: graphql.NewList(channelType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{Type: idList}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := getLoader(p)
+					var channels []interface{}
+					for _, id := range stringList(p.Args["ids"]) {
+						channels = append(channels, l.load(l.channels, id))
+					}
+					return channels, nil
+				},
+			},
+			"playlists": &graphql.Field{
+				Type: graphql.NewList(playlistType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{Type: idList}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := getLoader(p)
+					var playlists []interface{}
+					for _, id := range stringList(p.Args["ids"]) {
+						playlists = append(playlists, l.load(l.playlists, id))
+					}
+					return playlists, nil
+				},
+			},
+			"videos": &graphql.Field{
+				Type: graphql.NewList(videoType),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{Type: idList}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := getLoader(p)
+					var videos []interface{}
+					for _, id := range stringList(p.Args["ids"]) {
+						videos = append(videos, l.video(id))
+					}
+					return videos, nil
+				},
+			},
+			"video_stats": &graphql.Field{
+				Type: videoStatsType,
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{Type: idList}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getLoader(p).videoStats(stringList(p.Args["ids"])), nil
+				},
+			},
+			"streams": &graphql.Field{
+				Type: graphql.NewList(streamUnion),
+				Args: graphql.FieldConfigArgument{"ids": &graphql.ArgumentConfig{Type: idList}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := getLoader(p)
+					var streams []interface{}
+					for _, id := range stringList(p.Args["ids"]) {
+						streams = append(streams, l.load(l.streams, id))
+					}
+					return streams, nil
+				},
+			},
+			"comments": &graphql.Field{
+				Type: graphql.NewList(commentType),
+				Args: graphql.FieldConfigArgument{
+					"video_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getLoader(p).videoComments(p.Args["video_id"].(string))
+				},
+			},
+			"chat": &graphql.Field{
+				Type: chatType,
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"page": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					l := getLoader(p)
+					id := p.Args["id"].(string)
+					chatInbound, youtubeStatus, quota := queryChat(l.input, id, l.key, p.Args["page"].(string))
+					l.mut.Lock()
+					l.quota += quota
+					l.mut.Unlock()
+					if youtubeStatus.StatusCode != http.StatusOK {
+						return nil, graphqlError(youtubeStatus)
+					}
+					return ChatParser(chatInbound, id), nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// GraphQLHandler is the handler for the GraphQL endpoint. /ytstats/v1/graphql/
+// Provides channels, playlists, videos, comments, streams and chat through one query. Quota usage is in extensions.
+func GraphQLHandler(input Inputs) http.Handler {
+	schema, err := graphqlSchema()
+	if err != nil {
+		log.Fatalf("Failed to build GraphQL schema: %v", err)
+	}
+	gql := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		var query GraphQLInbound
+		switch r.Method {
+		case http.MethodGet:
+			query.Query = r.URL.Query().Get("query")
+			query.OperationName = r.URL.Query().Get("operationName")
+			if variables := r.URL.Query().Get("variables"); variables != "" {
+				if json.Unmarshal([]byte(variables), &query.Variables) != nil {
+					sendStatusCode(w, quota, http.StatusBadRequest, "queryInvalid")
+					return
+				}
+			}
+		case http.MethodPost:
+			r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+			queryErr := json.NewDecoder(r.Body).Decode(&query)
+			if queryErr != nil && queryErr.Error() == "http: request body too large" {
+				sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "queryBodyTooLarge")
+				return
+			} else if queryErr != nil && queryErr != io.EOF {
+				sendStatusCode(w, quota, http.StatusBadRequest, "queryInvalid")
+				return
+			}
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+
+		// Check user input and fail if input is incorrect or missing.
+		key := getKey(r)
+		if key == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+			return
+		}
+		if query.Query == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "queryMissing")
+			return
+		}
+
+		// Execute query and provide response.
+		loader := newGraphqlLoader(input, key)
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  query.Query,
+			VariableValues: query.Variables,
+			OperationName:  query.OperationName,
+			Context:        context.WithValue(r.Context(), graphqlLoaderKey{}, loader),
+		})
+		result.Extensions = map[string]interface{}{"quota_usage": loader.quota}
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(result)
+		if err != nil {
+			log.Println("Failed to respond to graphql endpoint.")
+		}
+	}
+	return http.HandlerFunc(gql)
+}
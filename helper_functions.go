@@ -5,6 +5,9 @@ import (
 	duration "github.com/channelmeter/iso8601duration"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Sends a status code response, used to report back errors.
@@ -44,3 +47,118 @@ func getKey(r *http.Request) string {
 	}
 	return key
 }
+
+// Get the ID from paths of the form root/{id}/resource/. Returns "" if the path has no ID.
+func getPathId(r *http.Request, root string) string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, root), "/"), "/")[0]
+}
+
+// SubResourceRouter routes requests of the form root/{id}/{resource}/ to the handler of that resource.
+// All other requests are routed to the base handler of the endpoint.
+func SubResourceRouter(root string, base http.Handler, resources map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, root), "/"), "/")
+		if len(segments) == 2 && segments[0] != "" {
+			if handler, ok := resources[segments[1]]; ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		base.ServeHTTP(w, r)
+	})
+}
+
+// Parses a date given as an RFC 3339 timestamp or as YYYY-MM-DD. Dates without a time are taken as the start of
+// the day, or the end of it if endOfDay is set. Returns the zero time for empty strings.
+func parseDate(date string, endOfDay bool) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// Splits a list of IDs into chunks of at most the given size, such as the 50 IDs YouTube accepts per request.
+func chunkIds(ids []string, size int) [][]string {
+	var chunks [][]string
+	for len(ids) > size {
+		chunks = append(chunks, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+// Optional channel parts that can be requested through the parts parameter, and the YouTube part they need.
+// Parts provided by the snippet YouTube part, which is always queried, need no additional YouTube part.
+var channelParts = map[string]string{
+	"details":       "",
+	"thumbnails":    "",
+	"branding":      "brandingSettings",
+	"topics":        "topicDetails",
+	"status":        "status",
+	"localizations": "localizations",
+}
+
+// Parses a comma separated list of optional channel parts. Fails if any of the parts are unknown.
+func parseChannelParts(param string) (map[string]bool, bool) {
+	parts := make(map[string]bool)
+	for _, part := range strings.Split(strings.ToLower(param), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, ok := channelParts[part]; !ok {
+			return nil, false
+		}
+		parts[part] = true
+	}
+	return parts, true
+}
+
+// Splits channel keywords on spaces, keeping keywords in quotes together.
+func splitKeywords(keywords string) []string {
+	var split []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range keywords {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				split = append(split, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		split = append(split, current.String())
+	}
+	return split
+}
+
+// ParseInterval parses an interval such as 90m, 6h or 7d. Days are supported in addition to the units of time.ParseDuration.
+func ParseInterval(interval string) (time.Duration, error) {
+	if strings.HasSuffix(interval, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(interval, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(interval)
+}
@@ -0,0 +1,302 @@
+"use strict";
+
+// All requests go to the API this page is served from, relative to /ytstats/v1/.
+const keyInput = document.getElementById("key");
+keyInput.value = localStorage.getItem("ytstats-key") || "";
+keyInput.addEventListener("change", () => localStorage.setItem("ytstats-key", keyInput.value));
+document.getElementById("key-form").addEventListener("submit", (e) => e.preventDefault());
+
+let quotaUsed = 0;
+
+// Queries an endpoint of the API, keeps track of quota used and shows errors reported by the API.
+async function api(path, options = {}) {
+    options.headers = Object.assign({"key": keyInput.value}, options.headers);
+    const response = await fetch(path, options);
+    const body = await response.json();
+    quotaUsed += body.quota_usage || 0;
+    document.getElementById("quota").textContent = `Quota used: ${quotaUsed}`;
+    if (body.status_message !== undefined && body.status_code !== undefined && !response.ok) {
+        throw new Error(`${body.status_code}: ${body.status_message}`);
+    }
+    hideError();
+    return body;
+}
+
+function showError(err) {
+    const footer = document.getElementById("error");
+    footer.textContent = err.message;
+    footer.hidden = false;
+}
+
+function hideError() {
+    document.getElementById("error").hidden = true;
+}
+
+// Creates an element with the given class and text content.
+function element(tag, className, text) {
+    const el = document.createElement(tag);
+    if (className) {
+        el.className = className;
+    }
+    if (text !== undefined) {
+        el.textContent = text;
+    }
+    return el;
+}
+
+function formatDuration(seconds) {
+    const h = Math.floor(seconds / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    const s = seconds % 60;
+    return (h ? `${h}:${String(m).padStart(2, "0")}` : `${m}`) + `:${String(s).padStart(2, "0")}`;
+}
+
+function formatNumber(n) {
+    return Number(n).toLocaleString();
+}
+
+function splitList(value) {
+    return value.split(",").map((s) => s.trim()).filter((s) => s !== "");
+}
+
+// Tabs.
+document.querySelectorAll("nav button").forEach((button) => {
+    button.addEventListener("click", () => {
+        document.querySelectorAll("nav button, .tab").forEach((el) => el.classList.remove("active"));
+        button.classList.add("active");
+        document.getElementById(button.dataset.tab).classList.add("active");
+    });
+});
+
+// Channel lookup.
+document.getElementById("channel-form").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const ids = splitList(document.getElementById("channel-ids").value).join(",");
+    const results = document.getElementById("channel-results");
+    try {
+        const body = await api(`channel/?id=${encodeURIComponent(ids)}`);
+        results.replaceChildren();
+        for (const channel of body.channels) {
+            const card = element("div", "card");
+            const img = element("img");
+            img.src = channel.thumbnail;
+            img.alt = "";
+            card.append(img, element("h3", "", channel.title));
+            const subs = channel.hidden_subscriber_count ? "hidden" : formatNumber(channel.subscriber_count);
+            card.append(element("p", "", `Subscribers: ${subs}`));
+            card.append(element("p", "", `Views: ${formatNumber(channel.view_count)}`));
+            card.append(element("p", "", `Videos: ${formatNumber(channel.video_count)}`));
+            const uploads = element("button", "", "Browse uploads");
+            uploads.addEventListener("click", () => {
+                document.getElementById("playlist-id").value = channel.uploads_playlist;
+                document.querySelector("nav button[data-tab=playlist]").click();
+                loadPlaylist();
+            });
+            card.append(uploads);
+            results.append(card);
+        }
+    } catch (err) {
+        showError(err);
+    }
+});
+
+// Playlist browser, with videos sortable by their statistics.
+let playlistVideos = [];
+let sortField = "published_at";
+let sortAscending = false;
+
+async function loadPlaylist() {
+    const id = document.getElementById("playlist-id").value.trim();
+    const info = document.getElementById("playlist-info");
+    try {
+        const body = await api(`playlist/?id=${encodeURIComponent(id)}&stats=true&videos=true`);
+        info.replaceChildren();
+        playlistVideos = [];
+        for (const playlist of body.playlists) {
+            info.append(element("h3", "", `${playlist.title} by ${playlist.channel_info.channel_title}`));
+            const stats = playlist.video_stats;
+            if (stats) {
+                info.append(element("p", "", `${stats.available_videos} videos, ` +
+                    `${formatDuration(stats.total_length)} total, ${formatNumber(stats.total_views)} views, ` +
+                    `averaging ${formatNumber(stats.average_views)} views, ${formatNumber(stats.average_likes)} ` +
+                    `likes and ${formatNumber(stats.average_comments)} comments per video.`));
+            }
+            playlistVideos = playlistVideos.concat(playlist.videos || []);
+        }
+        renderPlaylist();
+    } catch (err) {
+        showError(err);
+    }
+}
+
+function renderPlaylist() {
+    const sorted = playlistVideos.slice().sort((a, b) => {
+        const order = a[sortField] < b[sortField] ? -1 : a[sortField] > b[sortField] ? 1 : 0;
+        return sortAscending ? order : -order;
+    });
+    const tbody = document.querySelector("#playlist-videos tbody");
+    tbody.replaceChildren();
+    for (const video of sorted) {
+        const row = element("tr");
+        const title = element("td");
+        const link = element("a", "", video.title);
+        link.href = `https://www.youtube.com/watch?v=${video.id}`;
+        title.append(link);
+        row.append(title, element("td", "", video.published_at.substring(0, 10)),
+            element("td", "", formatDuration(video.duration)), element("td", "", formatNumber(video.view_count)),
+            element("td", "", formatNumber(video.like_count)), element("td", "", formatNumber(video.comment_count)));
+        tbody.append(row);
+    }
+    document.querySelectorAll("#playlist-videos th").forEach((th) => {
+        th.classList.toggle("sorted", th.dataset.sort === sortField);
+        th.classList.toggle("ascending", th.dataset.sort === sortField && sortAscending);
+    });
+}
+
+document.getElementById("playlist-form").addEventListener("submit", (e) => {
+    e.preventDefault();
+    loadPlaylist();
+});
+
+document.querySelectorAll("#playlist-videos th[data-sort]").forEach((th) => {
+    th.addEventListener("click", () => {
+        sortAscending = th.dataset.sort === sortField ? !sortAscending : false;
+        sortField = th.dataset.sort;
+        renderPlaylist();
+    });
+});
+
+// Comment search with filter builder. Filters are applied in the order they are listed.
+document.getElementById("add-filter").addEventListener("click", () => {
+    const filter = document.getElementById("filter-template").content.cloneNode(true);
+    filter.querySelector(".remove-filter").addEventListener("click", (e) => e.target.parentElement.remove());
+    document.getElementById("filters").append(filter);
+});
+
+document.getElementById("comments-form").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const id = document.getElementById("comments-video").value.trim();
+    const filters = Array.from(document.querySelectorAll("#filters .filter")).map((fieldset) => ({
+        case_sensitive: fieldset.querySelector(".filter-case").checked,
+        match_any: fieldset.querySelector(".filter-any").checked,
+        reductive: fieldset.querySelector(".filter-reductive").checked,
+        content: splitList(fieldset.querySelector(".filter-content").value),
+        users: splitList(fieldset.querySelector(".filter-users").value),
+    }));
+    const results = document.getElementById("comments-results");
+    try {
+        const body = await api(`comments/?id=${encodeURIComponent(id)}`, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: filters.length ? JSON.stringify(filters) : "",
+        });
+        const comments = body.comments || [];
+        document.getElementById("comments-summary").textContent = `${comments.length} matching comments and replies.`;
+        results.replaceChildren();
+        for (const comment of comments) {
+            const item = element("li", comment.type);
+            item.append(element("span", "author", comment.author_name), element("span", "", comment.message));
+            results.append(item);
+        }
+    } catch (err) {
+        showError(err);
+    }
+});
+
+// Live stream viewer counter and chat. Polls the stream and chat endpoints following the suggested cooldown.
+let liveTimers = [];
+
+function stopLive() {
+    liveTimers.forEach((timer) => clearTimeout(timer));
+    liveTimers = [];
+    document.getElementById("live-stop").disabled = true;
+}
+
+function describeAmount(event) {
+    return event.amount_display || `${event.amount} ${event.currency}`;
+}
+
+function describeEvent(event) {
+    switch (event.type) {
+        case "message":
+            return [event.author.user_name, event.message];
+        case "superchat":
+            return [event.sent_by.user_name, `${describeAmount(event)}: ${event.message}`];
+        case "supersticker":
+            return [event.sent_by.user_name, `${describeAmount(event)}: ${event.alt_text}`];
+        case "new_member":
+            return [event.new_member.user_name, event.message];
+        case "membership_milestone":
+            return [event.member.user_name, `${event.message} ${event.user_comment}`];
+        case "memberships_gifted":
+            return [event.gifted_by.user_name, event.message];
+        case "gift_membership_received":
+            return [event.recipient.user_name, event.message];
+        case "ban":
+            return [event.banned_user.user_name, `was banned by ${event.banned_by.user_name}`];
+        case "message_deleted":
+            return [event.deleted_by.user_name, "deleted a message"];
+        case "chat_ended":
+            return ["", "The chat has ended."];
+        default:
+            return ["", event.type];
+    }
+}
+
+async function pollViewers(videoId) {
+    try {
+        const body = await api(`stream/?id=${encodeURIComponent(videoId)}`);
+        const stream = body.streams[0];
+        document.getElementById("live-state").textContent = stream ? stream.status : "not found";
+        document.getElementById("live-viewers").textContent =
+            stream && stream.status === "live" ? `${formatNumber(stream.concurrent_viewers)} watching` : "";
+        if (stream && stream.status === "live") {
+            liveTimers.push(setTimeout(() => pollViewers(videoId), 30000));
+        }
+        return stream;
+    } catch (err) {
+        showError(err);
+        stopLive();
+    }
+}
+
+async function pollChat(chatId, page) {
+    try {
+        const body = await api(`chat/?id=${encodeURIComponent(chatId)}&page=${encodeURIComponent(page)}`);
+        const chat = document.getElementById("live-chat");
+        const atBottom = chat.scrollTop + chat.clientHeight >= chat.scrollHeight - 5;
+        let ended = false;
+        for (const event of body.chat_events) {
+            if (!event) {
+                continue;
+            }
+            const [author, text] = describeEvent(event);
+            const item = element("li", event.type);
+            item.append(element("span", "author", author), element("span", "", text));
+            chat.append(item);
+            ended = ended || event.type === "chat_ended";
+        }
+        if (atBottom) {
+            chat.scrollTop = chat.scrollHeight;
+        }
+        if (!ended) {
+            liveTimers.push(setTimeout(() => pollChat(chatId, body.next_page), Math.max(body.suggested_cooldown, 1000)));
+        }
+    } catch (err) {
+        showError(err);
+        stopLive();
+    }
+}
+
+document.getElementById("live-form").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    stopLive();
+    document.getElementById("live-chat").replaceChildren();
+    document.getElementById("live-stop").disabled = false;
+    const stream = await pollViewers(document.getElementById("live-video").value.trim());
+    if (stream && stream.chat_id) {
+        pollChat(stream.chat_id, "");
+    }
+});
+
+document.getElementById("live-stop").addEventListener("click", stopLive);
@@ -0,0 +1,156 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Sends jobs as the response of the jobs endpoints.
+func sendJobs(w http.ResponseWriter, jobs []Job) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(JobsOutbound{Jobs: jobs})
+	if err != nil {
+		log.Println("Failed to respond to jobs endpoint.")
+	}
+}
+
+// JobsHandler is the handler for the jobs endpoint. /ytstats/v1/jobs/
+// Lists and creates recurring collection jobs with GET and POST, and gives or deletes one job with GET and DELETE on
+// /ytstats/v1/jobs/{id}/. Jobs run with the key used to create them, and are only visible when using that key.
+func JobsHandler(input Inputs) http.Handler {
+	jobs := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+
+		// Check user input and fail if input is incorrect or missing.
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+		key := getKey(r)
+		if key == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+			return
+		}
+		if input.Scheduler == nil {
+			sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+			return
+		}
+		id := getPathId(r, "/ytstats/v1/jobs/")
+
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			jobs, err := input.Scheduler.Jobs(key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			sendJobs(w, jobs)
+		case r.Method == http.MethodGet:
+			job, found, err := input.Scheduler.Job(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "jobNotFound")
+				return
+			}
+			sendJobs(w, []Job{job})
+		case r.Method == http.MethodPost && id == "":
+			var job Job
+			r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+			jobErr := json.NewDecoder(r.Body).Decode(&job)
+			if jobErr != nil && jobErr.Error() == "http: request body too large" {
+				sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "jobBodyTooLarge")
+				return
+			} else if jobErr != nil && jobErr != io.EOF {
+				sendStatusCode(w, quota, http.StatusBadRequest, "jobBodyInvalid")
+				return
+			}
+			job, msg, err := input.Scheduler.CreateJob(job, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+			sendJobs(w, []Job{job})
+		case r.Method == http.MethodDelete && id != "":
+			job, found, err := input.Scheduler.Job(id, key)
+			if err == nil && found {
+				found, err = input.Scheduler.DeleteJob(id, key)
+			}
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "jobNotFound")
+				return
+			}
+			sendJobs(w, []Job{job})
+		case r.Method == http.MethodDelete:
+			sendStatusCode(w, quota, http.StatusBadRequest, "jobIdMissing")
+		default:
+			unsupportedRequestType(w)
+		}
+	}
+	return http.HandlerFunc(jobs)
+}
+
+// Gives a handler pausing or resuming a job with POST.
+func jobPausingHandler(input Inputs, paused bool) http.Handler {
+	pausing := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodPost:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			if input.Scheduler == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/jobs/")
+
+			// Pause or resume the job and provide response.
+			job, found, err := input.Scheduler.SetPaused(id, key, paused)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "jobNotFound")
+				return
+			}
+			sendJobs(w, []Job{job})
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(pausing)
+}
+
+// JobPauseHandler is the handler for the job pause endpoint. /ytstats/v1/jobs/{id}/pause/
+// Pauses a job, which keeps it from running until it is resumed.
+func JobPauseHandler(input Inputs) http.Handler {
+	return jobPausingHandler(input, true)
+}
+
+// JobResumeHandler is the handler for the job resume endpoint. /ytstats/v1/jobs/{id}/resume/
+// Resumes a paused job, scheduling its next run from now.
+func JobResumeHandler(input Inputs) http.Handler {
+	return jobPausingHandler(input, false)
+}
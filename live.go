@@ -0,0 +1,184 @@
+package yt_stats
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store collection of channels watched for scheduled and live streams.
+const liveChannelsCollection = "live_channels"
+
+// How many of the newest uploads of a channel are checked for streams. Scheduled and live streams are listed among
+// the newest uploads, so a short page is enough to find new ones.
+const liveUploadsChecked = 10
+
+// A channel watched for streams, as stored by the tracker, including the key that started watching it, which is never
+// sent back.
+type liveChannel struct {
+	Since time.Time `json:"since"`
+	Key   string    `json:"key"`
+}
+
+// Gives the ID of the uploads playlist of a channel, which shares the ID of the channel with a different prefix.
+func uploadsPlaylistId(channelId string) string {
+	if !strings.HasPrefix(channelId, "UC") {
+		return ""
+	}
+	return "UU" + strings.TrimPrefix(channelId, "UC")
+}
+
+// Gives the last known states of the streams of a channel that are scheduled or live, by scheduled start time.
+func (t *Tracker) activeStreams(channelId string) ([]streamState, error) {
+	ids, err := t.store.Keys(streamStatesCollection)
+	if err != nil {
+		return nil, err
+	}
+	var streams []streamState
+	for _, id := range ids {
+		var state streamState
+		found, err := t.store.Get(streamStatesCollection, id, &state)
+		if err != nil {
+			return nil, err
+		}
+		if found && state.ChannelId == channelId && (state.Status == "scheduled" || state.Status == "live") {
+			streams = append(streams, state)
+		}
+	}
+	sort.SliceStable(streams, func(i int, j int) bool {
+		return streams[i].ScheduledStartTime < streams[j].ScheduledStartTime
+	})
+	return streams, nil
+}
+
+// Discovers scheduled and live streams among the newest uploads of channels, and records snapshots of them along
+// with the streams of the channels already known to be scheduled or live, emitting events as their states change.
+// Each channel costs one quota, and the streams are queried in batches of 50. Gives back the status of the queries
+// and the channels that were found.
+func (t *Tracker) detectStreams(channelIds []string, key string, budget *jobBudget) (StatusCodeOutbound, []string,
+	error) {
+	youtubeStatus := StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}
+	streamChannels := make(map[string]string)
+	var ids []string
+	addStream := func(id string, channelId string) {
+		if _, ok := streamChannels[id]; !ok {
+			streamChannels[id] = channelId
+			ids = append(ids, id)
+		}
+	}
+
+	// Find candidate streams in the newest uploads of each channel.
+	var found []string
+	for _, channelId := range channelIds {
+		uploads := uploadsPlaylistId(channelId)
+		if uploads == "" {
+			continue
+		}
+		if !budget.spend(1) {
+			return youtubeStatus, found, errBudgetExhausted
+		}
+		playlistStatus, _ := walkPlaylistItems(t.input, uploads, key, func(page PlaylistItemsInbound) bool {
+			for i, item := range page.Items {
+				if i >= liveUploadsChecked {
+					break
+				}
+				addStream(item.Snippet.ResourceId.VideoId, channelId)
+			}
+			return false
+		})
+		if playlistStatus.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if playlistStatus.StatusCode != http.StatusOK {
+			return playlistStatus, found, nil
+		}
+		found = append(found, channelId)
+		active, err := t.activeStreams(channelId)
+		if err != nil {
+			return youtubeStatus, found, err
+		}
+		for _, state := range active {
+			addStream(state.Id, channelId)
+		}
+	}
+
+	// Query the candidates and record the ones that are streams.
+	now := time.Now().UTC()
+	for _, chunk := range chunkIds(ids, 50) {
+		if !budget.spend(1) {
+			return youtubeStatus, found, errBudgetExhausted
+		}
+		streamInbound, streamStatusCode, _ := queryStreams(t.input, strings.Join(chunk, ","), key)
+		if streamStatusCode.StatusCode != http.StatusOK {
+			return streamStatusCode, found, nil
+		}
+		for i, stream := range StreamParser(streamInbound).Streams {
+			if streamStatus(stream) == "video" {
+				continue
+			}
+			id := streamInbound.Items[i].Id
+			if err := t.recordStream(id, streamChannels[id], stream, now); err != nil {
+				return youtubeStatus, found, err
+			}
+		}
+	}
+	return youtubeStatus, found, nil
+}
+
+// Gives the IDs of all channels watched for streams.
+func (t *Tracker) liveChannelIds() ([]string, error) {
+	return t.store.Keys(liveChannelsCollection)
+}
+
+// WatchChannelLive checks a channel for streams using the given key, and starts watching it for streams with the key
+// if it exists. Watching a channel already watched keeps the key that started it. Gives back the status of the
+// queries, the quota used, and whether the channel was found.
+func (t *Tracker) WatchChannelLive(id string, key string) (StatusCodeOutbound, int, bool, error) {
+	budget := &jobBudget{}
+	youtubeStatus, found, err := t.detectStreams([]string{id}, key, budget)
+	if err != nil || youtubeStatus.StatusCode != http.StatusOK || len(found) == 0 {
+		return youtubeStatus, budget.used, false, err
+	}
+	var watched liveChannel
+	exists, err := t.store.Get(liveChannelsCollection, id, &watched)
+	if err != nil || exists {
+		return youtubeStatus, budget.used, true, err
+	}
+	return youtubeStatus, budget.used, true, t.store.Put(liveChannelsCollection, id,
+		liveChannel{Since: time.Now().UTC(), Key: key})
+}
+
+// UnwatchChannelLive stops watching a channel for streams, unless it was started with another key. Channels watched
+// before their key was kept can be unwatched with any key. States of its streams already known are kept. Gives back
+// false if the channel is watched with another key.
+func (t *Tracker) UnwatchChannelLive(id string, key string) (bool, error) {
+	var watched liveChannel
+	found, err := t.store.Get(liveChannelsCollection, id, &watched)
+	if err != nil || !found {
+		return true, err
+	}
+	if watched.Key != "" && watched.Key != key {
+		return false, nil
+	}
+	return true, t.store.Delete(liveChannelsCollection, id)
+}
+
+// ChannelLiveWatched checks whether a channel is currently watched for streams.
+func (t *Tracker) ChannelLiveWatched(id string) (bool, error) {
+	var watched liveChannel
+	return t.store.Get(liveChannelsCollection, id, &watched)
+}
+
+// ChannelStreams gives the streams of a channel last known to be scheduled or live, by scheduled start time.
+func (t *Tracker) ChannelStreams(id string) ([]interface{}, error) {
+	active, err := t.activeStreams(id)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]interface{}, len(active))
+	for i, state := range active {
+		streams[i] = state.Stream
+	}
+	return streams, nil
+}
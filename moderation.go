@@ -0,0 +1,429 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Store collection of channels whose moderation is logged, and store series of their moderation actions.
+const (
+	moderatedChannelsCollection = "moderated_channels"
+	moderationSeries            = "moderation"
+)
+
+// How many of the newest messages of a followed chat are kept, to give the text of messages when they are deleted.
+const moderationMessageCache = 2000
+
+// How often channels whose last followed chat ended are checked for a new live stream. Channels not watched for
+// streams through the channel live endpoint cost two quota per check.
+const moderationStreamCheckInterval = 5 * time.Minute
+
+// Statuses of following the chat of a channel for its moderation log.
+const (
+	moderationFollowing = "following"
+	moderationWaiting   = "waiting"
+	moderationEnded     = "ended"
+	moderationStopped   = "stopped"
+	moderationFailed    = "failed"
+)
+
+// ModerationLog logs the bans, timeouts, message deletions and member only mode changes in the live chats of
+// channels, along with the moderator who acted. The chat of the current live stream of a channel is followed through
+// the relay until it ends, keeping the page token after the last event seen, so that following is resumed from where
+// it left off when the server restarts. Once the chat ends, the channel waits for its next live stream, found through
+// the stream detection of the tracker, and follows its chat in turn until following is stopped with the key that
+// started it. Deletions are linked to the text and author of the deleted message if the message was seen earlier
+// while following the chat.
+type ModerationLog struct {
+	mutex    sync.Mutex
+	input    Inputs
+	store    Store
+	watchers map[string]*moderatedChat
+}
+
+// A channel whose moderation is logged, as stored, including the key polling its chat, which is never sent back.
+type moderatedChannel struct {
+	ChannelId   string    `json:"channel_id"`
+	VideoId     string    `json:"video_id"`
+	ChatId      string    `json:"chat_id"`
+	Key         string    `json:"key"`
+	Status      string    `json:"status"`
+	Page        string    `json:"page"`
+	LastEventId string    `json:"last_event_id"`
+	StartedAt   time.Time `json:"started_at"`
+	Error       string    `json:"error"`
+}
+
+// A chat currently followed for the moderation log of its channel, and the newest messages seen in it.
+type moderatedChat struct {
+	subscription *chatSubscription
+	stopped      bool
+	messages     map[string]ChatMessage
+	order        []string
+}
+
+// NewModerationLog creates a moderation log persisted in the given store, following chats through the relay of the
+// inputs.
+func NewModerationLog(input Inputs, store Store) *ModerationLog {
+	return &ModerationLog{input: input, store: store, watchers: make(map[string]*moderatedChat)}
+}
+
+// Keeps a message seen in a followed chat, forgetting the oldest message once the cache is full.
+func (c *moderatedChat) remember(message ChatMessage) {
+	if _, ok := c.messages[message.Id]; ok {
+		return
+	}
+	c.messages[message.Id] = message
+	c.order = append(c.order, message.Id)
+	if len(c.order) > moderationMessageCache {
+		delete(c.messages, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Gives the moderation action taken by a chat event parsed by ChatParser, and whether the event is one. Super chats
+// and messages are remembered, so that their text can be given when they are deleted.
+func (c *moderatedChat) action(channel moderatedChannel, event relayedEvent) (ModerationAction, bool) {
+	action := ModerationAction{
+		Id:      event.Id,
+		Time:    event.Time.Format(time.RFC3339),
+		VideoId: channel.VideoId,
+		ChatId:  channel.ChatId,
+	}
+	switch e := event.Event.(type) {
+	case ChatMessage:
+		c.remember(e)
+	case ChatSuperChat:
+		c.remember(ChatMessage{Id: e.Id, Type: e.Type, PublishedAt: e.PublishedAt, Message: e.Message,
+			Author: e.SentBy})
+	case ChatUserBanned:
+		action.Action = "ban"
+		if e.BanType == "temporary" {
+			action.Action = "timeout"
+			action.Duration = e.BanDuration
+		}
+		action.Moderator = e.BannedBy
+		user := e.BannedUser
+		action.User = &user
+		return action, true
+	case ChatMessageDeleted:
+		action.Action = "deletion"
+		action.Moderator = e.DeletedBy
+		action.MessageId = e.DeletedMessage
+		if message, ok := c.messages[e.DeletedMessage]; ok {
+			action.Message = message.Message
+			action.User = &message.Author
+		}
+		return action, true
+	case ChatMemberOnlyModeStarted:
+		action.Action = "members_only_started"
+		action.Moderator = e.StartedBy
+		return action, true
+	case ChatMemberOnlyModeEnded:
+		action.Action = "members_only_ended"
+		action.Moderator = e.EndedBy
+		return action, true
+	}
+	return action, false
+}
+
+// Reads the stored state of a channel whose moderation is logged.
+func (m *ModerationLog) readChannel(channelId string) (moderatedChannel, bool, error) {
+	var channel moderatedChannel
+	found, err := m.store.Get(moderatedChannelsCollection, channelId, &channel)
+	return channel, found, err
+}
+
+// Starts following the chat of a channel from its last page, unless it is already followed. Must be called with the
+// mutex held.
+func (m *ModerationLog) start(channel moderatedChannel) {
+	if _, ok := m.watchers[channel.ChannelId]; ok {
+		return
+	}
+	watcher := &moderatedChat{
+		subscription: m.input.Relay.subscribe(channel.ChatId, channel.Key, channel.Page, channel.LastEventId),
+		messages:     make(map[string]ChatMessage),
+	}
+	m.watchers[channel.ChannelId] = watcher
+	go m.run(channel, watcher)
+}
+
+// Logs the moderation actions in a followed chat until the chat ends, polling fails, or following is stopped. The
+// state of the channel is saved whenever all events received so far are logged, and is left to Stop once stopped.
+func (m *ModerationLog) run(channel moderatedChannel, watcher *moderatedChat) {
+	for {
+		event, ok := <-watcher.subscription.events
+		m.mutex.Lock()
+		if watcher.stopped {
+			m.mutex.Unlock()
+			watcher.subscription.close()
+			return
+		}
+		switch {
+		case !ok:
+			channel.Status = moderationFailed
+			channel.Error = "fellBehind"
+		case event.Type == relayErrorEvent:
+			status, _ := event.Event.(StatusCodeOutbound)
+			channel.Status = moderationFailed
+			channel.Error = status.StatusMessage
+		default:
+			if action, isAction := watcher.action(channel, event); isAction {
+				err := m.store.Append(moderationSeries, channel.ChannelId, event.Time, action)
+				if err != nil {
+					log.Printf("Failed to log moderation action %s of %s: %v", event.Id, channel.ChannelId, err)
+				}
+			}
+			channel.Page = event.Page
+			channel.LastEventId = event.Id
+			if event.Type == "chat_ended" && m.input.Tracker != nil {
+				channel.Status = moderationWaiting
+			} else if event.Type == "chat_ended" {
+				channel.Status = moderationEnded
+			}
+		}
+		if channel.Status != moderationFollowing && m.watchers[channel.ChannelId] == watcher {
+			delete(m.watchers, channel.ChannelId)
+		}
+		if channel.Status != moderationFollowing || len(watcher.subscription.events) == 0 {
+			if err := m.store.Put(moderatedChannelsCollection, channel.ChannelId, channel); err != nil {
+				log.Printf("Failed to save moderation log state of %s: %v", channel.ChannelId, err)
+			}
+		}
+		m.mutex.Unlock()
+		if channel.Status != moderationFollowing {
+			watcher.subscription.close()
+			return
+		}
+	}
+}
+
+// Resume resumes following the chats of all channels that were still followed when the server stopped, from the
+// page they left off on.
+func (m *ModerationLog) Resume() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ids, err := m.store.Keys(moderatedChannelsCollection)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		channel, found, err := m.readChannel(id)
+		if err != nil {
+			return err
+		}
+		if found && channel.Status == moderationFollowing {
+			m.start(channel)
+		}
+	}
+	return nil
+}
+
+// Follow starts logging the moderation of the current live stream of a channel using the given key, unless its chat
+// is already followed. Gives back the status of looking up the live stream, and the quota used.
+func (m *ModerationLog) Follow(channelId string, key string) (StatusCodeOutbound, int, error) {
+	youtubeStatus := StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}
+	m.mutex.Lock()
+	_, following := m.watchers[channelId]
+	m.mutex.Unlock()
+	if following {
+		return youtubeStatus, 0, nil
+	}
+	stream, youtubeStatus, quota := m.input.Resolver.channel(m.input, channelId, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, following := m.watchers[channelId]; following {
+		return youtubeStatus, quota, nil
+	}
+	channel := moderatedChannel{
+		ChannelId: channelId,
+		VideoId:   stream.videoId,
+		ChatId:    stream.chatId,
+		Key:       key,
+		Status:    moderationFollowing,
+		StartedAt: time.Now().UTC(),
+	}
+	if err := m.store.Put(moderatedChannelsCollection, channelId, channel); err != nil {
+		return youtubeStatus, quota, err
+	}
+	m.start(channel)
+	return youtubeStatus, quota, nil
+}
+
+// Stop stops following the chat of a channel or waiting for its next live stream, keeping its moderation log. Gives
+// back false if the moderation of the channel was never logged, or was started with another key.
+func (m *ModerationLog) Stop(channelId string, key string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	channel, found, err := m.readChannel(channelId)
+	if err != nil || !found || channel.Key != key {
+		return false, err
+	}
+	watcher, following := m.watchers[channelId]
+	if !following && channel.Status != moderationWaiting {
+		return true, nil
+	}
+	if following {
+		watcher.stopped = true
+		delete(m.watchers, channelId)
+	}
+	channel.Status = moderationStopped
+	if err := m.store.Put(moderatedChannelsCollection, channelId, channel); err != nil {
+		return true, err
+	}
+	if following {
+		watcher.subscription.close()
+	}
+	return true, nil
+}
+
+// Gives the ID of a live stream of a channel other than the given one, or "" if there is none. The streams found by
+// the checks of channels watched for streams are used if the channel is watched, and the channel is checked with
+// the given key otherwise.
+func (m *ModerationLog) nextLiveStream(channelId string, previousId string, key string) (string, error) {
+	tracker := m.input.Tracker
+	watched, err := tracker.ChannelLiveWatched(channelId)
+	if err != nil {
+		return "", err
+	}
+	if !watched {
+		youtubeStatus, _, err := tracker.detectStreams([]string{channelId}, key, &jobBudget{})
+		if err != nil {
+			return "", err
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return "", err
+		}
+	}
+	active, err := tracker.activeStreams(channelId)
+	if err != nil {
+		return "", err
+	}
+	for _, state := range active {
+		if state.Status == "live" && state.Id != previousId {
+			return state.Id, nil
+		}
+	}
+	return "", nil
+}
+
+// Gives the channels waiting for a new live stream. Must be called with the mutex held.
+func (m *ModerationLog) waitingChannels() ([]moderatedChannel, error) {
+	ids, err := m.store.Keys(moderatedChannelsCollection)
+	if err != nil {
+		return nil, err
+	}
+	var waiting []moderatedChannel
+	for _, id := range ids {
+		channel, found, err := m.readChannel(id)
+		if err != nil {
+			return nil, err
+		}
+		if found && channel.Status == moderationWaiting {
+			waiting = append(waiting, channel)
+		}
+	}
+	return waiting, nil
+}
+
+// CheckStreams looks for a new live stream of each channel waiting for one since its last followed chat ended, and
+// starts following the chat of the stream found.
+func (m *ModerationLog) CheckStreams() {
+	if m.input.Tracker == nil {
+		return
+	}
+	m.mutex.Lock()
+	waiting, err := m.waitingChannels()
+	m.mutex.Unlock()
+	if err != nil {
+		log.Printf("Failed to read channels waiting for streams to log moderation of: %v", err)
+		return
+	}
+	for _, channel := range waiting {
+		videoId, err := m.nextLiveStream(channel.ChannelId, channel.VideoId, channel.Key)
+		if err != nil {
+			log.Printf("Failed to check %s for a new stream to log moderation of: %v", channel.ChannelId, err)
+			continue
+		}
+		if videoId == "" {
+			continue
+		}
+		stream, youtubeStatus, _ := m.input.Resolver.video(m.input, videoId, channel.Key)
+		if err := youtubeError(youtubeStatus); err != nil {
+			log.Printf("Failed to look up the chat of stream %s: %v", videoId, err)
+			continue
+		}
+		m.mutex.Lock()
+		err = m.followStream(channel.ChannelId, stream)
+		m.mutex.Unlock()
+		if err != nil {
+			log.Printf("Failed to follow stream %s to log moderation of: %v", videoId, err)
+		}
+	}
+}
+
+// Starts following the chat of a new live stream of a channel, unless the channel stopped waiting for one. Must be
+// called with the mutex held.
+func (m *ModerationLog) followStream(channelId string, stream liveChat) error {
+	channel, found, err := m.readChannel(channelId)
+	if err != nil || !found || channel.Status != moderationWaiting {
+		return err
+	}
+	channel.VideoId = stream.videoId
+	channel.ChatId = stream.chatId
+	channel.Status = moderationFollowing
+	channel.Page = ""
+	channel.LastEventId = ""
+	channel.Error = ""
+	if err := m.store.Put(moderatedChannelsCollection, channelId, channel); err != nil {
+		return err
+	}
+	m.start(channel)
+	return nil
+}
+
+// Run checks the channels waiting for a new live stream every check interval. Never returns.
+func (m *ModerationLog) Run() {
+	for range time.Tick(moderationStreamCheckInterval) {
+		m.CheckStreams()
+	}
+}
+
+// Log gives the moderation actions logged on a channel within a time range, where zero times leave the range open,
+// in the order they were taken. If a user ID is given, only the actions on that user or by that moderator are
+// given. Gives back false if the moderation of the channel was never logged.
+func (m *ModerationLog) Log(channelId string, userId string, since time.Time, until time.Time) (ModerationLogOutbound,
+	bool, error) {
+	outbound := ModerationLogOutbound{ChannelId: channelId, Actions: []ModerationAction{}}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	channel, found, err := m.readChannel(channelId)
+	if err != nil || !found {
+		return outbound, found, err
+	}
+	_, outbound.Following = m.watchers[channelId]
+	outbound.VideoId = channel.VideoId
+	outbound.ChatId = channel.ChatId
+	outbound.Status = channel.Status
+	outbound.Error = channel.Error
+	values, err := m.store.Range(moderationSeries, channelId, since, until)
+	if err != nil {
+		return outbound, true, err
+	}
+	for _, value := range values {
+		var action ModerationAction
+		if err := json.Unmarshal(value, &action); err != nil {
+			return outbound, true, err
+		}
+		if userId == "" || action.Moderator.UserId == userId || (action.User != nil && action.User.UserId == userId) {
+			outbound.Actions = append(outbound.Actions, action)
+		}
+	}
+	return outbound, true, nil
+}
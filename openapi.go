@@ -0,0 +1,32 @@
+package yt_stats
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// The OpenAPI 3 specification of the API, kept next to structs.go so changes to either are made together.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler is the handler for the OpenAPI specification endpoint. /ytstats/v1/openapi.json
+// Provides the OpenAPI 3 document describing every endpoint, parameter, response and error of the API.
+func OpenAPIHandler(input Inputs) http.Handler {
+	spec := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write(openAPISpec)
+			if err != nil {
+				log.Println("Failed to respond to openapi endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(spec)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -97,6 +98,67 @@ func ChannelParser(inbound ChannelInbound) ChannelOutbound {
 	return outbound
 }
 
+// ChannelPartsParser parses the requested optional parts of a ChannelInbound struct into an already parsed
+// ChannelOutbound struct. Channels are matched on ID, as the order of both is the same.
+func ChannelPartsParser(inbound ChannelInbound, outbound *ChannelOutbound, parts map[string]bool) {
+	for i, rawChannel := range inbound.Items {
+		if i >= len(outbound.Channels) || outbound.Channels[i].Id != rawChannel.Id {
+			log.Printf("failed to match optional parts for %s", rawChannel.Id)
+			continue
+		}
+		channel := &outbound.Channels[i]
+		if parts["details"] {
+			channel.CustomUrl = rawChannel.Snippet.CustomUrl
+			channel.PublishedAt = rawChannel.Snippet.PublishedAt
+		}
+		if parts["thumbnails"] {
+			thumbnails := rawChannel.Snippet.Thumbnails
+			channel.Thumbnails = &ChannelThumbnails{
+				Default: Thumbnail(thumbnails.Default),
+				Medium:  Thumbnail(thumbnails.Medium),
+				High:    Thumbnail(thumbnails.High),
+			}
+		}
+		if parts["branding"] {
+			branding := rawChannel.BrandingSettings
+			channel.Branding = &ChannelBranding{
+				Keywords:            splitKeywords(branding.Channel.Keywords),
+				UnsubscribedTrailer: branding.Channel.UnsubscribedTrailer,
+				DefaultLanguage:     branding.Channel.DefaultLanguage,
+				Banner:              branding.Image.BannerExternalUrl,
+			}
+		}
+		if parts["topics"] {
+			channel.Topics = &ChannelTopics{
+				TopicIds:        rawChannel.TopicDetails.TopicIds,
+				TopicCategories: rawChannel.TopicDetails.TopicCategories,
+			}
+		}
+		if parts["status"] {
+			channel.Status = &ChannelStatus{
+				PrivacyStatus:           rawChannel.Status.PrivacyStatus,
+				IsLinked:                rawChannel.Status.IsLinked,
+				LongUploadsStatus:       rawChannel.Status.LongUploadsStatus,
+				MadeForKids:             rawChannel.Status.MadeForKids,
+				SelfDeclaredMadeForKids: rawChannel.Status.SelfDeclaredMadeForKids,
+			}
+		}
+		if parts["localizations"] {
+			channel.Localizations = []ChannelLocalization{}
+			for language, localization := range rawChannel.Localizations {
+				channel.Localizations = append(channel.Localizations, ChannelLocalization{
+					Language:    language,
+					Title:       localization.Title,
+					Description: localization.Description,
+				})
+			}
+			sort.Slice(channel.Localizations, func(i int, j int) bool {
+				return channel.Localizations[i].Language < channel.Localizations[j].Language
+			})
+		}
+	}
+}
+
 // PlaylistTopLevelParser parses a PlaylistInbound struct to a PlaylistOutbound struct.
 func PlaylistTopLevelParser(inbound PlaylistInbound) PlaylistOutbound {
 	var outbound PlaylistOutbound
@@ -114,6 +176,25 @@ func PlaylistTopLevelParser(inbound PlaylistInbound) PlaylistOutbound {
 	return outbound
 }
 
+// SectionsParser parses a SectionsInbound struct to a SectionsOutbound struct, ordered by position on the channel.
+func SectionsParser(inbound SectionsInbound, channelId string) SectionsOutbound {
+	var outbound SectionsOutbound
+	outbound.ChannelId = channelId
+	outbound.Sections = make([]Section, len(inbound.Items))
+	for i, inboundSection := range inbound.Items {
+		outbound.Sections[i].Id = inboundSection.Id
+		outbound.Sections[i].Type = inboundSection.Snippet.Type
+		outbound.Sections[i].Title = inboundSection.Snippet.Title
+		outbound.Sections[i].Position = inboundSection.Snippet.Position
+		outbound.Sections[i].Playlists = inboundSection.ContentDetails.Playlists
+		outbound.Sections[i].Channels = inboundSection.ContentDetails.Channels
+	}
+	sort.SliceStable(outbound.Sections, func(i int, j int) bool {
+		return outbound.Sections[i].Position < outbound.Sections[j].Position
+	})
+	return outbound
+}
+
 // PlaylistItemsParser parses a slice of PlaylistItemInbound structs to a slice of string slices including all the video IDs.
 func PlaylistItemsParser(inbound []PlaylistItemsInbound) [][]string {
 	var outbound [][]string
@@ -214,7 +295,9 @@ func VideoParser(inbound []VideoInbound, playlistObject *Playlist, stats bool, v
 	}
 
 	// Handle average statistics.
-	if stats {
+	if stats && vStats.AvailableVideos == 0 {
+		playlistObject.VideoStats = &vStats
+	} else if stats {
 		vStats.AverageVideoDuration = vStats.TotalLength / vStats.AvailableVideos
 		vStats.AverageViews = vStats.TotalViews / vStats.AvailableVideos
 		vStats.AverageLikes = totalLikes / vStats.AvailableVideos
@@ -329,17 +412,18 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 	outbound.ChatId = chatId
 	outbound.NextPage = inbound.NextPageToken
 	outbound.SuggestedCooldown = inbound.PollingIntervalMillis
-	outbound.ChatEvents = make([]interface{}, len(inbound.Items))
-	for i, event := range inbound.Items {
+	outbound.ChatEvents = make([]interface{}, 0, len(inbound.Items))
+	for _, event := range inbound.Items {
+		var chatEvent interface{}
 		switch event.Snippet.Type {
 		case "chatEndedEvent":
-			outbound.ChatEvents[i] = ChatEnded{
+			chatEvent = ChatEnded{
 				Id:          event.Id,
 				Type:        "chat_ended",
 				PublishedAt: event.Snippet.PublishedAt,
 			}
 		case "giftMembershipReceivedEvent":
-			outbound.ChatEvents[i] = ChatMembershipGiftReceived{
+			chatEvent = ChatMembershipGiftReceived{
 				Id:            event.Id,
 				Type:          "gift_membership_received",
 				PublishedAt:   event.Snippet.PublishedAt,
@@ -358,7 +442,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "membershipGiftingEvent":
-			outbound.ChatEvents[i] = ChatMembershipGifting{
+			chatEvent = ChatMembershipGifting{
 				Id:          event.Id,
 				Type:        "memberships_gifted",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -376,7 +460,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "messageDeletedEvent":
-			outbound.ChatEvents[i] = ChatMessageDeleted{
+			chatEvent = ChatMessageDeleted{
 				Id:             event.Id,
 				Type:           "message_deleted",
 				PublishedAt:    event.Snippet.PublishedAt,
@@ -392,7 +476,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "newSponsorEvent":
-			outbound.ChatEvents[i] = ChatNewMember{
+			chatEvent = ChatNewMember{
 				Id:          event.Id,
 				Type:        "new_member",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -410,7 +494,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "memberMilestoneChatEvent":
-			outbound.ChatEvents[i] = ChatMemberMilestone{
+			chatEvent = ChatMemberMilestone{
 				Id:          event.Id,
 				Type:        "membership_milestone",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -429,7 +513,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "sponsorOnlyModeEndedEvent":
-			outbound.ChatEvents[i] = ChatMemberOnlyModeEnded{
+			chatEvent = ChatMemberOnlyModeEnded{
 				Id:          event.Id,
 				Type:        "member_only_off",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -444,7 +528,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "sponsorOnlyModeStartedEvent":
-			outbound.ChatEvents[i] = ChatMemberOnlyModeStarted{
+			chatEvent = ChatMemberOnlyModeStarted{
 				Id:          event.Id,
 				Type:        "member_only_on",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -461,13 +545,15 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 		case "superChatEvent":
 			amountMicros, err := strconv.ParseFloat(event.Snippet.SuperChatDetails.AmountMicros, 64)
 			if err == nil {
-				outbound.ChatEvents[i] = ChatSuperChat{
-					Id:          event.Id,
-					Type:        "superchat",
-					PublishedAt: event.Snippet.PublishedAt,
-					Message:     event.Snippet.SuperChatDetails.UserComment,
-					Amount:      amountMicros / 1000000,
-					Currency:    event.Snippet.SuperChatDetails.Currency,
+				chatEvent = ChatSuperChat{
+					Id:            event.Id,
+					Type:          "superchat",
+					PublishedAt:   event.Snippet.PublishedAt,
+					Message:       event.Snippet.SuperChatDetails.UserComment,
+					Amount:        amountMicros / 1000000,
+					Currency:      event.Snippet.SuperChatDetails.Currency,
+					AmountDisplay: event.Snippet.SuperChatDetails.AmountDisplayString,
+					Tier:          event.Snippet.SuperChatDetails.Tier,
 					SentBy: ChatUser{
 						UserName:       event.AuthorDetails.DisplayName,
 						UserId:         event.AuthorDetails.ChannelId,
@@ -480,16 +566,19 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				}
 			}
 		case "superStickerEvent":
-			amountMicros, err := strconv.ParseFloat(event.Snippet.SuperChatDetails.AmountMicros, 64)
+			amountMicros, err := strconv.ParseFloat(event.Snippet.SuperStickerDetails.AmountMicros, 64)
 			if err == nil {
-				outbound.ChatEvents[i] = ChatSuperSticker{
-					Id:          event.Id,
-					Type:        "supersticker",
-					PublishedAt: event.Snippet.PublishedAt,
-					Amount:      amountMicros / 1000000,
-					Currency:    event.Snippet.SuperStickerDetails.Currency,
-					StickerId:   event.Snippet.SuperStickerDetails.SuperStickerMetadata.StickerId,
-					AltText:     event.Snippet.SuperStickerDetails.SuperStickerMetadata.AltText,
+				chatEvent = ChatSuperSticker{
+					Id:            event.Id,
+					Type:          "supersticker",
+					PublishedAt:   event.Snippet.PublishedAt,
+					Amount:        amountMicros / 1000000,
+					Currency:      event.Snippet.SuperStickerDetails.Currency,
+					AmountDisplay: event.Snippet.SuperStickerDetails.AmountDisplayString,
+					Tier:          event.Snippet.SuperStickerDetails.Tier,
+					StickerId:     event.Snippet.SuperStickerDetails.SuperStickerMetadata.StickerId,
+					AltText:       event.Snippet.SuperStickerDetails.SuperStickerMetadata.AltText,
+					Language:      event.Snippet.SuperStickerDetails.SuperStickerMetadata.Language,
 					SentBy: ChatUser{
 						UserName:       event.AuthorDetails.DisplayName,
 						UserId:         event.AuthorDetails.ChannelId,
@@ -502,7 +591,7 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				}
 			}
 		case "textMessageEvent":
-			outbound.ChatEvents[i] = ChatMessage{
+			chatEvent = ChatMessage{
 				Id:          event.Id,
 				Type:        "message",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -518,13 +607,13 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 				},
 			}
 		case "tombstone":
-			outbound.ChatEvents[i] = ChatTombstone{
+			chatEvent = ChatTombstone{
 				Id:          event.Id,
 				Type:        "tombstone",
 				PublishedAt: event.Snippet.PublishedAt,
 			}
 		case "userBannedEvent":
-			outbound.ChatEvents[i] = ChatUserBanned{
+			chatEvent = ChatUserBanned{
 				Id:          event.Id,
 				Type:        "ban",
 				PublishedAt: event.Snippet.PublishedAt,
@@ -545,12 +634,16 @@ func ChatParser(inbound ChatInbound, chatId string) ChatOutbound {
 					Verified:       event.AuthorDetails.IsVerified,
 				},
 			}
-		default:
-			outbound.ChatEvents[i] = ChatUnknownEvent{
+		}
+
+		// Events of unknown types, and events that could not be parsed, are passed on as they are.
+		if chatEvent == nil {
+			chatEvent = ChatUnknownEvent{
 				Type:  "unknown",
 				Event: event,
 			}
 		}
+		outbound.ChatEvents = append(outbound.ChatEvents, chatEvent)
 	}
 	return outbound
 }
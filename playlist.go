@@ -2,10 +2,8 @@ package yt_stats
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
 )
 
@@ -18,8 +16,6 @@ func PlaylistHandler(input Inputs) http.Handler {
 		case http.MethodGet:
 
 			// Check user input and fail if input is incorrect or missing.
-			var youtubeStatus StatusCodeOutbound
-			var playlistInbound PlaylistInbound
 			key := getKey(r)
 			if key == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
@@ -46,18 +42,9 @@ func PlaylistHandler(input Inputs) http.Handler {
 			}
 
 			// Query youtube playlist endpoint and check response for errors.
-			resp, err := http.Get(fmt.Sprintf("%s&id=%s&key=%s", input.PlaylistsRoot, url.QueryEscape(ids), key))
-			if err != nil {
-				sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-				return
-			}
-			defer resp.Body.Close()
-			quota++
-			youtubeStatus = ErrorParser(resp.Body, &playlistInbound)
+			playlistInbound, youtubeStatus, cost := queryPlaylists(input, ids, key)
+			quota += cost
 			if youtubeStatus.StatusCode != http.StatusOK {
-				if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-					quota--
-				}
 				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
 				return
 			}
@@ -67,78 +54,28 @@ func PlaylistHandler(input Inputs) http.Handler {
 			if videosFlag == "false" && statsFlag == "false" {
 				plOutbound.QuotaUsage = quota
 				w.Header().Set("Content-Type", "application/json")
-				err = json.NewEncoder(w).Encode(plOutbound)
+				err := json.NewEncoder(w).Encode(plOutbound)
 				if err != nil {
 					log.Println("Failed to respond to playlist endpoint.")
 				}
 				return
 			}
 
-			// For all playlists query playlist items endpoint and handle pagination.
+			// For all playlists query playlist items and videos endpoints, and parse videos and statistics.
 			for i := range plOutbound.Playlists {
-				pageToken := ""
-				var playlistItemsInbound []PlaylistItemsInbound
-				for hasNextPage := true; hasNextPage; hasNextPage = pageToken != "" {
-					var playlistItemPageInbound PlaylistItemsInbound
-					ok := func() bool { // Internal function for deferring the closing of response bodies inside loop.
-						resp, err = http.Get(fmt.Sprintf("%s&playlistId=%s&key=%s&pageToken=%s",
-							input.PlaylistItemsRoot, plOutbound.Playlists[i].Id, key, pageToken))
-						if err != nil {
-							sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-							return false
-						}
-						defer resp.Body.Close()
-						quota++
-						youtubeStatus = ErrorParser(resp.Body, &playlistItemPageInbound)
-						if youtubeStatus.StatusCode != http.StatusOK {
-							sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
-							return false
-						}
-						pageToken = playlistItemPageInbound.NextPageToken
-						playlistItemsInbound = append(playlistItemsInbound, playlistItemPageInbound)
-						return true
-					}
-					if !ok() {
-						return
-					}
-				}
-
-				// Parse video IDs from playlist items endpoint response, query youtube videos endpoint and parse.
-				videoIds := PlaylistItemsParser(playlistItemsInbound)
-				var videoInbound []VideoInbound
-				for _, page := range videoIds {
-					var videoInboundPage VideoInbound
-					ok := func() bool {
-						videoPageIds := url.QueryEscape(strings.Join(page, ","))
-						resp, err = http.Get(fmt.Sprintf("%s&id=%s&key=%s", input.VideosRoot, videoPageIds, key))
-						if err != nil {
-							sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-							return false
-						}
-						defer resp.Body.Close()
-						quota++
-						youtubeStatus = ErrorParser(resp.Body, &videoInboundPage)
-						if youtubeStatus.StatusCode != http.StatusOK {
-							sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
-							return false
-						}
-						videoInbound = append(videoInbound, videoInboundPage)
-						return true
-					}()
-					if !ok {
-						return
-					}
-				}
-				err = VideoParser(videoInbound, &plOutbound.Playlists[i], statsFlag != "false", videosFlag != "false")
-				if err != nil {
-					sendStatusCode(w, quota, http.StatusInternalServerError, "failedParsingYouTubeResponse")
+				youtubeStatus, cost = queryPlaylistVideos(input, key, &plOutbound.Playlists[i],
+					statsFlag != "false", videosFlag != "false")
+				quota += cost
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
 				}
 			}
 
 			// Provide response.
 			plOutbound.QuotaUsage = quota
 			w.Header().Set("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(plOutbound)
+			err := json.NewEncoder(w).Encode(plOutbound)
 			if err != nil {
 				log.Println("Failed to respond to playlist endpoint.")
 			}
@@ -0,0 +1,238 @@
+package yt_stats
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Queries a YouTube endpoint and parses the response into the provided struct.
+// Returns the status of the query and the quota it cost. Quota cannot be deducted from invalid keys.
+func youtubeQuery(u string, s interface{}, cost int) (StatusCodeOutbound, int) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return StatusCodeOutbound{
+			StatusCode:    http.StatusInternalServerError,
+			StatusMessage: "failedToQueryYouTubeAPI",
+		}, 0
+	}
+	defer resp.Body.Close()
+	youtubeStatus := ErrorParser(resp.Body, s)
+	if youtubeStatus.StatusMessage == "keyInvalid" {
+		return youtubeStatus, 0
+	}
+	return youtubeStatus, cost
+}
+
+// Queries the YouTube Channels endpoint for up to 50 comma separated channel IDs.
+// The YouTube parts needed by the requested optional channel parts are queried in addition to the default ones.
+func queryChannels(input Inputs, ids string, key string,
+	parts map[string]bool) (ChannelInbound, StatusCodeOutbound, int) {
+	var channelInbound ChannelInbound
+	root := input.ChannelsRoot
+	var youtubeParts []string
+	for part := range parts {
+		if youtubePart := channelParts[part]; youtubePart != "" {
+			youtubeParts = append(youtubeParts, youtubePart)
+		}
+	}
+	if len(youtubeParts) > 0 {
+		sort.Strings(youtubeParts)
+		root = strings.Replace(root, "part=", "part="+strings.Join(youtubeParts, ",")+",", 1)
+	}
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&id=%s&key=%s",
+		root, url.QueryEscape(ids), key), &channelInbound, 1)
+	return channelInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube Playlists endpoint for up to 50 comma separated playlist IDs.
+func queryPlaylists(input Inputs, ids string, key string) (PlaylistInbound, StatusCodeOutbound, int) {
+	var playlistInbound PlaylistInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&id=%s&key=%s",
+		input.PlaylistsRoot, url.QueryEscape(ids), key), &playlistInbound, 1)
+	return playlistInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube Playlists endpoint for all pages of public playlists owned by a channel.
+func queryChannelPlaylists(input Inputs, channelId string, key string) (PlaylistInbound, StatusCodeOutbound, int) {
+	quota := 0
+	pageToken := ""
+	var playlistInbound PlaylistInbound
+	for hasNextPage := true; hasNextPage; hasNextPage = pageToken != "" {
+		var playlistPageInbound PlaylistInbound
+		youtubeStatus, cost := youtubeQuery(fmt.Sprintf("%s&channelId=%s&key=%s&pageToken=%s",
+			input.PlaylistsRoot, url.QueryEscape(channelId), key, pageToken), &playlistPageInbound, 1)
+		quota += cost
+		if youtubeStatus.StatusCode != http.StatusOK {
+			return playlistInbound, youtubeStatus, quota
+		}
+		pageToken = playlistPageInbound.NextPageToken
+		playlistInbound.Items = append(playlistInbound.Items, playlistPageInbound.Items...)
+	}
+	return playlistInbound, StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}, quota
+}
+
+// Queries the YouTube ChannelSections endpoint for the sections of a channel.
+func querySections(input Inputs, channelId string, key string) (SectionsInbound, StatusCodeOutbound, int) {
+	var sectionsInbound SectionsInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&channelId=%s&key=%s",
+		input.SectionsRoot, url.QueryEscape(channelId), key), &sectionsInbound, 1)
+	return sectionsInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube PlaylistItems endpoint page by page, handing each page to the provided function.
+// Stops paginating once there are no more pages, or once the function returns false.
+func walkPlaylistItems(input Inputs, id string, key string,
+	f func(PlaylistItemsInbound) bool) (StatusCodeOutbound, int) {
+	quota := 0
+	pageToken := ""
+	for hasNextPage := true; hasNextPage; hasNextPage = pageToken != "" {
+		var playlistItemPageInbound PlaylistItemsInbound
+		youtubeStatus, cost := youtubeQuery(fmt.Sprintf("%s&playlistId=%s&key=%s&pageToken=%s",
+			input.PlaylistItemsRoot, id, key, pageToken), &playlistItemPageInbound, 1)
+		quota += cost
+		if youtubeStatus.StatusCode != http.StatusOK {
+			return youtubeStatus, quota
+		}
+		pageToken = playlistItemPageInbound.NextPageToken
+		if !f(playlistItemPageInbound) {
+			break
+		}
+	}
+	return StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}, quota
+}
+
+// Queries the YouTube PlaylistItems endpoint for all pages of a playlist, and returns the video IDs page by page.
+func queryPlaylistItems(input Inputs, id string, key string) ([][]string, StatusCodeOutbound, int) {
+	var playlistItemsInbound []PlaylistItemsInbound
+	youtubeStatus, quota := walkPlaylistItems(input, id, key, func(page PlaylistItemsInbound) bool {
+		playlistItemsInbound = append(playlistItemsInbound, page)
+		return true
+	})
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return nil, youtubeStatus, quota
+	}
+	return PlaylistItemsParser(playlistItemsInbound), youtubeStatus, quota
+}
+
+// Queries the YouTube Videos endpoint for up to 50 comma separated video IDs.
+func queryVideos(input Inputs, ids string, key string) (VideoInbound, StatusCodeOutbound, int) {
+	var videoInbound VideoInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&id=%s&key=%s",
+		input.VideosRoot, url.QueryEscape(ids), key), &videoInbound, 1)
+	return videoInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube Videos endpoint for pages of up to 50 video IDs each, one request per page.
+func queryVideoPages(input Inputs, pages [][]string, key string) ([]VideoInbound, StatusCodeOutbound, int) {
+	quota := 0
+	var videoInbound []VideoInbound
+	for _, page := range pages {
+		videoInboundPage, youtubeStatus, cost := queryVideos(input, strings.Join(page, ","), key)
+		quota += cost
+		if youtubeStatus.StatusCode != http.StatusOK {
+			return nil, youtubeStatus, quota
+		}
+		videoInbound = append(videoInbound, videoInboundPage)
+	}
+	return videoInbound, StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}, quota
+}
+
+// Queries the YouTube Videos endpoint for live streaming details of up to 50 comma separated video IDs.
+func queryStreams(input Inputs, ids string, key string) (StreamInbound, StatusCodeOutbound, int) {
+	var streamInbound StreamInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&id=%s&key=%s",
+		input.StreamRoot, url.QueryEscape(ids), key), &streamInbound, 1)
+	return streamInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube liveChatMessages endpoint for one page of chat events.
+func queryChat(input Inputs, id string, key string, page string) (ChatInbound, StatusCodeOutbound, int) {
+	var chatInbound ChatInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&liveChatId=%s&key=%s&pageToken=%s",
+		input.ChatRoot, url.QueryEscape(id), key, page), &chatInbound, 5)
+	return chatInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube CommentThreads endpoint for the newest page of comment threads on a video.
+func queryLatestComments(input Inputs, id string, key string) (CommentsInbound, StatusCodeOutbound, int) {
+	var commentsInbound CommentsInbound
+	youtubeStatus, quota := youtubeQuery(fmt.Sprintf("%s&order=time&videoId=%s&key=%s",
+		input.CommentsRoot, url.QueryEscape(id), key), &commentsInbound, 1)
+	return commentsInbound, youtubeStatus, quota
+}
+
+// Queries the YouTube CommentThreads and Comments endpoints for all comments and replies on a video.
+// Replies that are not included with their comment thread are retrieved by concurrent workers.
+func queryComments(input Inputs, id string, key string) ([]interface{}, StatusCodeOutbound, int) {
+	workers := 10
+	quota := 0
+	var comments []interface{}
+	var needReplies []string
+	pageToken := ""
+	for hasNextPage := true; hasNextPage; hasNextPage = pageToken != "" {
+		var commentsInbound CommentsInbound
+		youtubeStatus, cost := youtubeQuery(fmt.Sprintf("%s&videoId=%s&key=%s&pageToken=%s",
+			input.CommentsRoot, id, key, pageToken), &commentsInbound, 1)
+		quota += cost
+		if youtubeStatus.StatusCode != http.StatusOK {
+			return nil, youtubeStatus, quota
+		}
+		CommentsParser(commentsInbound, &comments, &needReplies)
+		pageToken = commentsInbound.NextPageToken
+	}
+
+	// Starts workers querying and handling pagination for all needed replies.
+	replyIds := make(chan string, len(needReplies))
+	for _, comId := range needReplies {
+		replyIds <- comId
+	}
+	close(replyIds)
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	var add sync.Mutex
+	workerResponses := make(chan StatusCodeOutbound, workers)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ { // Launch workers.
+		go func() {
+			n := worker(replyIds, &comments, workerResponses, &mut, input, key)
+			add.Lock()
+			quota += n
+			add.Unlock()
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	close(workerResponses)
+	for response := range workerResponses {
+		if response.StatusCode != http.StatusOK {
+			return nil, response, quota
+		}
+	}
+	return comments, StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}, quota
+}
+
+// Queries all videos of a playlist and parses them, and optionally statistics on them, into the playlist.
+func queryPlaylistVideos(input Inputs, key string, playlist *Playlist, stats bool,
+	videos bool) (StatusCodeOutbound, int) {
+	videoIds, youtubeStatus, quota := queryPlaylistItems(input, playlist.Id, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota
+	}
+	videoInbound, youtubeStatus, cost := queryVideoPages(input, videoIds, key)
+	quota += cost
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota
+	}
+	err := VideoParser(videoInbound, playlist, stats, videos)
+	if err != nil {
+		return StatusCodeOutbound{
+			StatusCode:    http.StatusInternalServerError,
+			StatusMessage: "failedParsingYouTubeResponse",
+		}, quota
+	}
+	return youtubeStatus, quota
+}
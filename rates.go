@@ -0,0 +1,212 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExchangeRates converts amounts between currencies using a table of exchange rates supplied by the operator in a
+// JSON file. The table holds a history of rates, each set dated from the day it takes effect, and is reloaded when
+// the file changes. If a changed file is invalid, the previous table is kept.
+type ExchangeRates struct {
+	mutex    sync.Mutex
+	path     string
+	modified time.Time
+	table    exchangeRateTable
+}
+
+// The exchange rate file. Rates are units of each currency per unit of the base currency.
+type exchangeRateTable struct {
+	Base  string            `json:"base"`
+	Rates []ExchangeRateSet `json:"rates"`
+}
+
+// NewExchangeRates loads the exchange rates in the given file, failing if the file is missing or invalid.
+func NewExchangeRates(path string) (*ExchangeRates, error) {
+	rates := &ExchangeRates{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	rates.table, err = readExchangeRates(path)
+	if err != nil {
+		return nil, err
+	}
+	rates.modified = info.ModTime()
+	return rates, nil
+}
+
+// Reads and validates an exchange rate file, giving back its table with the currency codes in upper case and the
+// sets of rates ordered by date.
+func readExchangeRates(path string) (exchangeRateTable, error) {
+	var table exchangeRateTable
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return table, err
+	}
+	err = json.Unmarshal(raw, &table)
+	if err != nil {
+		return table, err
+	}
+	table.Base = strings.ToUpper(table.Base)
+	if table.Base == "" {
+		return table, errors.New("no base currency")
+	}
+	for i, set := range table.Rates {
+		if _, err := time.Parse("2006-01-02", set.Date); err != nil {
+			return table, fmt.Errorf("invalid date %q", set.Date)
+		}
+		rates := make(map[string]float64, len(set.Rates))
+		for currency, rate := range set.Rates {
+			if rate <= 0 {
+				return table, fmt.Errorf("invalid rate of %s on %s", currency, set.Date)
+			}
+			rates[strings.ToUpper(currency)] = rate
+		}
+		table.Rates[i].Rates = rates
+	}
+	sort.SliceStable(table.Rates, func(i, j int) bool { return table.Rates[i].Date < table.Rates[j].Date })
+	return table, nil
+}
+
+// Gives the current table, reloading the file first if it changed since it was last loaded.
+func (e *ExchangeRates) current() exchangeRateTable {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	info, err := os.Stat(e.path)
+	if err != nil || info.ModTime().Equal(e.modified) {
+		return e.table
+	}
+	table, err := readExchangeRates(e.path)
+	if err != nil {
+		log.Printf("Failed to reload exchange rates, keeping the previous ones: %v", err)
+	} else {
+		e.table = table
+	}
+	e.modified = info.ModTime()
+	return e.table
+}
+
+// Gives the rate of a currency in effect on a day, which is the rate of the newest set dated on or before it. Days
+// before the first rate of the currency use its first rate. Gives back false if the table has no rate for it.
+func (table exchangeRateTable) rate(currency string, day string) (float64, bool) {
+	if currency == table.Base {
+		return 1, true
+	}
+	rate, found := 0.0, false
+	for _, set := range table.Rates {
+		setRate, ok := set.Rates[currency]
+		if !ok {
+			continue
+		}
+		if found && set.Date > day {
+			break
+		}
+		rate, found = setRate, true
+	}
+	return rate, found
+}
+
+// Gives the rates of all currencies in effect on a day.
+func (table exchangeRateTable) ratesOn(day string) ExchangeRateSet {
+	set := ExchangeRateSet{Date: day, Rates: map[string]float64{table.Base: 1}}
+	for _, dated := range table.Rates {
+		for currency := range dated.Rates {
+			set.Rates[currency], _ = table.rate(currency, day)
+		}
+	}
+	return set
+}
+
+// Converts an amount between currencies at the rates in effect at the given time. Amounts in the target currency are
+// kept as they are, also without a table. Gives back false if a rate is missing.
+func (e *ExchangeRates) convert(amount float64, from string, to string, at time.Time) (float64, bool) {
+	from = strings.ToUpper(from)
+	to = strings.ToUpper(to)
+	if from == to {
+		return amount, true
+	}
+	if e == nil {
+		return 0, false
+	}
+	table := e.current()
+	day := at.UTC().Format("2006-01-02")
+	fromRate, ok := table.rate(from, day)
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := table.rate(to, day)
+	if !ok {
+		return 0, false
+	}
+	return amount / fromRate * toRate, true
+}
+
+// Base gives the base currency of the exchange rates.
+func (e *ExchangeRates) Base() string {
+	return e.current().Base
+}
+
+// Rates gives the history of exchange rates, or only the rates in effect on the given day if one is given.
+func (e *ExchangeRates) Rates(day time.Time) ExchangeRatesOutbound {
+	table := e.current()
+	outbound := ExchangeRatesOutbound{Base: table.Base, Rates: table.Rates}
+	if !day.IsZero() {
+		outbound.Rates = []ExchangeRateSet{table.ratesOn(day.UTC().Format("2006-01-02"))}
+	}
+	if outbound.Rates == nil {
+		outbound.Rates = []ExchangeRateSet{}
+	}
+	return outbound
+}
+
+// RatesHandler is the handler for the exchange rates endpoint. /ytstats/v1/rates/
+// Provides the history of exchange rates used to convert revenue, or the rates in effect on a date. The rates are
+// supplied by the operator of the server in a file.
+func RatesHandler(input Inputs) http.Handler {
+	rates := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			if input.Rates == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "ratesDisabled")
+				return
+			}
+			date, err := parseDate(r.URL.Query().Get("date"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+
+			// Provide response.
+			ratesOutbound := input.Rates.Rates(date)
+			ratesOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(ratesOutbound)
+			if err != nil {
+				log.Println("Failed to respond to rates endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(rates)
+}
@@ -0,0 +1,418 @@
+package yt_stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of chat recordings.
+const (
+	recordingActive  = "recording"
+	recordingEnded   = "ended"
+	recordingStopped = "stopped"
+	recordingFailed  = "failed"
+)
+
+// Recorder records every event of live chats into an append-only archive with one JSON line per event, and one
+// archive per video, along with the users who wrote messages in each chat. Recordings follow the chats through the
+// relay, and keep the page token after the last event recorded, so that recordings still active are resumed from
+// where they left off when the server restarts.
+type Recorder struct {
+	mutex  sync.Mutex
+	dir    string
+	relay  *Relay
+	active map[string]*activeRecording
+}
+
+// A recording as stored next to its archive, including the key polling the chat, which is never sent back.
+type chatRecording struct {
+	VideoId     string    `json:"video_id"`
+	ChatId      string    `json:"chat_id"`
+	Key         string    `json:"key"`
+	Status      string    `json:"status"`
+	Page        string    `json:"page"`
+	LastEventId string    `json:"last_event_id"`
+	Events      int       `json:"events"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Error       string    `json:"error"`
+}
+
+// A line of a chat archive.
+type archivedChatEvent struct {
+	Time  time.Time       `json:"time"`
+	Id    string          `json:"id"`
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// A recording currently following a chat, the users who wrote messages in it, and a channel closed once it has
+// stopped.
+type activeRecording struct {
+	subscription *chatSubscription
+	chatters     map[string]bool
+	stopped      bool
+	done         chan struct{}
+}
+
+// NewRecorder creates a recorder keeping archives in the given directory, creating the directory if needed.
+func NewRecorder(relay *Relay, dir string) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{dir: dir, relay: relay, active: make(map[string]*activeRecording)}, nil
+}
+
+// Gives the path of the archive of a video.
+func (rec *Recorder) archivePath(videoId string) string {
+	return filepath.Join(rec.dir, url.PathEscape(videoId)+".jsonl")
+}
+
+// Gives the path of the recording of a video.
+func (rec *Recorder) recordingPath(videoId string) string {
+	return filepath.Join(rec.dir, url.PathEscape(videoId)+".json")
+}
+
+// Gives the path of the users who wrote messages in the recorded chat of a video, with one user ID per line.
+func (rec *Recorder) chattersPath(videoId string) string {
+	return filepath.Join(rec.dir, url.PathEscape(videoId)+".chatters")
+}
+
+// Reads the users who wrote messages in the recorded chat of a video. Recordings made before their chatters were
+// kept have them gathered from their archive once and saved. Must be called with the mutex held.
+func (rec *Recorder) readChatters(videoId string) (map[string]bool, error) {
+	chatters := make(map[string]bool)
+	raw, err := ioutil.ReadFile(rec.chattersPath(videoId))
+	if err == nil {
+		for _, id := range strings.Split(string(raw), "\n") {
+			if id != "" {
+				chatters[id] = true
+			}
+		}
+		return chatters, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	var lines bytes.Buffer
+	_, err = rec.readArchive(videoId, func(event archivedChatEvent) error {
+		if !chatMessageTypes[event.Type] {
+			return nil
+		}
+		chatEvent, err := decodeChatEvent(event.Type, event.Event)
+		if err != nil {
+			return err
+		}
+		if author, ok := chatMessageAuthor(event.Type, chatEvent); ok && !chatters[author.UserId] {
+			chatters[author.UserId] = true
+			lines.WriteString(author.UserId + "\n")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	path := rec.chattersPath(videoId)
+	err = ioutil.WriteFile(path+".tmp", lines.Bytes(), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return chatters, os.Rename(path+".tmp", path)
+}
+
+// Reads the recording of a video. Gives back false if the video was never recorded.
+func (rec *Recorder) readRecording(videoId string) (chatRecording, bool, error) {
+	var recording chatRecording
+	raw, err := ioutil.ReadFile(rec.recordingPath(videoId))
+	if os.IsNotExist(err) {
+		return recording, false, nil
+	}
+	if err != nil {
+		return recording, false, err
+	}
+	return recording, true, json.Unmarshal(raw, &recording)
+}
+
+// Writes the recording of a video, replacing the file atomically.
+func (rec *Recorder) writeRecording(recording chatRecording) error {
+	raw, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+	path := rec.recordingPath(recording.VideoId)
+	err = ioutil.WriteFile(path+".tmp", raw, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Gives the outbound form of a recording.
+func (recording chatRecording) outbound() ChatRecordingOutbound {
+	outbound := ChatRecordingOutbound{
+		VideoId:   recording.VideoId,
+		ChatId:    recording.ChatId,
+		Status:    recording.Status,
+		Events:    recording.Events,
+		StartedAt: recording.StartedAt.Format(time.RFC3339),
+		Error:     recording.Error,
+	}
+	if !recording.EndedAt.IsZero() {
+		outbound.EndedAt = recording.EndedAt.Format(time.RFC3339)
+	}
+	return outbound
+}
+
+// Starts following the chat of a recording from its last page, unless it is already followed.
+func (rec *Recorder) start(recording chatRecording) error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if _, ok := rec.active[recording.VideoId]; ok {
+		return nil
+	}
+	chatters, err := rec.readChatters(recording.VideoId)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rec.archivePath(recording.VideoId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	chattersFile, err := os.OpenFile(rec.chattersPath(recording.VideoId), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	active := &activeRecording{
+		subscription: rec.relay.subscribe(recording.ChatId, recording.Key, recording.Page, recording.LastEventId),
+		chatters:     chatters,
+		done:         make(chan struct{}),
+	}
+	rec.active[recording.VideoId] = active
+	go rec.run(recording, active, file, chattersFile)
+	return nil
+}
+
+// Appends the events of a followed chat to its archive until the chat ends, polling fails, or the recording is
+// stopped. Each burst of events is appended in one write, along with the users who wrote their first messages in
+// it, after which the recording is saved.
+func (rec *Recorder) run(recording chatRecording, active *activeRecording, file *os.File, chattersFile *os.File) {
+	defer close(active.done)
+	defer file.Close()
+	defer chattersFile.Close()
+	var burst bytes.Buffer
+	var chatters bytes.Buffer
+
+	// Appends one event to the archive, and gives back whether it was the last one of the recording.
+	record := func(event relayedEvent) (bool, error) {
+		if event.Type == relayErrorEvent {
+			status, _ := event.Event.(StatusCodeOutbound)
+			recording.Status = recordingFailed
+			recording.Error = status.StatusMessage
+			return true, nil
+		}
+		line, err := json.Marshal(archivedChatEvent{Time: event.Time, Id: event.Id, Type: event.Type,
+			Event: event.Data})
+		if err != nil {
+			return false, err
+		}
+		burst.Write(append(line, '\n'))
+		if author, ok := chatMessageAuthor(event.Type, event.Event); ok && !active.chatters[author.UserId] {
+			active.chatters[author.UserId] = true
+			chatters.WriteString(author.UserId + "\n")
+		}
+		recording.Events++
+		recording.LastEventId = event.Id
+		recording.Page = event.Page
+		if event.Type == "chat_ended" {
+			recording.Status = recordingEnded
+			return true, nil
+		}
+		return false, nil
+	}
+
+	for {
+		event, ok := <-active.subscription.events
+		final := false
+		var err error
+	events:
+		for ok && !final && err == nil {
+			final, err = record(event)
+			select {
+			case event, ok = <-active.subscription.events:
+			default:
+				break events
+			}
+		}
+		if err == nil && burst.Len() > 0 {
+			_, err = file.Write(burst.Bytes())
+			burst.Reset()
+		}
+		rec.mutex.Lock()
+		if err == nil && chatters.Len() > 0 {
+			_, err = chattersFile.Write(chatters.Bytes())
+			chatters.Reset()
+		}
+		switch {
+		case err != nil:
+			recording.Status = recordingFailed
+			recording.Error = err.Error()
+		case final:
+		case !ok && active.stopped:
+			recording.Status = recordingStopped
+		case !ok:
+			recording.Status = recordingFailed
+			recording.Error = "fellBehind"
+		}
+		if recording.Status != recordingActive {
+			delete(rec.active, recording.VideoId)
+			recording.EndedAt = time.Now().UTC()
+		}
+		rec.mutex.Unlock()
+		if err := rec.writeRecording(recording); err != nil {
+			log.Printf("Failed to save recording of %s: %v", recording.VideoId, err)
+		}
+		if recording.Status != recordingActive {
+			active.subscription.close()
+			return
+		}
+	}
+}
+
+// Resume resumes all recordings that were still active when the server stopped, from the page they left off on.
+func (rec *Recorder) Resume() error {
+	paths, err := filepath.Glob(filepath.Join(rec.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		videoId, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		recording, found, err := rec.readRecording(videoId)
+		if err != nil {
+			return err
+		}
+		if found && recording.Status == recordingActive {
+			if err := rec.start(recording); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Record starts recording the chat of a stream using the given key, looking up its current chat. Recording a stream
+// again appends to its archive. Gives back the status of the query, the quota used, the recording, and whether the
+// stream has an active chat.
+func (rec *Recorder) Record(videoId string, key string) (StatusCodeOutbound, int, ChatRecordingOutbound, bool,
+	error) {
+	youtubeStatus := StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}
+	recording, exists, err := rec.readRecording(videoId)
+	if err != nil {
+		return youtubeStatus, 0, ChatRecordingOutbound{}, false, err
+	}
+	rec.mutex.Lock()
+	_, active := rec.active[videoId]
+	rec.mutex.Unlock()
+	if exists && active {
+		return youtubeStatus, 0, recording.outbound(), true, nil
+	}
+
+	// Look up the current chat of the stream, and start following it from its last page if it is the same chat.
+	streamInbound, youtubeStatus, quota := queryStreams(rec.relay.input, videoId, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, ChatRecordingOutbound{}, false, nil
+	}
+	if len(streamInbound.Items) == 0 || streamInbound.Items[0].LiveStreamingDetails.ActiveLiveChatId == "" {
+		return youtubeStatus, quota, ChatRecordingOutbound{}, false, nil
+	}
+	chatId := streamInbound.Items[0].LiveStreamingDetails.ActiveLiveChatId
+	if chatId != recording.ChatId {
+		recording.Page = ""
+		recording.LastEventId = ""
+	}
+	recording.VideoId = videoId
+	recording.ChatId = chatId
+	recording.Key = key
+	recording.Status = recordingActive
+	recording.StartedAt = time.Now().UTC()
+	recording.EndedAt = time.Time{}
+	recording.Error = ""
+	if err := rec.writeRecording(recording); err != nil {
+		return youtubeStatus, quota, ChatRecordingOutbound{}, false, err
+	}
+	return youtubeStatus, quota, recording.outbound(), true, rec.start(recording)
+}
+
+// Recording gives the recording of a stream. Gives back false if the stream was never recorded.
+func (rec *Recorder) Recording(videoId string) (ChatRecordingOutbound, bool, error) {
+	recording, found, err := rec.readRecording(videoId)
+	return recording.outbound(), found, err
+}
+
+// Stop stops recording the chat of a stream, keeping its archive, unless it was recorded with another key. Gives back
+// false if the stream was never recorded, or was recorded with another key.
+func (rec *Recorder) Stop(videoId string, key string) (ChatRecordingOutbound, bool, error) {
+	recording, found, err := rec.readRecording(videoId)
+	if err != nil || !found || recording.Key != key {
+		return ChatRecordingOutbound{}, false, err
+	}
+	rec.mutex.Lock()
+	active, ok := rec.active[videoId]
+	if ok {
+		active.stopped = true
+	}
+	rec.mutex.Unlock()
+	if ok {
+		active.subscription.close()
+		<-active.done
+	}
+	recording, found, err = rec.readRecording(videoId)
+	if err != nil || !found {
+		return ChatRecordingOutbound{}, found, err
+	}
+	if recording.Status == recordingActive {
+		recording.Status = recordingStopped
+		recording.EndedAt = time.Now().UTC()
+		err = rec.writeRecording(recording)
+	}
+	return recording.outbound(), true, err
+}
+
+// Reads the archive of a stream, calling the given function with each event in the order they were recorded until
+// it fails. Gives back false if the stream was never recorded.
+func (rec *Recorder) readArchive(videoId string, each func(event archivedChatEvent) error) (bool, error) {
+	file, err := os.Open(rec.archivePath(videoId))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event archivedChatEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return true, err
+		}
+		if err := each(event); err != nil {
+			return true, err
+		}
+	}
+	return true, scanner.Err()
+}
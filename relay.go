@@ -0,0 +1,332 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits of chat polling. YouTube suggests how long to wait between polls, which is used when given. Failures of
+// YouTube itself are retried a few times before the chat is given up on, and subscribers falling behind by more than
+// the buffer size, one full page of chat, are dropped rather than holding up the others. The newest events are kept
+// in a history for subscribers resuming after the last event they received.
+const (
+	defaultChatPollInterval = 5 * time.Second
+	maxChatPollFailures     = 3
+	relayBufferSize         = 2000
+	relayHistorySize        = 2000
+)
+
+// How often streaming clients are sent a heartbeat while no events arrive, keeping idle connections open.
+const chatHeartbeatInterval = 15 * time.Second
+
+// How long a key stays checked once YouTube accepted it, before subscribers using it to join a chat polled with
+// another key have it checked again.
+const relayKeyCheckInterval = time.Hour
+
+// Type of the event relayed when polling a chat fails, which is always the last event of a subscription.
+const relayErrorEvent = "error"
+
+// A chat event as relayed to subscribers, along with its ID, type, time, JSON encoding, and the page token
+// continuing after the page it was on.
+type relayedEvent struct {
+	Id    string
+	Type  string
+	Time  time.Time
+	Data  []byte
+	Event interface{}
+	Page  string
+}
+
+// Relay polls live chats on the server and relays their events to subscribers. Each chat is polled by one poller
+// shared by all of its subscribers, using the key of the subscriber that started it unless a subscriber switches it
+// to another key, and is stopped once the chat ends, polling fails, or the last subscriber leaves. Subscribers
+// joining a chat polled with another key have their own key checked with YouTube first, as it is never used to poll.
+type Relay struct {
+	mutex   sync.Mutex
+	input   Inputs
+	pollers map[string]*chatPoller
+	checked map[string]time.Time
+}
+
+// A poller of one chat, the subscribers to it, and the newest events it relayed.
+type chatPoller struct {
+	id          string
+	key         string
+	subscribers map[*chatSubscription]bool
+	history     []relayedEvent
+	stop        chan struct{}
+}
+
+// A subscription receiving the events of a chat from the relay until the chat ends or the subscription is closed.
+// The events channel is closed when no more events will be received. While resumeAfter is set, the subscription
+// waits for the event with that ID, and only receives the events after it.
+type chatSubscription struct {
+	events      chan relayedEvent
+	resumeAfter string
+	relay       *Relay
+	poller      *chatPoller
+}
+
+// Where to follow a chat again from after its subscription was dropped for falling behind: the page holding the
+// last event received, and the ID of that event. The page is the one the event was published on rather than the one
+// after it, so that the rest of its page is not skipped.
+type chatPosition struct {
+	page        string
+	nextPage    string
+	lastEventId string
+}
+
+// Moves the position past an event received from a subscription.
+func (p *chatPosition) advance(event relayedEvent) {
+	if event.Page != p.nextPage {
+		p.page, p.nextPage = p.nextPage, event.Page
+	}
+	p.lastEventId = event.Id
+}
+
+// NewRelay creates a relay polling chats with the given inputs.
+func NewRelay(input Inputs) *Relay {
+	return &Relay{input: input, pollers: make(map[string]*chatPoller), checked: make(map[string]time.Time)}
+}
+
+// Gives the relayed form of a chat event parsed by ChatParser. Its time is when it was published, or now if unknown.
+func newRelayedEvent(event interface{}) (relayedEvent, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return relayedEvent{}, err
+	}
+	var header struct {
+		Id          string `json:"id"`
+		Type        string `json:"type"`
+		PublishedAt string `json:"published_at"`
+	}
+	err = json.Unmarshal(data, &header)
+	eventTime, timeErr := time.Parse(time.RFC3339, header.PublishedAt)
+	if timeErr != nil {
+		eventTime = time.Now()
+	}
+	return relayedEvent{Id: header.Id, Type: header.Type, Time: eventTime.UTC(), Data: data, Event: event}, err
+}
+
+// Checks a key with a query costing one unit of quota, unless it was accepted within the key check interval. Gives
+// back the status YouTube responded with.
+func (r *Relay) checkKey(key string) StatusCodeOutbound {
+	r.mutex.Lock()
+	checked, ok := r.checked[key]
+	r.mutex.Unlock()
+	if ok && time.Since(checked) < relayKeyCheckInterval {
+		return StatusCodeOutbound{StatusCode: http.StatusOK}
+	}
+	youtubeStatus, _ := youtubeQuery(fmt.Sprintf("%s&key=%s", r.input.StatusCheck, key), nil, 1)
+	if youtubeStatus.StatusCode == http.StatusOK {
+		r.mutex.Lock()
+		r.checked[key] = time.Now()
+		r.mutex.Unlock()
+	}
+	return youtubeStatus
+}
+
+// Subscribes to the events of a chat, starting a poller using the given key from the given page if the chat is not
+// polled yet. If the ID of the last event received is given, the events after it are replayed from the history of
+// the poller. If the poller has only just started, the events after it on the first page polled are relayed instead.
+// If the chat is polled with another key and the given key is not accepted by YouTube, the subscription only
+// receives an error event.
+func (r *Relay) subscribe(id string, key string, page string, lastEventId string) *chatSubscription {
+	r.mutex.Lock()
+	poller, ok := r.pollers[id]
+	shared := ok && poller.key != key
+	r.mutex.Unlock()
+	if shared {
+		if youtubeStatus := r.checkKey(key); youtubeStatus.StatusCode != http.StatusOK {
+			data, _ := json.Marshal(youtubeStatus)
+			subscription := &chatSubscription{events: make(chan relayedEvent, 1), relay: r, poller: &chatPoller{}}
+			subscription.events <- relayedEvent{Type: relayErrorEvent, Data: data, Event: youtubeStatus}
+			close(subscription.events)
+			return subscription
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	poller, ok = r.pollers[id]
+	if !ok {
+		poller = &chatPoller{
+			id:          id,
+			key:         key,
+			subscribers: make(map[*chatSubscription]bool),
+			stop:        make(chan struct{}),
+		}
+		r.pollers[id] = poller
+		go r.poll(poller, page)
+	}
+	subscription := &chatSubscription{
+		events:      make(chan relayedEvent, relayBufferSize),
+		resumeAfter: lastEventId,
+		relay:       r,
+		poller:      poller,
+	}
+	poller.subscribers[subscription] = true
+	if lastEventId != "" && len(poller.history) > 0 {
+		if missed, found := eventsAfter(poller.history, lastEventId); found {
+			subscription.send(missed)
+		}
+		subscription.resumeAfter = ""
+	}
+	return subscription
+}
+
+// Gives the events after the event with the given ID, and whether the event was found.
+func eventsAfter(events []relayedEvent, id string) ([]relayedEvent, bool) {
+	for i, event := range events {
+		if event.Id == id {
+			return events[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+// Sends events to the subscription without blocking. Gives back false if the subscription fell behind.
+func (s *chatSubscription) send(events []relayedEvent) bool {
+	for _, event := range events {
+		select {
+		case s.events <- event:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Ends the subscription, stopping the poller of the chat if it was the last subscriber.
+func (s *chatSubscription) close() {
+	s.relay.mutex.Lock()
+	defer s.relay.mutex.Unlock()
+	if !s.poller.subscribers[s] {
+		return
+	}
+	delete(s.poller.subscribers, s)
+	close(s.events)
+	if len(s.poller.subscribers) == 0 && s.relay.pollers[s.poller.id] == s.poller {
+		delete(s.relay.pollers, s.poller.id)
+		close(s.poller.stop)
+	}
+}
+
+// Switches the poller of the subscription to the given key from its next poll on, for subscribers following a chat
+// on behalf of the owner of the key.
+func (s *chatSubscription) useKey(key string) {
+	s.relay.mutex.Lock()
+	defer s.relay.mutex.Unlock()
+	if s.poller.subscribers[s] {
+		s.poller.key = key
+	}
+}
+
+// Pollers gives the amount of chats currently polled.
+func (r *Relay) Pollers() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.pollers)
+}
+
+// Gives a copy of the newest events relayed from a chat, and whether the chat is currently polled.
+func (r *Relay) history(id string) ([]relayedEvent, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	poller, ok := r.pollers[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]relayedEvent(nil), poller.history...), true
+}
+
+// Sends a batch of events to all subscribers of a poller and keeps them in its history, dropping the subscribers
+// that fell behind. Subscribers still waiting to resume only receive the events after the one they resume after, or
+// the whole batch if it is not part of it. If final is set, the poller is removed and all subscriptions are ended
+// after the batch. Gives back false if the poller was stopped.
+func (r *Relay) publish(poller *chatPoller, events []relayedEvent, final bool) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.pollers[poller.id] != poller {
+		return false
+	}
+	poller.history = append(poller.history, events...)
+	if len(poller.history) > relayHistorySize {
+		poller.history = poller.history[len(poller.history)-relayHistorySize:]
+	}
+	for subscription := range poller.subscribers {
+		batch := events
+		if subscription.resumeAfter != "" {
+			if missed, found := eventsAfter(events, subscription.resumeAfter); found {
+				batch = missed
+			}
+			subscription.resumeAfter = ""
+		}
+		if !subscription.send(batch) {
+			log.Printf("Dropped subscriber falling behind on chat %s.", poller.id)
+			delete(poller.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+	if final || len(poller.subscribers) == 0 {
+		for subscription := range poller.subscribers {
+			delete(poller.subscribers, subscription)
+			close(subscription.events)
+		}
+		delete(r.pollers, poller.id)
+		close(poller.stop)
+		return false
+	}
+	return true
+}
+
+// Polls a chat from the given page until it ends, polling fails or the poller is stopped, waiting between polls as
+// long as YouTube suggests.
+func (r *Relay) poll(poller *chatPoller, page string) {
+	failures := 0
+	for {
+		wait := defaultChatPollInterval
+		r.mutex.Lock()
+		key := poller.key
+		r.mutex.Unlock()
+		chatInbound, youtubeStatus, _ := queryChat(r.input, poller.id, key, page)
+		if youtubeStatus.StatusCode != http.StatusOK {
+			failures++
+			if youtubeStatus.StatusCode < http.StatusInternalServerError || failures >= maxChatPollFailures {
+				data, _ := json.Marshal(youtubeStatus)
+				r.publish(poller, []relayedEvent{{Type: relayErrorEvent, Data: data, Event: youtubeStatus}}, true)
+				return
+			}
+		} else {
+			failures = 0
+			chatOutbound := ChatParser(chatInbound, poller.id)
+			var events []relayedEvent
+			ended := false
+			for _, chatEvent := range chatOutbound.ChatEvents {
+				event, err := newRelayedEvent(chatEvent)
+				if err != nil {
+					log.Printf("Failed to relay event of chat %s: %v", poller.id, err)
+					continue
+				}
+				event.Page = chatOutbound.NextPage
+				events = append(events, event)
+				ended = ended || event.Type == "chat_ended"
+			}
+			if (len(events) > 0 || ended) && !r.publish(poller, events, ended) {
+				return
+			}
+			page = chatOutbound.NextPage
+			if chatOutbound.SuggestedCooldown > 0 {
+				wait = time.Duration(chatOutbound.SuggestedCooldown) * time.Millisecond
+			}
+		}
+		select {
+		case <-poller.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
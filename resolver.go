@@ -0,0 +1,173 @@
+package yt_stats
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the live chats of videos and the live streams of channels are cached. Chats are looked up again every
+// minute, keeping the viewer count given with them current, while the live stream of a channel is kept for longer
+// as finding it costs more quota, and is only looked up again early once it has ended.
+const (
+	chatLookupTTL    = time.Minute
+	channelLookupTTL = 10 * time.Minute
+)
+
+// ChatResolver looks up the live chats of videos and the live streams of channels, caching what it found. Chat IDs
+// change between broadcasts, so only chats of streams currently live are cached, and only for a short time. A nil
+// resolver looks everything up without caching.
+type ChatResolver struct {
+	mutex    sync.Mutex
+	streams  map[string]liveChat
+	channels map[string]liveChannelStream
+}
+
+// The live chat of a stream, along with the viewers of the stream and when it was looked up.
+type liveChat struct {
+	videoId string
+	chatId  string
+	viewers int
+	at      time.Time
+}
+
+// The live stream of a channel, and when it was looked up.
+type liveChannelStream struct {
+	videoId string
+	at      time.Time
+}
+
+// NewChatResolver creates a resolver with an empty cache.
+func NewChatResolver() *ChatResolver {
+	return &ChatResolver{streams: make(map[string]liveChat), channels: make(map[string]liveChannelStream)}
+}
+
+// Gives the cached live chat of a video if it was looked up recently enough.
+func (c *ChatResolver) cachedStream(videoId string) (liveChat, bool) {
+	if c == nil {
+		return liveChat{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, ok := c.streams[videoId]
+	if !ok || time.Since(stream.at) >= chatLookupTTL {
+		return liveChat{}, false
+	}
+	return stream, true
+}
+
+// Caches the live chat of a video, and the video as the live stream of a channel if a channel is given.
+func (c *ChatResolver) cache(stream liveChat, channelId string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.streams[stream.videoId] = stream
+	if channelId != "" {
+		c.channels[channelId] = liveChannelStream{videoId: stream.videoId, at: stream.at}
+	}
+}
+
+// Forgets the live chat of a video, for example once reading the chat failed because it ended.
+func (c *ChatResolver) forget(videoId string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.streams, videoId)
+}
+
+// Gives the first stream of the queried streams that is live with an active chat. Gives back false if there is none.
+func firstLiveChat(streamInbound StreamInbound, at time.Time) (liveChat, bool) {
+	for _, stream := range StreamParser(streamInbound).Streams {
+		live, ok := stream.(LiveStream)
+		if ok && live.ChatId != "" {
+			return liveChat{videoId: live.Id, chatId: live.ChatId, viewers: live.ConcurrentViewers, at: at}, true
+		}
+	}
+	return liveChat{}, false
+}
+
+// Gives the live chat of a video using the given key, from the cache if it was looked up recently. Fails with
+// streamNotFound if the video does not exist, and with streamNotLive if it is not live or has no active chat. Gives
+// back the status of the query, and the quota used.
+func (c *ChatResolver) video(input Inputs, videoId string, key string) (liveChat, StatusCodeOutbound, int) {
+	if stream, ok := c.cachedStream(videoId); ok {
+		return stream, StatusCodeOutbound{StatusCode: http.StatusOK, StatusMessage: "OK"}, 0
+	}
+	streamInbound, youtubeStatus, quota := queryStreams(input, videoId, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return liveChat{}, youtubeStatus, quota
+	}
+	if len(streamInbound.Items) == 0 {
+		return liveChat{}, StatusCodeOutbound{StatusCode: http.StatusNotFound, StatusMessage: "streamNotFound"}, quota
+	}
+	stream, ok := firstLiveChat(streamInbound, time.Now())
+	if !ok {
+		return liveChat{}, StatusCodeOutbound{StatusCode: http.StatusNotFound, StatusMessage: "streamNotLive"}, quota
+	}
+	c.cache(stream, "")
+	return stream, youtubeStatus, quota
+}
+
+// Gives the live chat of the current live stream of a channel using the given key. The live stream is found among
+// the newest uploads of the channel, and is kept in the cache until it ends. Fails with channelNotFound if the
+// channel does not exist, and with streamNotLive if none of its newest uploads are live with an active chat. Gives
+// back the status of the queries, and the quota used.
+func (c *ChatResolver) channel(input Inputs, channelId string, key string) (liveChat, StatusCodeOutbound, int) {
+	notFound := StatusCodeOutbound{StatusCode: http.StatusNotFound, StatusMessage: "channelNotFound"}
+	quota := 0
+	if c != nil {
+		c.mutex.Lock()
+		cached, ok := c.channels[channelId]
+		c.mutex.Unlock()
+		if ok && time.Since(cached.at) < channelLookupTTL {
+			stream, youtubeStatus, cost := c.video(input, cached.videoId, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusNotFound {
+				return stream, youtubeStatus, quota
+			}
+		}
+	}
+
+	// Find the live stream among the newest uploads of the channel.
+	uploads := uploadsPlaylistId(channelId)
+	if uploads == "" {
+		return liveChat{}, notFound, quota
+	}
+	var ids []string
+	youtubeStatus, cost := walkPlaylistItems(input, uploads, key, func(page PlaylistItemsInbound) bool {
+		for i, item := range page.Items {
+			if i >= liveUploadsChecked {
+				break
+			}
+			ids = append(ids, item.Snippet.ResourceId.VideoId)
+		}
+		return false
+	})
+	quota += cost
+	if youtubeStatus.StatusCode == http.StatusNotFound {
+		return liveChat{}, notFound, quota
+	}
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return liveChat{}, youtubeStatus, quota
+	}
+	notLive := StatusCodeOutbound{StatusCode: http.StatusNotFound, StatusMessage: "streamNotLive"}
+	if len(ids) == 0 {
+		return liveChat{}, notLive, quota
+	}
+	streamInbound, youtubeStatus, cost := queryStreams(input, strings.Join(ids, ","), key)
+	quota += cost
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return liveChat{}, youtubeStatus, quota
+	}
+	stream, ok := firstLiveChat(streamInbound, time.Now())
+	if !ok {
+		return liveChat{}, notLive, quota
+	}
+	c.cache(stream, channelId)
+	return stream, youtubeStatus, quota
+}
@@ -0,0 +1,179 @@
+package yt_stats
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A paid chat event as kept for the timeline, with its amount converted into the target currency.
+type revenueEvent struct {
+	time      time.Time
+	eventType string
+	amount    float64
+	gifted    int
+}
+
+// Rounds an amount to cents.
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Sums up the super chats, super stickers and gifted memberships in the recorded chat of a stream between two times.
+// Amounts are summed per currency, and converted into the target currency at the rates in effect when each was sent.
+// Converted amounts are rounded to cents, and currencies without a rate are left out of them. Donors are ordered by
+// the amount they gave, then by memberships gifted, then by who gave first. Gives back false if the stream was never
+// recorded.
+func (rec *Recorder) revenue(videoId string, since time.Time, until time.Time, currency string,
+	rates *ExchangeRates, interval time.Duration, limit int) (StreamRevenueOutbound, bool, error) {
+	_, found, err := rec.readRecording(videoId)
+	if err != nil || !found {
+		return StreamRevenueOutbound{}, found, err
+	}
+	outbound := StreamRevenueOutbound{
+		StreamId:    videoId,
+		Currency:    currency,
+		Unconverted: []string{},
+		ByCurrency:  []CurrencyRevenue{},
+		TopDonors:   []DonorRevenue{},
+		Timeline:    []RevenueBucket{},
+	}
+	micros := make(map[string]int64)
+	currencies := make(map[string]*CurrencyRevenue)
+	unconverted := make(map[string]bool)
+	donors := make(map[string]*DonorRevenue)
+	var donorOrder []string
+	var events []revenueEvent
+	_, err = rec.readArchive(videoId, func(event archivedChatEvent) error {
+		if event.Time.Before(since) || (!until.IsZero() && event.Time.After(until)) {
+			return nil
+		}
+		if event.Type != "superchat" && event.Type != "supersticker" && event.Type != "memberships_gifted" {
+			return nil
+		}
+		chatEvent, err := decodeChatEvent(event.Type, event.Event)
+		if err != nil {
+			return err
+		}
+		paid := revenueEvent{time: event.Time, eventType: event.Type}
+		var donor ChatUser
+		var amount float64
+		var code string
+		switch e := chatEvent.(type) {
+		case ChatSuperChat:
+			donor, amount, code = e.SentBy, e.Amount, e.Currency
+			outbound.SuperChats++
+		case ChatSuperSticker:
+			donor, amount, code = e.SentBy, e.Amount, e.Currency
+			outbound.SuperStickers++
+		case ChatMembershipGifting:
+			donor, paid.gifted = e.GiftedBy, e.Count
+			outbound.GiftedMemberships += e.Count
+		}
+
+		// Sum up the amount in its own currency, and converted if there is a rate for it.
+		if code != "" {
+			code = strings.ToUpper(code)
+			total, ok := currencies[code]
+			if !ok {
+				total = &CurrencyRevenue{Currency: code}
+				currencies[code] = total
+			}
+			total.Count++
+			micros[code] += int64(math.Round(amount * 1000000))
+			converted, ok := rates.convert(amount, code, currency, event.Time)
+			if ok {
+				total.Converted += converted
+				paid.amount = converted
+			} else {
+				unconverted[code] = true
+			}
+		}
+		events = append(events, paid)
+
+		// Add what was given to the donor.
+		if donor.UserId == "" {
+			return nil
+		}
+		given, ok := donors[donor.UserId]
+		if !ok {
+			given = &DonorRevenue{}
+			donors[donor.UserId] = given
+			donorOrder = append(donorOrder, donor.UserId)
+		}
+		given.Donor = donor
+		given.Amount += paid.amount
+		given.GiftedMemberships += paid.gifted
+		switch event.Type {
+		case "superchat":
+			given.SuperChats++
+		case "supersticker":
+			given.SuperStickers++
+		}
+		return nil
+	})
+	if err != nil {
+		return StreamRevenueOutbound{}, true, err
+	}
+
+	// Total up the currencies and donors.
+	for code, total := range currencies {
+		total.Amount = float64(micros[code]) / 1000000
+		total.Converted = roundCents(total.Converted)
+		outbound.Total += total.Converted
+		outbound.ByCurrency = append(outbound.ByCurrency, *total)
+	}
+	sort.Slice(outbound.ByCurrency, func(i, j int) bool {
+		return outbound.ByCurrency[i].Currency < outbound.ByCurrency[j].Currency
+	})
+	outbound.Total = roundCents(outbound.Total)
+	for code := range unconverted {
+		outbound.Unconverted = append(outbound.Unconverted, code)
+	}
+	sort.Strings(outbound.Unconverted)
+	for _, id := range donorOrder {
+		donors[id].Amount = roundCents(donors[id].Amount)
+		outbound.TopDonors = append(outbound.TopDonors, *donors[id])
+	}
+	sort.SliceStable(outbound.TopDonors, func(i, j int) bool {
+		if outbound.TopDonors[i].Amount != outbound.TopDonors[j].Amount {
+			return outbound.TopDonors[i].Amount > outbound.TopDonors[j].Amount
+		}
+		return outbound.TopDonors[i].GiftedMemberships > outbound.TopDonors[j].GiftedMemberships
+	})
+	if len(outbound.TopDonors) > limit {
+		outbound.TopDonors = outbound.TopDonors[:limit]
+	}
+	if len(events) == 0 {
+		return outbound, true, nil
+	}
+
+	// Sum up the events into buckets aligned to the interval, in chronological order as archives keep events in the
+	// order they were received.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time.Before(events[j].time) })
+	first, interval, buckets := alignTimeline(events[0].time, events[len(events)-1].time, interval)
+	outbound.Interval = int(interval.Seconds())
+	outbound.Timeline = make([]RevenueBucket, buckets)
+	for i := range outbound.Timeline {
+		outbound.Timeline[i].Time = first.Add(time.Duration(i) * interval).Format(time.RFC3339)
+	}
+	for _, event := range events {
+		i := int(event.time.Sub(first) / interval)
+		if event.time.Before(first) || i >= len(outbound.Timeline) {
+			continue
+		}
+		outbound.Timeline[i].Amount += event.amount
+		outbound.Timeline[i].GiftedMemberships += event.gifted
+		switch event.eventType {
+		case "superchat":
+			outbound.Timeline[i].SuperChats++
+		case "supersticker":
+			outbound.Timeline[i].SuperStickers++
+		}
+	}
+	for i := range outbound.Timeline {
+		outbound.Timeline[i].Amount = roundCents(outbound.Timeline[i].Amount)
+	}
+	return outbound, true, nil
+}
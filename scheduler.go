@@ -0,0 +1,470 @@
+package yt_stats
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Store collection used by the scheduler.
+const jobsCollection = "jobs"
+
+// Delay before the first retry of a failed job run. Each following retry waits twice as long as the last.
+const retryDelay = time.Minute
+
+// Reported by job runners when the quota budget of the job would be exceeded by continuing.
+var errBudgetExhausted = errors.New("quota budget exhausted")
+
+// Scheduler runs recurring collection jobs, persisted in the store of the tracker they record snapshots with.
+// Jobs run with the API key they were created with, and are only visible to requests using that key.
+type Scheduler struct {
+	mutex   sync.Mutex
+	running sync.Mutex
+	tracker *Tracker
+	store   Store
+}
+
+// A job as stored by the scheduler, including the key it runs with, which is never sent back.
+type storedJob struct {
+	Job Job    `json:"job"`
+	Key string `json:"key"`
+}
+
+// Keeps track of the quota a job run has used, and whether it may use more. A zero limit is unlimited.
+type jobBudget struct {
+	limit int
+	used  int
+}
+
+// Checks whether the given cost fits within the budget, and spends it if so.
+func (b *jobBudget) spend(cost int) bool {
+	if b.limit > 0 && b.used+cost > b.limit {
+		return false
+	}
+	b.used += cost
+	return true
+}
+
+// Turns the status of a YouTube query into an error, or nil if the query succeeded.
+func youtubeError(youtubeStatus StatusCodeOutbound) error {
+	if youtubeStatus.StatusCode == http.StatusOK {
+		return nil
+	}
+	return fmt.Errorf("youtube responded with %d %s", youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+}
+
+// Runners of the different job types, querying YouTube with the given key for the given targets.
+var jobRunners = map[string]func(t *Tracker, key string, targets []string, budget *jobBudget) error{
+	"tracked":   runTrackedJob,
+	"channels":  runChannelsJob,
+	"videos":    runVideosJob,
+	"playlists": runPlaylistsJob,
+	"streams":   runStreamsJob,
+	"comments":  runCommentsJob,
+	"live":      runLiveJob,
+	"viewers":   runViewersJob,
+}
+
+// Takes snapshots of all channels tracked and videos watched through the history endpoints, and checks all channels
+// watched through the live endpoint for streams.
+func runTrackedJob(t *Tracker, key string, _ []string, budget *jobBudget) error {
+	channelIds, err := t.trackedChannelIds()
+	if err != nil {
+		return err
+	}
+	if err := runChannelsJob(t, key, channelIds, budget); err != nil {
+		return err
+	}
+	videoIds, err := t.watchedVideoIds()
+	if err != nil {
+		return err
+	}
+	if err := runVideosJob(t, key, videoIds, budget); err != nil {
+		return err
+	}
+	liveChannelIds, err := t.liveChannelIds()
+	if err != nil {
+		return err
+	}
+	return runLiveJob(t, key, liveChannelIds, budget)
+}
+
+// Takes snapshots of the target channels.
+func runChannelsJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	for _, chunk := range chunkIds(targets, 50) {
+		if !budget.spend(1) {
+			return errBudgetExhausted
+		}
+		youtubeStatus, quota, _, err := t.snapshotChannels(chunk, key)
+		if quota > 1 {
+			budget.used += quota - 1 // Looking up new uploads costs quota beyond the snapshot.
+		}
+		if err != nil {
+			return err
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Takes snapshots of the target videos.
+func runVideosJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	for _, chunk := range chunkIds(targets, 50) {
+		if !budget.spend(1) {
+			return errBudgetExhausted
+		}
+		youtubeStatus, _, _, err := t.snapshotVideos(chunk, key)
+		if err != nil {
+			return err
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Takes snapshots of all videos in the target playlists. The amount of pages of a playlist is not known in advance,
+// so the budget is only checked before each playlist, and may be exceeded by the pages of the last one.
+func runPlaylistsJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	for _, id := range targets {
+		if !budget.spend(1) {
+			return errBudgetExhausted
+		}
+		videoIds, youtubeStatus, quota := queryPlaylistItems(t.input, id, key)
+		if quota > 1 {
+			budget.used += quota - 1 // Pages beyond the first cost quota beyond the unit spent.
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return err
+		}
+		for _, page := range videoIds {
+			if err := runVideosJob(t, key, page, budget); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Takes snapshots of the target streams.
+func runStreamsJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	for _, chunk := range chunkIds(targets, 50) {
+		if !budget.spend(1) {
+			return errBudgetExhausted
+		}
+		youtubeStatus, _, err := t.snapshotStreams(chunk, key)
+		if err != nil {
+			return err
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks new comments on the target videos for keywords of webhooks. Only the newest page of comments is checked, so
+// comments may be missed on videos receiving more than 100 comments between runs.
+func runCommentsJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	for _, id := range targets {
+		if !budget.spend(1) {
+			return errBudgetExhausted
+		}
+		youtubeStatus, _, err := t.checkComments(id, key)
+		if err != nil {
+			return err
+		}
+		if err := youtubeError(youtubeStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the target channels for scheduled and live streams.
+func runLiveJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	youtubeStatus, _, err := t.detectStreams(targets, key, budget)
+	if err != nil {
+		return err
+	}
+	return youtubeError(youtubeStatus)
+}
+
+// Takes snapshots of the target streams to sample their viewers, or of all streams that are live or about to start if
+// there are no targets.
+func runViewersJob(t *Tracker, key string, targets []string, budget *jobBudget) error {
+	if len(targets) == 0 {
+		var err error
+		targets, err = t.activeStreamIds(time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return runStreamsJob(t, key, targets, budget)
+}
+
+// NewScheduler creates a scheduler running jobs with the given tracker, persisting them in its store.
+func NewScheduler(tracker *Tracker) *Scheduler {
+	return &Scheduler{tracker: tracker, store: tracker.store}
+}
+
+// Run runs due jobs every 15 seconds. Never returns.
+func (s *Scheduler) Run() {
+	for now := range time.Tick(15 * time.Second) {
+		s.RunDue(now)
+	}
+}
+
+// RunDue runs all jobs that are not paused and due at the given time, one after another.
+func (s *Scheduler) RunDue(now time.Time) {
+	s.running.Lock()
+	defer s.running.Unlock()
+	s.mutex.Lock()
+	ids, err := s.store.Keys(jobsCollection)
+	if err != nil {
+		s.mutex.Unlock()
+		log.Printf("Failed to read jobs: %v", err)
+		return
+	}
+	var due []storedJob
+	for _, id := range ids {
+		var stored storedJob
+		found, err := s.store.Get(jobsCollection, id, &stored)
+		if err != nil || !found || stored.Job.Paused {
+			continue
+		}
+		nextRun, err := time.Parse(time.RFC3339, stored.Job.NextRun)
+		if err == nil && !nextRun.After(now) {
+			due = append(due, stored)
+		}
+	}
+	s.mutex.Unlock()
+	for _, stored := range due {
+		s.runJob(stored, now)
+	}
+}
+
+// Runs a job and records the outcome. Failed runs are retried with exponential backoff, up to the maximum retries.
+func (s *Scheduler) runJob(stored storedJob, now time.Time) {
+	job := stored.Job
+	today := now.UTC().Format("2006-01-02")
+	if job.QuotaDay != today {
+		job.QuotaDay = today
+		job.QuotaUsed = 0
+	}
+	budget := &jobBudget{}
+	if job.QuotaBudget > 0 {
+		budget.limit = job.QuotaBudget - job.QuotaUsed
+	}
+	var err error
+	if job.QuotaBudget > 0 && budget.limit <= 0 {
+		err = errBudgetExhausted
+	} else {
+		err = jobRunners[job.Type](s.tracker, stored.Key, job.Targets, budget)
+	}
+
+	// Record the outcome and schedule the next run.
+	job.LastRun = now.UTC().Format(time.RFC3339)
+	job.QuotaUsed += budget.used
+	job.LastError = ""
+	switch {
+	case err == nil:
+		job.LastStatus = "ok"
+		job.Retries = 0
+	case errors.Is(err, errBudgetExhausted):
+		job.LastStatus = "budgetExhausted"
+		job.Retries = 0
+	default:
+		job.LastStatus = "failed"
+		job.LastError = err.Error()
+		log.Printf("Job %s failed: %v", job.Id, err)
+	}
+	if job.LastStatus == "failed" && job.Retries < job.MaxRetries {
+		job.NextRun = now.Add(retryDelay << uint(job.Retries)).UTC().Format(time.RFC3339)
+		job.Retries++
+	} else {
+		job.Retries = 0
+		job.NextRun = nextJobRun(job, now)
+	}
+
+	// Save the outcome, unless the job was deleted while running. Pausing while running is kept.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var current storedJob
+	found, err := s.store.Get(jobsCollection, job.Id, &current)
+	if err != nil || !found {
+		return
+	}
+	job.Paused = current.Job.Paused
+	current.Job = job
+	if err := s.store.Put(jobsCollection, job.Id, current); err != nil {
+		log.Printf("Failed to save job %s: %v", job.Id, err)
+	}
+}
+
+// Gives the next run of a job after the given time, delayed by a random amount up to the jitter of the job.
+func nextJobRun(job Job, after time.Time) string {
+	jobSchedule, err := parseSchedule(job.Schedule)
+	if err != nil {
+		return ""
+	}
+	next := jobSchedule.next(after)
+	if jitter, err := ParseInterval(job.Jitter); err == nil && jitter > 0 {
+		next = next.Add(time.Duration(mathrand.Int63n(int64(jitter))))
+	}
+	return next.UTC().Format(time.RFC3339)
+}
+
+// Checks the definition of a job, giving back the status message describing what is wrong with it, or "".
+func validateJob(job Job) string {
+	if _, ok := jobRunners[job.Type]; !ok {
+		return "jobTypeInvalid"
+	}
+	if job.Type != "tracked" && job.Type != "viewers" && len(job.Targets) == 0 {
+		return "jobTargetsMissing"
+	}
+	if _, err := parseSchedule(job.Schedule); err != nil {
+		return "scheduleInvalid"
+	}
+	if job.Jitter != "" {
+		if jitter, err := ParseInterval(job.Jitter); err != nil || jitter < 0 {
+			return "scheduleInvalid"
+		}
+	}
+	if job.QuotaBudget < 0 || job.MaxRetries < 0 {
+		return "jobBodyInvalid"
+	}
+	return ""
+}
+
+// Resets the state of a job definition, and schedules its first run.
+func newJobState(job Job, now time.Time) Job {
+	job.Paused = false
+	job.LastRun = ""
+	job.LastStatus = ""
+	job.LastError = ""
+	job.Retries = 0
+	job.QuotaUsed = 0
+	job.QuotaDay = ""
+	job.NextRun = nextJobRun(job, now)
+	return job
+}
+
+// CreateJob validates and stores a new job running with the given key. Gives back the job, or a status message
+// describing why the job is invalid.
+func (s *Scheduler) CreateJob(job Job, key string) (Job, string, error) {
+	if msg := validateJob(job); msg != "" {
+		return job, msg, nil
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return job, "", err
+	}
+	job.Id = id
+	job = newJobState(job, time.Now())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return job, "", s.store.Put(jobsCollection, job.Id, storedJob{Job: job, Key: key})
+}
+
+// EnsureJob stores a job with a fixed ID running with the given key, such as jobs configured on the server.
+// If the job already exists its definition is updated, while its state and whether it is paused is kept.
+func (s *Scheduler) EnsureJob(job Job, key string) error {
+	if msg := validateJob(job); msg != "" {
+		return fmt.Errorf("job %s is invalid: %s", job.Id, msg)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var current storedJob
+	found, err := s.store.Get(jobsCollection, job.Id, &current)
+	if err != nil {
+		return err
+	}
+	if !found || current.Job.Schedule != job.Schedule || current.Job.Jitter != job.Jitter {
+		paused := current.Job.Paused
+		job = newJobState(job, time.Now())
+		job.Paused = paused
+	} else {
+		state := current.Job
+		state.Type = job.Type
+		state.Targets = job.Targets
+		state.QuotaBudget = job.QuotaBudget
+		state.MaxRetries = job.MaxRetries
+		job = state
+	}
+	return s.store.Put(jobsCollection, job.Id, storedJob{Job: job, Key: key})
+}
+
+// Jobs gives all jobs running with the given key.
+func (s *Scheduler) Jobs(key string) ([]Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids, err := s.store.Keys(jobsCollection)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []Job{}
+	for _, id := range ids {
+		var stored storedJob
+		found, err := s.store.Get(jobsCollection, id, &stored)
+		if err != nil {
+			return nil, err
+		}
+		if found && stored.Key == key {
+			jobs = append(jobs, stored.Job)
+		}
+	}
+	return jobs, nil
+}
+
+// Job gives a job running with the given key, reporting whether it exists.
+func (s *Scheduler) Job(id string, key string) (Job, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var stored storedJob
+	found, err := s.store.Get(jobsCollection, id, &stored)
+	if err != nil || !found || stored.Key != key {
+		return Job{}, false, err
+	}
+	return stored.Job, true, nil
+}
+
+// SetPaused pauses or resumes a job running with the given key, reporting whether it exists. Resumed jobs are
+// scheduled from the time they are resumed.
+func (s *Scheduler) SetPaused(id string, key string, paused bool) (Job, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var stored storedJob
+	found, err := s.store.Get(jobsCollection, id, &stored)
+	if err != nil || !found || stored.Key != key {
+		return Job{}, false, err
+	}
+	if stored.Job.Paused && !paused {
+		stored.Job.NextRun = nextJobRun(stored.Job, time.Now())
+		stored.Job.Retries = 0
+	}
+	stored.Job.Paused = paused
+	return stored.Job, true, s.store.Put(jobsCollection, id, stored)
+}
+
+// DeleteJob deletes a job running with the given key, reporting whether it existed.
+func (s *Scheduler) DeleteJob(id string, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var stored storedJob
+	found, err := s.store.Get(jobsCollection, id, &stored)
+	if err != nil || !found || stored.Key != key {
+		return false, err
+	}
+	return true, s.store.Delete(jobsCollection, id)
+}
@@ -0,0 +1,205 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event types of ChatParser that can be filtered on.
+var chatEventTypes = map[string]bool{
+	"message":                  true,
+	"superchat":                true,
+	"supersticker":             true,
+	"new_member":               true,
+	"membership_milestone":     true,
+	"memberships_gifted":       true,
+	"gift_membership_received": true,
+	"message_deleted":          true,
+	"ban":                      true,
+	"member_only_on":           true,
+	"member_only_off":          true,
+	"tombstone":                true,
+	"chat_ended":               true,
+	"unknown":                  true,
+}
+
+// Roles of chat users that can be filtered on.
+var chatUserRoles = map[string]func(user ChatUser) bool{
+	"owner":     func(user ChatUser) bool { return user.ChatOwner },
+	"moderator": func(user ChatUser) bool { return user.Moderator },
+	"member":    func(user ChatUser) bool { return user.Member },
+	"verified":  func(user ChatUser) bool { return user.Verified },
+}
+
+// Checks a filter for unknown event types and roles. Gives back the status message if it is invalid.
+func validateChatSocketFilter(filter ChatSocketFilter) string {
+	for _, eventType := range filter.Types {
+		if !chatEventTypes[eventType] {
+			return "filterTypeInvalid"
+		}
+	}
+	for _, role := range filter.Roles {
+		if _, ok := chatUserRoles[role]; !ok {
+			return "filterRoleInvalid"
+		}
+	}
+	return validateChatFilters(filter.Filters)
+}
+
+// Checks whether a chat event parsed by ChatParser matches the filter. The end of the chat always matches.
+func (filter ChatSocketFilter) matches(eventType string, event interface{}) bool {
+	if eventType == "chat_ended" {
+		return true
+	}
+	if len(filter.Types) > 0 {
+		matched := false
+		for _, filterType := range filter.Types {
+			matched = matched || filterType == eventType
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(filter.Roles) > 0 {
+		author, ok := chatEventAuthor(event)
+		matched := false
+		for _, role := range filter.Roles {
+			matched = matched || ok && chatUserRoles[role](author)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(filter.Keywords) > 0 {
+		message := strings.ToLower(chatEventMessage(event))
+		matched := false
+		for _, keyword := range filter.Keywords {
+			matched = matched || keyword != "" && strings.Contains(message, strings.ToLower(keyword))
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(filter.Filters) > 0 {
+		_, kept := ChatFilter(filter.Filters, []interface{}{event})
+		return len(kept) == 1
+	}
+	return true
+}
+
+// Relays the events of a chat over a socket until the chat ends or either side closes the socket. Filters sent by
+// the client replace the current filter, which starts out matching all events.
+func relayChatSocket(ws *websocket.Conn, relay *Relay, id string, key string, lastEventId string) {
+	done := make(chan struct{})
+	defer close(done)
+	closed := make(chan struct{})
+	filters := make(chan *ChatSocketFilter)
+	go func() {
+		defer close(closed)
+		for {
+			var text string
+			if err := websocket.Message.Receive(ws, &text); err != nil {
+				return
+			}
+			filter := &ChatSocketFilter{}
+			if err := json.Unmarshal([]byte(text), filter); err != nil {
+				filter = nil
+			}
+			select {
+			case filters <- filter:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	subscription := relay.subscribe(id, key, "", lastEventId)
+	defer subscription.close()
+	filter := ChatSocketFilter{}
+	heartbeat := time.NewTicker(chatHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var message ChatSocketOutbound
+		select {
+		case <-closed:
+			return
+		case update := <-filters:
+			msg := "filterInvalid"
+			if update != nil {
+				msg = validateChatSocketFilter(*update)
+			}
+			if msg != "" {
+				message = ChatSocketOutbound{Type: relayErrorEvent, Status: &StatusCodeOutbound{
+					StatusCode:    http.StatusBadRequest,
+					StatusMessage: msg,
+				}}
+				break
+			}
+			filter = *update
+			message = ChatSocketOutbound{Type: "filter", Filter: &filter}
+		case now := <-heartbeat.C:
+			message = ChatSocketOutbound{Type: "heartbeat", Time: now.UTC().Format(time.RFC3339)}
+		case event, ok := <-subscription.events:
+			if !ok {
+				return
+			}
+			if event.Type == relayErrorEvent {
+				status := event.Event.(StatusCodeOutbound)
+				_ = websocket.JSON.Send(ws, ChatSocketOutbound{Type: relayErrorEvent, Status: &status})
+				return
+			}
+			if !filter.matches(event.Type, event.Event) {
+				continue
+			}
+			message = ChatSocketOutbound{Type: "event", Id: event.Id, Event: event.Event}
+		}
+		if err := websocket.JSON.Send(ws, message); err != nil {
+			return
+		}
+	}
+}
+
+// ChatSocketHandler is the handler for the chat socket endpoint. /ytstats/v1/chat/{id}/socket/
+// Relays the events of a live chat over a WebSocket from the same shared poller as the chat stream endpoint. Clients
+// can send a ChatSocketFilter at any time to only receive matching events, are sent heartbeats while the chat is
+// quiet, and can resume after the last event they received with the last_event_id parameter.
+func ChatSocketHandler(input Inputs) http.Handler {
+	relay := input.Relay
+	if relay == nil {
+		relay = NewRelay(input)
+	}
+	chatSocket := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/chat/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "chatIdMissing")
+				return
+			}
+			lastEventId := r.URL.Query().Get("last_event_id")
+
+			// Upgrade the connection and relay the chat. Clients are not required to send an origin, as the API is
+			// used by bots and other services as well as browsers.
+			server := websocket.Server{Handler: func(ws *websocket.Conn) {
+				relayChatSocket(ws, relay, id, key, lastEventId)
+			}}
+			server.ServeHTTP(w, r)
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(chatSocket)
+}
@@ -0,0 +1,130 @@
+package yt_stats
+
+import (
+	"database/sql"
+	"encoding/json"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// SQLiteStore is a Store backed by a SQLite database file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates a SQLite database at the given path and prepares its tables.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS documents (
+			collection TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (collection, key)
+		);
+		CREATE TABLE IF NOT EXISTS series (
+			series TEXT NOT NULL,
+			key TEXT NOT NULL,
+			time INTEGER NOT NULL,
+			value TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS series_lookup ON series (series, key, time);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Put stores a document, replacing any existing document with the same key.
+func (s *SQLiteStore) Put(collection string, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT OR REPLACE INTO documents (collection, key, value) VALUES (?, ?, ?)",
+		collection, key, string(raw))
+	return err
+}
+
+// Get reads a document into the provided value, reporting whether it exists.
+func (s *SQLiteStore) Get(collection string, key string, value interface{}) (bool, error) {
+	var raw string
+	err := s.db.QueryRow("SELECT value FROM documents WHERE collection = ? AND key = ?", collection, key).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(raw), value)
+}
+
+// Delete removes a document. Deleting a document that does not exist is not an error.
+func (s *SQLiteStore) Delete(collection string, key string) error {
+	_, err := s.db.Exec("DELETE FROM documents WHERE collection = ? AND key = ?", collection, key)
+	return err
+}
+
+// Keys lists the keys of all documents in a collection, sorted.
+func (s *SQLiteStore) Keys(collection string) ([]string, error) {
+	rows, err := s.db.Query("SELECT key FROM documents WHERE collection = ? ORDER BY key", collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Append adds a value to a series at the given time.
+func (s *SQLiteStore) Append(series string, key string, t time.Time, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO series (series, key, time, value) VALUES (?, ?, ?, ?)",
+		series, key, t.UnixNano(), string(raw))
+	return err
+}
+
+// Range reads the values of a series within a time range in chronological order. Zero times leave the range open.
+func (s *SQLiteStore) Range(series string, key string, since time.Time, until time.Time) ([]json.RawMessage, error) {
+	from, to := int64(-1<<63), int64(1<<63-1)
+	if !since.IsZero() {
+		from = since.UnixNano()
+	}
+	if !until.IsZero() {
+		to = until.UnixNano()
+	}
+	rows, err := s.db.Query("SELECT value FROM series WHERE series = ? AND key = ? AND time BETWEEN ? AND ? "+
+		"ORDER BY time, rowid", series, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []json.RawMessage{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		values = append(values, json.RawMessage(raw))
+	}
+	return values, rows.Err()
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
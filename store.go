@@ -0,0 +1,42 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Store persists data collected in the background, such as statistics snapshots and tracked items.
+// Documents are JSON values stored by key within a collection. Series are JSON values stored by key and time,
+// and are read back in chronological order.
+type Store interface {
+	Put(collection string, key string, value interface{}) error
+	Get(collection string, key string, value interface{}) (bool, error)
+	Delete(collection string, key string) error
+	Keys(collection string) ([]string, error)
+	Append(series string, key string, t time.Time, value interface{}) error
+	Range(series string, key string, since time.Time, until time.Time) ([]json.RawMessage, error)
+	Close() error
+}
+
+// OpenStore opens a store from a description such as "sqlite:ytstats.db" or "file:data".
+func OpenStore(description string) (Store, error) {
+	split := strings.SplitN(description, ":", 2)
+	if len(split) != 2 || split[1] == "" {
+		return nil, fmt.Errorf("store %q is not of the form type:path", description)
+	}
+	switch split[0] {
+	case "sqlite":
+		return NewSQLiteStore(split[1])
+	case "file":
+		return NewFileStore(split[1])
+	default:
+		return nil, fmt.Errorf("unknown store type %q", split[0])
+	}
+}
+
+// Checks whether a time lies within a range, where zero times leave the range open in that direction.
+func inTimeRange(t time.Time, since time.Time, until time.Time) bool {
+	return (since.IsZero() || !t.Before(since)) && (until.IsZero() || !t.After(until))
+}
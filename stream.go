@@ -2,11 +2,12 @@ package yt_stats
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // StreamHandler is the handler for the stream endpoint. /ytstats/v1/stream/
@@ -18,8 +19,6 @@ func StreamHandler(input Inputs) http.Handler {
 		case http.MethodGet:
 
 			// Check user input and fail if input is incorrect or missing.
-			var youtubeStatus StatusCodeOutbound
-			var streamInbound StreamInbound
 			key := getKey(r)
 			if key == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
@@ -36,18 +35,9 @@ func StreamHandler(input Inputs) http.Handler {
 			}
 
 			// Query youtube and check response for errors.
-			resp, err := http.Get(fmt.Sprintf("%s&id=%s&key=%s", input.StreamRoot, url.QueryEscape(ids), key))
-			if err != nil {
-				sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-				return
-			}
-			defer resp.Body.Close()
-			quota++
-			youtubeStatus = ErrorParser(resp.Body, &streamInbound)
+			streamInbound, youtubeStatus, cost := queryStreams(input, ids, key)
+			quota += cost
 			if youtubeStatus.StatusCode != http.StatusOK {
-				if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-					quota--
-				}
 				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
 				return
 			}
@@ -56,7 +46,7 @@ func StreamHandler(input Inputs) http.Handler {
 			streamOutbound := StreamParser(streamInbound)
 			streamOutbound.QuotaUsage = quota
 			w.Header().Set("Content-Type", "application/json")
-			err = json.NewEncoder(w).Encode(streamOutbound)
+			err := json.NewEncoder(w).Encode(streamOutbound)
 			if err != nil {
 				log.Println("Failed to respond to stream endpoint.")
 			}
@@ -68,3 +58,493 @@ func StreamHandler(input Inputs) http.Handler {
 	}
 	return http.HandlerFunc(stats)
 }
+
+// StreamViewersHandler is the handler for the stream viewers endpoint. /ytstats/v1/stream/{id}/viewers/
+// Provides the concurrent viewers of a stream sampled over time and a summary of them with GET, and takes a snapshot
+// of a stream with POST, after which it is sampled periodically while it is scheduled or live.
+func StreamViewersHandler(input Inputs) http.Handler {
+	streamViewers := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Tracker == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			var interval time.Duration
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval <= 0 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+
+			// Take a snapshot of the stream, which also makes sure it is a stream.
+			if r.Method == http.MethodPost {
+				youtubeStatus, cost, found, err := input.Tracker.RecordStream(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "streamNotFound")
+					return
+				}
+			}
+
+			// Read the viewers from the store.
+			status, err := input.Tracker.StreamStatus(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if status == "" {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+			summary, viewers, err := input.Tracker.StreamViewers(id, since, until, interval)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+
+			// Provide response.
+			streamViewersOutbound := StreamViewersOutbound{
+				QuotaUsage: quota,
+				StreamId:   id,
+				Status:     status,
+				Summary:    summary,
+				Viewers:    viewers,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(streamViewersOutbound)
+			if err != nil {
+				log.Println("Failed to respond to stream viewers endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamViewers)
+}
+
+// StreamRecordingHandler is the handler for the stream recording endpoint. /ytstats/v1/stream/{id}/recording/
+// Starts recording the chat of a stream into its archive with POST, stops recording with DELETE, and gives the status
+// of the recording with GET. Recordings continue until the chat ends, also across restarts of the server.
+func StreamRecordingHandler(input Inputs) http.Handler {
+	streamRecording := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Recorder == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "recordingDisabled")
+				return
+			}
+
+			// Start, stop or read the recording.
+			var recording ChatRecordingOutbound
+			var found bool
+			var err error
+			switch r.Method {
+			case http.MethodPost:
+				var youtubeStatus StatusCodeOutbound
+				var cost int
+				youtubeStatus, cost, recording, found, err = input.Recorder.Record(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "chatNotActive")
+					return
+				}
+			case http.MethodDelete:
+				recording, found, err = input.Recorder.Stop(id, key)
+			default:
+				recording, found, err = input.Recorder.Recording(id)
+			}
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+
+			// Provide response.
+			recording.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(recording)
+			if err != nil {
+				log.Println("Failed to respond to stream recording endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamRecording)
+}
+
+// StreamReplayHandler is the handler for the stream replay endpoint. /ytstats/v1/stream/{id}/replay/
+// Replays the recorded chat of a stream as Server-Sent Events in the same format as the chat stream endpoint, with
+// the original time between events divided by the speed parameter. The stream closes after the last recorded event.
+func StreamReplayHandler(input Inputs) http.Handler {
+	streamReplay := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Recorder == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "recordingDisabled")
+				return
+			}
+			speed := 1.0
+			if speedParam := r.URL.Query().Get("speed"); speedParam != "" {
+				var err error
+				speed, err = strconv.ParseFloat(speedParam, 64)
+				if err != nil || speed <= 0 || math.IsInf(speed, 0) {
+					sendStatusCode(w, quota, http.StatusBadRequest, "speedInvalid")
+					return
+				}
+			}
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "streamingUnsupported")
+				return
+			}
+			_, found, err := input.Recorder.Recording(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+
+			// Replay the archive, resuming after the last event received if given.
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+			resumeAfter := r.Header.Get("Last-Event-ID")
+			var previous time.Time
+			_, err = input.Recorder.readArchive(id, func(event archivedChatEvent) error {
+				if resumeAfter != "" {
+					if event.Id == resumeAfter {
+						resumeAfter = ""
+					}
+					return nil
+				}
+				if !previous.IsZero() && event.Time.After(previous) {
+					select {
+					case <-r.Context().Done():
+						return r.Context().Err()
+					case <-time.After(time.Duration(float64(event.Time.Sub(previous)) / speed)):
+					}
+				}
+				previous = event.Time
+				err := writeServerSentEvent(w, relayedEvent{Id: event.Id, Type: event.Type, Data: event.Event})
+				flusher.Flush()
+				return err
+			})
+			if err != nil && r.Context().Err() == nil {
+				log.Println("Failed to respond to stream replay endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamReplay)
+}
+
+// StreamAnalyticsHandler is the handler for the stream analytics endpoint. /ytstats/v1/stream/{id}/analytics/
+// Provides statistics on the recorded chat of a stream, optionally limited to a time range, such as messages per
+// minute, new and returning chatters, the top chatters, and a timeline of the chat activity per interval.
+func StreamAnalyticsHandler(input Inputs) http.Handler {
+	streamAnalytics := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Recorder == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "recordingDisabled")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			interval := defaultChatInterval
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval < time.Second {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+			limit := defaultTopChatters
+			if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+				limit, err = strconv.Atoi(limitParam)
+				if err != nil || limit < 1 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "limitInvalid")
+					return
+				}
+			}
+
+			// Analyse the archive.
+			chatAnalyticsOutbound, found, err := input.Recorder.analyze(id, since, until, interval, limit)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+
+			// Provide response.
+			chatAnalyticsOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(chatAnalyticsOutbound)
+			if err != nil {
+				log.Println("Failed to respond to stream analytics endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamAnalytics)
+}
+
+// StreamRevenueHandler is the handler for the stream revenue endpoint. /ytstats/v1/stream/{id}/revenue/
+// Sums up the super chats, super stickers and gifted memberships in the recorded chat of a stream, optionally limited
+// to a time range, per currency, per donor and per interval, converting amounts into the target currency using the
+// exchange rates supplied by the operator. The target currency defaults to the base currency of the exchange rates.
+func StreamRevenueHandler(input Inputs) http.Handler {
+	streamRevenue := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Recorder == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "recordingDisabled")
+				return
+			}
+			currency := strings.ToUpper(r.URL.Query().Get("currency"))
+			if currency == "" && input.Rates != nil {
+				currency = input.Rates.Base()
+			}
+			if currency == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "currencyMissing")
+				return
+			}
+			if len(currency) != 3 {
+				sendStatusCode(w, quota, http.StatusBadRequest, "currencyInvalid")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			interval := defaultChatInterval
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval < time.Second {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+			limit := defaultTopChatters
+			if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+				limit, err = strconv.Atoi(limitParam)
+				if err != nil || limit < 1 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "limitInvalid")
+					return
+				}
+			}
+
+			// Sum up the archive.
+			streamRevenueOutbound, found, err := input.Recorder.revenue(id, since, until, currency, input.Rates,
+				interval, limit)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+
+			// Provide response.
+			streamRevenueOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(streamRevenueOutbound)
+			if err != nil {
+				log.Println("Failed to respond to stream revenue endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamRevenue)
+}
+
+// StreamEmotesHandler is the handler for the stream emotes endpoint. /ytstats/v1/stream/{id}/emotes/
+// Provides frequency tables of the words, Unicode emoji and emote shortcodes in the messages and super chats of the
+// recorded chat of a stream, optionally limited to a time range, and per interval if one is given.
+func StreamEmotesHandler(input Inputs) http.Handler {
+	streamEmotes := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/stream/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "streamIdMissing")
+				return
+			}
+			if input.Recorder == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "recordingDisabled")
+				return
+			}
+			since, until, interval, limit, msg := parseEmotesQuery(r)
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+
+			// Tabulate the archive.
+			emotesOutbound, found, err := input.Recorder.emotes(id, since, until, interval, limit)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingArchive")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "streamNotRecorded")
+				return
+			}
+
+			// Provide response.
+			emotesOutbound.QuotaUsage = quota
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(emotesOutbound)
+			if err != nil {
+				log.Println("Failed to respond to stream emotes endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(streamEmotes)
+}
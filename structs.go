@@ -13,9 +13,20 @@ type Inputs struct {
 	ChannelsRoot      string
 	PlaylistsRoot     string
 	PlaylistItemsRoot string
+	SectionsRoot      string
 	VideosRoot        string
 	StreamRoot        string
 	ChatRoot          string
+	Tracker           *Tracker
+	Scheduler         *Scheduler
+	Dispatcher        *Dispatcher
+	Resolver          *ChatResolver
+	Relay             *Relay
+	Recorder          *Recorder
+	Rates             *ExchangeRates
+	Triggers          *Triggers
+	Giveaways         *Giveaways
+	Moderation        *ModerationLog
 }
 
 // YoutubeErrorInbound represents the JSON received from a YouTube error response.
@@ -54,10 +65,12 @@ type ChannelInbound struct {
 		Snippet struct {
 			Title       string `json:"title"`
 			Description string `json:"description"`
+			CustomUrl   string `json:"customUrl"`
+			PublishedAt string `json:"publishedAt"`
 			Thumbnails  struct {
-				Medium struct {
-					Url string `json:"url"`
-				} `json:"medium"`
+				Default ThumbnailInbound `json:"default"`
+				Medium  ThumbnailInbound `json:"medium"`
+				High    ThumbnailInbound `json:"high"`
 			} `json:"thumbnails"`
 			Country string `json:"country"`
 		} `json:"snippet"`
@@ -72,9 +85,41 @@ type ChannelInbound struct {
 			HiddenSubscriberCount bool   `json:"hiddenSubscriberCount"`
 			VideoCount            string `json:"videoCount"`
 		} `json:"statistics"`
+		BrandingSettings struct {
+			Channel struct {
+				Keywords            string `json:"keywords"`
+				UnsubscribedTrailer string `json:"unsubscribedTrailer"`
+				DefaultLanguage     string `json:"defaultLanguage"`
+			} `json:"channel"`
+			Image struct {
+				BannerExternalUrl string `json:"bannerExternalUrl"`
+			} `json:"image"`
+		} `json:"brandingSettings"`
+		TopicDetails struct {
+			TopicIds        []string `json:"topicIds"`
+			TopicCategories []string `json:"topicCategories"`
+		} `json:"topicDetails"`
+		Status struct {
+			PrivacyStatus           string `json:"privacyStatus"`
+			IsLinked                bool   `json:"isLinked"`
+			LongUploadsStatus       string `json:"longUploadsStatus"`
+			MadeForKids             bool   `json:"madeForKids"`
+			SelfDeclaredMadeForKids bool   `json:"selfDeclaredMadeForKids"`
+		} `json:"status"`
+		Localizations map[string]struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		} `json:"localizations"`
 	} `json:"items"`
 }
 
+// ThumbnailInbound represents one thumbnail size received from YouTube.
+type ThumbnailInbound struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
 // Channel represets the JSON for one channel. Part of ChannelOutbound struct.
 type Channel struct {
 	Id                    string `json:"id"`
@@ -87,6 +132,60 @@ type Channel struct {
 	HiddenSubscriberCount bool   `json:"hidden_subscriber_count"`
 	SubscriberCount       int    `json:"subscriber_count"`
 	VideoCount            int    `json:"video_count"`
+
+	// Optional parts, only included when requested.
+	CustomUrl     string                `json:"custom_url,omitempty"`
+	PublishedAt   string                `json:"published_at,omitempty"`
+	Thumbnails    *ChannelThumbnails    `json:"thumbnails,omitempty"`
+	Branding      *ChannelBranding      `json:"branding,omitempty"`
+	Topics        *ChannelTopics        `json:"topics,omitempty"`
+	Status        *ChannelStatus        `json:"status,omitempty"`
+	Localizations []ChannelLocalization `json:"localizations,omitempty"`
+}
+
+// Thumbnail represents the JSON for one thumbnail size.
+type Thumbnail struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ChannelThumbnails represents the JSON for all thumbnail sizes of a channel. Part of Channel struct.
+type ChannelThumbnails struct {
+	Default Thumbnail `json:"default"`
+	Medium  Thumbnail `json:"medium"`
+	High    Thumbnail `json:"high"`
+}
+
+// ChannelBranding represents the JSON for the branding settings of a channel. Part of Channel struct.
+type ChannelBranding struct {
+	Keywords            []string `json:"keywords"`
+	UnsubscribedTrailer string   `json:"unsubscribed_trailer"`
+	DefaultLanguage     string   `json:"default_language"`
+	Banner              string   `json:"banner"`
+}
+
+// ChannelTopics represents the JSON for the topics of a channel. Part of Channel struct.
+type ChannelTopics struct {
+	TopicIds        []string `json:"topic_ids"`
+	TopicCategories []string `json:"topic_categories"`
+}
+
+// ChannelStatus represents the JSON for the status of a channel. Part of Channel struct.
+type ChannelStatus struct {
+	PrivacyStatus           string `json:"privacy_status"`
+	IsLinked                bool   `json:"is_linked"`
+	LongUploadsStatus       string `json:"long_uploads_status"`
+	MadeForKids             bool   `json:"made_for_kids"`
+	SelfDeclaredMadeForKids bool   `json:"self_declared_made_for_kids"`
+}
+
+// ChannelLocalization represents the JSON for the title and description of a channel in one language.
+// Part of Channel struct.
+type ChannelLocalization struct {
+	Language    string `json:"language"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
 // ChannelOutbound represets the JSON sent by the Channel endpoint.
@@ -97,7 +196,8 @@ type ChannelOutbound struct {
 
 // PlaylistInbound represents the JSON received from the YouTube Playlists endpoint.
 type PlaylistInbound struct {
-	Items []struct {
+	NextPageToken string `json:"nextPageToken"`
+	Items         []struct {
 		Id      string `json:"id"`
 		Snippet struct {
 			PublishedAt string `json:"publishedAt"`
@@ -117,15 +217,67 @@ type PlaylistInbound struct {
 	} `json:"items"`
 }
 
+// ChannelPlaylistsOutbound represents the JSON sent by the Channel Playlists endpoint.
+type ChannelPlaylistsOutbound struct {
+	QuotaUsage int        `json:"quota_usage"`
+	ChannelId  string     `json:"channel_id"`
+	Playlists  []Playlist `json:"playlists"`
+}
+
+// SectionsInbound represents the JSON received from the YouTube ChannelSections endpoint.
+type SectionsInbound struct {
+	Items []struct {
+		Id      string `json:"id"`
+		Snippet struct {
+			Type      string `json:"type"`
+			ChannelId string `json:"channelId"`
+			Title     string `json:"title"`
+			Position  int    `json:"position"`
+		} `json:"snippet"`
+		ContentDetails struct {
+			Playlists []string `json:"playlists"`
+			Channels  []string `json:"channels"`
+		} `json:"contentDetails"`
+	} `json:"items"`
+}
+
+// Section represents the JSON for one channel section. Part of SectionsOutbound struct.
+type Section struct {
+	Id        string   `json:"id"`
+	Type      string   `json:"type"`
+	Title     string   `json:"title,omitempty"`
+	Position  int      `json:"position"`
+	Playlists []string `json:"playlists,omitempty"`
+	Channels  []string `json:"channels,omitempty"`
+}
+
+// SectionsOutbound represents the JSON sent by the Channel Sections endpoint.
+type SectionsOutbound struct {
+	QuotaUsage int       `json:"quota_usage"`
+	ChannelId  string    `json:"channel_id"`
+	Sections   []Section `json:"sections"`
+}
+
+// FeaturedChannelsOutbound represents the JSON sent by the Featured Channels endpoint.
+type FeaturedChannelsOutbound struct {
+	QuotaUsage int       `json:"quota_usage"`
+	ChannelId  string    `json:"channel_id"`
+	Channels   []Channel `json:"channels"`
+}
+
 // PlaylistItemsInbound represents the JSON received from the YouTube PlaylistsItems endpoint.
 type PlaylistItemsInbound struct {
 	NextPageToken string `json:"nextPageToken"`
 	Items         []struct {
 		Snippet struct {
-			ResourceId struct {
+			PublishedAt string `json:"publishedAt"`
+			ResourceId  struct {
 				VideoId string `json:"videoId"`
 			} `json:"resourceId"`
 		} `json:"snippet"`
+		ContentDetails struct {
+			VideoPublishedAt string `json:"videoPublishedAt"`
+		} `json:"contentDetails"`
 	} `json:"items"`
 }
 
@@ -225,6 +377,15 @@ type VideoOutbound struct {
 	Videos     []Video     `json:"videos"`
 }
 
+// ChannelVideosOutbound represents the JSON sent by the Channel Videos endpoint.
+type ChannelVideosOutbound struct {
+	QuotaUsage      int         `json:"quota_usage"`
+	ChannelId       string      `json:"channel_id"`
+	UploadsPlaylist string      `json:"uploads_playlist"`
+	VideoStats      *VideoStats `json:"video_stats,omitempty"`
+	Videos          []Video     `json:"videos"`
+}
+
 // CommentsInbound represents the JSON received from the YouTube CommentThreads endpoint.
 type CommentsInbound struct {
 	NextPageToken string `json:"nextPageToken"`
@@ -314,13 +475,16 @@ type CommentOutbound struct {
 	Comments   []interface{} `json:"comments"`
 }
 
-// Filter represents the JSON for a filter query.
+// Filter represents the JSON for a filter query. Used to filter comments as well as chat events, where users match
+// names and IDs of authors, types match the types of comments and chat events, and roles match roles of chat users.
 type Filter struct {
 	CaseSensitive bool     `json:"case_sensitive"`
 	MatchAny      bool     `json:"match_any"`
 	Reductive     bool     `json:"reductive"`
 	Users         []string `json:"users"`
 	Content       []string `json:"content"`
+	Types         []string `json:"types"`
+	Roles         []string `json:"roles"`
 }
 
 // StreamInbound represents the JSON received from the YouTube Video endpoint used for Streams endpoint.
@@ -386,17 +550,22 @@ type ChatInbound struct {
 				BanDurationSeconds int    `json:"banDurationSeconds"`
 			} `json:"userBannedDetails"`
 			SuperChatDetails struct {
-				AmountMicros string `json:"amountMicros"`
-				Currency     string `json:"currency"`
-				UserComment  string `json:"userComment"`
+				AmountMicros        string `json:"amountMicros"`
+				Currency            string `json:"currency"`
+				AmountDisplayString string `json:"amountDisplayString"`
+				UserComment         string `json:"userComment"`
+				Tier                int    `json:"tier"`
 			} `json:"superChatDetails"`
 			SuperStickerDetails struct {
 				SuperStickerMetadata struct {
 					StickerId string `json:"stickerId"`
 					AltText   string `json:"altText"`
+					Language  string `json:"language"`
 				} `json:"superStickerMetadata"`
-				AmountMicros string `json:"amountMicros"`
-				Currency     string `json:"currency"`
+				AmountMicros        string `json:"amountMicros"`
+				Currency            string `json:"currency"`
+				AmountDisplayString string `json:"amountDisplayString"`
+				Tier                int    `json:"tier"`
 			} `json:"superStickerDetails"`
 			NewSponsorDetails struct {
 				MemberLevelName string `json:"memberLevelName"`
@@ -429,15 +598,49 @@ type ChatInbound struct {
 	} `json:"items"`
 }
 
-// ChatOutbound represents the JSON sent by the Chat endpoint.
+// ChatOutbound represents the JSON sent by the Chat endpoint. The video and its concurrent viewers are only given if
+// the chat was looked up by video or channel.
 type ChatOutbound struct {
 	QuotaUsage        int           `json:"quota_usage"`
 	ChatId            string        `json:"chat_id"`
+	VideoId           string        `json:"video_id,omitempty"`
+	ConcurrentViewers *int          `json:"concurrent_viewers,omitempty"`
 	NextPage          string        `json:"next_page"`
 	SuggestedCooldown int           `json:"suggested_cooldown"`
 	ChatEvents        []interface{} `json:"chat_events"`
 }
 
+// ChatSocketFilter represents the JSON sent to the chat socket to choose which events to receive. Events are received
+// if they have one of the types, are caused by a user with one of the roles, contain one of the keywords, and are
+// kept by the filters, which work like the filters of the comments endpoint. Empty lists match all events.
+type ChatSocketFilter struct {
+	Types    []string `json:"types"`
+	Roles    []string `json:"roles"`
+	Keywords []string `json:"keywords"`
+	Filters  []Filter `json:"filters"`
+}
+
+// ChatSocketOutbound represents the JSON of messages sent by the chat socket. Chat events are sent as event messages,
+// while filter messages confirm a new filter, and error messages report invalid filters or failed polling.
+type ChatSocketOutbound struct {
+	Type   string              `json:"type"`
+	Id     string              `json:"id,omitempty"`
+	Event  interface{}         `json:"event,omitempty"`
+	Filter *ChatSocketFilter   `json:"filter,omitempty"`
+	Status *StatusCodeOutbound `json:"status,omitempty"`
+	Time   string              `json:"time,omitempty"`
+}
+
+// ChatFeedEvent represents the JSON of events sent by the chat feed endpoint. Chat events are sent along with the
+// source they came from, as given in the request, and the status is sent in place of the event when a source fails.
+type ChatFeedEvent struct {
+	Source  string              `json:"source"`
+	VideoId string              `json:"video_id,omitempty"`
+	ChatId  string              `json:"chat_id,omitempty"`
+	Event   interface{}         `json:"event,omitempty"`
+	Status  *StatusCodeOutbound `json:"status,omitempty"`
+}
+
 // ChatUser represents the JSON for a user in chat. Part of chat events.
 type ChatUser struct {
 	UserName       string `json:"user_name"`
@@ -529,25 +732,30 @@ type ChatMemberOnlyModeStarted struct {
 
 // ChatSuperChat represents the JSON for a super chat. Part of ChatOutbound.
 type ChatSuperChat struct {
-	Id          string   `json:"id"`
-	Type        string   `json:"type"`
-	PublishedAt string   `json:"published_at"`
-	Message     string   `json:"message"`
-	Amount      float64  `json:"amount"`
-	Currency    string   `json:"currency"`
-	SentBy      ChatUser `json:"sent_by"`
+	Id            string   `json:"id"`
+	Type          string   `json:"type"`
+	PublishedAt   string   `json:"published_at"`
+	Message       string   `json:"message"`
+	Amount        float64  `json:"amount"`
+	Currency      string   `json:"currency"`
+	AmountDisplay string   `json:"amount_display"`
+	Tier          int      `json:"tier"`
+	SentBy        ChatUser `json:"sent_by"`
 }
 
 // ChatSuperSticker represents the JSON for a super sticker. Part of ChatOutbound.
 type ChatSuperSticker struct {
-	Id          string   `json:"id"`
-	Type        string   `json:"type"`
-	PublishedAt string   `json:"published_at"`
-	Amount      float64  `json:"amount"`
-	Currency    string   `json:"currency"`
-	StickerId   string   `json:"sticker_id"`
-	AltText     string   `json:"alt_text"`
-	SentBy      ChatUser `json:"sent_by"`
+	Id            string   `json:"id"`
+	Type          string   `json:"type"`
+	PublishedAt   string   `json:"published_at"`
+	Amount        float64  `json:"amount"`
+	Currency      string   `json:"currency"`
+	AmountDisplay string   `json:"amount_display"`
+	Tier          int      `json:"tier"`
+	StickerId     string   `json:"sticker_id"`
+	AltText       string   `json:"alt_text"`
+	Language      string   `json:"language"`
+	SentBy        ChatUser `json:"sent_by"`
 }
 
 // ChatMessage represents the JSON for chat message. Part of ChatOutbound.
@@ -582,3 +790,437 @@ type ChatUnknownEvent struct {
 	Type  string      `json:"type"`
 	Event interface{} `json:"event"`
 }
+
+// GraphQLInbound represents the JSON for a query sent to the GraphQL endpoint.
+type GraphQLInbound struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// ChannelHistoryPoint represents the JSON for the statistics of a channel at one point in time.
+// Part of ChannelHistoryOutbound struct.
+type ChannelHistoryPoint struct {
+	Time                  string `json:"time"`
+	HiddenSubscriberCount bool   `json:"hidden_subscriber_count"`
+	SubscriberCount       int    `json:"subscriber_count"`
+	ViewCount             int    `json:"view_count"`
+	VideoCount            int    `json:"video_count"`
+	SubscriberDelta       *int   `json:"subscriber_delta,omitempty"`
+	ViewDelta             *int   `json:"view_delta,omitempty"`
+	VideoDelta            *int   `json:"video_delta,omitempty"`
+}
+
+// ChannelHistoryOutbound represents the JSON sent by the Channel History endpoint.
+type ChannelHistoryOutbound struct {
+	QuotaUsage int                   `json:"quota_usage"`
+	ChannelId  string                `json:"channel_id"`
+	Tracked    bool                  `json:"tracked"`
+	History    []ChannelHistoryPoint `json:"history"`
+}
+
+// VideoHistoryPoint represents the JSON for the statistics of a video at one point in time.
+// Part of VideoHistoryOutbound struct.
+type VideoHistoryPoint struct {
+	Time             string   `json:"time"`
+	ViewCount        int      `json:"view_count"`
+	LikeCount        int      `json:"like_count"`
+	CommentCount     int      `json:"comment_count"`
+	ViewsPerHour     *float64 `json:"views_per_hour,omitempty"`
+	LikesPerHour     *float64 `json:"likes_per_hour,omitempty"`
+	CommentsPerHour  *float64 `json:"comments_per_hour,omitempty"`
+	ViewAcceleration *float64 `json:"view_acceleration,omitempty"`
+}
+
+// VideoHistoryOutbound represents the JSON sent by the Video History endpoint.
+type VideoHistoryOutbound struct {
+	QuotaUsage   int                 `json:"quota_usage"`
+	VideoId      string              `json:"video_id"`
+	Watched      bool                `json:"watched"`
+	WatchedUntil string              `json:"watched_until,omitempty"`
+	History      []VideoHistoryPoint `json:"history"`
+}
+
+// ViewerSample represents the JSON for the concurrent viewers of a live stream at one point in time.
+// Part of StreamViewersOutbound struct.
+type ViewerSample struct {
+	Time              string `json:"time"`
+	ConcurrentViewers int    `json:"concurrent_viewers"`
+}
+
+// ViewerSummary represents the JSON summarizing the viewer samples of a stream. Part of StreamViewersOutbound struct.
+type ViewerSummary struct {
+	Samples        int     `json:"samples"`
+	PeakViewers    int     `json:"peak_viewers"`
+	PeakTime       string  `json:"peak_time,omitempty"`
+	AverageViewers float64 `json:"average_viewers"`
+	StartTime      string  `json:"start_time,omitempty"`
+	EndTime        string  `json:"end_time,omitempty"`
+	DurationLive   int     `json:"duration_live"`
+}
+
+// StreamViewersOutbound represents the JSON sent by the Stream Viewers endpoint.
+type StreamViewersOutbound struct {
+	QuotaUsage int            `json:"quota_usage"`
+	StreamId   string         `json:"stream_id"`
+	Status     string         `json:"status"`
+	Summary    ViewerSummary  `json:"summary"`
+	Viewers    []ViewerSample `json:"viewers"`
+}
+
+// ChatterCount represents the JSON for a chatter and the amount of messages they wrote. Part of
+// ChatAnalyticsOutbound struct.
+type ChatterCount struct {
+	Chatter  ChatUser `json:"chatter"`
+	Messages int      `json:"messages"`
+}
+
+// ChatActivityBucket represents the JSON for the chat activity within one interval. Part of ChatAnalyticsOutbound
+// struct.
+type ChatActivityBucket struct {
+	Time     string `json:"time"`
+	Events   int    `json:"events"`
+	Messages int    `json:"messages"`
+	Chatters int    `json:"chatters"`
+}
+
+// ChatAnalyticsOutbound represents the JSON sent by the Stream Analytics and Chat Analytics endpoints.
+type ChatAnalyticsOutbound struct {
+	QuotaUsage        int                  `json:"quota_usage"`
+	Id                string               `json:"id"`
+	Source            string               `json:"source"`
+	StartTime         string               `json:"start_time,omitempty"`
+	EndTime           string               `json:"end_time,omitempty"`
+	Events            int                  `json:"events"`
+	Messages          int                  `json:"messages"`
+	MessagesPerMinute float64              `json:"messages_per_minute"`
+	UniqueChatters    int                  `json:"unique_chatters"`
+	NewChatters       int                  `json:"new_chatters"`
+	ReturningChatters int                  `json:"returning_chatters"`
+	MemberShare       float64              `json:"member_share"`
+	ModeratorShare    float64              `json:"moderator_share"`
+	Bans              int                  `json:"bans"`
+	Deletions         int                  `json:"deletions"`
+	TopChatters       []ChatterCount       `json:"top_chatters"`
+	Interval          int                  `json:"interval,omitempty"`
+	Timeline          []ChatActivityBucket `json:"timeline"`
+}
+
+// TokenCount represents the JSON for how often a word, emoji or emote was used. Part of EmotesOutbound and EmoteBucket
+// structs.
+type TokenCount struct {
+	Token string `json:"token"`
+	Count int    `json:"count"`
+}
+
+// EmoteBucket represents the JSON for the words, emojis and emotes used within one interval. Part of EmotesOutbound
+// struct.
+type EmoteBucket struct {
+	Time     string       `json:"time"`
+	Messages int          `json:"messages"`
+	Words    []TokenCount `json:"words"`
+	Emojis   []TokenCount `json:"emojis"`
+	Emotes   []TokenCount `json:"emotes"`
+}
+
+// EmotesOutbound represents the JSON sent by the Stream Emotes and Video Emotes endpoints. The source is chat for the
+// recorded chat of a stream, and comments for the comments and replies of a video.
+type EmotesOutbound struct {
+	QuotaUsage  int           `json:"quota_usage"`
+	VideoId     string        `json:"video_id"`
+	Source      string        `json:"source"`
+	StartTime   string        `json:"start_time,omitempty"`
+	EndTime     string        `json:"end_time,omitempty"`
+	Messages    int           `json:"messages"`
+	TotalWords  int           `json:"total_words"`
+	TotalEmojis int           `json:"total_emojis"`
+	TotalEmotes int           `json:"total_emotes"`
+	Words       []TokenCount  `json:"words"`
+	Emojis      []TokenCount  `json:"emojis"`
+	Emotes      []TokenCount  `json:"emotes"`
+	Interval    int           `json:"interval,omitempty"`
+	Timeline    []EmoteBucket `json:"timeline"`
+}
+
+// ExchangeRateSet represents the JSON for the exchange rates taking effect on a day, in units of each currency per
+// unit of the base currency. Part of ExchangeRatesOutbound struct.
+type ExchangeRateSet struct {
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// ExchangeRatesOutbound represents the JSON sent by the Exchange Rates endpoint.
+type ExchangeRatesOutbound struct {
+	QuotaUsage int               `json:"quota_usage"`
+	Base       string            `json:"base"`
+	Rates      []ExchangeRateSet `json:"rates"`
+}
+
+// CurrencyRevenue represents the JSON for the revenue of a stream in one currency. Part of StreamRevenueOutbound
+// struct.
+type CurrencyRevenue struct {
+	Currency  string  `json:"currency"`
+	Amount    float64 `json:"amount"`
+	Count     int     `json:"count"`
+	Converted float64 `json:"converted"`
+}
+
+// DonorRevenue represents the JSON for what one user gave on a stream. Part of StreamRevenueOutbound struct.
+type DonorRevenue struct {
+	Donor             ChatUser `json:"donor"`
+	Amount            float64  `json:"amount"`
+	SuperChats        int      `json:"super_chats"`
+	SuperStickers     int      `json:"super_stickers"`
+	GiftedMemberships int      `json:"gifted_memberships"`
+}
+
+// RevenueBucket represents the JSON for the revenue of a stream within one interval. Part of StreamRevenueOutbound
+// struct.
+type RevenueBucket struct {
+	Time              string  `json:"time"`
+	Amount            float64 `json:"amount"`
+	SuperChats        int     `json:"super_chats"`
+	SuperStickers     int     `json:"super_stickers"`
+	GiftedMemberships int     `json:"gifted_memberships"`
+}
+
+// StreamRevenueOutbound represents the JSON sent by the Stream Revenue endpoint.
+type StreamRevenueOutbound struct {
+	QuotaUsage        int               `json:"quota_usage"`
+	StreamId          string            `json:"stream_id"`
+	Currency          string            `json:"currency"`
+	Total             float64           `json:"total"`
+	SuperChats        int               `json:"super_chats"`
+	SuperStickers     int               `json:"super_stickers"`
+	GiftedMemberships int               `json:"gifted_memberships"`
+	Unconverted       []string          `json:"unconverted"`
+	ByCurrency        []CurrencyRevenue `json:"by_currency"`
+	TopDonors         []DonorRevenue    `json:"top_donors"`
+	Interval          int               `json:"interval,omitempty"`
+	Timeline          []RevenueBucket   `json:"timeline"`
+}
+
+// ChatRecordingOutbound represents the JSON sent by the Stream Recording endpoint.
+type ChatRecordingOutbound struct {
+	QuotaUsage int    `json:"quota_usage"`
+	VideoId    string `json:"video_id"`
+	ChatId     string `json:"chat_id"`
+	Status     string `json:"status"`
+	Events     int    `json:"events"`
+	StartedAt  string `json:"started_at"`
+	EndedAt    string `json:"ended_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ModerationAction represents the JSON for one moderation action in a live chat. Part of ModerationLogOutbound
+// struct. The user is the banned user, or the author of the deleted message if it was seen before it was deleted.
+type ModerationAction struct {
+	Id        string    `json:"id"`
+	Action    string    `json:"action"`
+	Time      string    `json:"time"`
+	VideoId   string    `json:"video_id"`
+	ChatId    string    `json:"chat_id"`
+	Moderator ChatUser  `json:"moderator"`
+	User      *ChatUser `json:"user,omitempty"`
+	Duration  int       `json:"duration,omitempty"`
+	MessageId string    `json:"message_id,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// ModerationLogOutbound represents the JSON sent by the Channel Moderation endpoint.
+type ModerationLogOutbound struct {
+	QuotaUsage int                `json:"quota_usage"`
+	ChannelId  string             `json:"channel_id"`
+	Following  bool               `json:"following"`
+	Status     string             `json:"status"`
+	VideoId    string             `json:"video_id"`
+	ChatId     string             `json:"chat_id"`
+	Error      string             `json:"error,omitempty"`
+	Actions    []ModerationAction `json:"actions"`
+}
+
+// ChannelLiveOutbound represents the JSON sent by the Channel Live endpoint. Streams are LiveStream or Stream structs.
+type ChannelLiveOutbound struct {
+	QuotaUsage int           `json:"quota_usage"`
+	ChannelId  string        `json:"channel_id"`
+	Watched    bool          `json:"watched"`
+	Streams    []interface{} `json:"streams"`
+}
+
+// ChatTrigger represents the JSON for one trigger on a live chat. Part of ChatTriggersOutbound struct, and received
+// by the Chat Triggers endpoint when creating a trigger, where the ID and creation time are ignored.
+type ChatTrigger struct {
+	Id        string  `json:"id"`
+	Type      string  `json:"type"`
+	Command   string  `json:"command,omitempty"`
+	Pattern   string  `json:"pattern,omitempty"`
+	MinAmount float64 `json:"min_amount,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	Cooldown  int     `json:"cooldown"`
+	CreatedAt string  `json:"created_at,omitempty"`
+}
+
+// ChatTriggersOutbound represents the JSON sent by the Chat Triggers endpoint.
+type ChatTriggersOutbound struct {
+	QuotaUsage int           `json:"quota_usage"`
+	ChatId     string        `json:"chat_id"`
+	Watching   bool          `json:"watching"`
+	Triggers   []ChatTrigger `json:"triggers"`
+}
+
+// ChatTriggerEvent represents the JSON data of a chat.trigger event, sent when a chat event matches a trigger, and of
+// the notifications sent by the Chat Notifications endpoint. The event is the chat event that matched.
+type ChatTriggerEvent struct {
+	ChatId      string      `json:"chat_id"`
+	TriggerId   string      `json:"trigger_id"`
+	TriggerType string      `json:"trigger_type"`
+	Args        []string    `json:"args"`
+	Event       interface{} `json:"event"`
+}
+
+// PollVotes represents the JSON for the votes for one option of a poll. Part of Giveaway struct.
+type PollVotes struct {
+	Option string `json:"option"`
+	Votes  int    `json:"votes"`
+}
+
+// GiveawayEntrant represents the JSON for a user who entered a giveaway or voted in a poll, and when. Part of
+// Giveaway struct.
+type GiveawayEntrant struct {
+	User ChatUser `json:"user"`
+	Vote string   `json:"vote,omitempty"`
+	Time string   `json:"time"`
+}
+
+// Giveaway represents the JSON for one giveaway or poll on a live chat. Part of GiveawaysOutbound struct, and received
+// by the Giveaways endpoint when opening a giveaway or poll, where the state fields are ignored. The seed is only
+// given once a giveaway is closed, and the entrants only when requesting one giveaway or poll.
+type Giveaway struct {
+	Id                string            `json:"id"`
+	ChatId            string            `json:"chat_id"`
+	Type              string            `json:"type"`
+	Keyword           string            `json:"keyword,omitempty"`
+	Options           []string          `json:"options,omitempty"`
+	MembersOnly       bool              `json:"members_only"`
+	ExcludeModerators bool              `json:"exclude_moderators"`
+	Status            string            `json:"status"`
+	OpenedAt          string            `json:"opened_at,omitempty"`
+	ClosedAt          string            `json:"closed_at,omitempty"`
+	Entries           int               `json:"entries"`
+	Votes             []PollVotes       `json:"votes,omitempty"`
+	SeedHash          string            `json:"seed_hash,omitempty"`
+	Seed              string            `json:"seed,omitempty"`
+	Winner            *ChatUser         `json:"winner,omitempty"`
+	Entrants          []GiveawayEntrant `json:"entrants,omitempty"`
+}
+
+// GiveawaysOutbound represents the JSON sent by the Giveaways endpoints.
+type GiveawaysOutbound struct {
+	QuotaUsage int        `json:"quota_usage"`
+	Giveaways  []Giveaway `json:"giveaways"`
+}
+
+// Job represents the JSON for one recurring collection job. Part of JobsOutbound struct, and received by the Jobs
+// endpoint when creating a job, where the state fields are ignored.
+type Job struct {
+	Id          string   `json:"id"`
+	Type        string   `json:"type"`
+	Targets     []string `json:"targets,omitempty"`
+	Schedule    string   `json:"schedule"`
+	Jitter      string   `json:"jitter,omitempty"`
+	QuotaBudget int      `json:"quota_budget,omitempty"`
+	MaxRetries  int      `json:"max_retries,omitempty"`
+	Paused      bool     `json:"paused"`
+	NextRun     string   `json:"next_run,omitempty"`
+	LastRun     string   `json:"last_run,omitempty"`
+	LastStatus  string   `json:"last_status,omitempty"`
+	LastError   string   `json:"last_error,omitempty"`
+	Retries     int      `json:"retries"`
+	QuotaUsed   int      `json:"quota_used"`
+	QuotaDay    string   `json:"quota_day,omitempty"`
+}
+
+// JobsOutbound represents the JSON sent by the Jobs endpoint.
+type JobsOutbound struct {
+	QuotaUsage int   `json:"quota_usage"`
+	Jobs       []Job `json:"jobs"`
+}
+
+// Webhook represents the JSON for one webhook subscription. The secret is only sent when the webhook is created.
+type Webhook struct {
+	Id        string   `json:"id"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	Targets   []string `json:"targets,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+// WebhooksOutbound represents the JSON sent by the Webhooks endpoint.
+type WebhooksOutbound struct {
+	QuotaUsage int       `json:"quota_usage"`
+	Webhooks   []Webhook `json:"webhooks"`
+}
+
+// WebhookEvent represents the JSON body of a webhook delivery.
+type WebhookEvent struct {
+	Id       string      `json:"id"`
+	Type     string      `json:"type"`
+	Time     string      `json:"time"`
+	Subject  string      `json:"subject,omitempty"`
+	Keywords []string    `json:"keywords,omitempty"`
+	Data     interface{} `json:"data"`
+}
+
+// ChannelMilestoneEvent represents the JSON data of a channel.milestone event, sent when a tracked channel
+// reaches a subscriber milestone such as 1000, 2000 or 10000 subscribers.
+type ChannelMilestoneEvent struct {
+	ChannelId       string `json:"channel_id"`
+	Title           string `json:"title"`
+	Milestone       int    `json:"milestone"`
+	SubscriberCount int    `json:"subscriber_count"`
+}
+
+// VideoUploadedEvent represents the JSON data of a video.uploaded event, sent when a tracked channel uploads a video.
+type VideoUploadedEvent struct {
+	ChannelId   string `json:"channel_id"`
+	VideoId     string `json:"video_id"`
+	PublishedAt string `json:"published_at"`
+}
+
+// StreamEvent represents the JSON data of the stream.scheduled, stream.rescheduled, stream.live and stream.ended
+// events. The stream is a LiveStream or Stream struct, and the channel is only known for streams of watched channels.
+type StreamEvent struct {
+	ChannelId                  string      `json:"channel_id,omitempty"`
+	PreviousScheduledStartTime string      `json:"previous_scheduled_start_time,omitempty"`
+	Stream                     interface{} `json:"stream"`
+}
+
+// CommentKeywordEvent represents the JSON data of a comment.keyword event, sent when a new comment on a video
+// contains a keyword of the webhook.
+type CommentKeywordEvent struct {
+	VideoId string  `json:"video_id"`
+	Comment Comment `json:"comment"`
+}
+
+// WebhookDelivery represents the JSON for one delivery of an event to a webhook. Part of WebhookDeliveriesOutbound.
+type WebhookDelivery struct {
+	Id           string       `json:"id"`
+	Event        string       `json:"event"`
+	Status       string       `json:"status"`
+	Attempts     int          `json:"attempts"`
+	CreatedAt    string       `json:"created_at"`
+	NextAttempt  string       `json:"next_attempt,omitempty"`
+	LastAttempt  string       `json:"last_attempt,omitempty"`
+	ResponseCode int          `json:"response_code,omitempty"`
+	LastError    string       `json:"last_error,omitempty"`
+	Payload      WebhookEvent `json:"payload"`
+}
+
+// WebhookDeliveriesOutbound represents the JSON sent by the Webhook Deliveries endpoint.
+type WebhookDeliveriesOutbound struct {
+	QuotaUsage int               `json:"quota_usage"`
+	WebhookId  string            `json:"webhook_id"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
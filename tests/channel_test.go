@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 	"yt_stats"
 )
 
@@ -114,3 +116,844 @@ func TestChannelHandlerTooManyChannels(t *testing.T) {
 func TestChannelHandlerUnsupportedType(t *testing.T) {
 	unsupportedRequestType(t, yt_stats.ChannelHandler, "/ytstats/v1/channel/", "PUT")
 }
+
+// Fake YouTube API with one channel that published a video every day of January 2021, listed newest first. The video
+// of the 20th was uploaded two days before it was published.
+func mockChannelVideos(t *testing.T) (yt_stats.Inputs, map[string]int) {
+	requests := make(map[string]int)
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/channels":
+			fmt.Fprint(w, `{"items":[{"id":"UC1","contentDetails":{"relatedPlaylists":{"uploads":"UU1"}},`+
+				`"statistics":{"viewCount":"0","subscriberCount":"0","videoCount":"31"}}]}`)
+		case "/playlistItems":
+			first, next := 31, `"nextPageToken":"page2",`
+			if r.URL.Query().Get("pageToken") == "page2" {
+				first, next = 11, ""
+			}
+			var items []string
+			for day := first; day > first-20 && day > 0; day-- {
+				uploaded := day
+				if day == 20 {
+					uploaded = 18
+				}
+				items = append(items, fmt.Sprintf(`{"snippet":{"publishedAt":"2021-01-%02dT12:00:00Z",`+
+					`"resourceId":{"videoId":"v%d"}},"contentDetails":{"videoPublishedAt":"2021-01-%02dT12:00:00Z"}}`,
+					uploaded, day, day))
+			}
+			fmt.Fprintf(w, `{%s"items":[%s]}`, next, strings.Join(items, ","))
+		case "/videos":
+			var items []string
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				items = append(items, fmt.Sprintf(`{"id":"%s","snippet":{"publishedAt":"2021-01-%02sT12:00:00Z"},`+
+					`"contentDetails":{"duration":"PT1M"},"statistics":{"viewCount":"%s","likeCount":"0",`+
+					`"commentCount":"0"}}`, id, id[1:], id[1:]))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		}
+	})
+	return inputs, requests
+}
+
+// Requests the channel videos endpoint for the mocked channel with the given query parameters.
+func getChannelVideos(t *testing.T, inputs yt_stats.Inputs, query string) yt_stats.ChannelVideosOutbound {
+	var response yt_stats.ChannelVideosOutbound
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/UC1/videos/?"+query, nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelVideosHandler(inputs)
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: expected %v actually %v", http.StatusOK, status)
+	}
+	err = json.NewDecoder(rr.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("failed decoding response from endpoint")
+	}
+	return response
+}
+
+func TestChannelVideosHandlerAllUploads(t *testing.T) {
+	inputs, requests := mockChannelVideos(t)
+	response := getChannelVideos(t, inputs, "")
+	if len(response.Videos) != 31 || response.UploadsPlaylist != "UU1" {
+		t.Errorf("handler returned wrong body, expected 31 videos from UU1 actually %d from %s",
+			len(response.Videos), response.UploadsPlaylist)
+	}
+	if response.VideoStats == nil || response.VideoStats.MostViewedVideo != "v31" {
+		t.Error("handler returned wrong body, statistics missing or incorrect")
+	}
+	if requests["/playlistItems"] != 2 || response.QuotaUsage != 4 {
+		t.Errorf("handler used wrong quota: expected 4 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelVideosHandlerDateRange(t *testing.T) {
+	inputs, requests := mockChannelVideos(t)
+	response := getChannelVideos(t, inputs, "since=2021-01-20&until=2021-01-25")
+	if len(response.Videos) != 6 || response.Videos[0].Id != "v25" || response.Videos[5].Id != "v20" {
+		t.Errorf("handler returned wrong body, expected videos v25 to v20 actually %+v", response.Videos)
+	}
+	if response.VideoStats.AvailableVideos != 6 {
+		t.Error("handler returned wrong body, statistics not limited to date range")
+	}
+	if requests["/playlistItems"] != 1 {
+		t.Errorf("handler kept paginating past start of range: %d pages queried", requests["/playlistItems"])
+	}
+}
+
+func TestChannelVideosHandlerUploadedBeforeRange(t *testing.T) {
+	inputs, requests := mockChannelVideos(t)
+	response := getChannelVideos(t, inputs, "since=2021-01-19T00:00:00Z&until=2021-01-21")
+	if len(response.Videos) != 3 || response.Videos[1].Id != "v20" || response.Videos[2].Id != "v19" {
+		t.Errorf("handler returned wrong body, expected videos v21 to v19 actually %+v", response.Videos)
+	}
+	if requests["/playlistItems"] != 1 {
+		t.Errorf("handler kept paginating past start of range: %d pages queried", requests["/playlistItems"])
+	}
+}
+
+func TestChannelVideosHandlerLimit(t *testing.T) {
+	inputs, requests := mockChannelVideos(t)
+	response := getChannelVideos(t, inputs, "limit=5&stats=false")
+	if len(response.Videos) != 5 || response.Videos[0].Id != "v31" {
+		t.Errorf("handler returned wrong body, expected 5 newest videos actually %+v", response.Videos)
+	}
+	if response.VideoStats != nil {
+		t.Error("handler returned wrong body, got back stats despite not asking for them")
+	}
+	if requests["/playlistItems"] != 1 || response.QuotaUsage != 3 {
+		t.Errorf("handler used wrong quota: expected 3 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelVideosHandlerInvalidDate(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/UC1/videos/?since=yesterday", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelVideosHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusBadRequest, status)
+	}
+	expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"dateInvalid"}`, http.StatusBadRequest)
+	if strings.Trim(rr.Body.String(), "\n") != expected {
+		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
+	}
+}
+
+func TestChannelVideosHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelVideosHandler, fmt.Sprintf("/ytstats/v1/channel/%s/videos/", ChannelId))
+}
+
+func TestChannelVideosHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelVideosHandler, "/ytstats/v1/channel/UC1/videos/", "PUT")
+}
+
+// Mocks YouTube with a channel owning three playlists over two pages, and sections featuring three channels.
+func mockChannelContent(t *testing.T) (yt_stats.Inputs, map[string]int) {
+	requests := make(map[string]int)
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/playlists":
+			if r.URL.Query().Get("channelId") != "UC1" {
+				t.Errorf("playlists queried for wrong channel: %s", r.URL.Query().Get("channelId"))
+			}
+			if r.URL.Query().Get("pageToken") == "page2" {
+				fmt.Fprint(w, `{"items":[{"id":"PL3","snippet":{"title":"Three","channelId":"UC1"}}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"nextPageToken":"page2","items":[{"id":"PL1","snippet":{"title":"One",`+
+				`"channelId":"UC1"}},{"id":"PL2","snippet":{"title":"Two","channelId":"UC1"}}]}`)
+		case "/playlistItems":
+			id := r.URL.Query().Get("playlistId")
+			fmt.Fprintf(w, `{"items":[{"snippet":{"resourceId":{"videoId":"%s-a"}}},`+
+				`{"snippet":{"resourceId":{"videoId":"%s-b"}}}]}`, id, id)
+		case "/videos":
+			var items []string
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				items = append(items, fmt.Sprintf(`{"id":"%s","snippet":{"publishedAt":"2021-01-01T12:00:00Z"},`+
+					`"contentDetails":{"duration":"PT1M"},"statistics":{"viewCount":"10","likeCount":"1",`+
+					`"commentCount":"0"}}`, id))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case "/channelSections":
+			fmt.Fprint(w, `{"items":[{"id":"s2","snippet":{"type":"multipleChannels","title":"Friends",`+
+				`"position":1},"contentDetails":{"channels":["UC3","UC2"]}},{"id":"s1","snippet":{"type":`+
+				`"singlePlaylist","position":0},"contentDetails":{"playlists":["PL1"]}},{"id":"s3","snippet":{`+
+				`"type":"multipleChannels","position":2},"contentDetails":{"channels":["UC2","UC4"]}}]}`)
+		case "/channels":
+			var items []string
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				if id != "UC4" {
+					items = append(items, fmt.Sprintf(`{"id":"%s","statistics":{"viewCount":"0",`+
+						`"subscriberCount":"0","videoCount":"0"}}`, id))
+				}
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		}
+	})
+	return inputs, requests
+}
+
+// Requests a channel sub-resource endpoint for the mocked channel and decodes the response.
+func getChannelResource(t *testing.T, f func(yt_stats.Inputs) http.Handler, inputs yt_stats.Inputs, url string,
+	response interface{}) {
+	req, err := http.NewRequest("GET", url, nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := f(inputs)
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: expected %v actually %v", http.StatusOK, status)
+	}
+	err = json.NewDecoder(rr.Body).Decode(response)
+	if err != nil {
+		t.Fatal("failed decoding response from endpoint")
+	}
+}
+
+func TestChannelPlaylistsHandler(t *testing.T) {
+	inputs, requests := mockChannelContent(t)
+	var response yt_stats.ChannelPlaylistsOutbound
+	getChannelResource(t, yt_stats.ChannelPlaylistsHandler, inputs, "/ytstats/v1/channel/UC1/playlists/", &response)
+	if len(response.Playlists) != 3 || response.Playlists[2].Id != "PL3" || response.ChannelId != "UC1" {
+		t.Errorf("handler returned wrong body, expected playlists PL1 to PL3 actually %+v", response.Playlists)
+	}
+	if response.Playlists[0].Videos != nil || response.Playlists[0].VideoStats != nil {
+		t.Error("handler returned wrong body, got back videos or stats despite not asking for them")
+	}
+	if requests["/playlistItems"] != 0 || response.QuotaUsage != 2 {
+		t.Errorf("handler used wrong quota: expected 2 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelPlaylistsHandlerStats(t *testing.T) {
+	inputs, requests := mockChannelContent(t)
+	var response yt_stats.ChannelPlaylistsOutbound
+	getChannelResource(t, yt_stats.ChannelPlaylistsHandler, inputs,
+		"/ytstats/v1/channel/UC1/playlists/?stats=true", &response)
+	for _, playlist := range response.Playlists {
+		if playlist.VideoStats == nil || playlist.VideoStats.TotalViews != 20 || playlist.Videos != nil {
+			t.Errorf("handler returned wrong body, expected only stats on %s actually %+v", playlist.Id, playlist)
+		}
+	}
+	if requests["/playlistItems"] != 3 || response.QuotaUsage != 8 {
+		t.Errorf("handler used wrong quota: expected 8 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelPlaylistsHandlerInvalidFlag(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/UC1/playlists/?videos=yes", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelPlaylistsHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"flagInvalid"}`, http.StatusBadRequest)
+	if strings.Trim(rr.Body.String(), "\n") != expected {
+		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
+	}
+}
+
+func TestChannelPlaylistsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelPlaylistsHandler, fmt.Sprintf("/ytstats/v1/channel/%s/playlists/", ChannelId))
+}
+
+func TestChannelPlaylistsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelPlaylistsHandler, "/ytstats/v1/channel/UC1/playlists/", "POST")
+}
+
+func TestChannelSectionsHandler(t *testing.T) {
+	inputs, _ := mockChannelContent(t)
+	var response yt_stats.SectionsOutbound
+	getChannelResource(t, yt_stats.ChannelSectionsHandler, inputs, "/ytstats/v1/channel/UC1/sections/", &response)
+	if len(response.Sections) != 3 || response.Sections[0].Id != "s1" || response.Sections[1].Title != "Friends" {
+		t.Errorf("handler returned wrong body, expected sections ordered by position actually %+v",
+			response.Sections)
+	}
+	if len(response.Sections[0].Playlists) != 1 || len(response.Sections[1].Channels) != 2 {
+		t.Error("handler returned wrong body, section content missing")
+	}
+	if response.QuotaUsage != 1 {
+		t.Errorf("handler used wrong quota: expected 1 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelSectionsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelSectionsHandler, fmt.Sprintf("/ytstats/v1/channel/%s/sections/", ChannelId))
+}
+
+func TestChannelSectionsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelSectionsHandler, "/ytstats/v1/channel/UC1/sections/", "POST")
+}
+
+func TestFeaturedChannelsHandler(t *testing.T) {
+	inputs, requests := mockChannelContent(t)
+	var response yt_stats.FeaturedChannelsOutbound
+	getChannelResource(t, yt_stats.FeaturedChannelsHandler, inputs, "/ytstats/v1/channel/UC1/featured/", &response)
+	if len(response.Channels) != 2 || response.Channels[0].Id != "UC3" || response.Channels[1].Id != "UC2" {
+		t.Errorf("handler returned wrong body, expected channels UC3 and UC2 actually %+v", response.Channels)
+	}
+	if requests["/channels"] != 1 || response.QuotaUsage != 2 {
+		t.Errorf("handler used wrong quota: expected 2 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestFeaturedChannelsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.FeaturedChannelsHandler, fmt.Sprintf("/ytstats/v1/channel/%s/featured/", ChannelId))
+}
+
+func TestFeaturedChannelsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.FeaturedChannelsHandler, "/ytstats/v1/channel/UC1/featured/", "POST")
+}
+
+// Mocks YouTube with a channel including all optional parts, reporting back the YouTube parts queried.
+func mockChannelParts(t *testing.T) (yt_stats.Inputs, *string) {
+	var queriedParts string
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		queriedParts = r.URL.Query().Get("part")
+		fmt.Fprint(w, `{"items":[{"id":"UC1","snippet":{"title":"One","customUrl":"@one",`+
+			`"publishedAt":"2010-01-01T00:00:00Z","thumbnails":{"default":{"url":"d","width":88,"height":88},`+
+			`"medium":{"url":"m","width":240,"height":240},"high":{"url":"h","width":800,"height":800}}},`+
+			`"statistics":{"viewCount":"1","subscriberCount":"1","videoCount":"1"},"brandingSettings":{"channel":{`+
+			`"keywords":"music \"live streams\" gaming","unsubscribedTrailer":"v1"},"image":{"bannerExternalUrl":`+
+			`"b"}},"topicDetails":{"topicIds":["/m/04rlf"]},"status":{"privacyStatus":"public","madeForKids":true},`+
+			`"localizations":{"nb":{"title":"En"},"de":{"title":"Eins"}}}]}`)
+	})
+	return inputs, &queriedParts
+}
+
+func TestChannelHandlerParts(t *testing.T) {
+	inputs, queriedParts := mockChannelParts(t)
+	var response yt_stats.ChannelOutbound
+	getChannelResource(t, yt_stats.ChannelHandler, inputs,
+		"/ytstats/v1/channel/?id=UC1&parts=details,thumbnails,branding,status,localizations", &response)
+	if *queriedParts != "brandingSettings,localizations,status,id,snippet,contentDetails,statistics" {
+		t.Errorf("handler queried wrong parts: %s", *queriedParts)
+	}
+	channel := response.Channels[0]
+	if channel.CustomUrl != "@one" || channel.PublishedAt != "2010-01-01T00:00:00Z" {
+		t.Error("handler returned wrong body, details missing")
+	}
+	if channel.Thumbnails == nil || channel.Thumbnails.High.Url != "h" || channel.Thumbnails.Default.Width != 88 {
+		t.Errorf("handler returned wrong body, thumbnails incorrect: %+v", channel.Thumbnails)
+	}
+	expectedKeywords := []string{"music", "live streams", "gaming"}
+	if channel.Branding == nil || !reflect.DeepEqual(channel.Branding.Keywords, expectedKeywords) ||
+		channel.Branding.Banner != "b" || channel.Branding.UnsubscribedTrailer != "v1" {
+		t.Errorf("handler returned wrong body, branding incorrect: %+v", channel.Branding)
+	}
+	if channel.Status == nil || !channel.Status.MadeForKids || channel.Status.PrivacyStatus != "public" {
+		t.Errorf("handler returned wrong body, status incorrect: %+v", channel.Status)
+	}
+	if len(channel.Localizations) != 2 || channel.Localizations[0].Language != "de" {
+		t.Errorf("handler returned wrong body, localizations incorrect: %+v", channel.Localizations)
+	}
+	if channel.Topics != nil {
+		t.Error("handler returned wrong body, got back topics despite not asking for them")
+	}
+	if response.QuotaUsage != 1 {
+		t.Errorf("handler returned wrong quota usage: expected 1 actually %d", response.QuotaUsage)
+	}
+}
+
+func TestChannelHandlerNoParts(t *testing.T) {
+	inputs, queriedParts := mockChannelParts(t)
+	var response yt_stats.ChannelOutbound
+	getChannelResource(t, yt_stats.ChannelHandler, inputs, "/ytstats/v1/channel/?id=UC1", &response)
+	if *queriedParts != "id,snippet,contentDetails,statistics" {
+		t.Errorf("handler queried wrong parts: %s", *queriedParts)
+	}
+	channel := response.Channels[0]
+	if channel.CustomUrl != "" || channel.Thumbnails != nil || channel.Branding != nil || channel.Status != nil ||
+		channel.Localizations != nil {
+		t.Errorf("handler returned wrong body, got back optional parts without asking for them: %+v", channel)
+	}
+}
+
+func TestChannelHandlerInvalidPart(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/?id=UC1&parts=branding,everything", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusBadRequest, status)
+	}
+	expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"partInvalid"}`, http.StatusBadRequest)
+	if strings.Trim(rr.Body.String(), "\n") != expected {
+		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
+	}
+}
+
+// Mocks YouTube with channels whose subscriber count grows by 10 every time they are queried, tracked in a store.
+func mockChannelTracking(t *testing.T) (yt_stats.Inputs, yt_stats.Store) {
+	queries := 0
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		var items []string
+		for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+			if id != "UCmissing" {
+				items = append(items, fmt.Sprintf(`{"id":"%s","statistics":{"viewCount":"%d",`+
+					`"subscriberCount":"%d","videoCount":"1"}}`, id, queries*100, queries*10))
+			}
+		}
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+	})
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, 0)
+	return inputs, store
+}
+
+// Requests the channel history endpoint with the given method, expecting the given status code.
+func requestChannelHistory(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.ChannelHistoryOutbound {
+	var response yt_stats.ChannelHistoryOutbound
+	requestHandler(t, yt_stats.ChannelHistoryHandler(inputs), method, url, "key", "", code, &response)
+	return response
+}
+
+func TestChannelHistoryHandlerTracking(t *testing.T) {
+	inputs, _ := mockChannelTracking(t)
+	requestChannelHistory(t, inputs, "GET", "/ytstats/v1/channel/UC1/history/", http.StatusNotFound)
+	response := requestChannelHistory(t, inputs, "POST", "/ytstats/v1/channel/UC1/history/", http.StatusOK)
+	if !response.Tracked || len(response.History) != 1 || response.History[0].SubscriberCount != 10 {
+		t.Errorf("handler returned wrong body, expected first snapshot actually %+v", response)
+	}
+	if response.QuotaUsage != 1 {
+		t.Errorf("handler returned wrong quota usage: expected 1 actually %d", response.QuotaUsage)
+	}
+	requestChannelHistory(t, inputs, "POST", "/ytstats/v1/channel/UC2/history/", http.StatusOK)
+	if _, err := inputs.Tracker.SnapshotTracked("key"); err != nil {
+		t.Fatal(err)
+	}
+	response = requestChannelHistory(t, inputs, "GET", "/ytstats/v1/channel/UC1/history/?deltas=true",
+		http.StatusOK)
+	if len(response.History) != 2 || response.History[1].SubscriberCount != 30 {
+		t.Errorf("handler returned wrong body, expected two snapshots actually %+v", response.History)
+	}
+	if response.History[0].SubscriberDelta != nil || response.History[1].SubscriberDelta == nil ||
+		*response.History[1].SubscriberDelta != 20 || *response.History[1].ViewDelta != 200 {
+		t.Errorf("handler returned wrong body, deltas incorrect: %+v", response.History)
+	}
+	if response.QuotaUsage != 0 {
+		t.Errorf("handler returned wrong quota usage: expected 0 actually %d", response.QuotaUsage)
+	}
+	body := requestHandler(t, yt_stats.ChannelHistoryHandler(inputs), "DELETE", "/ytstats/v1/channel/UC1/history/",
+		"other", "", http.StatusNotFound, nil)
+	if !strings.Contains(body, "channelNotTracked") {
+		t.Errorf("handler untracked channel with another key: %s", body)
+	}
+	if tracked, _ := inputs.Tracker.ChannelTracked("UC1"); !tracked {
+		t.Error("handler untracked channel with another key")
+	}
+	response = requestChannelHistory(t, inputs, "DELETE", "/ytstats/v1/channel/UC1/history/", http.StatusOK)
+	if response.Tracked || len(response.History) != 2 {
+		t.Errorf("handler returned wrong body, expected untracked channel with history actually %+v", response)
+	}
+}
+
+func TestChannelHistoryHandlerDownsampling(t *testing.T) {
+	inputs, store := mockChannelTracking(t)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour < 48; hour++ {
+		at := start.Add(time.Duration(hour) * time.Hour)
+		snapshot := map[string]interface{}{"time": at, "channel": map[string]int{"subscriber_count": hour}}
+		if err := store.Append("channel_snapshots", "UC1", at, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	response := requestChannelHistory(t, inputs, "GET",
+		"/ytstats/v1/channel/UC1/history/?interval=1d&deltas=true&since=2021-01-01T12:00:00Z", http.StatusOK)
+	if len(response.History) != 2 || response.History[0].SubscriberCount != 23 ||
+		response.History[1].SubscriberCount != 47 || response.History[1].Time != "2021-01-02T23:00:00Z" {
+		t.Errorf("handler returned wrong body, expected last snapshot of each day actually %+v", response.History)
+	}
+	if *response.History[1].SubscriberDelta != 24 {
+		t.Errorf("handler returned wrong body, expected delta of 24 actually %d", *response.History[1].SubscriberDelta)
+	}
+}
+
+func TestChannelHistoryHandlerNotFound(t *testing.T) {
+	inputs, _ := mockChannelTracking(t)
+	requestChannelHistory(t, inputs, "POST", "/ytstats/v1/channel/UCmissing/history/", http.StatusNotFound)
+	if tracked, _ := inputs.Tracker.ChannelTracked("UCmissing"); tracked {
+		t.Error("handler started tracking channel that does not exist")
+	}
+}
+
+func TestChannelHistoryHandlerInvalidInterval(t *testing.T) {
+	inputs, _ := mockChannelTracking(t)
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/UC1/history/?interval=-1h", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelHistoryHandler(inputs)
+	handler.ServeHTTP(rr, req)
+	expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"intervalInvalid"}`,
+		http.StatusBadRequest)
+	if strings.Trim(rr.Body.String(), "\n") != expected {
+		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
+	}
+}
+
+func TestChannelHistoryHandlerTrackingDisabled(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/channel/UC1/history/", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.ChannelHistoryHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusServiceUnavailable, status)
+	}
+}
+
+func TestChannelHistoryHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelHistoryHandler, fmt.Sprintf("/ytstats/v1/channel/%s/history/", ChannelId))
+}
+
+func TestChannelHistoryHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelHistoryHandler, "/ytstats/v1/channel/UC1/history/", "PUT")
+}
+
+// Requests the channel live endpoint with the given method, expecting the given status code.
+func requestChannelLive(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.ChannelLiveOutbound {
+	var response yt_stats.ChannelLiveOutbound
+	requestHandler(t, yt_stats.ChannelLiveHandler(inputs), method, url, "key", "", code, &response)
+	return response
+}
+
+func TestChannelLiveHandlerDetectsStreams(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{uploads: []string{"2021-01-01T00:00:00Z"}, streamStatus: "upcoming"}
+	inputs, receiver, received := mockWebhooks(t, youtube, &status)
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.scheduled","stream.rescheduled",`+
+		`"stream.live","stream.ended"],"targets":["UC1"]}`, receiver))
+	err := inputs.Scheduler.EnsureJob(yt_stats.Job{Id: "tracked", Type: "tracked", Schedule: "@every 1h"}, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestChannelLive(t, inputs, "GET", "/ytstats/v1/channel/UC1/live/", http.StatusNotFound)
+	response := requestChannelLive(t, inputs, "POST", "/ytstats/v1/channel/UC1/live/", http.StatusOK)
+	if !response.Watched || len(response.Streams) != 1 || response.QuotaUsage != 2 {
+		t.Errorf("handler returned wrong body, expected scheduled stream actually %+v", response)
+	}
+	now := time.Now()
+	for _, change := range []func(){
+		func() { youtube.streamStart = "2021-01-02T00:00:00Z" },
+		func() { youtube.streamStatus = "live" },
+		func() { youtube.uploads = nil }, // Known streams are still checked once they are no longer among uploads.
+		func() { youtube.streamStatus = "ended" },
+	} {
+		change()
+		now = now.Add(2 * time.Hour)
+		inputs.Scheduler.RunDue(now)
+	}
+	inputs.Dispatcher.DeliverDue(time.Now().Add(time.Hour))
+	expected := []string{"stream.scheduled", "stream.rescheduled", "stream.live", "stream.ended"}
+	if events := receivedEvents(*received); !reflect.DeepEqual(events, expected) {
+		t.Errorf("receiver got wrong deliveries: expected %v actually %v", expected, events)
+	}
+	var event struct{ Data yt_stats.StreamEvent }
+	if err := json.Unmarshal((*received)[1].body, &event); err != nil || event.Data.ChannelId != "UC1" ||
+		event.Data.PreviousScheduledStartTime != "2021-01-01T00:00:00Z" {
+		t.Errorf("delivery has wrong body: %s", (*received)[1].body)
+	}
+	response = requestChannelLive(t, inputs, "GET", "/ytstats/v1/channel/UC1/live/", http.StatusOK)
+	if !response.Watched || len(response.Streams) != 0 {
+		t.Errorf("handler returned wrong body, expected no streams actually %+v", response)
+	}
+	body := requestHandler(t, yt_stats.ChannelLiveHandler(inputs), "DELETE", "/ytstats/v1/channel/UC1/live/", "other", "",
+		http.StatusNotFound, nil)
+	if !strings.Contains(body, "channelNotWatched") {
+		t.Errorf("handler unwatched channel with another key: %s", body)
+	}
+	if watched, _ := inputs.Tracker.ChannelLiveWatched("UC1"); !watched {
+		t.Error("handler unwatched channel with another key")
+	}
+	response = requestChannelLive(t, inputs, "DELETE", "/ytstats/v1/channel/UC1/live/", http.StatusOK)
+	if response.Watched {
+		t.Error("handler did not stop watching channel")
+	}
+	requestChannelLive(t, inputs, "GET", "/ytstats/v1/channel/UC1/live/", http.StatusNotFound)
+}
+
+func TestChannelLiveHandlerChannelNotFound(t *testing.T) {
+	status := http.StatusOK
+	inputs, _, _ := mockWebhooks(t, &mockYouTube{}, &status)
+	requestChannelLive(t, inputs, "POST", "/ytstats/v1/channel/invalid/live/", http.StatusNotFound)
+}
+
+func TestChannelLiveHandlerTrackingDisabled(t *testing.T) {
+	requestChannelLive(t, getInputs(), "GET", "/ytstats/v1/channel/UC1/live/", http.StatusServiceUnavailable)
+}
+
+func TestChannelLiveHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelLiveHandler, "/ytstats/v1/channel/UC1/live/")
+}
+
+func TestChannelLiveHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelLiveHandler, "/ytstats/v1/channel/UC1/live/", "PUT")
+}
+
+// Mocks the channel UClive with the stream v1 live with the chat c1, and the channel UCnone without streams. The chat
+// has two messages, followed by their moderation, and ends once stage is 1. From stage 2 on, the stream v2 is live
+// with the chat c2, which has one ban. Gives back inputs with a moderation log and a tracker.
+func mockModeratedChannel(t *testing.T, stage *int32) yt_stats.Inputs {
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/playlistItems"):
+			if r.URL.Query().Get("playlistId") != "UUlive" {
+				fmt.Fprint(w, `{"items":[]}`)
+			} else if atomic.LoadInt32(stage) >= 2 {
+				fmt.Fprint(w, `{"items":[{"snippet":{"resourceId":{"videoId":"v2"}}},`+
+					`{"snippet":{"resourceId":{"videoId":"v1"}}}]}`)
+			} else {
+				fmt.Fprint(w, `{"items":[{"snippet":{"resourceId":{"videoId":"v1"}}}]}`)
+			}
+		case strings.HasSuffix(r.URL.Path, "/videos"):
+			var items []string
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				switch {
+				case id == "v1" && atomic.LoadInt32(stage) == 0:
+					items = append(items, `{"id":"v1","liveStreamingDetails":{"actualStartTime":`+
+						`"2021-01-01T00:00:00Z","concurrentViewers":"10","activeLiveChatId":"c1"}}`)
+				case id == "v1":
+					items = append(items, `{"id":"v1","liveStreamingDetails":{"actualStartTime":`+
+						`"2021-01-01T00:00:00Z","actualEndTime":"2021-01-02T00:00:02Z"}}`)
+				case id == "v2" && atomic.LoadInt32(stage) >= 2:
+					items = append(items, `{"id":"v2","liveStreamingDetails":{"actualStartTime":`+
+						`"2021-01-03T00:00:00Z","concurrentViewers":"10","activeLiveChatId":"c2"}}`)
+				}
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case r.URL.Query().Get("liveChatId") == "c2" && r.URL.Query().Get("pageToken") == "":
+			fmt.Fprint(w, `{"nextPageToken":"q1","pollingIntervalMillis":10,"items":[`+
+				`{"id":"b3","snippet":{"type":"userBannedEvent","publishedAt":"2021-01-03T00:00:01Z",`+
+				`"userBannedDetails":{"bannedUserDetails":{"channelId":"u3"},"banType":"permanent"}},`+
+				`"authorDetails":{"channelId":"mod"}}]}`)
+		case r.URL.Query().Get("liveChatId") == "c2":
+			fmt.Fprint(w, `{"nextPageToken":"q1","pollingIntervalMillis":10,"items":[]}`)
+		case r.URL.Query().Get("pageToken") == "":
+			fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[`+
+				`{"id":"m1","snippet":{"type":"textMessageEvent","displayMessage":"buy followers",`+
+				`"publishedAt":"2021-01-01T00:00:01Z"},"authorDetails":{"channelId":"u1"}},`+
+				`{"id":"m2","snippet":{"type":"textMessageEvent","displayMessage":"hi",`+
+				`"publishedAt":"2021-01-01T00:00:02Z"},"authorDetails":{"channelId":"u2"}}]}`)
+		case r.URL.Query().Get("pageToken") == "p1":
+			fmt.Fprint(w, `{"nextPageToken":"p2","pollingIntervalMillis":10,"items":[`+
+				`{"id":"d1","snippet":{"type":"messageDeletedEvent","publishedAt":"2021-01-01T00:00:03Z",`+
+				`"messageDeletedDetails":{"deletedMessageId":"m1"}},"authorDetails":{"channelId":"mod"}},`+
+				`{"id":"d2","snippet":{"type":"messageDeletedEvent","publishedAt":"2021-01-01T00:00:04Z",`+
+				`"messageDeletedDetails":{"deletedMessageId":"m0"}},"authorDetails":{"channelId":"mod"}},`+
+				`{"id":"b1","snippet":{"type":"userBannedEvent","publishedAt":"2021-01-01T00:00:05Z",`+
+				`"userBannedDetails":{"bannedUserDetails":{"channelId":"u1"},"banType":"temporary",`+
+				`"banDurationSeconds":300}},"authorDetails":{"channelId":"mod"}},`+
+				`{"id":"b2","snippet":{"type":"userBannedEvent","publishedAt":"2021-01-02T00:00:00Z",`+
+				`"userBannedDetails":{"bannedUserDetails":{"channelId":"u2"},"banType":"permanent"}},`+
+				`"authorDetails":{"channelId":"owner"}},`+
+				`{"id":"s1","snippet":{"type":"sponsorOnlyModeStartedEvent","publishedAt":"2021-01-02T00:00:01Z"},`+
+				`"authorDetails":{"channelId":"owner"}}]}`)
+		case atomic.LoadInt32(stage) >= 1:
+			fmt.Fprint(w, `{"nextPageToken":"p3","pollingIntervalMillis":10,"items":[`+
+				`{"id":"e1","snippet":{"type":"chatEndedEvent","publishedAt":"2021-01-02T00:00:02Z"}}]}`)
+		default:
+			fmt.Fprint(w, `{"nextPageToken":"p2","pollingIntervalMillis":10,"items":[]}`)
+		}
+	})
+	inputs.Resolver = yt_stats.NewChatResolver()
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, 0)
+	inputs.Moderation = yt_stats.NewModerationLog(inputs, store)
+	return inputs
+}
+
+// Requests the channel moderation endpoint with the given method, expecting the given status code.
+func requestChannelModeration(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.ModerationLogOutbound {
+	return requestChannelModerationWithKey(t, inputs, method, url, "key", code)
+}
+
+// Requests the channel moderation endpoint with the given method and key, expecting the given status code.
+func requestChannelModerationWithKey(t *testing.T, inputs yt_stats.Inputs, method string, url string, key string,
+	code int) yt_stats.ModerationLogOutbound {
+	var response yt_stats.ModerationLogOutbound
+	requestHandler(t, yt_stats.ChannelModerationHandler(inputs), method, url, key, "", code, &response)
+	return response
+}
+
+// Reads the moderation log of the channel UClive until it holds the given amount of actions and has the given status.
+func getModerationLog(t *testing.T, inputs yt_stats.Inputs, actions int, status string) yt_stats.ModerationLogOutbound {
+	var response yt_stats.ModerationLogOutbound
+	for i := 0; i < 100; i++ {
+		response = requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+		if len(response.Actions) >= actions && response.Status == status {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return response
+}
+
+// Gives the actions of a moderation log, along with the moderator and the user acted on where there is one.
+func moderationActions(response yt_stats.ModerationLogOutbound) []string {
+	actions := make([]string, len(response.Actions))
+	for i, action := range response.Actions {
+		actions[i] = action.Action + " " + action.Moderator.UserId
+		if action.User != nil {
+			actions[i] += " " + action.User.UserId
+		}
+	}
+	return actions
+}
+
+func TestChannelModerationHandlerLogsActions(t *testing.T) {
+	var stage int32
+	inputs := mockModeratedChannel(t, &stage)
+	requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/", http.StatusNotFound)
+	response := requestChannelModeration(t, inputs, "POST", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	if !response.Following || response.VideoId != "v1" || response.ChatId != "c1" || response.QuotaUsage == 0 {
+		t.Errorf("handler did not start following the chat of the stream: %+v", response)
+	}
+	response = getModerationLog(t, inputs, 5, "following")
+	expected := []string{"deletion mod u1", "deletion mod", "timeout mod u1", "ban owner u2", "members_only_started owner"}
+	if actions := moderationActions(response); !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("handler returned wrong actions: expected %v actually %v", expected, actions)
+	}
+	if response.Actions[0].MessageId != "m1" || response.Actions[0].Message != "buy followers" {
+		t.Errorf("deletion was not linked to the deleted message: %+v", response.Actions[0])
+	}
+	if response.Actions[1].MessageId != "m0" || response.Actions[1].Message != "" {
+		t.Errorf("deletion of unseen message has wrong message: %+v", response.Actions[1])
+	}
+	if response.Actions[2].Duration != 300 || response.Actions[3].Duration != 0 {
+		t.Errorf("bans have wrong durations: %+v", response.Actions[2:4])
+	}
+
+	// The log is filtered by the user acted on or the moderator acting, and by time.
+	response = requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/?user=u1",
+		http.StatusOK)
+	expected = []string{"deletion mod u1", "timeout mod u1"}
+	if actions := moderationActions(response); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("handler returned wrong actions on user: expected %v actually %v", expected, actions)
+	}
+	response = requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/?user=owner",
+		http.StatusOK)
+	if len(response.Actions) != 2 {
+		t.Errorf("handler returned wrong actions by moderator: %v", moderationActions(response))
+	}
+	response = requestChannelModeration(t, inputs, "GET",
+		"/ytstats/v1/channel/UClive/moderation/?since=2021-01-02&until=2021-01-02T00:00:00Z", http.StatusOK)
+	expected = []string{"ban owner u2"}
+	if actions := moderationActions(response); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("handler returned wrong actions in range: expected %v actually %v", expected, actions)
+	}
+	requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/?since=yesterday",
+		http.StatusBadRequest)
+
+	// Following ends with the chat, and resumes with the chat of the next live stream of the channel.
+	atomic.StoreInt32(&stage, 1)
+	response = getModerationLog(t, inputs, 5, "waiting")
+	if response.Status != "waiting" || response.Following || len(response.Actions) != 5 {
+		t.Fatalf("handler did not stop following ended chat: %+v", response)
+	}
+	inputs.Moderation.CheckStreams()
+	response = getModerationLog(t, inputs, 5, "waiting")
+	if response.Status != "waiting" || response.VideoId != "v1" {
+		t.Errorf("handler followed a stream that is not live: %+v", response)
+	}
+	atomic.StoreInt32(&stage, 2)
+	inputs.Moderation.CheckStreams()
+	response = getModerationLog(t, inputs, 6, "following")
+	if !response.Following || response.VideoId != "v2" || response.ChatId != "c2" {
+		t.Errorf("handler did not follow the chat of the next stream: %+v", response)
+	}
+	expected = []string{"deletion mod u1", "deletion mod", "timeout mod u1", "ban owner u2", "members_only_started owner",
+		"ban mod u3"}
+	if actions := moderationActions(response); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("handler returned wrong actions after next stream: expected %v actually %v", expected, actions)
+	}
+}
+
+func TestChannelModerationHandlerStop(t *testing.T) {
+	var stage int32
+	inputs := mockModeratedChannel(t, &stage)
+	requestChannelModeration(t, inputs, "DELETE", "/ytstats/v1/channel/UClive/moderation/", http.StatusNotFound)
+	requestChannelModeration(t, inputs, "POST", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	getModerationLog(t, inputs, 5, "following")
+
+	// Only the key that started following can stop it.
+	requestChannelModerationWithKey(t, inputs, "DELETE", "/ytstats/v1/channel/UClive/moderation/", "other",
+		http.StatusNotFound)
+	response := requestChannelModeration(t, inputs, "DELETE", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	if response.Following || response.Status != "stopped" || len(response.Actions) != 5 {
+		t.Errorf("handler did not stop following chat while keeping its log: %+v", response)
+	}
+
+	// Following is started again with a new request.
+	response = requestChannelModeration(t, inputs, "POST", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	if !response.Following || response.Status != "following" {
+		t.Errorf("handler did not follow chat again: %+v", response)
+	}
+
+	// Waiting for the next live stream is stopped as well.
+	atomic.StoreInt32(&stage, 1)
+	getModerationLog(t, inputs, 5, "waiting")
+	requestChannelModeration(t, inputs, "DELETE", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	atomic.StoreInt32(&stage, 2)
+	inputs.Moderation.CheckStreams()
+	response = requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UClive/moderation/", http.StatusOK)
+	if response.Following || response.Status != "stopped" || response.VideoId != "v1" {
+		t.Errorf("handler followed the next stream after stopping: %+v", response)
+	}
+}
+
+func TestChannelModerationHandlerNotLive(t *testing.T) {
+	var stage int32
+	inputs := mockModeratedChannel(t, &stage)
+	requestChannelModeration(t, inputs, "POST", "/ytstats/v1/channel/UCnone/moderation/", http.StatusNotFound)
+	requestChannelModeration(t, inputs, "GET", "/ytstats/v1/channel/UCnone/moderation/", http.StatusNotFound)
+}
+
+func TestChannelModerationHandlerTrackingDisabled(t *testing.T) {
+	requestChannelModeration(t, getInputs(), "GET", "/ytstats/v1/channel/UC1/moderation/",
+		http.StatusServiceUnavailable)
+}
+
+func TestChannelModerationHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChannelModerationHandler, "/ytstats/v1/channel/UC1/moderation/")
+}
+
+func TestChannelModerationHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChannelModerationHandler, "/ytstats/v1/channel/UC1/moderation/", "PUT")
+}
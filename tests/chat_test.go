@@ -1,14 +1,22 @@
 package yt_stats_test
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"golang.org/x/net/websocket"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	neturl "net/url"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"yt_stats"
 )
 
@@ -101,12 +109,14 @@ func fromFileFixerChat(t *testing.T, f string) yt_stats.ChatOutbound {
 					outbound.ChatEvents[i] = event
 				} else if entry["type"] == "superchat" {
 					event := yt_stats.ChatSuperChat{
-						Id:          entry["id"].(string),
-						Type:        "superchat",
-						PublishedAt: entry["published_at"].(string),
-						Message:     entry["message"].(string),
-						Amount:      entry["amount"].(float64),
-						Currency:    entry["currency"].(string),
+						Id:            entry["id"].(string),
+						Type:          "superchat",
+						PublishedAt:   entry["published_at"].(string),
+						Message:       entry["message"].(string),
+						Amount:        entry["amount"].(float64),
+						Currency:      entry["currency"].(string),
+						AmountDisplay: entry["amount_display"].(string),
+						Tier:          int(entry["tier"].(float64)),
 					}
 					if author, authorOk := entry["sent_by"].(map[string]interface{}); authorOk {
 						event.SentBy = yt_stats.ChatUser{
@@ -186,6 +196,119 @@ func TestChatParser(t *testing.T) {
 	}
 }
 
+func TestChatParserEventTypes(t *testing.T) {
+	var inbound yt_stats.ChatInbound
+	var expected, actual map[string]interface{}
+	parseFile(t, "res/chat_events_inbound.json", &inbound)
+	parseFile(t, "res/chat_events_outbound.json", &expected)
+	outbound := yt_stats.ChatParser(inbound, "chat")
+	if len(outbound.ChatEvents) != len(inbound.Items) {
+		t.Fatalf("function parsed %d events from %d items", len(outbound.ChatEvents), len(inbound.Items))
+	}
+	for i, event := range outbound.ChatEvents {
+		if event == nil {
+			t.Errorf("function parsed item %d into nil", i)
+		}
+	}
+	raw, err := json.Marshal(outbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(raw, &actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEvents := expected["chat_events"].([]interface{})
+	actualEvents := actual["chat_events"].([]interface{})
+	types := make(map[string]bool)
+	for i := range expectedEvents {
+		if !reflect.DeepEqual(actualEvents[i], expectedEvents[i]) {
+			t.Errorf("function parsed event %d incorrectly: expected %v actually %v", i, expectedEvents[i],
+				actualEvents[i])
+		}
+		types[actualEvents[i].(map[string]interface{})["type"].(string)] = true
+	}
+	for _, eventType := range []string{"message", "superchat", "supersticker", "new_member", "membership_milestone",
+		"memberships_gifted", "gift_membership_received", "message_deleted", "ban", "member_only_on",
+		"member_only_off", "tombstone", "chat_ended", "unknown"} {
+		if !types[eventType] {
+			t.Errorf("fixture does not cover events of type %s", eventType)
+		}
+	}
+}
+
+func TestChatParserSuperStickerAmount(t *testing.T) {
+	var inbound yt_stats.ChatInbound
+	parseFile(t, "res/chat_events_inbound.json", &inbound)
+	for _, event := range yt_stats.ChatParser(inbound, "chat").ChatEvents {
+		if sticker, ok := event.(yt_stats.ChatSuperSticker); ok {
+			if sticker.Amount != 1.5 || sticker.Currency != "USD" || sticker.AmountDisplay != "$1.50" ||
+				sticker.Tier != 1 || sticker.Language != "en" {
+				t.Errorf("function parsed super sticker incorrectly: %+v", sticker)
+			}
+			return
+		}
+	}
+	t.Error("function did not parse the super sticker")
+}
+
+// Gives the IDs of chat events parsed by ChatParser.
+func chatEventIds(t *testing.T, events []interface{}) []string {
+	ids := []string{}
+	for _, event := range events {
+		var header struct {
+			Id string `json:"id"`
+		}
+		raw, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, header.Id)
+	}
+	return ids
+}
+
+func TestChatFilter(t *testing.T) {
+	var inbound yt_stats.ChatInbound
+	parseFile(t, "res/chat_events_inbound.json", &inbound)
+	events := yt_stats.ChatParser(inbound, "chat").ChatEvents
+	tests := []struct {
+		filter   string
+		expected []string
+	}{
+		{`[{"types":["superchat","supersticker"]}]`, []string{"superchat1", "sticker1"}},
+		{`[{"users":["UCfan"]}]`, []string{"text1", "sticker1", "gifting1"}},
+		{`[{"users":["mem"]}]`, []string{"superchat1", "member1", "milestone1", "received1"}},
+		{`[{"users":["mem"],"case_sensitive":true}]`, []string{}},
+		{`[{"roles":["owner","verified"]}]`, []string{"membersonly1", "membersonly2"}},
+		{`[{"roles":["moderator","owner"],"match_any":true}]`, []string{"deleted1", "ban1", "membersonly1",
+			"membersonly2"}},
+		{`[{"content":["thank"]},{"users":["Fan"]}]`, []string{"superchat1", "text1", "sticker1", "gifting1"}},
+		{`[{"users":["Fan"]},{"reductive":true,"types":["message"]}]`, []string{"text1"}},
+		{`[{"content":["hello"]},{"content":["thanks","bye"],"match_any":true}]`, []string{"text1", "superchat1"}},
+		{`[]`, []string{}},
+	}
+	for _, test := range tests {
+		var searches []yt_stats.Filter
+		if err := json.Unmarshal([]byte(test.filter), &searches); err != nil {
+			t.Fatal(err)
+		}
+		ok, results := yt_stats.ChatFilter(searches, events)
+		if !ok {
+			t.Fatalf("failed filtering chat events with %s", test.filter)
+		}
+		if ids := chatEventIds(t, results); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("filter %s kept wrong events: expected %v actually %v", test.filter, test.expected, ids)
+		}
+	}
+	if _, results := yt_stats.ChatFilter(nil, events); len(results) != len(events) {
+		t.Errorf("filtering without filters kept %d of %d events", len(results), len(events))
+	}
+}
+
 func TestChatHandlerInvalidKey(t *testing.T) {
 	req, err := http.NewRequest("GET", fmt.Sprintf("/ytstats/v1/chat/?id=%s", chatId), nil)
 	req.Header.Set("key", "invalid")
@@ -249,3 +372,825 @@ func TestChatHandlerClosedChat(t *testing.T) {
 func TestChatHandlerUnsupportedType(t *testing.T) {
 	unsupportedRequestType(t, yt_stats.ChatHandler, "/ytstats/v1/chat/", "PUT")
 }
+
+// Mocks the channel UClive with the ended stream v0 and the stream v1 live with the chat c1 among its uploads, and
+// the channel UCnone with only v0. The chat of v1 ends once ended is set. Gives back the inputs with a resolver, and
+// the amount of requests for streams.
+func mockLiveChannel(t *testing.T, ended *int32) (yt_stats.Inputs, *int32) {
+	var streamRequests int32
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/playlistItems"):
+			uploads := map[string][]string{"UUlive": {"v0", "v1"}, "UUnone": {"v0"}}[r.URL.Query().Get("playlistId")]
+			if uploads == nil {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":{"code":404,"errors":[{"reason":"playlistNotFound"}]}}`)
+				return
+			}
+			var items []string
+			for _, id := range uploads {
+				items = append(items, fmt.Sprintf(`{"snippet":{"resourceId":{"videoId":"%s"}}}`, id))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case strings.HasSuffix(r.URL.Path, "/videos"):
+			atomic.AddInt32(&streamRequests, 1)
+			var items []string
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				switch id {
+				case "v0":
+					items = append(items, `{"id":"v0","liveStreamingDetails":{"actualStartTime":"2021-01-01T00:00:00Z",`+
+						`"actualEndTime":"2021-01-01T01:00:00Z"}}`)
+				case "v1":
+					items = append(items, `{"id":"v1","liveStreamingDetails":{"actualStartTime":"2021-01-01T00:00:00Z",`+
+						`"concurrentViewers":"10","activeLiveChatId":"c1"}}`)
+				}
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case atomic.LoadInt32(ended) == 1:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":{"code":403,"errors":[{"reason":"liveChatEnded"}]}}`)
+		default:
+			fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[`+
+				`{"id":"m1","snippet":{"type":"textMessageEvent","displayMessage":"hello"},`+
+				`"authorDetails":{"channelId":"u1"}}]}`)
+		}
+	})
+	inputs.Resolver = yt_stats.NewChatResolver()
+	return inputs, &streamRequests
+}
+
+// Requests a page of chat from the given handler, expecting the given status code. Gives back the body.
+func requestChat(t *testing.T, handler http.Handler, url string, code int) string {
+	return requestHandler(t, handler, "GET", url, "key", "", code, nil)
+}
+
+func TestChatHandlerResolvesVideo(t *testing.T) {
+	var ended int32
+	inputs, streamRequests := mockLiveChannel(t, &ended)
+	handler := yt_stats.ChatHandler(inputs)
+
+	// The chat is looked up once, and read from the cache afterwards.
+	for i, quota := range []int{6, 5} {
+		var response yt_stats.ChatOutbound
+		body := requestChat(t, handler, "/ytstats/v1/chat/?video=v1", http.StatusOK)
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal("failed decoding response from endpoint")
+		}
+		if response.QuotaUsage != quota || response.ChatId != "c1" || response.VideoId != "v1" ||
+			response.ConcurrentViewers == nil || *response.ConcurrentViewers != 10 || len(response.ChatEvents) != 1 {
+			t.Errorf("request %d got wrong chat: %s", i, body)
+		}
+	}
+	if requests := atomic.LoadInt32(streamRequests); requests != 1 {
+		t.Errorf("expected the stream to be queried once, actually %d times", requests)
+	}
+
+	// Once the chat ended, it is looked up again.
+	atomic.StoreInt32(&ended, 1)
+	requestChat(t, handler, "/ytstats/v1/chat/?video=v1", http.StatusForbidden)
+	requestChat(t, handler, "/ytstats/v1/chat/?video=v1", http.StatusForbidden)
+	if requests := atomic.LoadInt32(streamRequests); requests != 2 {
+		t.Errorf("expected the stream to be queried again once, actually %d times", requests-1)
+	}
+
+	// Chats given by ID come without a video.
+	atomic.StoreInt32(&ended, 0)
+	body := requestChat(t, handler, "/ytstats/v1/chat/?id=c1", http.StatusOK)
+	if strings.Contains(body, "video_id") || strings.Contains(body, "concurrent_viewers") {
+		t.Errorf("chat given by ID got a video: %s", body)
+	}
+}
+
+func TestChatHandlerResolvesChannel(t *testing.T) {
+	var ended int32
+	inputs, streamRequests := mockLiveChannel(t, &ended)
+	handler := yt_stats.ChatHandler(inputs)
+	for i, quota := range []int{7, 5} {
+		var response yt_stats.ChatOutbound
+		body := requestChat(t, handler, "/ytstats/v1/chat/?channel=UClive", http.StatusOK)
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatal("failed decoding response from endpoint")
+		}
+		if response.QuotaUsage != quota || response.ChatId != "c1" || response.VideoId != "v1" {
+			t.Errorf("request %d got wrong chat: %s", i, body)
+		}
+	}
+	if requests := atomic.LoadInt32(streamRequests); requests != 1 {
+		t.Errorf("expected the streams to be queried once, actually %d times", requests)
+	}
+}
+
+func TestChatHandlerNotLive(t *testing.T) {
+	var ended int32
+	inputs, _ := mockLiveChannel(t, &ended)
+	handler := yt_stats.ChatHandler(inputs)
+	tests := []struct {
+		query   string
+		code    int
+		message string
+		quota   int
+	}{
+		{"video=v0", http.StatusNotFound, "streamNotLive", 1},
+		{"video=v2", http.StatusNotFound, "streamNotFound", 1},
+		{"channel=UCnone", http.StatusNotFound, "streamNotLive", 2},
+		{"channel=UCmissing", http.StatusNotFound, "channelNotFound", 1},
+		{"channel=missing", http.StatusNotFound, "channelNotFound", 0},
+		{"video=v0,v1", http.StatusBadRequest, "tooManyItems", 0},
+		{"id=c1&video=v1", http.StatusBadRequest, "tooManyItems", 0},
+		{"video=v1&channel=UC1", http.StatusBadRequest, "tooManyItems", 0},
+	}
+	for _, test := range tests {
+		body := requestChat(t, handler, "/ytstats/v1/chat/?"+test.query, test.code)
+		expected := fmt.Sprintf(`{"quota_usage":%d,"status_code":%d,"status_message":"%s"}`, test.quota, test.code,
+			test.message)
+		if body != expected {
+			t.Errorf("%s: handler returned wrong body: expected %v actually %v", test.query, expected, body)
+		}
+	}
+}
+
+func TestChatHandlerFilters(t *testing.T) {
+	var ended int32
+	inputs, _ := mockLiveChannel(t, &ended)
+	handler := yt_stats.ChatHandler(inputs)
+	tests := []struct {
+		body     string
+		code     int
+		expected string
+	}{
+		{`[{"users":["u1"]}]`, http.StatusOK, `"chat_events":[{"id":"m1","type":"message"`},
+		{`[{"types":["superchat"]}]`, http.StatusOK, `"chat_events":[]`},
+		{`[{"roles":["admin"]}]`, http.StatusBadRequest, `"status_message":"filterRoleInvalid"`},
+		{`[{"types":["comment"]}]`, http.StatusBadRequest, `"status_message":"filterTypeInvalid"`},
+		{`{"users":"u1"}`, http.StatusBadRequest, `"status_message":"searchBodyInvalid"`},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/ytstats/v1/chat/?id=c1", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("key", "key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != test.code {
+			t.Errorf("%s: handler returned wrong status code: expected %v actually %v", test.body, test.code, status)
+		}
+		if !strings.Contains(rr.Body.String(), test.expected) {
+			t.Errorf("%s: handler returned wrong body: expected %v in %v", test.body, test.expected, rr.Body.String())
+		}
+	}
+}
+
+// Stages of the mocked live chat, which is quiet until the messages are sent, and ends afterwards when set to end.
+const (
+	chatQuiet int32 = iota
+	chatMessages
+	chatEnd
+)
+
+// Mocks a live chat of the stream v1 going through the stage pointed to, sending a message, a message by a moderator
+// and a superchat by the first author as a member once it reaches the messages stage. Triggers, giveaways and webhooks
+// are kept in a store. Gives back the URL of the chat and stream endpoints served from the inputs, the inputs, and the
+// amount of requests for the first page.
+func mockChatStream(t *testing.T, stage *int32) (string, yt_stats.Inputs, *int32) {
+	var firstPages int32
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") == "invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"code":400,"message":"API key not valid. Please pass a valid API key.",`+
+				`"errors":[{"reason":"badRequest"}]}}`)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/videos") {
+			if r.URL.Query().Get("id") != "v1" {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"items":[{"id":"v1","liveStreamingDetails":{"actualStartTime":"2021-01-01T00:00:00Z",`+
+				`"concurrentViewers":"10","activeLiveChatId":"%s"}}]}`, chatId)
+			return
+		}
+		if r.URL.Query().Get("liveChatId") == "invalid" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"errors":[{"reason":"liveChatNotFound"}]}}`)
+			return
+		}
+		page := r.URL.Query().Get("pageToken")
+		switch {
+		case page == "":
+			atomic.AddInt32(&firstPages, 1)
+			fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[]}`)
+		case page == "p1" && atomic.LoadInt32(stage) >= chatMessages:
+			fmt.Fprint(w, `{"nextPageToken":"p2","pollingIntervalMillis":10,"items":[`+
+				`{"id":"m1","snippet":{"type":"textMessageEvent","displayMessage":"hello"},`+
+				`"authorDetails":{"channelId":"u1"}},`+
+				`{"id":"m2","snippet":{"type":"textMessageEvent","displayMessage":"hi"},`+
+				`"authorDetails":{"channelId":"u2","isChatModerator":true}},`+
+				`{"id":"m3","snippet":{"type":"superChatEvent","superChatDetails":{"amountMicros":"5000000",`+
+				`"currency":"USD","userComment":"Hello there"}},"authorDetails":{"channelId":"u1",`+
+				`"isChatSponsor":true}}]}`)
+		case page == "p2" && atomic.LoadInt32(stage) >= chatEnd:
+			fmt.Fprint(w, `{"nextPageToken":"p3","pollingIntervalMillis":10,"items":[`+
+				`{"id":"e1","snippet":{"type":"chatEndedEvent"}}]}`)
+		default:
+			fmt.Fprintf(w, `{"nextPageToken":"%s","pollingIntervalMillis":10,"items":[]}`, page)
+		}
+	})
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	recorder, err := yt_stats.NewRecorder(inputs.Relay, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Dispatcher = yt_stats.NewDispatcher(store, true)
+	inputs.Triggers = yt_stats.NewTriggers(inputs, store)
+	inputs.Giveaways = yt_stats.NewGiveaways(inputs, store)
+	mux := http.NewServeMux()
+	mux.Handle("/ytstats/v1/chat/", yt_stats.SubResourceRouter("/ytstats/v1/chat/", yt_stats.ChatHandler(inputs),
+		map[string]http.Handler{
+			"stream":        yt_stats.ChatStreamHandler(inputs),
+			"socket":        yt_stats.ChatSocketHandler(inputs),
+			"analytics":     yt_stats.ChatAnalyticsHandler(inputs),
+			"triggers":      yt_stats.ChatTriggersHandler(inputs),
+			"notifications": yt_stats.ChatNotificationsHandler(inputs),
+		}))
+	mux.Handle("/ytstats/v1/stream/", yt_stats.SubResourceRouter("/ytstats/v1/stream/",
+		yt_stats.StreamHandler(inputs), map[string]http.Handler{
+			"recording": yt_stats.StreamRecordingHandler(inputs),
+			"replay":    yt_stats.StreamReplayHandler(inputs),
+		}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/ytstats/v1/", inputs, &firstPages
+}
+
+// Amount of messages sent at once by mockFloodedChat, more than the relay buffers for a subscriber.
+const chatFloodSize = 2100
+
+// Mocks a chat that stays quiet until the stage pointed to is set, then sends the given message from one user,
+// followed by the flood of the same message from as many other users on the next page. Gives back inputs with a
+// relay.
+func mockFloodedChat(t *testing.T, message string, stage *int32) yt_stats.Inputs {
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		item := func(i int) string {
+			return fmt.Sprintf(`{"id":"m%d","snippet":{"type":"textMessageEvent","displayMessage":"%s"},`+
+				`"authorDetails":{"channelId":"u%d"}}`, i, message, i)
+		}
+		switch page := r.URL.Query().Get("pageToken"); {
+		case page == "" || (page == "p1" && atomic.LoadInt32(stage) == 0):
+			fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[]}`)
+		case page == "p1":
+			fmt.Fprintf(w, `{"nextPageToken":"p2","pollingIntervalMillis":10,"items":[%s]}`, item(0))
+		case page == "p2":
+			var items []string
+			for i := 1; i <= chatFloodSize; i++ {
+				items = append(items, item(i))
+			}
+			fmt.Fprintf(w, `{"nextPageToken":"p3","pollingIntervalMillis":10,"items":[%s]}`,
+				strings.Join(items, ","))
+		default:
+			fmt.Fprint(w, `{"nextPageToken":"p3","pollingIntervalMillis":10,"items":[]}`)
+		}
+	})
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	return inputs
+}
+
+// Waits until the relay dropped the only subscriber of a flooded chat, which stops its poller.
+func awaitDropped(t *testing.T, inputs yt_stats.Inputs, store *gatedStore) {
+	for i := 0; i < 200 && (atomic.LoadInt32(&store.accesses) == 0 || inputs.Relay.Pollers() != 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if inputs.Relay.Pollers() != 0 {
+		t.Fatal("relay did not drop the subscriber falling behind")
+	}
+}
+
+// Opens a chat stream, failing if it does not respond with an event stream.
+func openChatStream(t *testing.T, url string) *bufio.Reader {
+	return openChatStreamWithKey(t, url, "key")
+}
+
+// Opens a chat stream with the given key, failing if it does not respond with an event stream.
+func openChatStreamWithKey(t *testing.T, url string, key string) *bufio.Reader {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("key", key)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("handler returned wrong response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// Reads events from a chat stream until the given amount is read or the stream closes, giving back the event names
+// and data.
+func readChatStream(t *testing.T, stream *bufio.Reader, amount int) ([]string, []string) {
+	var names, data []string
+	for len(names) < amount {
+		line, err := stream.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, "event: ") {
+			names = append(names, strings.TrimPrefix(line, "event: "))
+		} else if strings.HasPrefix(line, "data: ") {
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return names, data
+}
+
+func TestChatStreamHandlerChecksKeyOfSharedPoller(t *testing.T) {
+	stage := chatQuiet
+	url, _, _ := mockChatStream(t, &stage)
+	stream := openChatStream(t, url+"chat/"+chatId+"/stream/")
+	names, data := readChatStream(t, openChatStreamWithKey(t, url+"chat/"+chatId+"/stream/", "invalid"), 10)
+	if !reflect.DeepEqual(names, []string{"error"}) || !strings.Contains(data[0], "keyInvalid") {
+		t.Errorf("handler shared poller with an invalid key: %v %v", names, data)
+	}
+	shared := openChatStreamWithKey(t, url+"chat/"+chatId+"/stream/", "other")
+	atomic.StoreInt32(&stage, chatEnd)
+	for _, reader := range []*bufio.Reader{stream, shared} {
+		if names, _ := readChatStream(t, reader, 10); len(names) != 4 || names[3] != "chat_ended" {
+			t.Errorf("handler sent wrong events to a valid key: %v", names)
+		}
+	}
+}
+
+func TestChatStreamHandlerSharesPoller(t *testing.T) {
+	stage := chatMessages
+	url, inputs, firstPages := mockChatStream(t, &stage)
+	first := openChatStream(t, url+"chat/"+chatId+"/stream/")
+	names, data := readChatStream(t, first, 3)
+	if !reflect.DeepEqual(names, []string{"message", "message", "superchat"}) || !strings.Contains(data[0], `"hello"`) {
+		t.Fatalf("handler streamed wrong events: %v %v", names, data)
+	}
+	second := openChatStream(t, url+"chat/"+chatId+"/stream/")
+	if pollers := inputs.Relay.Pollers(); pollers != 1 {
+		t.Errorf("relay polls wrong amount of chats: expected 1 actually %d", pollers)
+	}
+	atomic.StoreInt32(&stage, chatEnd)
+	for _, stream := range []*bufio.Reader{first, second} {
+		names, _ = readChatStream(t, stream, 10)
+		if !reflect.DeepEqual(names, []string{"chat_ended"}) {
+			t.Errorf("handler streamed wrong events after the chat ended: %v", names)
+		}
+	}
+	if pages := atomic.LoadInt32(firstPages); pages != 1 {
+		t.Errorf("relay polled the chat from the start %d times, expected once", pages)
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after the chat ended: %d pollers", pollers)
+	}
+}
+
+func TestChatStreamHandlerFilters(t *testing.T) {
+	stage := chatEnd
+	url, _, _ := mockChatStream(t, &stage)
+	filters := neturl.QueryEscape(`[{"roles":["moderator"]}]`)
+	stream := openChatStream(t, url+"chat/"+chatId+"/stream/?filters="+filters)
+	names, data := readChatStream(t, stream, 3)
+	if !reflect.DeepEqual(names, []string{"message", "chat_ended"}) || !strings.Contains(data[0], `"id":"m2"`) {
+		t.Errorf("filtered stream sent wrong events: %v %v", names, data)
+	}
+	invalid := map[string]string{`roles`: "filterInvalid", `[{"roles":["admin"]}]`: "filterRoleInvalid"}
+	for filter, expected := range invalid {
+		body := requestChat(t, yt_stats.ChatStreamHandler(getInputs()),
+			"/ytstats/v1/chat/"+chatId+"/stream/?filters="+neturl.QueryEscape(filter), http.StatusBadRequest)
+		if !strings.Contains(body, expected) {
+			t.Errorf("stream with filters %s returned wrong body: %s", filter, body)
+		}
+	}
+}
+
+func TestChatStreamHandlerStopsPolling(t *testing.T) {
+	stage := chatMessages
+	url, inputs, _ := mockChatStream(t, &stage)
+	req, err := http.NewRequest("GET", url+"chat/"+chatId+"/stream/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("key", "key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readChatStream(t, bufio.NewReader(resp.Body), 3)
+	resp.Body.Close()
+	for i := 0; i < 100 && inputs.Relay.Pollers() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after the last client left: %d pollers", pollers)
+	}
+}
+
+func TestChatStreamHandlerError(t *testing.T) {
+	stage := chatQuiet
+	url, _, _ := mockChatStream(t, &stage)
+	names, data := readChatStream(t, openChatStream(t, url+"chat/invalid/stream/"), 10)
+	if !reflect.DeepEqual(names, []string{"error"}) || !strings.Contains(data[0], `"liveChatNotFound"`) {
+		t.Errorf("handler streamed wrong events: %v %v", names, data)
+	}
+}
+
+func TestChatStreamHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChatStreamHandler, "/ytstats/v1/chat/"+chatId+"/stream/")
+}
+
+func TestChatStreamHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChatStreamHandler, "/ytstats/v1/chat/"+chatId+"/stream/", "POST")
+}
+
+// Opens a chat socket with the given query parameters.
+func openChatSocket(t *testing.T, url string, query string) *websocket.Conn {
+	ws, err := websocket.Dial(strings.Replace(url, "http://", "ws://", 1)+"?key=key"+query, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	err = ws.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// Sends a filter to a chat socket, expecting the given type of message in response.
+func sendChatSocketFilter(t *testing.T, ws *websocket.Conn, filter string,
+	expected string) yt_stats.ChatSocketOutbound {
+	err := websocket.Message.Send(ws, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message yt_stats.ChatSocketOutbound
+	err = websocket.JSON.Receive(ws, &message)
+	if err != nil || message.Type != expected {
+		t.Fatalf("socket sent wrong response to filter %s: %+v %v", filter, message, err)
+	}
+	return message
+}
+
+// Reads messages from a chat socket until it closes, giving back the event IDs, or the types of other messages.
+func readChatSocket(t *testing.T, ws *websocket.Conn) []string {
+	var received []string
+	for {
+		var message yt_stats.ChatSocketOutbound
+		err := websocket.JSON.Receive(ws, &message)
+		if err == io.EOF {
+			return received
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == "event" {
+			received = append(received, message.Id)
+		} else {
+			received = append(received, message.Type)
+		}
+	}
+}
+
+func TestChatSocketHandlerFilters(t *testing.T) {
+	filters := map[string][]string{
+		`{}`:                                     {"m1", "m2", "m3", "e1"},
+		`{"roles":["moderator"]}`:                {"m2", "e1"},
+		`{"roles":["owner","member"]}`:           {"m3", "e1"},
+		`{"types":["superchat"]}`:                {"m3", "e1"},
+		`{"keywords":["HELLO"]}`:                 {"m1", "m3", "e1"},
+		`{"types":["message"],"keywords":["h"]}`: {"m1", "m2", "e1"},
+		`{"filters":[{"users":["u1"]}]}`:         {"m1", "m3", "e1"},
+		`{"filters":[{"content":["h"]},{"reductive":true,"roles":["member"]}]}`: {"m3", "e1"},
+	}
+	for filter, expected := range filters {
+		stage := chatQuiet
+		url, _, _ := mockChatStream(t, &stage)
+		ws := openChatSocket(t, url+"chat/"+chatId+"/socket/", "")
+		sendChatSocketFilter(t, ws, filter, "filter")
+		atomic.StoreInt32(&stage, chatEnd)
+		if received := readChatSocket(t, ws); !reflect.DeepEqual(received, expected) {
+			t.Errorf("socket with filter %s sent wrong events: expected %v actually %v", filter, expected, received)
+		}
+	}
+}
+
+func TestChatSocketHandlerInvalidFilter(t *testing.T) {
+	stage := chatQuiet
+	url, _, _ := mockChatStream(t, &stage)
+	ws := openChatSocket(t, url+"chat/"+chatId+"/socket/", "")
+	filters := map[string]string{
+		`{"roles":["admin"]}`:               "filterRoleInvalid",
+		`{"types":["comment"]}`:             "filterTypeInvalid",
+		`roles`:                             "filterInvalid",
+		`{"filters":[{"roles":["admin"]}]}`: "filterRoleInvalid",
+	}
+	for filter, expected := range filters {
+		message := sendChatSocketFilter(t, ws, filter, "error")
+		if message.Status == nil || message.Status.StatusMessage != expected {
+			t.Errorf("socket sent wrong error for filter %s: %+v", filter, message.Status)
+		}
+	}
+	atomic.StoreInt32(&stage, chatEnd)
+	if received := readChatSocket(t, ws); !reflect.DeepEqual(received, []string{"m1", "m2", "m3", "e1"}) {
+		t.Errorf("socket sent wrong events after invalid filters: %v", received)
+	}
+}
+
+func TestChatSocketHandlerResumes(t *testing.T) {
+	stage := chatMessages
+	url, _, _ := mockChatStream(t, &stage)
+	first := openChatSocket(t, url+"chat/"+chatId+"/socket/", "")
+	for _, expected := range []string{"m1", "m2", "m3"} {
+		var message yt_stats.ChatSocketOutbound
+		err := websocket.JSON.Receive(first, &message)
+		if err != nil || message.Id != expected {
+			t.Fatalf("socket sent wrong event: expected %s actually %+v %v", expected, message, err)
+		}
+	}
+	second := openChatSocket(t, url+"chat/"+chatId+"/socket/", "&last_event_id=m1")
+	atomic.StoreInt32(&stage, chatEnd)
+	if received := readChatSocket(t, second); !reflect.DeepEqual(received, []string{"m2", "m3", "e1"}) {
+		t.Errorf("resumed socket sent wrong events: %v", received)
+	}
+}
+
+func TestChatSocketHandlerError(t *testing.T) {
+	stage := chatQuiet
+	url, _, _ := mockChatStream(t, &stage)
+	ws := openChatSocket(t, url+"chat/invalid/socket/", "")
+	var message yt_stats.ChatSocketOutbound
+	err := websocket.JSON.Receive(ws, &message)
+	if err != nil || message.Type != "error" || message.Status == nil ||
+		message.Status.StatusMessage != "liveChatNotFound" {
+		t.Errorf("socket sent wrong error: %+v %v", message, err)
+	}
+}
+
+func TestChatSocketHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChatSocketHandler, "/ytstats/v1/chat/"+chatId+"/socket/")
+}
+
+func TestChatSocketHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChatSocketHandler, "/ytstats/v1/chat/"+chatId+"/socket/", "POST")
+}
+
+func TestChatAnalyticsHandlerAnalysesWindow(t *testing.T) {
+	stage := chatMessages
+	url, inputs, _ := mockChatStream(t, &stage)
+	readChatStream(t, openChatStream(t, url+"chat/"+chatId+"/stream/"), 3)
+	handler := yt_stats.ChatAnalyticsHandler(inputs)
+	analytics := requestChatAnalytics(t, handler, "/ytstats/v1/chat/"+chatId+"/analytics/?window=1h", http.StatusOK)
+	if analytics.Id != chatId || analytics.Source != "live" || analytics.Messages != 3 ||
+		analytics.UniqueChatters != 2 || analytics.NewChatters != 2 || analytics.Interval != 60 {
+		t.Errorf("handler returned wrong analytics: %+v", analytics)
+	}
+	if last := analytics.Timeline[len(analytics.Timeline)-1]; len(analytics.Timeline) < 60 || last.Messages != 3 {
+		t.Errorf("handler returned wrong timeline: %+v", analytics.Timeline)
+	}
+	if len(analytics.TopChatters) != 2 || analytics.TopChatters[0].Chatter.UserId != "u1" {
+		t.Errorf("handler returned wrong top chatters: %+v", analytics.TopChatters)
+	}
+	requestChatAnalytics(t, handler, "/ytstats/v1/chat/other/analytics/", http.StatusNotFound)
+	requestChatAnalytics(t, handler, "/ytstats/v1/chat/"+chatId+"/analytics/?window=0", http.StatusBadRequest)
+}
+
+func TestChatAnalyticsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChatAnalyticsHandler, "/ytstats/v1/chat/"+chatId+"/analytics/")
+}
+
+func TestChatAnalyticsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChatAnalyticsHandler, "/ytstats/v1/chat/"+chatId+"/analytics/", "POST")
+}
+
+// Requests the chat triggers endpoint with the given method and body, expecting the given status code. Gives back the
+// response body.
+func requestChatTriggers(t *testing.T, inputs yt_stats.Inputs, method string, url string, body string,
+	code int) string {
+	return requestHandler(t, yt_stats.ChatTriggersHandler(inputs), method, url, "key", body, code, nil)
+}
+
+// Creates a trigger on the mocked chat with the given definition, giving back the created trigger.
+func createChatTrigger(t *testing.T, inputs yt_stats.Inputs, definition string) yt_stats.ChatTrigger {
+	var response yt_stats.ChatTriggersOutbound
+	body := requestChatTriggers(t, inputs, "POST", "/ytstats/v1/chat/"+chatId+"/triggers/", definition, http.StatusOK)
+	err := json.Unmarshal([]byte(body), &response)
+	if err != nil || len(response.Triggers) != 1 || response.Triggers[0].Id == "" || !response.Watching {
+		t.Fatalf("handler returned wrong body, expected created trigger actually %s", body)
+	}
+	return response.Triggers[0]
+}
+
+func TestChatTriggersHandlerFiresTriggers(t *testing.T) {
+	stage := chatQuiet
+	url, inputs, _ := mockChatStream(t, &stage)
+	var received [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, body)
+	}))
+	t.Cleanup(receiver.Close)
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["chat.trigger"],"targets":["%s"]}`, receiver.URL,
+		chatId))
+	var foreign [][]byte
+	foreignReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		foreign = append(foreign, body)
+	}))
+	t.Cleanup(foreignReceiver.Close)
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "POST", "/ytstats/v1/webhooks/", "other",
+		fmt.Sprintf(`{"url":"%s","events":["chat.trigger"]}`, foreignReceiver.URL), http.StatusOK, nil)
+	command := createChatTrigger(t, inputs, `{"type":"command","command":"HELLO","cooldown":60}`)
+	regex := createChatTrigger(t, inputs, `{"type":"regex","pattern":"^h(i|ello)$"}`)
+	superChat := createChatTrigger(t, inputs, `{"type":"superchat","min_amount":5}`)
+	createChatTrigger(t, inputs, `{"type":"new_member"}`)
+	stream := openChatStream(t, url+"chat/"+chatId+"/notifications/")
+	atomic.StoreInt32(&stage, chatEnd)
+	names, data := readChatStream(t, stream, 10)
+	expected := []struct {
+		trigger string
+		event   string
+		args    []string
+	}{
+		{command.Id, "m1", []string{}},
+		{regex.Id, "m1", []string{"ello"}},
+		{regex.Id, "m2", []string{"i"}},
+		{superChat.Id, "m3", []string{}},
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("handler sent wrong notifications: %v %v", names, data)
+	}
+	for i, notification := range expected {
+		var fired struct {
+			yt_stats.ChatTriggerEvent
+			Event struct{ Id string } `json:"event"`
+		}
+		err := json.Unmarshal([]byte(data[i]), &fired)
+		if err != nil || names[i] != "trigger" || fired.ChatId != chatId || fired.TriggerId != notification.trigger ||
+			fired.Event.Id != notification.event || !reflect.DeepEqual(fired.Args, notification.args) {
+			t.Errorf("handler sent wrong notification, expected %+v actually %s", notification, data[i])
+		}
+	}
+	inputs.Dispatcher.DeliverDue(time.Now())
+	if len(received) != len(expected) || !strings.Contains(string(received[0]), `"trigger_type":"command"`) {
+		t.Errorf("receiver got wrong deliveries: %d", len(received))
+	}
+	if len(foreign) != 0 {
+		t.Errorf("webhook of another key received triggers: %d", len(foreign))
+	}
+	var response yt_stats.ChatTriggersOutbound
+	body := requestChatTriggers(t, inputs, "GET", "/ytstats/v1/chat/"+chatId+"/triggers/", "", http.StatusOK)
+	if json.Unmarshal([]byte(body), &response) != nil || len(response.Triggers) != 4 || response.Watching {
+		t.Errorf("handler returned wrong triggers after the chat ended: %s", body)
+	}
+	if err := inputs.Triggers.Resume(); err != nil || inputs.Relay.Pollers() != 0 {
+		t.Errorf("triggers of the ended chat were followed again when resuming: %v", err)
+	}
+}
+
+func TestChatTriggersFollowWithNewestKey(t *testing.T) {
+	var mutex sync.Mutex
+	var keys []string
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		keys = append(keys, r.URL.Query().Get("key"))
+		mutex.Unlock()
+		fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[]}`)
+	})
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	triggers := yt_stats.NewTriggers(inputs, store)
+	lastKey := func() string {
+		mutex.Lock()
+		keys = nil
+		mutex.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(keys) == 0 {
+			return ""
+		}
+		return keys[len(keys)-1]
+	}
+	first, _, err := triggers.CreateTrigger(chatId, yt_stats.ChatTrigger{Type: "new_member"}, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := triggers.CreateTrigger(chatId, yt_stats.ChatTrigger{Type: "new_member"}, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := lastKey(); key != "b" {
+		t.Errorf("chat polled with wrong key after a newer trigger: expected b actually %s", key)
+	}
+	if _, found, err := triggers.DeleteTrigger(chatId, second.Id, "b"); err != nil || !found {
+		t.Fatalf("failed deleting trigger: %v", err)
+	}
+	if key := lastKey(); key != "a" {
+		t.Errorf("chat polled with wrong key after the newest trigger was deleted: expected a actually %s", key)
+	}
+	if _, found, err := triggers.DeleteTrigger(chatId, first.Id, "a"); err != nil || !found {
+		t.Fatalf("failed deleting trigger: %v", err)
+	}
+	if key := lastKey(); key != "" || inputs.Relay.Pollers() != 0 {
+		t.Errorf("chat still polled after its last trigger was deleted with key %s", key)
+	}
+}
+
+func TestChatTriggersFollowAgainAfterFallingBehind(t *testing.T) {
+	var stage int32
+	inputs := mockFloodedChat(t, "!hello", &stage)
+	store := newGatedStore(t, "webhooks")
+	inputs.Dispatcher = yt_stats.NewDispatcher(store, true)
+	triggers := yt_stats.NewTriggers(inputs, store)
+	if _, _, err := triggers.CreateTrigger(chatId, yt_stats.ChatTrigger{Type: "command", Command: "!hello"},
+		"key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Firing on the first message is held back until the relay drops the watcher during the flood.
+	store.hold()
+	atomic.StoreInt32(&stage, 1)
+	awaitDropped(t, inputs, store)
+	store.release()
+	for i := 0; i < 300 && atomic.LoadInt32(&store.accesses) < chatFloodSize+1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fired := atomic.LoadInt32(&store.accesses); fired != chatFloodSize+1 {
+		t.Errorf("triggers fired on wrong amount of messages after falling behind: expected %d actually %d",
+			chatFloodSize+1, fired)
+	}
+	if _, watching, err := triggers.ChatTriggers(chatId, "key"); err != nil || !watching {
+		t.Errorf("chat no longer followed after falling behind: %v", err)
+	}
+}
+
+func TestChatTriggersHandlerLifecycle(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	root := "/ytstats/v1/chat/" + chatId + "/triggers/"
+	trigger := createChatTrigger(t, inputs, `{"type":"command","command":"!dice"}`)
+	body := requestChatTriggers(t, inputs, "GET", root, "", http.StatusOK)
+	if !strings.Contains(body, `"watching":true`) || !strings.Contains(body, `"command":"!dice"`) {
+		t.Errorf("handler returned wrong triggers: %s", body)
+	}
+	invalid := map[string]string{
+		`{"type":"keyword"}`:                        "triggerTypeInvalid",
+		`{"type":"command","command":"!roll dice"}`: "triggerCommandInvalid",
+		`{"type":"regex","pattern":"("}`:            "triggerPatternInvalid",
+		`{"type":"superchat","min_amount":-1}`:      "triggerAmountInvalid",
+		`{"type":"superchat","currency":"EURO"}`:    "currencyInvalid",
+		`{"type":"new_member","cooldown":-1}`:       "triggerCooldownInvalid",
+		`{"type":"new_member","cooldown":"1m"}`:     "triggerBodyInvalid",
+	}
+	for definition, expected := range invalid {
+		body = requestChatTriggers(t, inputs, "POST", root, definition, http.StatusBadRequest)
+		if !strings.Contains(body, expected) {
+			t.Errorf("creating trigger %s returned wrong body: %s", definition, body)
+		}
+	}
+	requestChatTriggers(t, inputs, "DELETE", root, "", http.StatusBadRequest)
+	requestChatTriggers(t, inputs, "DELETE", root+"?trigger=unknown", "", http.StatusNotFound)
+	body = requestChatTriggers(t, inputs, "DELETE", root+"?trigger="+trigger.Id, "", http.StatusOK)
+	if !strings.Contains(body, `"watching":false`) || !strings.Contains(body, trigger.Id) {
+		t.Errorf("handler returned wrong deleted trigger: %s", body)
+	}
+	body = requestChat(t, yt_stats.ChatNotificationsHandler(inputs), "/ytstats/v1/chat/"+chatId+"/notifications/",
+		http.StatusNotFound)
+	if !strings.Contains(body, "chatNotTriggered") {
+		t.Errorf("notifications of an unfollowed chat returned wrong body: %s", body)
+	}
+}
+
+func TestChatTriggersHandlerTrackingDisabled(t *testing.T) {
+	requestChatTriggers(t, getInputs(), "GET", "/ytstats/v1/chat/"+chatId+"/triggers/", "",
+		http.StatusServiceUnavailable)
+}
+
+func TestChatTriggersHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChatTriggersHandler, "/ytstats/v1/chat/"+chatId+"/triggers/")
+	keyMissing(t, yt_stats.ChatNotificationsHandler, "/ytstats/v1/chat/"+chatId+"/notifications/")
+}
+
+func TestChatTriggersHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChatTriggersHandler, "/ytstats/v1/chat/"+chatId+"/triggers/", "PUT")
+	unsupportedRequestType(t, yt_stats.ChatNotificationsHandler, "/ytstats/v1/chat/"+chatId+"/notifications/", "POST")
+}
@@ -158,6 +158,16 @@ func TestCommentSearch(t *testing.T) {
 	if len(results) != 0 {
 		t.Errorf("function returned wrong result, should have 0 comments, got %d", len(results))
 	}
+	testData = fromFileFixerComments(t, "res/sample_comments.json")
+	worked, results = yt_stats.CommentFilter([]yt_stats.Filter{}, testData)
+	if !worked || len(results) != 0 {
+		t.Errorf("function returned wrong result for empty searches, should have 0 comments, got %d", len(results))
+	}
+	worked, results = yt_stats.CommentFilter(nil, testData)
+	if !worked || len(results) != len(testData) {
+		t.Errorf("function returned wrong result without searches, should have %d comments, got %d", len(testData),
+			len(results))
+	}
 }
 
 func TestCommentsHandlerSuccess(t *testing.T) {
@@ -0,0 +1,57 @@
+package yt_stats_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yt_stats"
+)
+
+func TestDashboardHandlerIndex(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.DashboardHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusOK, status)
+	}
+	if !strings.Contains(rr.Body.String(), `<script src="dashboard.js"></script>`) {
+		t.Error("handler returned wrong body, dashboard page does not load its script")
+	}
+}
+
+func TestDashboardHandlerAssets(t *testing.T) {
+	for _, asset := range []string{"dashboard.js", "dashboard.css"} {
+		req, err := http.NewRequest("GET", "/ytstats/v1/"+asset, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := yt_stats.DashboardHandler(getInputs())
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code for %s: expected %v actually %v", asset, http.StatusOK, status)
+		}
+	}
+}
+
+func TestDashboardHandlerNotFound(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/missing.js", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.DashboardHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusNotFound, status)
+	}
+}
+
+func TestDashboardHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.DashboardHandler, "/ytstats/v1/", "PUT")
+}
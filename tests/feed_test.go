@@ -0,0 +1,120 @@
+package yt_stats_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"yt_stats"
+)
+
+// Mocks the chat ca of the stream va and the chat cb, each sending two messages with interleaved publishing times
+// before ending, and the chat bad which fails. Gives back the URL of the chat feed endpoint served from the inputs.
+func mockChatFeed(t *testing.T) (string, yt_stats.Inputs) {
+	message := func(id string, second int) string {
+		return fmt.Sprintf(`{"id":"%s","snippet":{"type":"textMessageEvent","displayMessage":"%s",`+
+			`"publishedAt":"2021-01-01T00:00:0%dZ"},"authorDetails":{"channelId":"u%s"}}`, id, id, second, id)
+	}
+	ended := func(second int) string {
+		return fmt.Sprintf(`{"id":"e%d","snippet":{"type":"chatEndedEvent","publishedAt":"2021-01-01T00:00:0%dZ"}}`,
+			second, second)
+	}
+	pages := map[string]map[string][]string{
+		"ca": {"": {message("a1", 1), message("a3", 3)}, "p1": {ended(6)}},
+		"cb": {"": {message("b2", 2), message("b4", 4)}, "p1": {ended(5)}},
+	}
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/videos") {
+			if r.URL.Query().Get("id") != "va" {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"items":[{"id":"va","liveStreamingDetails":{"actualStartTime":"2021-01-01T00:00:00Z",`+
+				`"concurrentViewers":"10","activeLiveChatId":"ca"}}]}`)
+			return
+		}
+		chat, ok := pages[r.URL.Query().Get("liveChatId")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"errors":[{"reason":"liveChatNotFound"}]}}`)
+			return
+		}
+		page := r.URL.Query().Get("pageToken")
+		fmt.Fprintf(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[%s]}`,
+			strings.Join(chat[page], ","))
+	})
+	inputs.Resolver = yt_stats.NewChatResolver()
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	mux := http.NewServeMux()
+	mux.Handle("/ytstats/v1/feed/", yt_stats.ChatFeedHandler(inputs))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/ytstats/v1/feed/", inputs
+}
+
+func TestChatFeedHandlerMergesChats(t *testing.T) {
+	url, inputs := mockChatFeed(t)
+	names, data := readChatStream(t, openChatStream(t, url+"?id=cb,bad&video=va,vnone&delay=500ms"), 20)
+	expected := []string{"error", "error", "message", "message", "message", "message", "chat_ended", "chat_ended"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("handler streamed wrong events: expected %v actually %v", expected, names)
+	}
+	for i, contents := range [][]string{
+		{`"source":"vnone"`, `"streamNotFound"`},
+		{`"source":"bad"`, `"chat_id":"bad"`, `"liveChatNotFound"`},
+		{`"source":"va"`, `"video_id":"va"`, `"chat_id":"ca"`, `"id":"a1"`},
+		{`"source":"cb"`, `"id":"b2"`},
+		{`"source":"va"`, `"id":"a3"`},
+		{`"source":"cb"`, `"id":"b4"`},
+		{`"source":"cb"`, `"id":"e5"`},
+		{`"source":"va"`, `"id":"e6"`},
+	} {
+		for _, content := range contents {
+			if !strings.Contains(data[i], content) {
+				t.Errorf("event %d lacks %s: %s", i, content, data[i])
+			}
+		}
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after the feed ended: %d pollers", pollers)
+	}
+}
+
+func TestChatFeedHandlerFilters(t *testing.T) {
+	url, _ := mockChatFeed(t)
+	filters := neturl.QueryEscape(`[{"content":["a3","b4"],"match_any":true}]`)
+	names, data := readChatStream(t, openChatStream(t, url+"?id=ca,cb&delay=500ms&filters="+filters), 20)
+	if !reflect.DeepEqual(names, []string{"message", "message", "chat_ended", "chat_ended"}) ||
+		!strings.Contains(data[0], `"id":"a3"`) || !strings.Contains(data[1], `"id":"b4"`) {
+		t.Errorf("filtered feed sent wrong events: %v %v", names, data)
+	}
+}
+
+func TestChatFeedHandlerInvalidInput(t *testing.T) {
+	invalid := map[string]string{
+		"":                                  "chatIdMissing",
+		"?id=,":                             "chatIdMissing",
+		"?id=1,2,3,4,5,6&video=7,8,9,10,11": "tooManyItems",
+		"?id=ca&delay=-1s":                  "delayInvalid",
+		"?id=ca&delay=soon":                 "delayInvalid",
+		"?id=ca&filters=roles":              "filterInvalid",
+	}
+	for query, expected := range invalid {
+		body := requestChat(t, yt_stats.ChatFeedHandler(getInputs()), "/ytstats/v1/feed/"+query,
+			http.StatusBadRequest)
+		if !strings.Contains(body, expected) {
+			t.Errorf("feed with query %s returned wrong body: expected %s actually %s", query, expected, body)
+		}
+	}
+}
+
+func TestChatFeedHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.ChatFeedHandler, "/ytstats/v1/feed/?id=ca")
+}
+
+func TestChatFeedHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.ChatFeedHandler, "/ytstats/v1/feed/?id=ca", "POST")
+}
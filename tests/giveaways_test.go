@@ -0,0 +1,336 @@
+package yt_stats_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"yt_stats"
+)
+
+// Requests a giveaways endpoint with the given method, key and body, expecting the given status code.
+func requestGiveaways(t *testing.T, f func(yt_stats.Inputs) http.Handler, inputs yt_stats.Inputs, method string,
+	url string, key string, body string, code int) []yt_stats.Giveaway {
+	var response yt_stats.GiveawaysOutbound
+	requestHandler(t, f(inputs), method, url, key, body, code, &response)
+	return response.Giveaways
+}
+
+// Opens a giveaway or poll on the mocked chat with the given definition, giving back the opened giveaway.
+func openGiveaway(t *testing.T, inputs yt_stats.Inputs, definition string) yt_stats.Giveaway {
+	giveaways := requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "POST", "/ytstats/v1/giveaways/", "key",
+		fmt.Sprintf(`{"chat_id":"%s",%s}`, chatId, definition), http.StatusOK)
+	if len(giveaways) != 1 || giveaways[0].Id == "" || giveaways[0].Status != "open" {
+		t.Fatalf("handler returned wrong body, expected opened giveaway actually %+v", giveaways)
+	}
+	return giveaways[0]
+}
+
+// Gives a giveaway or poll as seen by the key that opened it, once the given amount of users entered it.
+func getGiveaway(t *testing.T, inputs yt_stats.Inputs, id string, entries int) yt_stats.Giveaway {
+	var giveaways []yt_stats.Giveaway
+	for i := 0; i < 100; i++ {
+		giveaways = requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "GET", "/ytstats/v1/giveaways/"+id+"/",
+			"key", "", http.StatusOK)
+		if giveaways[0].Entries >= entries {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return giveaways[0]
+}
+
+// Gives the IDs of the users who entered a giveaway or poll, in the order they entered.
+func giveawayEntrants(giveaway yt_stats.Giveaway) []string {
+	ids := make([]string, len(giveaway.Entrants))
+	for i, entrant := range giveaway.Entrants {
+		ids[i] = entrant.User.UserId
+	}
+	return ids
+}
+
+func TestGiveawaysHandlerCollectsEntries(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	giveaway := openGiveaway(t, inputs, `"type":"giveaway","keyword":"HELLO"`)
+	members := openGiveaway(t, inputs, `"type":"giveaway","keyword":"hello","members_only":true`)
+	poll := openGiveaway(t, inputs, `"type":"poll","options":["Hello","hi"]`)
+	moderated := openGiveaway(t, inputs, `"type":"poll","options":["Hello","hi"],"exclude_moderators":true`)
+	atomic.StoreInt32(&stage, chatMessages)
+	expected := []struct {
+		giveaway yt_stats.Giveaway
+		entrants []string
+		votes    []yt_stats.PollVotes
+	}{
+		{giveaway, []string{"u1"}, nil},
+		{members, []string{"u1"}, nil},
+		{poll, []string{"u1", "u2"}, []yt_stats.PollVotes{{Option: "Hello", Votes: 1}, {Option: "hi", Votes: 1}}},
+		{moderated, []string{"u1"}, []yt_stats.PollVotes{{Option: "Hello", Votes: 1}, {Option: "hi", Votes: 0}}},
+	}
+	for _, entries := range expected {
+		collected := getGiveaway(t, inputs, entries.giveaway.Id, len(entries.entrants))
+		if !reflect.DeepEqual(giveawayEntrants(collected), entries.entrants) ||
+			collected.Entries != len(entries.entrants) || !reflect.DeepEqual(collected.Votes, entries.votes) {
+			t.Errorf("giveaway collected wrong entries, expected %+v actually %+v", entries, collected)
+		}
+	}
+	if entrant := getGiveaway(t, inputs, members.Id, 1).Entrants[0]; !entrant.User.Member {
+		t.Errorf("members only giveaway collected wrong entrant: %+v", entrant)
+	}
+	listed := requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "GET", "/ytstats/v1/giveaways/?chat="+chatId,
+		"key", "", http.StatusOK)
+	if len(listed) != 4 || listed[0].Id != giveaway.Id || listed[0].Entries != 1 || listed[0].Entrants != nil {
+		t.Errorf("handler listed wrong giveaways: %+v", listed)
+	}
+	listed = requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "GET", "/ytstats/v1/giveaways/?chat=other",
+		"key", "", http.StatusOK)
+	if len(listed) != 0 {
+		t.Errorf("handler listed giveaways of another chat: %+v", listed)
+	}
+	for _, opened := range []yt_stats.Giveaway{giveaway, members, poll, moderated} {
+		requestGiveaways(t, yt_stats.GiveawayCloseHandler, inputs, "POST", "/ytstats/v1/giveaways/"+opened.Id+"/close/",
+			"key", "", http.StatusOK)
+	}
+	for i := 0; i < 100 && inputs.Relay.Pollers() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after all giveaways closed: %d pollers", pollers)
+	}
+}
+
+func TestGiveawaysHandlerDrawsVerifiableWinner(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	giveaway := openGiveaway(t, inputs, `"type":"poll","keyword":"!vote","options":["a","b"]`)
+	if giveaway.SeedHash != "" {
+		t.Errorf("poll has a seed hash: %+v", giveaway)
+	}
+	giveaway = openGiveaway(t, inputs, `"type":"giveaway","keyword":"hello"`)
+	if giveaway.SeedHash == "" || giveaway.Seed != "" {
+		t.Fatalf("opened giveaway has wrong seed: %+v", giveaway)
+	}
+	atomic.StoreInt32(&stage, chatMessages)
+	entrants := giveawayEntrants(getGiveaway(t, inputs, giveaway.Id, 1))
+	closed := requestGiveaways(t, yt_stats.GiveawayCloseHandler, inputs, "POST",
+		"/ytstats/v1/giveaways/"+giveaway.Id+"/close/", "key", "", http.StatusOK)[0]
+	hash := sha256.Sum256([]byte(closed.Seed))
+	if closed.Status != "closed" || closed.ClosedAt == "" || hex.EncodeToString(hash[:]) != giveaway.SeedHash {
+		t.Fatalf("closed giveaway has wrong seed: %+v", closed)
+	}
+	draw := sha256.Sum256([]byte(strings.Join(append([]string{closed.Seed}, entrants...), "\n")))
+	winner := entrants[binary.BigEndian.Uint64(draw[:8])%uint64(len(entrants))]
+	if closed.Winner == nil || closed.Winner.UserId != winner {
+		t.Errorf("closed giveaway has wrong winner, expected %s actually %+v", winner, closed.Winner)
+	}
+	again := requestGiveaways(t, yt_stats.GiveawayCloseHandler, inputs, "POST",
+		"/ytstats/v1/giveaways/"+giveaway.Id+"/close/", "key", "", http.StatusOK)[0]
+	if !reflect.DeepEqual(again, closed) {
+		t.Errorf("closing a closed giveaway changed it: %+v", again)
+	}
+}
+
+func TestGiveawaysHandlerLifecycle(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	giveaway := openGiveaway(t, inputs, `"type":"giveaway","keyword":"!enter"`)
+	requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "GET", "/ytstats/v1/giveaways/"+giveaway.Id+"/", "other",
+		"", http.StatusNotFound)
+	requestGiveaways(t, yt_stats.GiveawayCloseHandler, inputs, "POST", "/ytstats/v1/giveaways/"+giveaway.Id+"/close/",
+		"other", "", http.StatusNotFound)
+	requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "DELETE", "/ytstats/v1/giveaways/", "key", "",
+		http.StatusBadRequest)
+	requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "DELETE", "/ytstats/v1/giveaways/"+giveaway.Id+"/", "key",
+		"", http.StatusOK)
+	requestGiveaways(t, yt_stats.GiveawaysHandler, inputs, "GET", "/ytstats/v1/giveaways/"+giveaway.Id+"/", "key",
+		"", http.StatusNotFound)
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after the giveaway was deleted: %d pollers", pollers)
+	}
+}
+
+// A store counting how often giveaways are written to it.
+type countingStore struct {
+	yt_stats.Store
+	giveawayWrites int32
+}
+
+func (s *countingStore) Put(collection string, key string, value interface{}) error {
+	if collection == "giveaways" {
+		atomic.AddInt32(&s.giveawayWrites, 1)
+	}
+	return s.Store.Put(collection, key, value)
+}
+
+// Mocks a chat on which the given amount of users write !enter all on one page, and sets up giveaways storing in a
+// counting store. Gives back the inputs, the store, and the keys the chat was polled with since last asked for them.
+func mockGiveawayChat(t *testing.T, users int) (yt_stats.Inputs, *countingStore, func() []string) {
+	var mutex sync.Mutex
+	var keys []string
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		keys = append(keys, r.URL.Query().Get("key"))
+		mutex.Unlock()
+		if r.URL.Query().Get("pageToken") != "p1" {
+			fmt.Fprint(w, `{"nextPageToken":"p1","pollingIntervalMillis":10,"items":[]}`)
+			return
+		}
+		var items []string
+		for i := 0; i < users; i++ {
+			items = append(items, fmt.Sprintf(`{"id":"m%d","snippet":{"type":"textMessageEvent",`+
+				`"displayMessage":"!enter"},"authorDetails":{"channelId":"u%d"}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"nextPageToken":"p2","pollingIntervalMillis":10,"items":[%s]}`, strings.Join(items, ","))
+	})
+	inputs.Relay = yt_stats.NewRelay(inputs)
+	fileStore, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{Store: fileStore}
+	inputs.Giveaways = yt_stats.NewGiveaways(inputs, store)
+	polledKeys := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		polled := keys
+		keys = nil
+		return polled
+	}
+	return inputs, store, polledKeys
+}
+
+func TestGiveawaysSaveEntriesInBatches(t *testing.T) {
+	inputs, store, _ := mockGiveawayChat(t, 500)
+	giveaway, _, err := inputs.Giveaways.Open(yt_stats.Giveaway{ChatId: chatId, Type: "giveaway", Keyword: "!enter"},
+		"key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := getGiveaway(t, inputs, giveaway.Id, 500).Entries; entries != 500 {
+		t.Fatalf("giveaway collected wrong amount of entries: %d", entries)
+	}
+	if writes := atomic.LoadInt32(&store.giveawayWrites); writes > 50 {
+		t.Errorf("giveaway was written once per entry: %d writes", writes)
+	}
+	resumed := yt_stats.NewGiveaways(inputs, store)
+	if err := resumed.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	saved, found, err := resumed.Giveaway(giveaway.Id, "key")
+	if err != nil || !found || saved.Entries != 500 {
+		t.Errorf("giveaway saved wrong entries: %d", saved.Entries)
+	}
+}
+
+func TestGiveawaysFollowAgainAfterFallingBehind(t *testing.T) {
+	var stage int32
+	inputs := mockFloodedChat(t, "!enter", &stage)
+	store := newGatedStore(t, "giveaways")
+	inputs.Giveaways = yt_stats.NewGiveaways(inputs, store)
+	giveaway, _, err := inputs.Giveaways.Open(yt_stats.Giveaway{ChatId: chatId, Type: "giveaway", Keyword: "!enter"},
+		"key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the first entry is held back until the relay drops the subscription during the flood.
+	store.hold()
+	atomic.StoreInt32(&stage, 1)
+	awaitDropped(t, inputs, store)
+	store.release()
+	if entries := getGiveaway(t, inputs, giveaway.Id, chatFloodSize+1).Entries; entries != chatFloodSize+1 {
+		t.Errorf("giveaway collected wrong amount of entries after falling behind: expected %d actually %d",
+			chatFloodSize+1, entries)
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 1 {
+		t.Errorf("chat of open giveaway no longer followed after falling behind: %d pollers", pollers)
+	}
+}
+
+func TestGiveawaysFollowWithNewestKey(t *testing.T) {
+	inputs, _, polledKeys := mockGiveawayChat(t, 0)
+	lastKey := func() string {
+		polledKeys()
+		time.Sleep(50 * time.Millisecond)
+		keys := polledKeys()
+		if len(keys) == 0 {
+			return ""
+		}
+		return keys[len(keys)-1]
+	}
+	first, _, err := inputs.Giveaways.Open(yt_stats.Giveaway{ChatId: chatId, Type: "giveaway", Keyword: "!a"}, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := inputs.Giveaways.Open(yt_stats.Giveaway{ChatId: chatId, Type: "giveaway", Keyword: "!b"}, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := lastKey(); key != "b" {
+		t.Errorf("chat polled with wrong key after a newer giveaway: expected b actually %s", key)
+	}
+	if _, found, err := inputs.Giveaways.Close(second.Id, "b"); err != nil || !found {
+		t.Fatalf("failed closing giveaway: %v", err)
+	}
+	if key := lastKey(); key != "a" {
+		t.Errorf("chat polled with wrong key after the newest giveaway closed: expected a actually %s", key)
+	}
+	if _, found, err := inputs.Giveaways.Delete(first.Id, "a"); err != nil || !found {
+		t.Fatalf("failed deleting giveaway: %v", err)
+	}
+	if key := lastKey(); key != "" || inputs.Relay.Pollers() != 0 {
+		t.Errorf("chat still polled after its last giveaway was deleted with key %s", key)
+	}
+}
+
+func TestGiveawaysHandlerInvalidGiveaways(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	invalid := map[string]string{
+		`{"type":"giveaway","keyword":"!enter"}`:                                   "chatIdMissing",
+		`{"chat_id":"c","type":"raffle","keyword":"!enter"}`:                       "giveawayTypeInvalid",
+		`{"chat_id":"c","type":"giveaway"}`:                                        "giveawayKeywordInvalid",
+		`{"chat_id":"c","type":"giveaway","keyword":"enter now"}`:                  "giveawayKeywordInvalid",
+		`{"chat_id":"c","type":"giveaway","keyword":"!enter","options":["a","b"]}`: "giveawayOptionsInvalid",
+		`{"chat_id":"c","type":"poll","options":["a"]}`:                            "giveawayOptionsInvalid",
+		`{"chat_id":"c","type":"poll","options":["a","A"]}`:                        "giveawayOptionsInvalid",
+		`{"chat_id":"c","type":"poll","options":["a"," "]}`:                        "giveawayOptionsInvalid",
+		`{"chat_id":"c","type":"poll","options":"a,b"}`:                            "giveawayBodyInvalid",
+	}
+	for body, msg := range invalid {
+		req, err := http.NewRequest("POST", "/ytstats/v1/giveaways/", strings.NewReader(body))
+		req.Header.Set("key", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := yt_stats.GiveawaysHandler(inputs)
+		handler.ServeHTTP(rr, req)
+		expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"%s"}`, http.StatusBadRequest, msg)
+		if strings.Trim(rr.Body.String(), "\n") != expected {
+			t.Errorf("handler returned wrong body for %s: expected %v actually %v", body, expected, rr.Body.String())
+		}
+	}
+}
+
+func TestGiveawaysHandlerTrackingDisabled(t *testing.T) {
+	requestGiveaways(t, yt_stats.GiveawaysHandler, getInputs(), "GET", "/ytstats/v1/giveaways/", "key", "",
+		http.StatusServiceUnavailable)
+}
+
+func TestGiveawaysHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.GiveawaysHandler, "/ytstats/v1/giveaways/")
+}
+
+func TestGiveawaysHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.GiveawaysHandler, "/ytstats/v1/giveaways/", "PUT")
+	unsupportedRequestType(t, yt_stats.GiveawayCloseHandler, "/ytstats/v1/giveaways/1/close/", "GET")
+}
@@ -0,0 +1,138 @@
+package yt_stats_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"yt_stats"
+)
+
+// Fake YouTube API with one channel whose uploads playlist holds 60 videos. Counts requests made to each endpoint.
+func mockGraphqlYoutube(t *testing.T) (yt_stats.Inputs, map[string]int) {
+	var mut sync.Mutex
+	requests := make(map[string]int)
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		requests[r.URL.Path]++
+		mut.Unlock()
+		switch r.URL.Path {
+		case "/channels":
+			fmt.Fprint(w, `{"items":[{"id":"UC1","snippet":{"title":"Channel"},"contentDetails":{"relatedPlaylists":`+
+				`{"uploads":"UU1"}},"statistics":{"viewCount":"10","subscriberCount":"5","videoCount":"60"}}]}`)
+		case "/playlists":
+			fmt.Fprint(w, `{"items":[{"id":"UU1","snippet":{"title":"Uploads","channelId":"UC1"},`+
+				`"contentDetails":{"itemCount":60}}]}`)
+		case "/playlistItems":
+			start, next := 0, `"nextPageToken":"page2",`
+			if r.URL.Query().Get("pageToken") == "page2" {
+				start, next = 50, ""
+			}
+			var items []string
+			for i := start; i < start+50 && i < 60; i++ {
+				items = append(items, fmt.Sprintf(`{"snippet":{"resourceId":{"videoId":"v%d"}}}`, i))
+			}
+			fmt.Fprintf(w, `{%s"items":[%s]}`, next, strings.Join(items, ","))
+		case "/videos":
+			var items []string
+			for i, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+				items = append(items, fmt.Sprintf(`{"id":"%s","snippet":{"channelId":"UC1"},"contentDetails":`+
+					`{"duration":"PT1M"},"statistics":{"viewCount":"%d","likeCount":"1","commentCount":"0"}}`, id, i))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	return inputs, requests
+}
+
+func TestGraphQLHandlerBatchedTraversal(t *testing.T) {
+	inputs, requests := mockGraphqlYoutube(t)
+	query := `{"query":"{ channels(ids: [\"UC1\"]) { title uploads { title videos { id channel { id } } ` +
+		`video_stats { available_videos } } } }"}`
+	req, err := http.NewRequest("POST", "/ytstats/v1/graphql/", bytes.NewBufferString(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("key", "key")
+	rr := httptest.NewRecorder()
+	handler := yt_stats.GraphQLHandler(inputs)
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusOK, status)
+	}
+	var response struct {
+		Data struct {
+			Channels []struct {
+				Title   string `json:"title"`
+				Uploads struct {
+					Videos []struct {
+						Id      string `json:"id"`
+						Channel struct {
+							Id string `json:"id"`
+						} `json:"channel"`
+					} `json:"videos"`
+					VideoStats struct {
+						AvailableVideos int `json:"available_videos"`
+					} `json:"video_stats"`
+				} `json:"uploads"`
+			} `json:"channels"`
+		} `json:"data"`
+		Errors     []interface{}  `json:"errors"`
+		Extensions map[string]int `json:"extensions"`
+	}
+	err = json.NewDecoder(rr.Body).Decode(&response)
+	if err != nil {
+		t.Fatal("failed decoding response from endpoint")
+	}
+	if len(response.Errors) != 0 {
+		t.Fatalf("handler returned errors: %v", response.Errors)
+	}
+	if len(response.Data.Channels) != 1 || len(response.Data.Channels[0].Uploads.Videos) != 60 {
+		t.Fatal("handler returned wrong body, expected one channel with 60 uploaded videos")
+	}
+	if response.Data.Channels[0].Uploads.Videos[59].Channel.Id != "UC1" {
+		t.Error("handler returned wrong body, video did not resolve its channel")
+	}
+	if response.Data.Channels[0].Uploads.VideoStats.AvailableVideos != 60 {
+		t.Error("handler returned wrong body, statistics not calculated over all videos")
+	}
+	if requests["/videos"] != 2 || requests["/channels"] != 1 {
+		t.Errorf("handler did not batch queries: %d video queries and %d channel queries",
+			requests["/videos"], requests["/channels"])
+	}
+	if response.Extensions["quota_usage"] != 6 {
+		t.Errorf("handler returned wrong quota usage: expected 6 actually %d", response.Extensions["quota_usage"])
+	}
+}
+
+func TestGraphQLHandlerNoQuery(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/graphql/", nil)
+	req.Header.Set("key", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.GraphQLHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusBadRequest, status)
+	}
+	expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"queryMissing"}`, http.StatusBadRequest)
+	if strings.Trim(rr.Body.String(), "\n") != expected {
+		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
+	}
+}
+
+func TestGraphQLHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.GraphQLHandler, "/ytstats/v1/graphql/?query=%7Bchannels(ids:[])%7Bid%7D%7D")
+}
+
+func TestGraphQLHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.GraphQLHandler, "/ytstats/v1/graphql/", "PUT")
+}
@@ -0,0 +1,265 @@
+package yt_stats_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yt_stats"
+)
+
+// Mocks YouTube with channels, failing while fail is set, and a scheduler storing its jobs in a store.
+func mockScheduler(t *testing.T) (yt_stats.Inputs, yt_stats.Store, map[string]int, *bool) {
+	requests := make(map[string]int)
+	fail := false
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"code":500,"message":"backendError","errors":[{"reason":"backendError"}]}}`)
+			return
+		}
+		var items []string
+		for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+			requests[id]++
+			items = append(items, fmt.Sprintf(`{"id":"%s","statistics":{"viewCount":"1","subscriberCount":"1",`+
+				`"videoCount":"1"}}`, id))
+		}
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+	})
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, 0)
+	inputs.Scheduler = yt_stats.NewScheduler(inputs.Tracker)
+	return inputs, store, requests, &fail
+}
+
+// Requests a jobs endpoint with the given method, key and body, expecting the given status code.
+func requestJobs(t *testing.T, f func(yt_stats.Inputs) http.Handler, inputs yt_stats.Inputs, method string,
+	url string, key string, body string, code int) []yt_stats.Job {
+	var response yt_stats.JobsOutbound
+	requestHandler(t, f(inputs), method, url, key, body, code, &response)
+	return response.Jobs
+}
+
+// Creates a job with the given definition, giving back the created job.
+func createJob(t *testing.T, inputs yt_stats.Inputs, definition string) yt_stats.Job {
+	jobs := requestJobs(t, yt_stats.JobsHandler, inputs, "POST", "/ytstats/v1/jobs/", "key", definition,
+		http.StatusOK)
+	if len(jobs) != 1 || jobs[0].Id == "" {
+		t.Fatalf("handler returned wrong body, expected created job actually %+v", jobs)
+	}
+	return jobs[0]
+}
+
+// Gives a job as seen by the key that created it.
+func getJob(t *testing.T, inputs yt_stats.Inputs, id string) yt_stats.Job {
+	jobs := requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/"+id+"/", "key", "",
+		http.StatusOK)
+	return jobs[0]
+}
+
+func TestJobsHandlerLifecycle(t *testing.T) {
+	inputs, _, _, _ := mockScheduler(t)
+	job := createJob(t, inputs, `{"type":"channels","targets":["UC1"],"schedule":"30 2 * * *"}`)
+	if !strings.HasSuffix(job.NextRun, "T02:30:00Z") || job.Paused {
+		t.Errorf("handler returned wrong body, expected next run at 02:30 actually %+v", job)
+	}
+	jobs := requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/", "key", "", http.StatusOK)
+	if len(jobs) != 1 || jobs[0].Id != job.Id {
+		t.Errorf("handler returned wrong body, expected created job actually %+v", jobs)
+	}
+	jobs = requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/", "other", "", http.StatusOK)
+	if len(jobs) != 0 {
+		t.Errorf("handler returned jobs created with another key: %+v", jobs)
+	}
+	requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/"+job.Id+"/", "other", "",
+		http.StatusNotFound)
+	jobs = requestJobs(t, yt_stats.JobPauseHandler, inputs, "POST", "/ytstats/v1/jobs/"+job.Id+"/pause/", "key",
+		"", http.StatusOK)
+	if !jobs[0].Paused {
+		t.Error("handler did not pause job")
+	}
+	jobs = requestJobs(t, yt_stats.JobResumeHandler, inputs, "POST", "/ytstats/v1/jobs/"+job.Id+"/resume/", "key",
+		"", http.StatusOK)
+	if jobs[0].Paused {
+		t.Error("handler did not resume job")
+	}
+	requestJobs(t, yt_stats.JobsHandler, inputs, "DELETE", "/ytstats/v1/jobs/"+job.Id+"/", "other", "",
+		http.StatusNotFound)
+	requestJobs(t, yt_stats.JobsHandler, inputs, "DELETE", "/ytstats/v1/jobs/"+job.Id+"/", "key", "", http.StatusOK)
+	requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/"+job.Id+"/", "key", "",
+		http.StatusNotFound)
+}
+
+func TestJobsHandlerRunsDueJobs(t *testing.T) {
+	inputs, _, requests, _ := mockScheduler(t)
+	job := createJob(t, inputs, `{"type":"channels","targets":["UC1","UC2"],"schedule":"@every 1h"}`)
+	paused := createJob(t, inputs, `{"type":"channels","targets":["UC3"],"schedule":"@every 1h"}`)
+	requestJobs(t, yt_stats.JobPauseHandler, inputs, "POST", "/ytstats/v1/jobs/"+paused.Id+"/pause/", "key", "",
+		http.StatusOK)
+	inputs.Scheduler.RunDue(time.Now())
+	if requests["UC1"] != 0 {
+		t.Error("scheduler ran job before it was due")
+	}
+	now := time.Now().Add(2 * time.Hour)
+	inputs.Scheduler.RunDue(now)
+	if requests["UC1"] != 1 || requests["UC2"] != 1 || requests["UC3"] != 0 {
+		t.Errorf("scheduler queried wrong channels: %v", requests)
+	}
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "ok" || job.QuotaUsed != 1 || job.NextRun != now.Add(time.Hour).UTC().Format(time.RFC3339) {
+		t.Errorf("scheduler recorded wrong outcome: %+v", job)
+	}
+	var history yt_stats.ChannelHistoryOutbound
+	getChannelResource(t, yt_stats.ChannelHistoryHandler, inputs, "/ytstats/v1/channel/UC2/history/", &history)
+	if len(history.History) != 1 || history.Tracked {
+		t.Errorf("scheduler did not record snapshot: %+v", history)
+	}
+}
+
+func TestJobsHandlerQuotaBudget(t *testing.T) {
+	inputs, _, requests, _ := mockScheduler(t)
+	var targets []string
+	for i := 0; i < 120; i++ {
+		targets = append(targets, fmt.Sprintf(`"UC%d"`, i))
+	}
+	job := createJob(t, inputs, fmt.Sprintf(`{"type":"channels","targets":[%s],"schedule":"@every 1m",`+
+		`"quota_budget":4}`, strings.Join(targets, ",")))
+	now := time.Now().Add(time.Hour)
+	inputs.Scheduler.RunDue(now)
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "ok" || job.QuotaUsed != 3 {
+		t.Errorf("scheduler recorded wrong outcome: %+v", job)
+	}
+	inputs.Scheduler.RunDue(now.Add(time.Hour))
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "budgetExhausted" || job.QuotaUsed != 4 || requests["UC0"] != 2 || requests["UC50"] != 1 {
+		t.Errorf("scheduler exceeded quota budget: %+v %v", job, requests)
+	}
+}
+
+func TestJobsHandlerPlaylistQuotaWithoutCost(t *testing.T) {
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400,"message":"API key not valid. Please pass a valid API key.",`+
+			`"errors":[{"reason":"badRequest"}]}}`)
+	})
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, 0)
+	inputs.Scheduler = yt_stats.NewScheduler(inputs.Tracker)
+	job := createJob(t, inputs, `{"type":"playlists","targets":["PL1"],"schedule":"@every 1h"}`)
+	inputs.Scheduler.RunDue(time.Now().Add(2 * time.Hour))
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "failed" || job.QuotaUsed != 1 {
+		t.Errorf("scheduler recorded wrong outcome: %+v", job)
+	}
+}
+
+func TestJobsHandlerRetries(t *testing.T) {
+	inputs, _, _, fail := mockScheduler(t)
+	job := createJob(t, inputs, `{"type":"channels","targets":["UC1"],"schedule":"@every 1h","max_retries":2}`)
+	*fail = true
+	now := time.Now().Add(2 * time.Hour)
+	inputs.Scheduler.RunDue(now)
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "failed" || job.LastError == "" || job.Retries != 1 ||
+		job.NextRun != now.Add(time.Minute).UTC().Format(time.RFC3339) {
+		t.Errorf("scheduler did not retry after a minute: %+v", job)
+	}
+	now = now.Add(time.Minute)
+	inputs.Scheduler.RunDue(now)
+	job = getJob(t, inputs, job.Id)
+	if job.Retries != 2 || job.NextRun != now.Add(2*time.Minute).UTC().Format(time.RFC3339) {
+		t.Errorf("scheduler did not back off exponentially: %+v", job)
+	}
+	now = now.Add(2 * time.Minute)
+	inputs.Scheduler.RunDue(now)
+	job = getJob(t, inputs, job.Id)
+	if job.Retries != 0 || job.NextRun != now.Add(time.Hour).UTC().Format(time.RFC3339) {
+		t.Errorf("scheduler kept retrying beyond maximum retries: %+v", job)
+	}
+	*fail = false
+	inputs.Scheduler.RunDue(now.Add(time.Hour))
+	job = getJob(t, inputs, job.Id)
+	if job.LastStatus != "ok" || job.LastError != "" {
+		t.Errorf("scheduler recorded wrong outcome: %+v", job)
+	}
+}
+
+func TestJobsHandlerJitter(t *testing.T) {
+	inputs, _, _, _ := mockScheduler(t)
+	job := createJob(t, inputs, `{"type":"channels","targets":["UC1"],"schedule":"0 * * * *","jitter":"10m"}`)
+	nextRun, err := time.Parse(time.RFC3339, job.NextRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextRun.Minute() >= 10 {
+		t.Errorf("scheduler delayed job beyond its jitter: %s", job.NextRun)
+	}
+}
+
+func TestJobsHandlerInvalidJobs(t *testing.T) {
+	inputs, _, _, _ := mockScheduler(t)
+	invalid := map[string]string{
+		`{"type":"captions","targets":["v1"],"schedule":"@every 1h"}`:             "jobTypeInvalid",
+		`{"type":"videos","schedule":"@every 1h"}`:                                "jobTargetsMissing",
+		`{"type":"videos","targets":["v1"],"schedule":"@every 1s"}`:               "scheduleInvalid",
+		`{"type":"videos","targets":["v1"],"schedule":"61 * * * *"}`:              "scheduleInvalid",
+		`{"type":"videos","targets":["v1"],"schedule":"0 0 30 2 *"}`:              "scheduleInvalid",
+		`{"type":"videos","targets":["v1"],"schedule":"@daily","jitter":"soon"}`:  "scheduleInvalid",
+		`{"type":"videos","targets":["v1"],"schedule":"@daily","max_retries":-1}`: "jobBodyInvalid",
+		`{"type":"videos"`: "jobBodyInvalid",
+	}
+	for body, msg := range invalid {
+		req, err := http.NewRequest("POST", "/ytstats/v1/jobs/", strings.NewReader(body))
+		req.Header.Set("key", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := yt_stats.JobsHandler(inputs)
+		handler.ServeHTTP(rr, req)
+		expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"%s"}`, http.StatusBadRequest, msg)
+		if strings.Trim(rr.Body.String(), "\n") != expected {
+			t.Errorf("handler returned wrong body for %s: expected %v actually %v", body, expected, rr.Body.String())
+		}
+	}
+}
+
+func TestJobsHandlerEnsureJob(t *testing.T) {
+	inputs, _, requests, _ := mockScheduler(t)
+	err := inputs.Scheduler.EnsureJob(yt_stats.Job{Id: "tracked", Type: "tracked", Schedule: "@every 1h"}, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestChannelHistory(t, inputs, "POST", "/ytstats/v1/channel/UC1/history/", http.StatusOK)
+	inputs.Scheduler.RunDue(time.Now().Add(2 * time.Hour))
+	if requests["UC1"] != 2 {
+		t.Errorf("scheduler did not take snapshots of tracked channels: %v", requests)
+	}
+	jobs := requestJobs(t, yt_stats.JobsHandler, inputs, "GET", "/ytstats/v1/jobs/", "server", "", http.StatusOK)
+	if len(jobs) != 1 || jobs[0].LastStatus != "ok" {
+		t.Errorf("handler returned wrong body, expected tracked job actually %+v", jobs)
+	}
+}
+
+func TestJobsHandlerTrackingDisabled(t *testing.T) {
+	requestJobs(t, yt_stats.JobsHandler, getInputs(), "GET", "/ytstats/v1/jobs/", "key", "",
+		http.StatusServiceUnavailable)
+}
+
+func TestJobsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.JobsHandler, "/ytstats/v1/jobs/")
+}
+
+func TestJobsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.JobsHandler, "/ytstats/v1/jobs/", "PUT")
+	unsupportedRequestType(t, yt_stats.JobPauseHandler, "/ytstats/v1/jobs/1/pause/", "GET")
+}
@@ -0,0 +1,250 @@
+package yt_stats_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"yt_stats"
+)
+
+// Structs described by the components of the OpenAPI specification. Every schema must be listed here.
+var openAPISchemas = map[string]interface{}{
+	"StatusCodeOutbound":         yt_stats.StatusCodeOutbound{},
+	"StatusOutbound":             yt_stats.StatusOutbound{},
+	"ChannelOutbound":            yt_stats.ChannelOutbound{},
+	"ChannelVideosOutbound":      yt_stats.ChannelVideosOutbound{},
+	"ChannelPlaylistsOutbound":   yt_stats.ChannelPlaylistsOutbound{},
+	"Section":                    yt_stats.Section{},
+	"SectionsOutbound":           yt_stats.SectionsOutbound{},
+	"FeaturedChannelsOutbound":   yt_stats.FeaturedChannelsOutbound{},
+	"Thumbnail":                  yt_stats.Thumbnail{},
+	"ChannelThumbnails":          yt_stats.ChannelThumbnails{},
+	"ChannelBranding":            yt_stats.ChannelBranding{},
+	"ChannelTopics":              yt_stats.ChannelTopics{},
+	"ChannelStatus":              yt_stats.ChannelStatus{},
+	"ChannelLocalization":        yt_stats.ChannelLocalization{},
+	"ChannelHistoryPoint":        yt_stats.ChannelHistoryPoint{},
+	"ChannelHistoryOutbound":     yt_stats.ChannelHistoryOutbound{},
+	"VideoHistoryPoint":          yt_stats.VideoHistoryPoint{},
+	"VideoHistoryOutbound":       yt_stats.VideoHistoryOutbound{},
+	"ViewerSample":               yt_stats.ViewerSample{},
+	"ViewerSummary":              yt_stats.ViewerSummary{},
+	"StreamViewersOutbound":      yt_stats.StreamViewersOutbound{},
+	"ChatRecordingOutbound":      yt_stats.ChatRecordingOutbound{},
+	"ChatterCount":               yt_stats.ChatterCount{},
+	"ChatActivityBucket":         yt_stats.ChatActivityBucket{},
+	"ChatAnalyticsOutbound":      yt_stats.ChatAnalyticsOutbound{},
+	"TokenCount":                 yt_stats.TokenCount{},
+	"EmoteBucket":                yt_stats.EmoteBucket{},
+	"EmotesOutbound":             yt_stats.EmotesOutbound{},
+	"ExchangeRateSet":            yt_stats.ExchangeRateSet{},
+	"ExchangeRatesOutbound":      yt_stats.ExchangeRatesOutbound{},
+	"CurrencyRevenue":            yt_stats.CurrencyRevenue{},
+	"DonorRevenue":               yt_stats.DonorRevenue{},
+	"RevenueBucket":              yt_stats.RevenueBucket{},
+	"StreamRevenueOutbound":      yt_stats.StreamRevenueOutbound{},
+	"ModerationAction":           yt_stats.ModerationAction{},
+	"ModerationLogOutbound":      yt_stats.ModerationLogOutbound{},
+	"ChannelLiveOutbound":        yt_stats.ChannelLiveOutbound{},
+	"ChatTrigger":                yt_stats.ChatTrigger{},
+	"ChatTriggersOutbound":       yt_stats.ChatTriggersOutbound{},
+	"PollVotes":                  yt_stats.PollVotes{},
+	"GiveawayEntrant":            yt_stats.GiveawayEntrant{},
+	"Giveaway":                   yt_stats.Giveaway{},
+	"GiveawaysOutbound":          yt_stats.GiveawaysOutbound{},
+	"Job":                        yt_stats.Job{},
+	"JobsOutbound":               yt_stats.JobsOutbound{},
+	"Webhook":                    yt_stats.Webhook{},
+	"WebhooksOutbound":           yt_stats.WebhooksOutbound{},
+	"WebhookEvent":               yt_stats.WebhookEvent{},
+	"ChannelMilestoneEvent":      yt_stats.ChannelMilestoneEvent{},
+	"VideoUploadedEvent":         yt_stats.VideoUploadedEvent{},
+	"StreamEvent":                yt_stats.StreamEvent{},
+	"CommentKeywordEvent":        yt_stats.CommentKeywordEvent{},
+	"ChatTriggerEvent":           yt_stats.ChatTriggerEvent{},
+	"WebhookDelivery":            yt_stats.WebhookDelivery{},
+	"WebhookDeliveriesOutbound":  yt_stats.WebhookDeliveriesOutbound{},
+	"Channel":                    yt_stats.Channel{},
+	"PlaylistOutbound":           yt_stats.PlaylistOutbound{},
+	"Playlist":                   yt_stats.Playlist{},
+	"VideoOutbound":              yt_stats.VideoOutbound{},
+	"Video":                      yt_stats.Video{},
+	"VideoStats":                 yt_stats.VideoStats{},
+	"CommentOutbound":            yt_stats.CommentOutbound{},
+	"Comment":                    yt_stats.Comment{},
+	"Reply":                      yt_stats.Reply{},
+	"Filter":                     yt_stats.Filter{},
+	"StreamOutbound":             yt_stats.StreamOutbound{},
+	"LiveStream":                 yt_stats.LiveStream{},
+	"Stream":                     yt_stats.Stream{},
+	"ChatOutbound":               yt_stats.ChatOutbound{},
+	"ChatSocketFilter":           yt_stats.ChatSocketFilter{},
+	"ChatSocketOutbound":         yt_stats.ChatSocketOutbound{},
+	"ChatFeedEvent":              yt_stats.ChatFeedEvent{},
+	"ChatUser":                   yt_stats.ChatUser{},
+	"ChatEnded":                  yt_stats.ChatEnded{},
+	"ChatMessageDeleted":         yt_stats.ChatMessageDeleted{},
+	"ChatNewMember":              yt_stats.ChatNewMember{},
+	"ChatMembershipGifting":      yt_stats.ChatMembershipGifting{},
+	"ChatMembershipGiftReceived": yt_stats.ChatMembershipGiftReceived{},
+	"ChatMemberMilestone":        yt_stats.ChatMemberMilestone{},
+	"ChatMemberOnlyModeEnded":    yt_stats.ChatMemberOnlyModeEnded{},
+	"ChatMemberOnlyModeStarted":  yt_stats.ChatMemberOnlyModeStarted{},
+	"ChatSuperChat":              yt_stats.ChatSuperChat{},
+	"ChatSuperSticker":           yt_stats.ChatSuperSticker{},
+	"ChatMessage":                yt_stats.ChatMessage{},
+	"ChatTombstone":              yt_stats.ChatTombstone{},
+	"ChatUserBanned":             yt_stats.ChatUserBanned{},
+	"ChatUnknownEvent":           yt_stats.ChatUnknownEvent{},
+	"GraphQLInbound":             yt_stats.GraphQLInbound{},
+}
+
+// Retrieves the OpenAPI specification from its endpoint.
+func getOpenAPISpec(t *testing.T) map[string]interface{} {
+	var spec map[string]interface{}
+	req, err := http.NewRequest("GET", "/ytstats/v1/openapi.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := yt_stats.OpenAPIHandler(getInputs())
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: expected %v actually %v", http.StatusOK, status)
+	}
+	err = json.NewDecoder(rr.Body).Decode(&spec)
+	if err != nil {
+		t.Fatal("failed decoding response from endpoint")
+	}
+	return spec
+}
+
+// Compares a schema from the specification with a Go type, reporting every field that differs.
+func compareSchema(t *testing.T, path string, schema map[string]interface{}, goType reflect.Type) {
+	if goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		if goType.Kind() != reflect.Struct || ref != "#/components/schemas/"+goType.Name() {
+			t.Errorf("%s: spec references %s but struct uses %s", path, ref, goType)
+		}
+		return
+	}
+	expected := map[reflect.Kind]string{
+		reflect.String:  "string",
+		reflect.Int:     "integer",
+		reflect.Int64:   "integer",
+		reflect.Float64: "number",
+		reflect.Bool:    "boolean",
+		reflect.Slice:   "array",
+		reflect.Struct:  "object",
+		reflect.Map:     "object",
+	}
+	if goType.Kind() == reflect.Interface {
+		return
+	}
+	if schema["type"] != expected[goType.Kind()] {
+		t.Errorf("%s: spec has type %v but struct has %s", path, schema["type"], goType)
+		return
+	}
+	switch goType.Kind() {
+	case reflect.Slice:
+		items, _ := schema["items"].(map[string]interface{})
+		if _, ok := items["oneOf"]; ok && goType.Elem().Kind() == reflect.Interface {
+			return
+		}
+		compareSchema(t, path+"[]", items, goType.Elem())
+	case reflect.Map:
+		if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			compareSchema(t, path+"{}", values, goType.Elem())
+		}
+	case reflect.Struct:
+		properties, _ := schema["properties"].(map[string]interface{})
+		seen := make(map[string]bool)
+		for i := 0; i < goType.NumField(); i++ {
+			name := strings.Split(goType.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			seen[name] = true
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				t.Errorf("%s.%s: field missing from spec", path, name)
+				continue
+			}
+			compareSchema(t, path+"."+name, property, goType.Field(i).Type)
+		}
+		for name := range properties {
+			if !seen[name] {
+				t.Errorf("%s.%s: field in spec does not exist in struct", path, name)
+			}
+		}
+	}
+}
+
+func TestOpenAPISpecMatchesStructs(t *testing.T) {
+	spec := getOpenAPISpec(t)
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for name, schema := range schemas {
+		goStruct, ok := openAPISchemas[name]
+		if !ok {
+			t.Errorf("%s: schema in spec has no matching struct", name)
+			continue
+		}
+		compareSchema(t, name, schema.(map[string]interface{}), reflect.TypeOf(goStruct))
+	}
+	for name := range openAPISchemas {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("%s: struct has no schema in spec", name)
+		}
+	}
+}
+
+func TestOpenAPISpecCoversStatusMessages(t *testing.T) {
+	spec := getOpenAPISpec(t)
+	statusSchema := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})["StatusCodeOutbound"]
+	documented := make(map[string]bool)
+	for _, entry := range statusSchema.(map[string]interface{})["x-status-messages"].([]interface{}) {
+		documented[entry.(map[string]interface{})["status_message"].(string)] = true
+	}
+	files, err := filepath.Glob("../*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusMessage := regexp.MustCompile(`(?:sendStatusCode\([^)]*|StatusMessage:\s*)"([A-Za-z]+)"`)
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range statusMessage.FindAllStringSubmatch(string(source), -1) {
+			if !documented[match[1]] && strings.ToLower(match[1]) != "ok" {
+				t.Errorf("status message %s used in %s is not documented in spec", match[1], file)
+			}
+		}
+	}
+}
+
+func TestOpenAPISpecCoversEndpoints(t *testing.T) {
+	spec := getOpenAPISpec(t)
+	paths := spec["paths"].(map[string]interface{})
+	source, err := ioutil.ReadFile("../cmd/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range regexp.MustCompile(`mux\.Handle\("([^"]+)"`).FindAllStringSubmatch(string(source), -1) {
+		if _, ok := paths[match[1]]; !ok {
+			t.Errorf("endpoint %s is not documented in spec", match[1])
+		}
+	}
+}
+
+func TestOpenAPIHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.OpenAPIHandler, "/ytstats/v1/openapi.json", "PUT")
+}
@@ -0,0 +1,117 @@
+package yt_stats_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"yt_stats"
+)
+
+// Exchange rates in USD with the rate of EUR changing on the second day, listed out of order.
+const mockRates = `{"base":"usd","rates":[{"date":"2021-01-02","rates":{"EUR":0.5}},` +
+	`{"date":"2021-01-01","rates":{"eur":0.8,"JPY":100}}]}`
+
+// Writes an exchange rate file into the given directory, giving back its path.
+func writeExchangeRates(t *testing.T, dir string, rates string) string {
+	path := filepath.Join(dir, "rates.json")
+	err := ioutil.WriteFile(path, []byte(rates), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Gives inputs with the mocked exchange rates, and the path of their file.
+func mockExchangeRates(t *testing.T) (yt_stats.Inputs, string) {
+	inputs := getInputs()
+	path := writeExchangeRates(t, t.TempDir(), mockRates)
+	rates, err := yt_stats.NewExchangeRates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Rates = rates
+	return inputs, path
+}
+
+// Requests the exchange rates endpoint, expecting the given status code.
+func requestRates(t *testing.T, inputs yt_stats.Inputs, url string, code int) yt_stats.ExchangeRatesOutbound {
+	var response yt_stats.ExchangeRatesOutbound
+	requestHandler(t, yt_stats.RatesHandler(inputs), "GET", url, "key", "", code, &response)
+	return response
+}
+
+func TestRatesHandlerHistory(t *testing.T) {
+	inputs, _ := mockExchangeRates(t)
+	rates := requestRates(t, inputs, "/ytstats/v1/rates/", http.StatusOK)
+	expected := []yt_stats.ExchangeRateSet{
+		{Date: "2021-01-01", Rates: map[string]float64{"EUR": 0.8, "JPY": 100}},
+		{Date: "2021-01-02", Rates: map[string]float64{"EUR": 0.5}},
+	}
+	if rates.Base != "USD" || !reflect.DeepEqual(rates.Rates, expected) {
+		t.Errorf("handler returned wrong rates: %+v", rates)
+	}
+}
+
+func TestRatesHandlerRatesOnDate(t *testing.T) {
+	inputs, _ := mockExchangeRates(t)
+	tests := map[string]map[string]float64{
+		"2020-06-01":           {"USD": 1, "EUR": 0.8, "JPY": 100},
+		"2021-01-01T23:00:00Z": {"USD": 1, "EUR": 0.8, "JPY": 100},
+		"2021-03-01":           {"USD": 1, "EUR": 0.5, "JPY": 100},
+	}
+	for date, expected := range tests {
+		rates := requestRates(t, inputs, "/ytstats/v1/rates/?date="+date, http.StatusOK)
+		if len(rates.Rates) != 1 || !reflect.DeepEqual(rates.Rates[0].Rates, expected) {
+			t.Errorf("handler returned wrong rates on %s: %+v", date, rates.Rates)
+		}
+	}
+}
+
+func TestRatesHandlerReloads(t *testing.T) {
+	inputs, path := mockExchangeRates(t)
+	later := time.Now().Add(time.Minute)
+	writeExchangeRates(t, filepath.Dir(path), `{"base":"EUR","rates":[]}`)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if rates := requestRates(t, inputs, "/ytstats/v1/rates/", http.StatusOK); rates.Base != "EUR" {
+		t.Errorf("handler did not reload rates: %+v", rates)
+	}
+	writeExchangeRates(t, filepath.Dir(path), `{"base":"GBP","rates":[{"date":"soon","rates":{}}]}`)
+	if err := os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if rates := requestRates(t, inputs, "/ytstats/v1/rates/", http.StatusOK); rates.Base != "EUR" {
+		t.Errorf("handler did not keep the previous rates: %+v", rates)
+	}
+}
+
+func TestNewExchangeRatesInvalid(t *testing.T) {
+	for _, rates := range []string{`{"rates":[]}`, `{"base":"USD","rates":[{"date":"2021-01-01","rates":{"EUR":0}}]}`,
+		`{"base":"USD","rates":[{"date":"today","rates":{}}]}`, `not json`} {
+		if _, err := yt_stats.NewExchangeRates(writeExchangeRates(t, t.TempDir(), rates)); err == nil {
+			t.Errorf("loaded invalid exchange rates: %s", rates)
+		}
+	}
+	if _, err := yt_stats.NewExchangeRates(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loaded missing exchange rates")
+	}
+}
+
+func TestRatesHandlerErrors(t *testing.T) {
+	inputs, _ := mockExchangeRates(t)
+	requestRates(t, inputs, "/ytstats/v1/rates/?date=tomorrow", http.StatusBadRequest)
+	requestRates(t, getInputs(), "/ytstats/v1/rates/", http.StatusServiceUnavailable)
+}
+
+func TestRatesHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.RatesHandler, "/ytstats/v1/rates/")
+}
+
+func TestRatesHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.RatesHandler, "/ytstats/v1/rates/", "POST")
+}
@@ -0,0 +1,104 @@
+package yt_stats_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"yt_stats"
+)
+
+// Opens each store implementation in a temporary directory.
+func getStores(t *testing.T) map[string]yt_stats.Store {
+	sqliteStore, err := yt_stats.NewSQLiteStore(filepath.Join(t.TempDir(), "ytstats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]yt_stats.Store{"sqlite": sqliteStore, "file": fileStore}
+	t.Cleanup(func() {
+		for _, store := range stores {
+			_ = store.Close()
+		}
+	})
+	return stores
+}
+
+func TestStoreDocuments(t *testing.T) {
+	for name, store := range getStores(t) {
+		for _, key := range []string{"b", "a/1", "c"} {
+			if err := store.Put("things", key, map[string]string{"key": key}); err != nil {
+				t.Fatalf("%s: failed to put document: %v", name, err)
+			}
+		}
+		if err := store.Put("things", "c", map[string]string{"key": "replaced"}); err != nil {
+			t.Fatalf("%s: failed to replace document: %v", name, err)
+		}
+		if err := store.Delete("things", "b"); err != nil {
+			t.Fatalf("%s: failed to delete document: %v", name, err)
+		}
+		keys, err := store.Keys("things")
+		if err != nil || !reflect.DeepEqual(keys, []string{"a/1", "c"}) {
+			t.Errorf("%s: store returned wrong keys: expected [a/1 c] actually %v", name, keys)
+		}
+		var document map[string]string
+		found, err := store.Get("things", "c", &document)
+		if err != nil || !found || document["key"] != "replaced" {
+			t.Errorf("%s: store returned wrong document: %v", name, document)
+		}
+		found, err = store.Get("things", "b", &document)
+		if err != nil || found {
+			t.Errorf("%s: store returned deleted document", name)
+		}
+		keys, err = store.Keys("nothing")
+		if err != nil || len(keys) != 0 {
+			t.Errorf("%s: store returned keys for empty collection: %v", name, keys)
+		}
+	}
+}
+
+func TestStoreSeries(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, store := range getStores(t) {
+		for _, hour := range []int{2, 0, 1, 3} {
+			at := start.Add(time.Duration(hour) * time.Hour)
+			if err := store.Append("counts", "x", at, hour); err != nil {
+				t.Fatalf("%s: failed to append to series: %v", name, err)
+			}
+		}
+		if err := store.Append("counts", "y", start, 100); err != nil {
+			t.Fatalf("%s: failed to append to series: %v", name, err)
+		}
+		values, err := store.Range("counts", "x", start.Add(time.Hour), start.Add(2*time.Hour))
+		if err != nil {
+			t.Fatalf("%s: failed to read series: %v", name, err)
+		}
+		var hours []int
+		for _, value := range values {
+			var hour int
+			if err := json.Unmarshal(value, &hour); err != nil {
+				t.Fatal(err)
+			}
+			hours = append(hours, hour)
+		}
+		if !reflect.DeepEqual(hours, []int{1, 2}) {
+			t.Errorf("%s: store returned wrong range: expected [1 2] actually %v", name, hours)
+		}
+		values, err = store.Range("counts", "x", time.Time{}, time.Time{})
+		if err != nil || len(values) != 4 || string(values[0]) != "0" || string(values[3]) != "3" {
+			t.Errorf("%s: store returned wrong series: %s", name, values)
+		}
+	}
+}
+
+func TestOpenStoreInvalid(t *testing.T) {
+	for _, description := range []string{"", "sqlite", "sqlite:", "postgres:ytstats"} {
+		if _, err := yt_stats.OpenStore(description); err == nil {
+			t.Errorf("opening store %q did not fail", description)
+		}
+	}
+}
@@ -3,12 +3,16 @@ package yt_stats_test
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 	"yt_stats"
 )
 
@@ -168,3 +172,692 @@ func TestStreamHandlerSuccess(t *testing.T) {
 func TestStreamHandlerUnsupportedType(t *testing.T) {
 	unsupportedRequestType(t, yt_stats.StreamHandler, "/ytstats/v1/stream/", "PUT")
 }
+
+// Requests the stream viewers endpoint with the given method and URL, expecting the given status code.
+func requestStreamViewers(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.StreamViewersOutbound {
+	var response yt_stats.StreamViewersOutbound
+	requestHandler(t, yt_stats.StreamViewersHandler(inputs), method, url, "key", "", code, &response)
+	return response
+}
+
+func TestStreamViewersHandlerRecordsViewers(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{streamStatus: "upcoming"}
+	inputs, _, _ := mockWebhooks(t, youtube, &status)
+	response := requestStreamViewers(t, inputs, "POST", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	if response.QuotaUsage != 1 || response.Status != "scheduled" || len(response.Viewers) != 0 {
+		t.Errorf("handler returned wrong body: %+v", response)
+	}
+	youtube.streamStatus = "live"
+	for _, viewers := range []int{10, 40, 20} {
+		youtube.viewers = viewers
+		requestStreamViewers(t, inputs, "POST", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	}
+	youtube.streamStatus = "ended"
+	requestStreamViewers(t, inputs, "POST", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	response = requestStreamViewers(t, inputs, "GET", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	expected := yt_stats.ViewerSummary{
+		Samples:        3,
+		PeakViewers:    40,
+		PeakTime:       response.Viewers[1].Time,
+		AverageViewers: 70.0 / 3,
+		StartTime:      "2021-01-01T00:01:00Z",
+		EndTime:        "2021-01-01T01:00:00Z",
+		DurationLive:   3540,
+	}
+	if response.QuotaUsage != 0 || response.Status != "ended" || !reflect.DeepEqual(response.Summary, expected) {
+		t.Errorf("handler returned wrong summary: %+v", response.Summary)
+	}
+	var viewers []int
+	for _, sample := range response.Viewers {
+		viewers = append(viewers, sample.ConcurrentViewers)
+	}
+	if !reflect.DeepEqual(viewers, []int{10, 40, 20}) {
+		t.Errorf("handler returned wrong viewers: %v", viewers)
+	}
+	response = requestStreamViewers(t, inputs, "GET", "/ytstats/v1/stream/v1/viewers/?interval=1h", http.StatusOK)
+	if len(response.Viewers) != 1 || response.Viewers[0].ConcurrentViewers != 40 || response.Summary.Samples != 3 {
+		t.Errorf("handler returned wrong downsampled viewers: %+v", response)
+	}
+}
+
+func TestStreamViewersHandlerSamplesActiveStreams(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{streamStatus: "live", viewers: 25}
+	inputs, _, _ := mockWebhooks(t, youtube, &status)
+	requestStreamViewers(t, inputs, "POST", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	err := inputs.Scheduler.EnsureJob(yt_stats.Job{Id: "viewers", Type: "viewers", Schedule: "@every 1m"}, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Scheduler.RunDue(time.Now().Add(2 * time.Minute))
+	youtube.streamStatus = "ended"
+	inputs.Scheduler.RunDue(time.Now().Add(4 * time.Minute))
+	inputs.Scheduler.RunDue(time.Now().Add(6 * time.Minute))
+	response := requestStreamViewers(t, inputs, "GET", "/ytstats/v1/stream/v1/viewers/", http.StatusOK)
+	if response.Status != "ended" || response.Summary.Samples != 2 || response.Summary.PeakViewers != 25 {
+		t.Errorf("handler returned wrong body: %+v", response)
+	}
+}
+
+func TestStreamViewersHandlerNotAStream(t *testing.T) {
+	status := http.StatusOK
+	inputs, _, _ := mockWebhooks(t, &mockYouTube{streamStatus: "video"}, &status)
+	requestStreamViewers(t, inputs, "POST", "/ytstats/v1/stream/v1/viewers/", http.StatusNotFound)
+	requestStreamViewers(t, inputs, "GET", "/ytstats/v1/stream/v1/viewers/", http.StatusNotFound)
+}
+
+func TestStreamViewersHandlerInvalidInterval(t *testing.T) {
+	status := http.StatusOK
+	inputs, _, _ := mockWebhooks(t, &mockYouTube{}, &status)
+	requestStreamViewers(t, inputs, "GET", "/ytstats/v1/stream/v1/viewers/?interval=soon", http.StatusBadRequest)
+}
+
+func TestStreamViewersHandlerTrackingDisabled(t *testing.T) {
+	requestStreamViewers(t, getInputs(), "GET", "/ytstats/v1/stream/v1/viewers/", http.StatusServiceUnavailable)
+}
+
+func TestStreamViewersHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.StreamViewersHandler, "/ytstats/v1/stream/v1/viewers/")
+}
+
+func TestStreamViewersHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.StreamViewersHandler, "/ytstats/v1/stream/v1/viewers/", "DELETE")
+}
+
+// Requests the stream recording endpoint with the given method, expecting the given status code.
+func requestStreamRecording(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.ChatRecordingOutbound {
+	var response yt_stats.ChatRecordingOutbound
+	requestHandler(t, yt_stats.StreamRecordingHandler(inputs), method, url, "key", "", code, &response)
+	return response
+}
+
+// Waits for a recording to reach the given status, failing if it does not.
+func awaitRecording(t *testing.T, inputs yt_stats.Inputs, url string, status string) yt_stats.ChatRecordingOutbound {
+	var recording yt_stats.ChatRecordingOutbound
+	for i := 0; i < 200; i++ {
+		recording = requestStreamRecording(t, inputs, "GET", url, http.StatusOK)
+		if recording.Status == status {
+			return recording
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("recording did not reach status %s: %+v", status, recording)
+	return recording
+}
+
+func TestStreamRecordingHandlerRecordsAndReplays(t *testing.T) {
+	stage := chatMessages
+	url, inputs, _ := mockChatStream(t, &stage)
+	recording := requestStreamRecording(t, inputs, "POST", "/ytstats/v1/stream/v1/recording/", http.StatusOK)
+	if recording.QuotaUsage != 1 || recording.Status != "recording" || recording.ChatId != chatId {
+		t.Errorf("handler returned wrong recording: %+v", recording)
+	}
+	atomic.StoreInt32(&stage, chatEnd)
+	recording = awaitRecording(t, inputs, "/ytstats/v1/stream/v1/recording/", "ended")
+	if recording.Events != 4 || recording.EndedAt == "" {
+		t.Errorf("handler returned wrong recording: %+v", recording)
+	}
+	names, data := readChatStream(t, openChatStream(t, url+"stream/v1/replay/?speed=1000"), 10)
+	if !reflect.DeepEqual(names, []string{"message", "message", "superchat", "chat_ended"}) ||
+		!strings.Contains(data[2], `"Hello there"`) {
+		t.Errorf("handler replayed wrong events: %v %v", names, data)
+	}
+}
+
+func TestStreamRecordingHandlerStops(t *testing.T) {
+	stage := chatMessages
+	_, inputs, _ := mockChatStream(t, &stage)
+	requestStreamRecording(t, inputs, "POST", "/ytstats/v1/stream/v1/recording/", http.StatusOK)
+	for i := 0; i < 200; i++ {
+		if requestStreamRecording(t, inputs, "GET", "/ytstats/v1/stream/v1/recording/", http.StatusOK).Events == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	requestHandler(t, yt_stats.StreamRecordingHandler(inputs), "DELETE", "/ytstats/v1/stream/v1/recording/", "other",
+		"", http.StatusNotFound, nil)
+	if pollers := inputs.Relay.Pollers(); pollers != 1 {
+		t.Errorf("relay stopped polling after a request with another key: %d pollers", pollers)
+	}
+	recording := requestStreamRecording(t, inputs, "DELETE", "/ytstats/v1/stream/v1/recording/", http.StatusOK)
+	if recording.Status != "stopped" || recording.Events != 3 {
+		t.Errorf("handler returned wrong recording: %+v", recording)
+	}
+	if pollers := inputs.Relay.Pollers(); pollers != 0 {
+		t.Errorf("relay kept polling after the recording stopped: %d pollers", pollers)
+	}
+}
+
+func TestStreamRecordingHandlerResumes(t *testing.T) {
+	stage := chatEnd
+	_, inputs, firstPages := mockChatStream(t, &stage)
+	dir := t.TempDir()
+	recording := fmt.Sprintf(`{"video_id":"v1","chat_id":"%s","key":"key","status":"recording","page":"p2",`+
+		`"last_event_id":"m3","events":3,"started_at":"2021-01-01T00:00:00Z"}`, chatId)
+	err := ioutil.WriteFile(filepath.Join(dir, "v1.json"), []byte(recording), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := yt_stats.NewRecorder(inputs.Relay, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recorder.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if resumed, _, _ := recorder.Recording("v1"); resumed.Status == "ended" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resumed, found, err := recorder.Recording("v1")
+	if err != nil || !found || resumed.Status != "ended" || resumed.Events != 4 {
+		t.Errorf("recorder did not resume recording: %+v", resumed)
+	}
+	if pages := atomic.LoadInt32(firstPages); pages != 0 {
+		t.Errorf("recorder polled the chat from the start %d times instead of resuming", pages)
+	}
+	archive, err := ioutil.ReadFile(filepath.Join(dir, "v1.jsonl"))
+	if err != nil || strings.Count(string(archive), "\n") != 1 || !strings.Contains(string(archive), `"e1"`) {
+		t.Errorf("recorder archived wrong events: %s", archive)
+	}
+}
+
+func TestStreamRecordingHandlerKeepsChatters(t *testing.T) {
+	stage := chatMessages
+	_, inputs, _ := mockChatStream(t, &stage)
+	dir := t.TempDir()
+	recorder, err := yt_stats.NewRecorder(inputs.Relay, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, active, err := recorder.Record("v1", "key"); err != nil || !active {
+		t.Fatalf("recorder did not start recording: %v", err)
+	}
+	atomic.StoreInt32(&stage, chatEnd)
+	for i := 0; i < 200; i++ {
+		if recording, _, _ := recorder.Recording("v1"); recording.Status == "ended" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	chatters, err := ioutil.ReadFile(filepath.Join(dir, "v1.chatters"))
+	if err != nil || string(chatters) != "u1\nu2\n" {
+		t.Errorf("recorder kept wrong chatters: %q %v", chatters, err)
+	}
+}
+
+func TestStreamRecordingHandlerChatNotActive(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	response := requestStreamRecording(t, inputs, "POST", "/ytstats/v1/stream/v2/recording/", http.StatusNotFound)
+	if response.QuotaUsage != 1 {
+		t.Errorf("handler returned wrong quota usage: %d", response.QuotaUsage)
+	}
+	requestStreamRecording(t, inputs, "GET", "/ytstats/v1/stream/v2/recording/", http.StatusNotFound)
+	requestHandler(t, yt_stats.StreamReplayHandler(inputs), "GET", "/ytstats/v1/stream/v2/replay/", "key", "",
+		http.StatusNotFound, nil)
+}
+
+func TestStreamReplayHandlerInvalidSpeed(t *testing.T) {
+	stage := chatQuiet
+	_, inputs, _ := mockChatStream(t, &stage)
+	requestHandler(t, yt_stats.StreamReplayHandler(inputs), "GET", "/ytstats/v1/stream/v1/replay/?speed=0", "key", "",
+		http.StatusBadRequest, nil)
+}
+
+func TestStreamRecordingHandlerRecordingDisabled(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ytstats/v1/stream/v1/recording/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("key", "key")
+	for _, handler := range []http.Handler{yt_stats.StreamRecordingHandler(getInputs()),
+		yt_stats.StreamReplayHandler(getInputs())} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusServiceUnavailable {
+			t.Errorf("handler returned wrong status code: expected %v actually %v", http.StatusServiceUnavailable,
+				status)
+		}
+	}
+}
+
+func TestStreamRecordingHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.StreamRecordingHandler, "/ytstats/v1/stream/v1/recording/")
+	keyMissing(t, yt_stats.StreamReplayHandler, "/ytstats/v1/stream/v1/replay/")
+}
+
+func TestStreamRecordingHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.StreamRecordingHandler, "/ytstats/v1/stream/v1/recording/", "PUT")
+	unsupportedRequestType(t, yt_stats.StreamReplayHandler, "/ytstats/v1/stream/v1/replay/", "POST")
+}
+
+// Requests the analytics of a stream or chat from the given handler, expecting the given status code.
+func requestChatAnalytics(t *testing.T, handler http.Handler, url string, code int) yt_stats.ChatAnalyticsOutbound {
+	var response yt_stats.ChatAnalyticsOutbound
+	requestHandler(t, handler, "GET", url, "key", "", code, &response)
+	return response
+}
+
+// Writes a finished recording of a stream and its archive into the given directory.
+func writeChatArchive(t *testing.T, dir string, videoId string, chatId string, events []string) {
+	recording := fmt.Sprintf(`{"video_id":"%s","chat_id":"%s","key":"key","status":"ended","events":%d,`+
+		`"started_at":"2021-01-01T00:00:00Z"}`, videoId, chatId, len(events))
+	err := ioutil.WriteFile(filepath.Join(dir, videoId+".json"), []byte(recording), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, videoId+".jsonl"), []byte(strings.Join(events, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Gives an archived chat event of the given type at the given time, with the given event fields.
+func archivedChatEvent(at string, id string, eventType string, fields string) string {
+	return fmt.Sprintf(`{"time":"%s","id":"%s","type":"%s","event":{"id":"%s","type":"%s","published_at":"%s",%s}}`,
+		at, id, eventType, id, eventType, at, fields)
+}
+
+// Gives inputs with a recorder holding an archive of the stream v1, and of the stream v0 written to by u2 before.
+func mockChatArchive(t *testing.T) yt_stats.Inputs {
+	return mockChatArchiveIn(t, t.TempDir())
+}
+
+// Gives inputs with a recorder holding the archives of mockChatArchive in the given directory.
+func mockChatArchiveIn(t *testing.T, dir string) yt_stats.Inputs {
+	inputs := getInputs()
+	writeChatArchive(t, dir, "v0", "c0", []string{
+		archivedChatEvent("2020-12-01T00:00:00Z", "o1", "message", `"message":"hey","author":{"user_id":"u2"}`),
+	})
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:00:10Z", "m1", "message", `"message":"hello","author":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:40Z", "m2", "message",
+			`"message":"hi","author":{"user_id":"u2","moderator":true}`),
+		archivedChatEvent("2021-01-01T00:01:30Z", "m3", "superchat",
+			`"message":"Hello there","amount":5,"currency":"USD","sent_by":{"user_id":"u1","member":true}`),
+		archivedChatEvent("2021-01-01T00:02:05Z", "d1", "message_deleted", `"deleted_message":"m2"`),
+		archivedChatEvent("2021-01-01T00:02:10Z", "b1", "ban", `"ban_type":"permanent","banned_user":{"user_id":"u2"}`),
+		archivedChatEvent("2021-01-01T00:02:30Z", "e1", "chat_ended", `"id":"e1"`),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	return inputs
+}
+
+func TestStreamAnalyticsHandlerAnalysesArchive(t *testing.T) {
+	handler := yt_stats.StreamAnalyticsHandler(mockChatArchive(t))
+	analytics := requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/", http.StatusOK)
+	if analytics.Id != "v1" || analytics.Source != "archive" || analytics.Events != 6 || analytics.Messages != 3 ||
+		analytics.Bans != 1 || analytics.Deletions != 1 {
+		t.Errorf("handler returned wrong counts: %+v", analytics)
+	}
+	if analytics.UniqueChatters != 2 || analytics.NewChatters != 1 || analytics.ReturningChatters != 1 {
+		t.Errorf("handler returned wrong chatters: %+v", analytics)
+	}
+	if analytics.StartTime != "2021-01-01T00:00:10Z" || analytics.EndTime != "2021-01-01T00:02:30Z" ||
+		analytics.MessagesPerMinute < 1.28 || analytics.MessagesPerMinute > 1.29 {
+		t.Errorf("handler returned wrong rate: %+v", analytics)
+	}
+	if analytics.MemberShare < 0.33 || analytics.MemberShare > 0.34 || analytics.ModeratorShare != analytics.MemberShare {
+		t.Errorf("handler returned wrong shares: %v %v", analytics.MemberShare, analytics.ModeratorShare)
+	}
+	if len(analytics.TopChatters) != 2 || analytics.TopChatters[0].Chatter.UserId != "u1" ||
+		analytics.TopChatters[0].Messages != 2 || !analytics.TopChatters[0].Chatter.Member {
+		t.Errorf("handler returned wrong top chatters: %+v", analytics.TopChatters)
+	}
+	expected := []yt_stats.ChatActivityBucket{
+		{Time: "2021-01-01T00:00:00Z", Events: 2, Messages: 2, Chatters: 2},
+		{Time: "2021-01-01T00:01:00Z", Events: 1, Messages: 1, Chatters: 1},
+		{Time: "2021-01-01T00:02:00Z", Events: 3},
+	}
+	if analytics.Interval != 60 || !reflect.DeepEqual(analytics.Timeline, expected) {
+		t.Errorf("handler returned wrong timeline: %d %+v", analytics.Interval, analytics.Timeline)
+	}
+}
+
+func TestStreamAnalyticsHandlerUnorderedArchive(t *testing.T) {
+	inputs := getInputs()
+	dir := t.TempDir()
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:01:10Z", "m1", "message", `"message":"late","author":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:10Z", "m2", "message", `"message":"early","author":{"user_id":"u2"}`),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	handler := yt_stats.StreamAnalyticsHandler(inputs)
+	analytics := requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/?interval=1m", http.StatusOK)
+	if analytics.StartTime != "2021-01-01T00:00:10Z" || analytics.EndTime != "2021-01-01T00:01:10Z" ||
+		analytics.MessagesPerMinute != 2 || len(analytics.Timeline) != 2 || analytics.Timeline[0].Messages != 1 ||
+		analytics.Timeline[1].Messages != 1 {
+		t.Errorf("handler returned wrong timeline for unordered archive: %+v", analytics)
+	}
+	if len(analytics.TopChatters) != 2 || analytics.TopChatters[0].Chatter.UserId != "u2" {
+		t.Errorf("handler did not order tied chatters by who wrote first: %+v", analytics.TopChatters)
+	}
+}
+
+func TestStreamAnalyticsHandlerKeepsChatters(t *testing.T) {
+	dir := t.TempDir()
+	handler := yt_stats.StreamAnalyticsHandler(mockChatArchiveIn(t, dir))
+	requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/", http.StatusOK)
+	chatters, err := ioutil.ReadFile(filepath.Join(dir, "v0.chatters"))
+	if err != nil || string(chatters) != "u2\n" {
+		t.Fatalf("handler did not keep the chatters of the archive: %q %v", chatters, err)
+	}
+
+	// The chatters kept are used instead of reading the archive again.
+	writeChatArchive(t, dir, "v0", "c0", []string{
+		archivedChatEvent("2020-12-01T00:00:00Z", "o1", "message", `"message":"hey","author":{"user_id":"u1"}`),
+	})
+	analytics := requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/", http.StatusOK)
+	if analytics.NewChatters != 1 || analytics.ReturningChatters != 1 {
+		t.Errorf("handler did not use the chatters kept: %+v", analytics)
+	}
+}
+
+func TestStreamAnalyticsHandlerTimeRange(t *testing.T) {
+	handler := yt_stats.StreamAnalyticsHandler(mockChatArchive(t))
+	analytics := requestChatAnalytics(t, handler,
+		"/ytstats/v1/stream/v1/analytics/?since=2021-01-01T00:01:00Z&interval=1h&limit=1", http.StatusOK)
+	if analytics.Events != 4 || analytics.Messages != 1 || analytics.NewChatters != 0 ||
+		analytics.ReturningChatters != 1 || len(analytics.TopChatters) != 1 {
+		t.Errorf("handler returned wrong analytics: %+v", analytics)
+	}
+	if analytics.Interval != 3600 || len(analytics.Timeline) != 1 || analytics.Timeline[0].Events != 4 {
+		t.Errorf("handler returned wrong timeline: %d %+v", analytics.Interval, analytics.Timeline)
+	}
+}
+
+func TestStreamAnalyticsHandlerWidensInterval(t *testing.T) {
+	handler := yt_stats.StreamAnalyticsHandler(mockChatArchive(t))
+	analytics := requestChatAnalytics(t, handler, "/ytstats/v1/stream/v0/analytics/?interval=1s", http.StatusOK)
+	if analytics.Interval != 1 || len(analytics.Timeline) != 1 || analytics.NewChatters != 0 {
+		t.Errorf("handler returned wrong analytics: %+v", analytics)
+	}
+	analytics = requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/?interval=1s", http.StatusOK)
+	if analytics.Interval != 1 || len(analytics.Timeline) != 141 {
+		t.Errorf("handler returned wrong timeline: %d with %d buckets", analytics.Interval, len(analytics.Timeline))
+	}
+}
+
+func TestStreamAnalyticsHandlerErrors(t *testing.T) {
+	handler := yt_stats.StreamAnalyticsHandler(mockChatArchive(t))
+	requestChatAnalytics(t, handler, "/ytstats/v1/stream/v2/analytics/", http.StatusNotFound)
+	requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/?interval=0", http.StatusBadRequest)
+	requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/?limit=0", http.StatusBadRequest)
+	requestChatAnalytics(t, handler, "/ytstats/v1/stream/v1/analytics/?since=yesterday", http.StatusBadRequest)
+	requestChatAnalytics(t, yt_stats.StreamAnalyticsHandler(getInputs()), "/ytstats/v1/stream/v1/analytics/",
+		http.StatusServiceUnavailable)
+}
+
+func TestStreamAnalyticsHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.StreamAnalyticsHandler, "/ytstats/v1/stream/v1/analytics/")
+}
+
+func TestStreamAnalyticsHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.StreamAnalyticsHandler, "/ytstats/v1/stream/v1/analytics/", "POST")
+}
+
+// Gives inputs with the mocked exchange rates and a recorder holding an archive of the stream v1 with paid events in
+// four currencies over two days, and a memberships gift.
+func mockRevenueArchive(t *testing.T) yt_stats.Inputs {
+	inputs, _ := mockExchangeRates(t)
+	dir := t.TempDir()
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:00:10Z", "s1", "superchat",
+			`"message":"hi","amount":5,"currency":"USD","sent_by":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:50Z", "s2", "supersticker",
+			`"amount":500,"currency":"JPY","sticker_id":"st","sent_by":{"user_id":"u2"}`),
+		archivedChatEvent("2021-01-01T00:01:10Z", "g1", "memberships_gifted",
+			`"level":"member","count":5,"gifted_by":{"user_id":"u3"}`),
+		archivedChatEvent("2021-01-01T00:01:30Z", "s3", "superchat",
+			`"message":"hey","amount":3,"currency":"GBP","sent_by":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:02:00Z", "m1", "message", `"message":"hello","author":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-02T00:00:10Z", "s4", "superchat",
+			`"message":"again","amount":10,"currency":"EUR","sent_by":{"user_id":"u2"}`),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	return inputs
+}
+
+// Requests the revenue of a stream, expecting the given status code.
+func requestStreamRevenue(t *testing.T, inputs yt_stats.Inputs, url string, code int) yt_stats.StreamRevenueOutbound {
+	var response yt_stats.StreamRevenueOutbound
+	requestHandler(t, yt_stats.StreamRevenueHandler(inputs), "GET", url, "key", "", code, &response)
+	return response
+}
+
+func TestStreamRevenueHandlerSumsRevenue(t *testing.T) {
+	revenue := requestStreamRevenue(t, mockRevenueArchive(t), "/ytstats/v1/stream/v1/revenue/?interval=1h",
+		http.StatusOK)
+	if revenue.StreamId != "v1" || revenue.Currency != "USD" || revenue.Total != 30 || revenue.SuperChats != 3 ||
+		revenue.SuperStickers != 1 || revenue.GiftedMemberships != 5 ||
+		!reflect.DeepEqual(revenue.Unconverted, []string{"GBP"}) {
+		t.Errorf("handler returned wrong revenue: %+v", revenue)
+	}
+	expectedCurrencies := []yt_stats.CurrencyRevenue{
+		{Currency: "EUR", Amount: 10, Count: 1, Converted: 20},
+		{Currency: "GBP", Amount: 3, Count: 1},
+		{Currency: "JPY", Amount: 500, Count: 1, Converted: 5},
+		{Currency: "USD", Amount: 5, Count: 1, Converted: 5},
+	}
+	if !reflect.DeepEqual(revenue.ByCurrency, expectedCurrencies) {
+		t.Errorf("handler returned wrong revenue per currency: %+v", revenue.ByCurrency)
+	}
+	var donors []string
+	for _, donor := range revenue.TopDonors {
+		donors = append(donors, fmt.Sprintf("%s %v %d %d %d", donor.Donor.UserId, donor.Amount, donor.SuperChats,
+			donor.SuperStickers, donor.GiftedMemberships))
+	}
+	if !reflect.DeepEqual(donors, []string{"u2 25 1 1 0", "u1 5 2 0 0", "u3 0 0 0 5"}) {
+		t.Errorf("handler returned wrong donors: %v", donors)
+	}
+	first := yt_stats.RevenueBucket{Time: "2021-01-01T00:00:00Z", Amount: 10, SuperChats: 2, SuperStickers: 1,
+		GiftedMemberships: 5}
+	last := yt_stats.RevenueBucket{Time: "2021-01-02T00:00:00Z", Amount: 20, SuperChats: 1}
+	if revenue.Interval != 3600 || len(revenue.Timeline) != 25 || revenue.Timeline[0] != first ||
+		revenue.Timeline[24] != last {
+		t.Errorf("handler returned wrong timeline: %d %+v", revenue.Interval, revenue.Timeline)
+	}
+}
+
+func TestStreamRevenueHandlerUnorderedArchive(t *testing.T) {
+	inputs, _ := mockExchangeRates(t)
+	dir := t.TempDir()
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:10:00Z", "s1", "superchat",
+			`"message":"late","amount":5,"currency":"USD","sent_by":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:10Z", "s2", "superchat",
+			`"message":"early","amount":2,"currency":"USD","sent_by":{"user_id":"u2"}`),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	revenue := requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?currency=USD&interval=1m",
+		http.StatusOK)
+	if revenue.Total != 7 || len(revenue.Timeline) != 11 || revenue.Timeline[0].Amount != 2 ||
+		revenue.Timeline[10].Amount != 5 {
+		t.Errorf("handler returned wrong timeline for unordered archive: %+v", revenue)
+	}
+}
+
+func TestStreamRevenueHandlerConverts(t *testing.T) {
+	inputs := mockRevenueArchive(t)
+	revenue := requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?currency=eur&limit=1", http.StatusOK)
+	if revenue.Currency != "EUR" || revenue.Total != 18 || len(revenue.TopDonors) != 1 ||
+		revenue.TopDonors[0].Amount != 14 || revenue.Interval != 120 {
+		t.Errorf("handler returned wrong revenue: %+v", revenue)
+	}
+	revenue = requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?until=2021-01-01", http.StatusOK)
+	if revenue.Total != 10 || revenue.SuperChats != 2 {
+		t.Errorf("handler returned wrong revenue within time range: %+v", revenue)
+	}
+	inputs.Rates = nil
+	revenue = requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?currency=EUR", http.StatusOK)
+	if revenue.Total != 10 || !reflect.DeepEqual(revenue.Unconverted, []string{"GBP", "JPY", "USD"}) {
+		t.Errorf("handler returned wrong revenue without exchange rates: %+v", revenue)
+	}
+}
+
+func TestStreamRevenueHandlerErrors(t *testing.T) {
+	inputs := mockRevenueArchive(t)
+	requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v2/revenue/", http.StatusNotFound)
+	requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?currency=euro", http.StatusBadRequest)
+	requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/?limit=none", http.StatusBadRequest)
+	inputs.Rates = nil
+	requestStreamRevenue(t, inputs, "/ytstats/v1/stream/v1/revenue/", http.StatusBadRequest)
+	requestStreamRevenue(t, getInputs(), "/ytstats/v1/stream/v1/revenue/?currency=USD", http.StatusServiceUnavailable)
+}
+
+func TestStreamRevenueHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.StreamRevenueHandler, "/ytstats/v1/stream/v1/revenue/")
+}
+
+func TestStreamRevenueHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.StreamRevenueHandler, "/ytstats/v1/stream/v1/revenue/", "POST")
+}
+
+// Gives inputs with a recorder holding an archive of the stream v1 with messages and a super chat using words, emoji
+// and emotes, and a ban.
+func mockEmoteArchive(t *testing.T) yt_stats.Inputs {
+	inputs := getInputs()
+	dir := t.TempDir()
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:00:10Z", "m1", "message",
+			`"message":"Hello hello :_wave: 😂😂","author":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:40Z", "m2", "message",
+			`"message":"LOL 😂 👍🏽 ❤️ :_wave::_hype:","author":{"user_id":"u2"}`),
+		archivedChatEvent("2021-01-01T00:01:30Z", "s1", "superchat",
+			"\"message\":\"GG 🇯🇵 \U0001F468‍\U0001F469‍\U0001F467 don't\",\"amount\":5,\"currency\":\"USD\","+
+				"\"sent_by\":{\"user_id\":\"u1\"}"),
+		archivedChatEvent("2021-01-01T00:02:00Z", "b1", "ban", `"ban_type":"permanent","banned_user":{"user_id":"u2"}`),
+		archivedChatEvent("2021-01-01T00:02:10Z", "m3", "message",
+			"\"message\":\"❤ is text, 1️⃣ keycap\",\"author\":{\"user_id\":\"u2\"}"),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	return inputs
+}
+
+// Requests the emotes of a stream or video from the given handler, expecting the given status code.
+func requestEmotes(t *testing.T, handler http.Handler, url string, code int) yt_stats.EmotesOutbound {
+	var response yt_stats.EmotesOutbound
+	requestHandler(t, handler, "GET", url, "key", "", code, &response)
+	return response
+}
+
+func TestStreamEmotesHandlerTabulatesArchive(t *testing.T) {
+	handler := yt_stats.StreamEmotesHandler(mockEmoteArchive(t))
+	emotes := requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/", http.StatusOK)
+	if emotes.VideoId != "v1" || emotes.Source != "chat" || emotes.Messages != 4 || emotes.TotalWords != 8 ||
+		emotes.TotalEmojis != 8 || emotes.TotalEmotes != 3 || emotes.StartTime != "2021-01-01T00:00:10Z" ||
+		emotes.EndTime != "2021-01-01T00:02:10Z" {
+		t.Errorf("handler returned wrong counts: %+v", emotes)
+	}
+	expectedEmojis := []yt_stats.TokenCount{{Token: "😂", Count: 3}, {Token: "👍🏽", Count: 1},
+		{Token: "❤", Count: 1}, {Token: "🇯🇵", Count: 1}, {Token: "\U0001F468‍\U0001F469‍\U0001F467", Count: 1},
+		{Token: "1⃣", Count: 1}}
+	if !reflect.DeepEqual(emotes.Emojis, expectedEmojis) {
+		t.Errorf("handler returned wrong emojis: expected %+v actually %+v", expectedEmojis, emotes.Emojis)
+	}
+	expectedEmotes := []yt_stats.TokenCount{{Token: ":_wave:", Count: 2}, {Token: ":_hype:", Count: 1}}
+	if !reflect.DeepEqual(emotes.Emotes, expectedEmotes) {
+		t.Errorf("handler returned wrong emotes: expected %+v actually %+v", expectedEmotes, emotes.Emotes)
+	}
+	var words []string
+	for _, word := range emotes.Words {
+		words = append(words, fmt.Sprintf("%s %d", word.Token, word.Count))
+	}
+	expectedWords := []string{"hello 2", "lol 1", "gg 1", "don't 1", "is 1", "text 1", "keycap 1"}
+	if !reflect.DeepEqual(words, expectedWords) {
+		t.Errorf("handler returned wrong words: expected %v actually %v", expectedWords, words)
+	}
+	if emotes.Interval != 0 || len(emotes.Timeline) != 0 {
+		t.Errorf("handler returned timeline without interval: %+v", emotes.Timeline)
+	}
+}
+
+func TestStreamEmotesHandlerTimeline(t *testing.T) {
+	handler := yt_stats.StreamEmotesHandler(mockEmoteArchive(t))
+	emotes := requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?interval=1m&limit=1", http.StatusOK)
+	if len(emotes.Words) != 1 || len(emotes.Emojis) != 1 || len(emotes.Emotes) != 1 {
+		t.Errorf("handler did not limit tables: %+v", emotes)
+	}
+	expected := []yt_stats.EmoteBucket{
+		{Time: "2021-01-01T00:00:00Z", Messages: 2, Words: []yt_stats.TokenCount{{Token: "hello", Count: 2}},
+			Emojis: []yt_stats.TokenCount{{Token: "😂", Count: 3}},
+			Emotes: []yt_stats.TokenCount{{Token: ":_wave:", Count: 2}}},
+		{Time: "2021-01-01T00:01:00Z", Messages: 1, Words: []yt_stats.TokenCount{{Token: "gg", Count: 1}},
+			Emojis: []yt_stats.TokenCount{{Token: "🇯🇵", Count: 1}}, Emotes: []yt_stats.TokenCount{}},
+		{Time: "2021-01-01T00:02:00Z", Messages: 1, Words: []yt_stats.TokenCount{{Token: "is", Count: 1}},
+			Emojis: []yt_stats.TokenCount{{Token: "1⃣", Count: 1}}, Emotes: []yt_stats.TokenCount{}},
+	}
+	if emotes.Interval != 60 || !reflect.DeepEqual(emotes.Timeline, expected) {
+		t.Errorf("handler returned wrong timeline: %d %+v", emotes.Interval, emotes.Timeline)
+	}
+	emotes = requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?since=2021-01-01T00:01:00Z", http.StatusOK)
+	if emotes.Messages != 2 || emotes.TotalEmotes != 0 || emotes.StartTime != "2021-01-01T00:01:30Z" {
+		t.Errorf("handler returned wrong emotes within time range: %+v", emotes)
+	}
+}
+
+func TestStreamEmotesHandlerUnorderedArchive(t *testing.T) {
+	inputs := getInputs()
+	dir := t.TempDir()
+	writeChatArchive(t, dir, "v1", "c1", []string{
+		archivedChatEvent("2021-01-01T00:01:10Z", "m1", "message", `"message":"late 😂","author":{"user_id":"u1"}`),
+		archivedChatEvent("2021-01-01T00:00:10Z", "m2", "message", `"message":"early 😂","author":{"user_id":"u2"}`),
+		archivedChatEvent("2021-01-01T00:00:50Z", "m3", "message", `"message":":_wave:","author":{"user_id":"u1"}`),
+	})
+	recorder, err := yt_stats.NewRecorder(yt_stats.NewRelay(inputs), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Recorder = recorder
+	handler := yt_stats.StreamEmotesHandler(inputs)
+	emotes := requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?interval=1m", http.StatusOK)
+	if emotes.StartTime != "2021-01-01T00:00:10Z" || emotes.EndTime != "2021-01-01T00:01:10Z" ||
+		len(emotes.Timeline) != 2 || emotes.Timeline[0].Messages != 2 || emotes.Timeline[1].Messages != 1 {
+		t.Errorf("handler returned wrong timeline for unordered archive: %+v", emotes)
+	}
+}
+
+func TestStreamEmotesHandlerErrors(t *testing.T) {
+	handler := yt_stats.StreamEmotesHandler(mockEmoteArchive(t))
+	requestEmotes(t, handler, "/ytstats/v1/stream/v2/emotes/", http.StatusNotFound)
+	requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?interval=0", http.StatusBadRequest)
+	requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?limit=0", http.StatusBadRequest)
+	requestEmotes(t, handler, "/ytstats/v1/stream/v1/emotes/?until=tomorrow", http.StatusBadRequest)
+	requestEmotes(t, yt_stats.StreamEmotesHandler(getInputs()), "/ytstats/v1/stream/v1/emotes/",
+		http.StatusServiceUnavailable)
+}
+
+func TestStreamEmotesHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.StreamEmotesHandler, "/ytstats/v1/stream/v1/emotes/")
+}
+
+func TestStreamEmotesHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.StreamEmotesHandler, "/ytstats/v1/stream/v1/emotes/", "POST")
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 	"yt_stats"
@@ -51,7 +53,8 @@ func getInputs() yt_stats.Inputs {
 		CommentsRoot:      "https://www.googleapis.com/youtube/v3/commentThreads?part=snippet,replies&maxResults=100&textFormat=plainText",
 		ChannelsRoot:      "https://www.googleapis.com/youtube/v3/channels?part=id,snippet,contentDetails,statistics&maxResults=50",
 		PlaylistsRoot:     "https://www.googleapis.com/youtube/v3/playlists?part=snippet,contentDetails&maxResults=50",
-		PlaylistItemsRoot: "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet&maxResults=50",
+		PlaylistItemsRoot: "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet,contentDetails&maxResults=50",
+		SectionsRoot:      "https://www.googleapis.com/youtube/v3/channelSections?part=snippet,contentDetails",
 		VideosRoot:        "https://www.googleapis.com/youtube/v3/videos?part=snippet,contentDetails,statistics&maxResults=50",
 		StreamRoot:        "https://www.googleapis.com/youtube/v3/videos?part=id,liveStreamingDetails&maxResults=50",
 		ChatRoot:          "https://www.googleapis.com/youtube/v3/liveChat/messages?part=id,snippet,authorDetails&maxResults=2000",
@@ -94,3 +97,88 @@ func unsupportedRequestType(t *testing.T, f func(inputs yt_stats.Inputs) http.Ha
 		t.Errorf("handler returned wrong body: expected %v actually %v", expected, rr.Body.String())
 	}
 }
+
+// Requests a handler with the given method, URL, key and body, expecting the given status code. Decodes the
+// response into the given struct unless it is nil, and gives back the body.
+func requestHandler(t *testing.T, handler http.Handler, method string, url string, key string, body string, code int,
+	response interface{}) string {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("key", key)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != code {
+		t.Fatalf("handler returned wrong status code: expected %v actually %v: %s", code, status, rr.Body.String())
+	}
+	if response != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal("failed decoding response from endpoint")
+		}
+	}
+	return strings.Trim(rr.Body.String(), "\n")
+}
+
+// A store holding back every access to one collection while held, until released, to make followers of chats fall
+// behind. Counts the accesses held back or not.
+type gatedStore struct {
+	yt_stats.Store
+	collection string
+	accesses   int32
+	held       int32
+	gate       chan struct{}
+}
+
+// Creates a store in a temporary directory gating the given collection.
+func newGatedStore(t *testing.T, collection string) *gatedStore {
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gatedStore{Store: store, collection: collection, gate: make(chan struct{})}
+}
+
+// Waits until the gate is released if the collection is held.
+func (s *gatedStore) wait(collection string) {
+	if collection != s.collection {
+		return
+	}
+	atomic.AddInt32(&s.accesses, 1)
+	if atomic.LoadInt32(&s.held) == 1 {
+		<-s.gate
+	}
+}
+
+func (s *gatedStore) hold() {
+	atomic.StoreInt32(&s.held, 1)
+}
+
+func (s *gatedStore) release() {
+	close(s.gate)
+}
+
+func (s *gatedStore) Put(collection string, key string, value interface{}) error {
+	s.wait(collection)
+	return s.Store.Put(collection, key, value)
+}
+
+func (s *gatedStore) Keys(collection string) ([]string, error) {
+	s.wait(collection)
+	return s.Store.Keys(collection)
+}
+
+// Starts a fake YouTube API served by the provided handler, and gives inputs pointing towards it instead of YouTube.
+func mockInputs(t *testing.T, handler http.HandlerFunc) yt_stats.Inputs {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	inputs := getInputs()
+	fields := reflect.ValueOf(&inputs).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Field(i).Kind() == reflect.String {
+			root := strings.Replace(fields.Field(i).String(), "https://www.googleapis.com/youtube/v3", server.URL, 1)
+			fields.Field(i).SetString(root)
+		}
+	}
+	return inputs
+}
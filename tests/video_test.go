@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 	"yt_stats"
 )
 
@@ -129,3 +130,194 @@ func TestVideoHandlerTooManyVideos(t *testing.T) {
 func TestVideoHandlerUnsupportedType(t *testing.T) {
 	unsupportedRequestType(t, yt_stats.VideoHandler, "/ytstats/v1/video/", "PUT")
 }
+
+// Mocks YouTube with videos gaining 60 views, 6 likes and 1 comment each time they are queried, watched in a store.
+func mockVideoWatching(t *testing.T, watchAge time.Duration) (yt_stats.Inputs, yt_stats.Store, map[string]int) {
+	requests := make(map[string]int)
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("id"), ",")
+		var items []string
+		for _, id := range ids {
+			requests[id]++
+			if id != "missing" {
+				n := requests[id]
+				items = append(items, fmt.Sprintf(`{"id":"%s","snippet":{"publishedAt":"2021-01-01T00:00:00Z"},`+
+					`"contentDetails":{"duration":"PT1M"},"statistics":{"viewCount":"%d","likeCount":"%d",`+
+					`"commentCount":"%d"}}`, id, n*60, n*6, n))
+			}
+		}
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+	})
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, watchAge)
+	return inputs, store, requests
+}
+
+// Requests the video history endpoint with the given method, expecting the given status code.
+func requestVideoHistory(t *testing.T, inputs yt_stats.Inputs, method string, url string,
+	code int) yt_stats.VideoHistoryOutbound {
+	var response yt_stats.VideoHistoryOutbound
+	requestHandler(t, yt_stats.VideoHistoryHandler(inputs), method, url, "key", "", code, &response)
+	return response
+}
+
+func TestVideoHistoryHandlerWatching(t *testing.T) {
+	inputs, _, requests := mockVideoWatching(t, 24*time.Hour)
+	requestVideoHistory(t, inputs, "GET", "/ytstats/v1/video/v1/history/", http.StatusNotFound)
+	response := requestVideoHistory(t, inputs, "POST", "/ytstats/v1/video/v1/history/", http.StatusOK)
+	if !response.Watched || response.WatchedUntil == "" || len(response.History) != 1 ||
+		response.History[0].ViewCount != 60 {
+		t.Errorf("handler returned wrong body, expected first snapshot actually %+v", response)
+	}
+	if response.QuotaUsage != 1 {
+		t.Errorf("handler returned wrong quota usage: expected 1 actually %d", response.QuotaUsage)
+	}
+	requestVideoHistory(t, inputs, "POST", "/ytstats/v1/video/v2/history/", http.StatusOK)
+	if _, err := inputs.Tracker.SnapshotTracked("key"); err != nil {
+		t.Fatal(err)
+	}
+	if requests["v1"] != 2 || requests["v2"] != 2 {
+		t.Errorf("tracker queried videos wrong amount of times: %v", requests)
+	}
+	body := requestHandler(t, yt_stats.VideoHistoryHandler(inputs), "DELETE", "/ytstats/v1/video/v1/history/", "other", "",
+		http.StatusNotFound, nil)
+	if !strings.Contains(body, "videoNotWatched") {
+		t.Errorf("handler unwatched video with another key: %s", body)
+	}
+	if watched, _, _ := inputs.Tracker.VideoWatched("v1"); !watched {
+		t.Error("handler unwatched video with another key")
+	}
+	response = requestVideoHistory(t, inputs, "DELETE", "/ytstats/v1/video/v1/history/", http.StatusOK)
+	if response.Watched || len(response.History) != 2 || response.History[1].ViewsPerHour == nil {
+		t.Errorf("handler returned wrong body, expected unwatched video with history actually %+v", response)
+	}
+	if _, err := inputs.Tracker.SnapshotTracked("key"); err != nil {
+		t.Fatal(err)
+	}
+	if requests["v1"] != 2 || requests["v2"] != 3 {
+		t.Errorf("tracker kept querying unwatched video: %v", requests)
+	}
+}
+
+func TestVideoHistoryHandlerRates(t *testing.T) {
+	inputs, store, _ := mockVideoWatching(t, 0)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, views := range []int{0, 100, 300, 600} {
+		at := start.Add(time.Duration(i*2) * time.Hour)
+		snapshot := map[string]interface{}{"time": at, "video": map[string]int{"view_count": views, "like_count": i}}
+		if err := store.Append("video_snapshots", "v1", at, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	response := requestVideoHistory(t, inputs, "GET", "/ytstats/v1/video/v1/history/", http.StatusOK)
+	history := response.History
+	if len(history) != 4 || history[0].ViewsPerHour != nil || history[1].ViewAcceleration != nil {
+		t.Fatalf("handler returned wrong body, rates on first points: %+v", history)
+	}
+	if *history[1].ViewsPerHour != 50 || *history[2].ViewsPerHour != 100 || *history[3].LikesPerHour != 0.5 {
+		t.Errorf("handler returned wrong body, rates incorrect: %+v", history)
+	}
+	if *history[2].ViewAcceleration != 25 || *history[3].ViewAcceleration != 25 {
+		t.Errorf("handler returned wrong body, acceleration incorrect: %v and %v",
+			*history[2].ViewAcceleration, *history[3].ViewAcceleration)
+	}
+	response = requestVideoHistory(t, inputs, "GET", "/ytstats/v1/video/v1/history/?interval=4h", http.StatusOK)
+	if len(response.History) != 2 || *response.History[1].ViewsPerHour != 125 {
+		t.Errorf("handler returned wrong body, downsampled rates incorrect: %+v", response.History)
+	}
+}
+
+func TestVideoHistoryHandlerExpiry(t *testing.T) {
+	inputs, store, requests := mockVideoWatching(t, time.Hour)
+	err := store.Put("watched_videos", "v1", map[string]time.Time{
+		"since": time.Now().Add(-2 * time.Hour), "until": time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inputs.Tracker.SnapshotTracked("key"); err != nil {
+		t.Fatal(err)
+	}
+	if requests["v1"] != 0 {
+		t.Error("tracker queried video after its watch age")
+	}
+	keys, err := store.Keys("watched_videos")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("tracker kept expired watch entries: %v", keys)
+	}
+}
+
+func TestVideoHistoryHandlerNotFound(t *testing.T) {
+	inputs, _, _ := mockVideoWatching(t, 0)
+	requestVideoHistory(t, inputs, "POST", "/ytstats/v1/video/missing/history/", http.StatusNotFound)
+}
+
+func TestVideoHistoryHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.VideoHistoryHandler, "/ytstats/v1/video/v1/history/")
+}
+
+func TestVideoHistoryHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.VideoHistoryHandler, "/ytstats/v1/video/v1/history/", "PUT")
+}
+
+// Mocks YouTube with the video v1 having two comments published out of order, the later with a reply, and the video
+// missing not existing.
+func mockVideoComments(t *testing.T) yt_stats.Inputs {
+	comment := func(id string, at string, text string, replies string, count int) string {
+		return fmt.Sprintf(`{"snippet":{"topLevelComment":{"id":"%s","snippet":{"textDisplay":"%s",`+
+			`"publishedAt":"%s"}},"totalReplyCount":%d},"replies":{"comments":[%s]}}`, id, text, at, count, replies)
+	}
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("videoId") != "v1" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"errors":[{"reason":"videoNotFound"}]}}`)
+			return
+		}
+		reply := `{"id":"c1.r1","snippet":{"textDisplay":"thanks 🎉","publishedAt":"2021-01-03T00:00:00Z"}}`
+		fmt.Fprintf(w, `{"items":[%s,%s]}`, comment("c1", "2021-01-02T00:00:00Z", "First! 🎉 :_cheer:", reply, 1),
+			comment("c2", "2021-01-01T00:00:00Z", "🎉🎉 nice", "", 0))
+	})
+	return inputs
+}
+
+func TestVideoEmotesHandlerTabulatesComments(t *testing.T) {
+	handler := yt_stats.VideoEmotesHandler(mockVideoComments(t))
+	emotes := requestEmotes(t, handler, "/ytstats/v1/video/v1/emotes/?interval=1d", http.StatusOK)
+	if emotes.VideoId != "v1" || emotes.Source != "comments" || emotes.Messages != 3 || emotes.QuotaUsage != 1 ||
+		emotes.StartTime != "2021-01-01T00:00:00Z" || emotes.EndTime != "2021-01-03T00:00:00Z" {
+		t.Errorf("handler returned wrong counts: %+v", emotes)
+	}
+	expectedWords := []yt_stats.TokenCount{{Token: "nice", Count: 1}, {Token: "first", Count: 1},
+		{Token: "thanks", Count: 1}}
+	if !reflect.DeepEqual(emotes.Words, expectedWords) ||
+		!reflect.DeepEqual(emotes.Emojis, []yt_stats.TokenCount{{Token: "🎉", Count: 4}}) ||
+		!reflect.DeepEqual(emotes.Emotes, []yt_stats.TokenCount{{Token: ":_cheer:", Count: 1}}) {
+		t.Errorf("handler returned wrong tables: %+v %+v %+v", emotes.Words, emotes.Emojis, emotes.Emotes)
+	}
+	if emotes.Interval != 86400 || len(emotes.Timeline) != 3 || emotes.Timeline[0].Emojis[0].Count != 2 ||
+		emotes.Timeline[2].Words[0].Token != "thanks" {
+		t.Errorf("handler returned wrong timeline: %d %+v", emotes.Interval, emotes.Timeline)
+	}
+	emotes = requestEmotes(t, handler, "/ytstats/v1/video/v1/emotes/?since=2021-01-02&until=2021-01-02",
+		http.StatusOK)
+	if emotes.Messages != 1 || emotes.TotalEmotes != 1 {
+		t.Errorf("handler returned wrong emotes within time range: %+v", emotes)
+	}
+}
+
+func TestVideoEmotesHandlerErrors(t *testing.T) {
+	handler := yt_stats.VideoEmotesHandler(mockVideoComments(t))
+	requestEmotes(t, handler, "/ytstats/v1/video/missing/emotes/", http.StatusNotFound)
+	requestEmotes(t, handler, "/ytstats/v1/video/v1/emotes/?limit=none", http.StatusBadRequest)
+	requestEmotes(t, handler, "/ytstats/v1/video/v1/emotes/?interval=1ms", http.StatusBadRequest)
+}
+
+func TestVideoEmotesHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.VideoEmotesHandler, "/ytstats/v1/video/v1/emotes/")
+}
+
+func TestVideoEmotesHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.VideoEmotesHandler, "/ytstats/v1/video/v1/emotes/", "POST")
+}
@@ -0,0 +1,386 @@
+package yt_stats_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"yt_stats"
+)
+
+// State of the mocked YouTube API, changed by tests between snapshots.
+type mockYouTube struct {
+	subscribers  int
+	videos       int
+	uploads      []string
+	streamStatus string
+	streamStart  string
+	viewers      int
+	comments     []string
+}
+
+// A request received by the mocked webhook receiver.
+type receivedDelivery struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// Mocks YouTube from the given state and a webhook receiver responding with the status code pointed to, and sets up
+// a tracker, scheduler and dispatcher storing in a store. Gives back the inputs, the URL of the receiver and the
+// deliveries it received.
+func mockWebhooks(t *testing.T, youtube *mockYouTube, status *int) (yt_stats.Inputs, string, *[]receivedDelivery) {
+	inputs := mockInputs(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/channels"):
+			fmt.Fprintf(w, `{"items":[{"id":"UC1","snippet":{"title":"One"},"contentDetails":{"relatedPlaylists":`+
+				`{"uploads":"UU1"}},"statistics":{"viewCount":"1","subscriberCount":"%d","videoCount":"%d"}}]}`,
+				youtube.subscribers, youtube.videos)
+		case strings.HasSuffix(r.URL.Path, "/playlistItems"):
+			var items []string
+			for i, publishedAt := range youtube.uploads {
+				items = append(items, fmt.Sprintf(`{"snippet":{"publishedAt":"%s","resourceId":{"videoId":"v%d"}}}`,
+					publishedAt, len(youtube.uploads)-i))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		case strings.HasSuffix(r.URL.Path, "/videos"):
+			streamStart := youtube.streamStart
+			if streamStart == "" {
+				streamStart = "2021-01-01T00:00:00Z"
+			}
+			viewers := youtube.viewers
+			if viewers == 0 {
+				viewers = 10
+			}
+			details := fmt.Sprintf(`"scheduledStartTime":"%s"`, streamStart)
+			if youtube.streamStatus == "video" {
+				details = ""
+			} else if youtube.streamStatus != "upcoming" {
+				details += fmt.Sprintf(`,"actualStartTime":"2021-01-01T00:01:00Z","concurrentViewers":"%d"`, viewers)
+			}
+			if youtube.streamStatus == "ended" {
+				details += `,"actualEndTime":"2021-01-01T01:00:00Z"`
+			}
+			fmt.Fprintf(w, `{"items":[{"id":"v1","liveStreamingDetails":{%s}}]}`, details)
+		case strings.HasSuffix(r.URL.Path, "/commentThreads"):
+			var items []string
+			for i := len(youtube.comments) - 1; i >= 0; i-- {
+				publishedAt := time.Date(2021, 1, 1, 0, i, 0, 0, time.UTC).Format(time.RFC3339)
+				items = append(items, fmt.Sprintf(`{"snippet":{"topLevelComment":{"id":"c%d","snippet":`+
+					`{"textDisplay":"%s","publishedAt":"%s"}},"totalReplyCount":0}}`, i, youtube.comments[i], publishedAt))
+			}
+			fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	})
+	var received []receivedDelivery
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, receivedDelivery{
+			event:     r.Header.Get("X-YTStats-Event"),
+			signature: r.Header.Get("X-YTStats-Signature"),
+			body:      body,
+		})
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(receiver.Close)
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Dispatcher = yt_stats.NewDispatcher(store, true)
+	inputs.Tracker = yt_stats.NewTracker(inputs, store, 0)
+	inputs.Scheduler = yt_stats.NewScheduler(inputs.Tracker)
+	return inputs, receiver.URL, &received
+}
+
+// Creates a webhook with the given definition, giving back the created webhook.
+func createWebhook(t *testing.T, inputs yt_stats.Inputs, definition string) yt_stats.Webhook {
+	var response yt_stats.WebhooksOutbound
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "POST", "/ytstats/v1/webhooks/", "key", definition,
+		http.StatusOK, &response)
+	if len(response.Webhooks) != 1 || response.Webhooks[0].Id == "" {
+		t.Fatalf("handler returned wrong body, expected created webhook actually %+v", response.Webhooks)
+	}
+	return response.Webhooks[0]
+}
+
+// Gives the delivery log of a webhook.
+func getDeliveries(t *testing.T, inputs yt_stats.Inputs, id string) []yt_stats.WebhookDelivery {
+	var response yt_stats.WebhookDeliveriesOutbound
+	requestHandler(t, yt_stats.WebhookDeliveriesHandler(inputs), "GET", "/ytstats/v1/webhooks/"+id+"/deliveries/",
+		"key", "", http.StatusOK, &response)
+	return response.Deliveries
+}
+
+// Gives the event types of received deliveries, in the order they were received.
+func receivedEvents(received []receivedDelivery) []string {
+	events := make([]string, len(received))
+	for i, delivery := range received {
+		events[i] = delivery.event
+	}
+	return events
+}
+
+func TestWebhooksHandlerLifecycle(t *testing.T) {
+	status := http.StatusOK
+	inputs, receiver, _ := mockWebhooks(t, &mockYouTube{}, &status)
+	webhook := createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.live"]}`, receiver))
+	if len(webhook.Secret) != 64 {
+		t.Errorf("handler did not generate secret: %+v", webhook)
+	}
+	var response yt_stats.WebhooksOutbound
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "GET", "/ytstats/v1/webhooks/", "key", "", http.StatusOK,
+		&response)
+	if len(response.Webhooks) != 1 || response.Webhooks[0].Id != webhook.Id || response.Webhooks[0].Secret != "" {
+		t.Errorf("handler returned wrong body, expected webhook without secret actually %+v", response.Webhooks)
+	}
+	response = yt_stats.WebhooksOutbound{}
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "GET", "/ytstats/v1/webhooks/", "other", "", http.StatusOK,
+		&response)
+	if len(response.Webhooks) != 0 {
+		t.Errorf("handler returned webhooks created with another key: %+v", response.Webhooks)
+	}
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "DELETE", "/ytstats/v1/webhooks/"+webhook.Id+"/", "other", "",
+		http.StatusNotFound, nil)
+	requestHandler(t, yt_stats.WebhookPingHandler(inputs), "POST", "/ytstats/v1/webhooks/"+webhook.Id+"/ping/",
+		"key", "", http.StatusOK, nil)
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "DELETE", "/ytstats/v1/webhooks/"+webhook.Id+"/", "key", "",
+		http.StatusOK, nil)
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "GET", "/ytstats/v1/webhooks/"+webhook.Id+"/", "key", "",
+		http.StatusNotFound, nil)
+	requestHandler(t, yt_stats.WebhookDeliveriesHandler(inputs), "GET",
+		"/ytstats/v1/webhooks/"+webhook.Id+"/deliveries/", "key", "", http.StatusNotFound, nil)
+	requestHandler(t, yt_stats.WebhooksHandler(inputs), "DELETE", "/ytstats/v1/webhooks/", "key", "",
+		http.StatusBadRequest, nil)
+}
+
+func TestWebhooksHandlerInvalidWebhooks(t *testing.T) {
+	status := http.StatusOK
+	inputs, _, _ := mockWebhooks(t, &mockYouTube{}, &status)
+	invalid := map[string]string{
+		`{"url":"ftp://example.com","events":["stream.live"]}`:        "webhookUrlInvalid",
+		`{"url":"/hook","events":["stream.live"]}`:                    "webhookUrlInvalid",
+		`{"url":"https://example.com"}`:                               "webhookEventsInvalid",
+		`{"url":"https://example.com","events":["ping"]}`:             "webhookEventsInvalid",
+		`{"url":"https://example.com","events":["comment.keyword"]}`:  "webhookKeywordsMissing",
+		`{"url":"https://example.com","events":"stream.live"}`:        "webhookBodyInvalid",
+		`{"url":"https://example.com","events":["stream.live"],"url"`: "webhookBodyInvalid",
+	}
+	for body, msg := range invalid {
+		req, err := http.NewRequest("POST", "/ytstats/v1/webhooks/", strings.NewReader(body))
+		req.Header.Set("key", "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := yt_stats.WebhooksHandler(inputs)
+		handler.ServeHTTP(rr, req)
+		expected := fmt.Sprintf(`{"quota_usage":0,"status_code":%d,"status_message":"%s"}`, http.StatusBadRequest, msg)
+		if strings.Trim(rr.Body.String(), "\n") != expected {
+			t.Errorf("handler returned wrong body for %s: expected %v actually %v", body, expected, rr.Body.String())
+		}
+	}
+}
+
+func TestWebhooksHandlerPrivateAddresses(t *testing.T) {
+	status := http.StatusOK
+	inputs, receiver, received := mockWebhooks(t, &mockYouTube{}, &status)
+	store, err := yt_stats.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs.Dispatcher = yt_stats.NewDispatcher(store, false)
+	for _, address := range []string{"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "[::1]", "[fd00:ec2::254]", "[fe80::1]", "[::ffff:127.0.0.1]"} {
+		body := fmt.Sprintf(`{"url":"http://%s/hook","events":["stream.live"]}`, address)
+		var response yt_stats.StatusCodeOutbound
+		requestHandler(t, yt_stats.WebhooksHandler(inputs), "POST", "/ytstats/v1/webhooks/", "key", body,
+			http.StatusBadRequest, &response)
+		if response.StatusMessage != "webhookAddressForbidden" {
+			t.Errorf("handler accepted webhook to %s: %+v", address, response)
+		}
+	}
+	webhook := createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.live"]}`,
+		strings.Replace(receiver, "127.0.0.1", "localhost", 1)))
+	requestHandler(t, yt_stats.WebhookPingHandler(inputs), "POST", "/ytstats/v1/webhooks/"+webhook.Id+"/ping/",
+		"key", "", http.StatusOK, nil)
+	inputs.Dispatcher.DeliverDue(time.Now())
+	deliveries := getDeliveries(t, inputs, webhook.Id)
+	if len(*received) != 0 || len(deliveries) != 1 || deliveries[0].ResponseCode != 0 ||
+		!strings.Contains(deliveries[0].LastError, "is not public") {
+		t.Errorf("dispatcher delivered to private address: %d %+v", len(*received), deliveries)
+	}
+}
+
+func TestWebhooksHandlerSignsDeliveries(t *testing.T) {
+	status := http.StatusOK
+	inputs, receiver, received := mockWebhooks(t, &mockYouTube{}, &status)
+	webhook := createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.live"],"secret":"s3cret"}`,
+		receiver))
+	var response yt_stats.WebhookDeliveriesOutbound
+	requestHandler(t, yt_stats.WebhookPingHandler(inputs), "POST", "/ytstats/v1/webhooks/"+webhook.Id+"/ping/",
+		"key", "", http.StatusOK, &response)
+	if len(response.Deliveries) != 1 || response.Deliveries[0].Status != "pending" {
+		t.Fatalf("handler returned wrong body, expected pending delivery actually %+v", response.Deliveries)
+	}
+	inputs.Dispatcher.DeliverDue(time.Now())
+	if len(*received) != 1 || (*received)[0].event != "ping" {
+		t.Fatalf("receiver got wrong deliveries: %v", receivedEvents(*received))
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write((*received)[0].body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); (*received)[0].signature != expected {
+		t.Errorf("delivery has wrong signature: expected %s actually %s", expected, (*received)[0].signature)
+	}
+	var event yt_stats.WebhookEvent
+	if err := json.Unmarshal((*received)[0].body, &event); err != nil || event.Type != "ping" {
+		t.Errorf("delivery has wrong body: %s", (*received)[0].body)
+	}
+	deliveries := getDeliveries(t, inputs, webhook.Id)
+	if len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].ResponseCode != http.StatusOK ||
+		deliveries[0].Attempts != 1 || deliveries[0].Payload.Id != event.Id {
+		t.Errorf("handler returned wrong delivery log: %+v", deliveries)
+	}
+}
+
+func TestWebhooksHandlerRetriesDeliveries(t *testing.T) {
+	status := http.StatusInternalServerError
+	inputs, receiver, received := mockWebhooks(t, &mockYouTube{}, &status)
+	webhook := createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.live"]}`, receiver))
+	requestHandler(t, yt_stats.WebhookPingHandler(inputs), "POST", "/ytstats/v1/webhooks/"+webhook.Id+"/ping/",
+		"key", "", http.StatusOK, nil)
+	now := time.Now()
+	inputs.Dispatcher.DeliverDue(now)
+	deliveries := getDeliveries(t, inputs, webhook.Id)
+	if deliveries[0].Status != "pending" || deliveries[0].Attempts != 1 || deliveries[0].LastError == "" ||
+		deliveries[0].NextAttempt != now.Add(30*time.Second).UTC().Format(time.RFC3339) {
+		t.Errorf("dispatcher did not retry after 30 seconds: %+v", deliveries[0])
+	}
+	inputs.Dispatcher.DeliverDue(now.Add(10 * time.Second))
+	if len(*received) != 1 {
+		t.Errorf("dispatcher retried delivery before it was due: %d attempts", len(*received))
+	}
+	now = now.Add(30 * time.Second)
+	inputs.Dispatcher.DeliverDue(now)
+	deliveries = getDeliveries(t, inputs, webhook.Id)
+	if deliveries[0].Attempts != 2 || deliveries[0].NextAttempt != now.Add(time.Minute).UTC().Format(time.RFC3339) {
+		t.Errorf("dispatcher did not back off exponentially: %+v", deliveries[0])
+	}
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Hour)
+		inputs.Dispatcher.DeliverDue(now)
+	}
+	deliveries = getDeliveries(t, inputs, webhook.Id)
+	if len(*received) != 8 || deliveries[0].Status != "failed" || deliveries[0].NextAttempt != "" {
+		t.Errorf("dispatcher did not give up after 8 attempts: %d attempts %+v", len(*received), deliveries[0])
+	}
+	status = http.StatusNoContent
+	requestHandler(t, yt_stats.WebhookPingHandler(inputs), "POST", "/ytstats/v1/webhooks/"+webhook.Id+"/ping/",
+		"key", "", http.StatusOK, nil)
+	inputs.Dispatcher.DeliverDue(time.Now())
+	deliveries = getDeliveries(t, inputs, webhook.Id)
+	if len(deliveries) != 2 || deliveries[0].Status != "delivered" || deliveries[1].Status != "failed" {
+		t.Errorf("handler returned wrong delivery log: %+v", deliveries)
+	}
+}
+
+func TestWebhooksHandlerChannelEvents(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{subscribers: 990, videos: 5}
+	inputs, receiver, received := mockWebhooks(t, youtube, &status)
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["channel.milestone","video.uploaded"],`+
+		`"targets":["UC1"]}`, receiver))
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["channel.milestone"],"targets":["UC2"]}`, receiver))
+	job := createJob(t, inputs, `{"type":"channels","targets":["UC1"],"schedule":"@every 1h"}`)
+	inputs.Scheduler.RunDue(time.Now().Add(2 * time.Hour))
+	youtube.subscribers = 2010
+	youtube.videos = 6
+	youtube.uploads = []string{time.Now().Add(time.Minute).UTC().Format(time.RFC3339), "2021-01-01T00:00:00Z"}
+	inputs.Scheduler.RunDue(time.Now().Add(4 * time.Hour))
+	inputs.Dispatcher.DeliverDue(time.Now().Add(time.Hour))
+	if events := receivedEvents(*received); !reflect.DeepEqual(events, []string{"channel.milestone", "video.uploaded"}) {
+		t.Fatalf("receiver got wrong deliveries: %v", events)
+	}
+	var milestone struct {
+		Data yt_stats.ChannelMilestoneEvent
+	}
+	var upload struct{ Data yt_stats.VideoUploadedEvent }
+	if err := json.Unmarshal((*received)[0].body, &milestone); err != nil || milestone.Data.Milestone != 2000 {
+		t.Errorf("delivery has wrong body: %s", (*received)[0].body)
+	}
+	if err := json.Unmarshal((*received)[1].body, &upload); err != nil || upload.Data.VideoId != "v2" {
+		t.Errorf("delivery has wrong body: %s", (*received)[1].body)
+	}
+	job = getJob(t, inputs, job.Id)
+	if job.QuotaUsed != 3 {
+		t.Errorf("scheduler recorded wrong quota usage, expected 3 actually %d", job.QuotaUsed)
+	}
+}
+
+func TestWebhooksHandlerStreamEvents(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{streamStatus: "upcoming"}
+	inputs, receiver, received := mockWebhooks(t, youtube, &status)
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["stream.live","stream.ended"]}`, receiver))
+	createJob(t, inputs, `{"type":"streams","targets":["v1"],"schedule":"@every 1h"}`)
+	now := time.Now()
+	for _, streamStatus := range []string{"upcoming", "live", "live", "ended", "ended"} {
+		youtube.streamStatus = streamStatus
+		now = now.Add(2 * time.Hour)
+		inputs.Scheduler.RunDue(now)
+	}
+	inputs.Dispatcher.DeliverDue(time.Now().Add(time.Hour))
+	if events := receivedEvents(*received); !reflect.DeepEqual(events, []string{"stream.live", "stream.ended"}) {
+		t.Errorf("receiver got wrong deliveries: %v", events)
+	}
+}
+
+func TestWebhooksHandlerCommentKeywords(t *testing.T) {
+	status := http.StatusOK
+	youtube := &mockYouTube{comments: []string{"an old giveaway"}}
+	inputs, receiver, received := mockWebhooks(t, youtube, &status)
+	createWebhook(t, inputs, fmt.Sprintf(`{"url":"%s","events":["comment.keyword"],"keywords":["giveaway","prize"]}`,
+		receiver))
+	createJob(t, inputs, `{"type":"comments","targets":["v1"],"schedule":"@every 1h"}`)
+	inputs.Scheduler.RunDue(time.Now().Add(2 * time.Hour))
+	youtube.comments = append(youtube.comments, "hello", "Is there a GIVEAWAY?")
+	inputs.Scheduler.RunDue(time.Now().Add(4 * time.Hour))
+	inputs.Dispatcher.DeliverDue(time.Now().Add(time.Hour))
+	if len(*received) != 1 {
+		t.Fatalf("receiver got wrong deliveries: %v", receivedEvents(*received))
+	}
+	var event struct {
+		Keywords []string
+		Data     yt_stats.CommentKeywordEvent
+	}
+	err := json.Unmarshal((*received)[0].body, &event)
+	if err != nil || !reflect.DeepEqual(event.Keywords, []string{"giveaway"}) ||
+		event.Data.Comment.Message != "Is there a GIVEAWAY?" || event.Data.VideoId != "v1" {
+		t.Errorf("delivery has wrong body: %s", (*received)[0].body)
+	}
+}
+
+func TestWebhooksHandlerTrackingDisabled(t *testing.T) {
+	requestHandler(t, yt_stats.WebhooksHandler(getInputs()), "GET", "/ytstats/v1/webhooks/", "key", "",
+		http.StatusServiceUnavailable, nil)
+}
+
+func TestWebhooksHandlerNoKey(t *testing.T) {
+	keyMissing(t, yt_stats.WebhooksHandler, "/ytstats/v1/webhooks/")
+}
+
+func TestWebhooksHandlerUnsupportedType(t *testing.T) {
+	unsupportedRequestType(t, yt_stats.WebhooksHandler, "/ytstats/v1/webhooks/", "PUT")
+	unsupportedRequestType(t, yt_stats.WebhookDeliveriesHandler, "/ytstats/v1/webhooks/1/deliveries/", "POST")
+	unsupportedRequestType(t, yt_stats.WebhookPingHandler, "/ytstats/v1/webhooks/1/ping/", "GET")
+}
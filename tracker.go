@@ -0,0 +1,558 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Store collections and series used by the tracker.
+const (
+	trackedChannelsCollection = "tracked_channels"
+	channelSnapshotsSeries    = "channel_snapshots"
+	watchedVideosCollection   = "watched_videos"
+	videoSnapshotsSeries      = "video_snapshots"
+	streamSnapshotsSeries     = "stream_snapshots"
+	channelStatesCollection   = "channel_states"
+	streamStatesCollection    = "stream_states"
+	commentCursorsCollection  = "comment_cursors"
+)
+
+// Tracker takes snapshots of the statistics of tracked items and records them in a store. Snapshots are taken
+// periodically by the scheduler, and when tracking of an item is started.
+type Tracker struct {
+	input    Inputs
+	store    Store
+	watchAge time.Duration
+}
+
+// A tracked channel, as stored by the tracker, including the key that started tracking it, which is never sent back.
+type trackedChannel struct {
+	Since time.Time `json:"since"`
+	Key   string    `json:"key"`
+}
+
+// A snapshot of a channel, as stored by the tracker.
+type channelSnapshot struct {
+	Time    time.Time `json:"time"`
+	Channel Channel   `json:"channel"`
+}
+
+// A watched video, as stored by the tracker. Videos are no longer watched after the until time, if set. Includes
+// the key that started watching it, which is never sent back.
+type watchedVideo struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Key   string    `json:"key"`
+}
+
+// A snapshot of a video, as stored by the tracker.
+type videoSnapshot struct {
+	Time  time.Time `json:"time"`
+	Video Video     `json:"video"`
+}
+
+// A snapshot of a stream, as stored by the tracker. The stream is a LiveStream or Stream struct.
+type streamSnapshot struct {
+	Time   time.Time   `json:"time"`
+	Stream interface{} `json:"stream"`
+}
+
+// The last known state of a channel, compared against new snapshots to detect events.
+type channelState struct {
+	Time                  time.Time `json:"time"`
+	HiddenSubscriberCount bool      `json:"hidden_subscriber_count"`
+	SubscriberCount       int       `json:"subscriber_count"`
+	VideoCount            int       `json:"video_count"`
+}
+
+// The last known state of a stream, compared against new snapshots to detect events. The stream is a LiveStream or
+// Stream struct, and the channel is only known for streams discovered through their channel.
+type streamState struct {
+	Id                 string      `json:"id"`
+	ChannelId          string      `json:"channel_id"`
+	Status             string      `json:"status"`
+	ScheduledStartTime string      `json:"scheduled_start_time"`
+	Time               time.Time   `json:"time"`
+	Stream             interface{} `json:"stream"`
+}
+
+// The publishing time of the newest comment seen on a video, so only newer comments are checked for keywords.
+type commentCursor struct {
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// NewTracker creates a tracker recording snapshots in the given store. Videos are watched for the given age, or
+// forever if it is zero.
+func NewTracker(input Inputs, store Store, watchAge time.Duration) *Tracker {
+	return &Tracker{input: input, store: store, watchAge: watchAge}
+}
+
+// SnapshotTracked takes a snapshot of all tracked channels and watched videos using the given key, in batches of 50.
+// Gives back the quota used.
+func (t *Tracker) SnapshotTracked(key string) (int, error) {
+	budget := &jobBudget{}
+	err := runTrackedJob(t, key, nil, budget)
+	return budget.used, err
+}
+
+// Gives the IDs of all tracked channels.
+func (t *Tracker) trackedChannelIds() ([]string, error) {
+	return t.store.Keys(trackedChannelsCollection)
+}
+
+// Gives the IDs of all watched videos. Videos watched for longer than the watch age are no longer watched.
+func (t *Tracker) watchedVideoIds() ([]string, error) {
+	ids, err := t.store.Keys(watchedVideosCollection)
+	if err != nil {
+		return nil, err
+	}
+	var watched []string
+	for _, id := range ids {
+		var video watchedVideo
+		found, err := t.store.Get(watchedVideosCollection, id, &video)
+		if err != nil {
+			return nil, err
+		}
+		if found && !video.Until.IsZero() && time.Now().After(video.Until) {
+			err = t.store.Delete(watchedVideosCollection, id)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		watched = append(watched, id)
+	}
+	return watched, nil
+}
+
+// Queries and records a snapshot of up to 50 channels. Gives back the quota used and the IDs of the channels found.
+func (t *Tracker) snapshotChannels(ids []string, key string) (StatusCodeOutbound, int, []string, error) {
+	channelInbound, youtubeStatus, quota := queryChannels(t.input, strings.Join(ids, ","), key, nil)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, nil, nil
+	}
+	now := time.Now().UTC()
+	var found []string
+	for _, channel := range ChannelParser(channelInbound).Channels {
+		err := t.store.Append(channelSnapshotsSeries, channel.Id, now, channelSnapshot{Time: now, Channel: channel})
+		if err != nil {
+			return youtubeStatus, quota, found, err
+		}
+		found = append(found, channel.Id)
+		cost, err := t.channelEvents(channel, now, key)
+		quota += cost
+		if err != nil {
+			return youtubeStatus, quota, found, err
+		}
+	}
+	return youtubeStatus, quota, found, nil
+}
+
+// Compares a new snapshot of a channel with its last known state, and emits milestone and upload events.
+// Uploads are only looked up if the video count went up and a webhook is subscribed to them. Gives the quota used.
+func (t *Tracker) channelEvents(channel Channel, now time.Time, key string) (int, error) {
+	var previous channelState
+	known, err := t.store.Get(channelStatesCollection, channel.Id, &previous)
+	if err != nil {
+		return 0, err
+	}
+	err = t.store.Put(channelStatesCollection, channel.Id, channelState{
+		Time:                  now,
+		HiddenSubscriberCount: channel.HiddenSubscriberCount,
+		SubscriberCount:       channel.SubscriberCount,
+		VideoCount:            channel.VideoCount,
+	})
+	if err != nil || !known {
+		return 0, err
+	}
+	dispatcher := t.input.Dispatcher
+	if !channel.HiddenSubscriberCount && !previous.HiddenSubscriberCount {
+		if milestone := subscriberMilestone(previous.SubscriberCount, channel.SubscriberCount); milestone > 0 {
+			err = dispatcher.Emit("channel.milestone", []string{channel.Id}, ChannelMilestoneEvent{
+				ChannelId:       channel.Id,
+				Title:           channel.Title,
+				Milestone:       milestone,
+				SubscriberCount: channel.SubscriberCount,
+			}, "")
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if channel.VideoCount <= previous.VideoCount || channel.UploadsPlaylist == "" ||
+		!dispatcher.Subscribed("video.uploaded") {
+		return 0, nil
+	}
+	var uploads []VideoUploadedEvent
+	youtubeStatus, quota := walkPlaylistItems(t.input, channel.UploadsPlaylist, key,
+		func(page PlaylistItemsInbound) bool {
+			for _, item := range page.Items {
+				publishedAt, err := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+				if err == nil && publishedAt.After(previous.Time) {
+					uploads = append(uploads, VideoUploadedEvent{
+						ChannelId:   channel.Id,
+						VideoId:     item.Snippet.ResourceId.VideoId,
+						PublishedAt: item.Snippet.PublishedAt,
+					})
+				}
+			}
+			return false
+		})
+	if err := youtubeError(youtubeStatus); err != nil {
+		return quota, err
+	}
+	for i := len(uploads) - 1; i >= 0; i-- {
+		if err := dispatcher.Emit("video.uploaded", []string{channel.Id}, uploads[i], ""); err != nil {
+			return quota, err
+		}
+	}
+	return quota, nil
+}
+
+// Gives the highest subscriber milestone passed when going from the previous to the current subscriber count, or 0
+// if none was passed. Milestones are the multiples of 1 to 9 of each power of ten from 10, such as 300 or 2000000.
+func subscriberMilestone(previous int, current int) int {
+	milestone := 0
+	for power := 10; power <= current; power *= 10 {
+		for digit := 1; digit <= 9; digit++ {
+			if m := digit * power; m > previous && m <= current {
+				milestone = m
+			}
+		}
+	}
+	return milestone
+}
+
+// Queries and records a snapshot of up to 50 videos. Gives back the quota used and the IDs of the videos found.
+func (t *Tracker) snapshotVideos(ids []string, key string) (StatusCodeOutbound, int, []string, error) {
+	videoInbound, youtubeStatus, quota := queryVideos(t.input, strings.Join(ids, ","), key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, nil, nil
+	}
+	var tempPlaylistObject Playlist
+	err := VideoParser([]VideoInbound{videoInbound}, &tempPlaylistObject, false, true)
+	if err != nil {
+		return StatusCodeOutbound{
+			StatusCode:    http.StatusInternalServerError,
+			StatusMessage: "failedParsingYouTubeResponse",
+		}, quota, nil, nil
+	}
+	now := time.Now().UTC()
+	var found []string
+	for _, video := range tempPlaylistObject.Videos {
+		err := t.store.Append(videoSnapshotsSeries, video.Id, now, videoSnapshot{Time: now, Video: video})
+		if err != nil {
+			return youtubeStatus, quota, found, err
+		}
+		found = append(found, video.Id)
+	}
+	return youtubeStatus, quota, found, nil
+}
+
+// Queries and records a snapshot of up to 50 streams. Gives back the quota used.
+func (t *Tracker) snapshotStreams(ids []string, key string) (StatusCodeOutbound, int, error) {
+	streamInbound, youtubeStatus, quota := queryStreams(t.input, strings.Join(ids, ","), key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, nil
+	}
+	now := time.Now().UTC()
+	for i, stream := range StreamParser(streamInbound).Streams {
+		if err := t.recordStream(streamInbound.Items[i].Id, "", stream, now); err != nil {
+			return youtubeStatus, quota, err
+		}
+	}
+	return youtubeStatus, quota, nil
+}
+
+// Gives the status of a stream parsed by StreamParser.
+func streamStatus(stream interface{}) string {
+	switch s := stream.(type) {
+	case LiveStream:
+		return s.Status
+	case Stream:
+		return s.Status
+	}
+	return ""
+}
+
+// Gives the scheduled start time of a stream parsed by StreamParser.
+func streamScheduledStart(stream interface{}) string {
+	switch s := stream.(type) {
+	case LiveStream:
+		return s.ScheduledStartTime
+	case Stream:
+		return s.ScheduledStartTime
+	}
+	return ""
+}
+
+// Records a snapshot of a stream, and compares it with the last known state of the stream to emit events when it
+// is scheduled, rescheduled, goes live or ends. Streams first seen live count as going live, while streams first
+// seen ended do not count as ending. The channel of the stream is kept from its last state if not given.
+func (t *Tracker) recordStream(id string, channelId string, stream interface{}, now time.Time) error {
+	err := t.store.Append(streamSnapshotsSeries, id, now, streamSnapshot{Time: now, Stream: stream})
+	if err != nil {
+		return err
+	}
+	var previous streamState
+	known, err := t.store.Get(streamStatesCollection, id, &previous)
+	if err != nil {
+		return err
+	}
+	if channelId == "" {
+		channelId = previous.ChannelId
+	}
+	state := streamState{
+		Id:                 id,
+		ChannelId:          channelId,
+		Status:             streamStatus(stream),
+		ScheduledStartTime: streamScheduledStart(stream),
+		Time:               now,
+		Stream:             stream,
+	}
+	if err := t.store.Put(streamStatesCollection, id, state); err != nil {
+		return err
+	}
+	subjects := []string{id}
+	if channelId != "" {
+		subjects = append(subjects, channelId)
+	}
+	event := StreamEvent{ChannelId: channelId, Stream: stream}
+	dispatcher := t.input.Dispatcher
+	switch {
+	case known && previous.Status == state.Status && previous.ScheduledStartTime == state.ScheduledStartTime:
+		return nil
+	case known && previous.Status == "scheduled" && state.Status == "scheduled":
+		event.PreviousScheduledStartTime = previous.ScheduledStartTime
+		return dispatcher.Emit("stream.rescheduled", subjects, event, "")
+	case state.Status == "scheduled" && (!known || previous.Status != "scheduled"):
+		return dispatcher.Emit("stream.scheduled", subjects, event, "")
+	case state.Status == "live" && (!known || previous.Status != "live"):
+		return dispatcher.Emit("stream.live", subjects, event, "")
+	case state.Status == "ended" && known && previous.Status != "ended":
+		return dispatcher.Emit("stream.ended", subjects, event, "")
+	}
+	return nil
+}
+
+// Checks the newest page of comments on a video for comments posted since the last check, and emits them as keyword
+// events to be matched against the keywords of webhooks. The first check only records the newest comment.
+func (t *Tracker) checkComments(id string, key string) (StatusCodeOutbound, int, error) {
+	commentsInbound, youtubeStatus, quota := queryLatestComments(t.input, id, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, nil
+	}
+	var cursor commentCursor
+	known, err := t.store.Get(commentCursorsCollection, id, &cursor)
+	if err != nil {
+		return youtubeStatus, quota, err
+	}
+	var comments []interface{}
+	CommentsParser(commentsInbound, &comments, &[]string{})
+	newest := cursor.PublishedAt
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment, ok := comments[i].(Comment)
+		if !ok {
+			continue
+		}
+		publishedAt, err := time.Parse(time.RFC3339, comment.PublishedAt)
+		if err != nil || !publishedAt.After(cursor.PublishedAt) {
+			continue
+		}
+		if publishedAt.After(newest) {
+			newest = publishedAt
+		}
+		if known {
+			err = t.input.Dispatcher.Emit(keywordCommentEvent, []string{id},
+				CommentKeywordEvent{VideoId: id, Comment: comment}, comment.Message)
+			if err != nil {
+				return youtubeStatus, quota, err
+			}
+		}
+	}
+	return youtubeStatus, quota, t.store.Put(commentCursorsCollection, id, commentCursor{PublishedAt: newest})
+}
+
+// TrackChannel takes a first snapshot of a channel using the given key, and starts tracking it with the key if it
+// exists. Tracking a channel already tracked keeps the key that started it. Gives back the status of the query, the
+// quota used, and whether the channel was found.
+func (t *Tracker) TrackChannel(id string, key string) (StatusCodeOutbound, int, bool, error) {
+	youtubeStatus, quota, found, err := t.snapshotChannels([]string{id}, key)
+	if err != nil || youtubeStatus.StatusCode != http.StatusOK || len(found) == 0 {
+		return youtubeStatus, quota, false, err
+	}
+	var tracked trackedChannel
+	exists, err := t.store.Get(trackedChannelsCollection, id, &tracked)
+	if err != nil || exists {
+		return youtubeStatus, quota, true, err
+	}
+	return youtubeStatus, quota, true, t.store.Put(trackedChannelsCollection, id,
+		trackedChannel{Since: time.Now().UTC(), Key: key})
+}
+
+// UntrackChannel stops tracking a channel, unless it was started with another key. Channels tracked before their key
+// was kept can be untracked with any key. Snapshots already taken are kept. Gives back false if the channel is
+// tracked with another key.
+func (t *Tracker) UntrackChannel(id string, key string) (bool, error) {
+	var tracked trackedChannel
+	found, err := t.store.Get(trackedChannelsCollection, id, &tracked)
+	if err != nil || !found {
+		return true, err
+	}
+	if tracked.Key != "" && tracked.Key != key {
+		return false, nil
+	}
+	return true, t.store.Delete(trackedChannelsCollection, id)
+}
+
+// ChannelTracked checks whether a channel is currently tracked.
+func (t *Tracker) ChannelTracked(id string) (bool, error) {
+	var tracked trackedChannel
+	return t.store.Get(trackedChannelsCollection, id, &tracked)
+}
+
+// ChannelHistory gives the snapshots of a channel within a time range. If an interval is given, only the last
+// snapshot within each interval is kept. If deltas are requested, each point includes the change since the last.
+func (t *Tracker) ChannelHistory(id string, since time.Time, until time.Time, interval time.Duration,
+	deltas bool) ([]ChannelHistoryPoint, error) {
+	raw, err := t.store.Range(channelSnapshotsSeries, id, since, until)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]channelSnapshot, 0, len(raw))
+	for _, r := range raw {
+		var snapshot channelSnapshot
+		if err := json.Unmarshal(r, &snapshot); err != nil {
+			return nil, err
+		}
+		if len(snapshots) > 0 && sameInterval(snapshots[len(snapshots)-1].Time, snapshot.Time, interval) {
+			snapshots[len(snapshots)-1] = snapshot
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	history := make([]ChannelHistoryPoint, len(snapshots))
+	for i, snapshot := range snapshots {
+		history[i] = ChannelHistoryPoint{
+			Time:                  snapshot.Time.Format(time.RFC3339),
+			HiddenSubscriberCount: snapshot.Channel.HiddenSubscriberCount,
+			SubscriberCount:       snapshot.Channel.SubscriberCount,
+			ViewCount:             snapshot.Channel.ViewCount,
+			VideoCount:            snapshot.Channel.VideoCount,
+		}
+		if deltas && i > 0 {
+			subscriberDelta := history[i].SubscriberCount - history[i-1].SubscriberCount
+			viewDelta := history[i].ViewCount - history[i-1].ViewCount
+			videoDelta := history[i].VideoCount - history[i-1].VideoCount
+			history[i].SubscriberDelta = &subscriberDelta
+			history[i].ViewDelta = &viewDelta
+			history[i].VideoDelta = &videoDelta
+		}
+	}
+	return history, nil
+}
+
+// WatchVideo takes a first snapshot of a video using the given key, and starts watching it with the key if it exists.
+// Watching an already watched video restarts the watch age, but keeps the key that started it. Gives back the status
+// of the query, the quota used, and whether the video was found.
+func (t *Tracker) WatchVideo(id string, key string) (StatusCodeOutbound, int, bool, error) {
+	youtubeStatus, quota, found, err := t.snapshotVideos([]string{id}, key)
+	if err != nil || youtubeStatus.StatusCode != http.StatusOK || len(found) == 0 {
+		return youtubeStatus, quota, false, err
+	}
+	var watched watchedVideo
+	exists, err := t.store.Get(watchedVideosCollection, id, &watched)
+	if err != nil {
+		return youtubeStatus, quota, true, err
+	}
+	video := watchedVideo{Since: time.Now().UTC(), Key: key}
+	if exists && (watched.Until.IsZero() || video.Since.Before(watched.Until)) {
+		video.Key = watched.Key
+	}
+	if t.watchAge > 0 {
+		video.Until = video.Since.Add(t.watchAge)
+	}
+	return youtubeStatus, quota, true, t.store.Put(watchedVideosCollection, id, video)
+}
+
+// UnwatchVideo stops watching a video, unless it was started with another key. Videos watched before their key was
+// kept can be unwatched with any key. Snapshots already taken are kept. Gives back false if the video is watched
+// with another key.
+func (t *Tracker) UnwatchVideo(id string, key string) (bool, error) {
+	var video watchedVideo
+	found, err := t.store.Get(watchedVideosCollection, id, &video)
+	if err != nil || !found {
+		return true, err
+	}
+	if video.Key != "" && video.Key != key {
+		return false, nil
+	}
+	return true, t.store.Delete(watchedVideosCollection, id)
+}
+
+// VideoWatched checks whether a video is currently watched, and gives the time watching it ends, if any.
+func (t *Tracker) VideoWatched(id string) (bool, time.Time, error) {
+	var video watchedVideo
+	found, err := t.store.Get(watchedVideosCollection, id, &video)
+	if err != nil || !found || (!video.Until.IsZero() && time.Now().After(video.Until)) {
+		return false, time.Time{}, err
+	}
+	return true, video.Until, nil
+}
+
+// VideoHistory gives the snapshots of a video within a time range, downsampled like ChannelHistory. Each point
+// after the first includes the rate of views, likes and comments per hour since the last, and each point after the
+// second includes the acceleration of views, as the change in views per hour per hour.
+func (t *Tracker) VideoHistory(id string, since time.Time, until time.Time,
+	interval time.Duration) ([]VideoHistoryPoint, error) {
+	raw, err := t.store.Range(videoSnapshotsSeries, id, since, until)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]videoSnapshot, 0, len(raw))
+	for _, r := range raw {
+		var snapshot videoSnapshot
+		if err := json.Unmarshal(r, &snapshot); err != nil {
+			return nil, err
+		}
+		if len(snapshots) > 0 && sameInterval(snapshots[len(snapshots)-1].Time, snapshot.Time, interval) {
+			snapshots[len(snapshots)-1] = snapshot
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	history := make([]VideoHistoryPoint, len(snapshots))
+	for i, snapshot := range snapshots {
+		history[i] = VideoHistoryPoint{
+			Time:         snapshot.Time.Format(time.RFC3339),
+			ViewCount:    snapshot.Video.ViewCount,
+			LikeCount:    snapshot.Video.LikeCount,
+			CommentCount: snapshot.Video.CommentCount,
+		}
+		if i == 0 {
+			continue
+		}
+		hours := snapshot.Time.Sub(snapshots[i-1].Time).Hours()
+		if hours <= 0 {
+			continue
+		}
+		viewsPerHour := float64(history[i].ViewCount-history[i-1].ViewCount) / hours
+		likesPerHour := float64(history[i].LikeCount-history[i-1].LikeCount) / hours
+		commentsPerHour := float64(history[i].CommentCount-history[i-1].CommentCount) / hours
+		history[i].ViewsPerHour = &viewsPerHour
+		history[i].LikesPerHour = &likesPerHour
+		history[i].CommentsPerHour = &commentsPerHour
+		if history[i-1].ViewsPerHour != nil {
+			viewAcceleration := (viewsPerHour - *history[i-1].ViewsPerHour) / hours
+			history[i].ViewAcceleration = &viewAcceleration
+		}
+	}
+	return history, nil
+}
+
+// Checks whether two times fall within the same interval. Without an interval no two times do.
+func sameInterval(a time.Time, b time.Time, interval time.Duration) bool {
+	return interval > 0 && a.Truncate(interval).Equal(b.Truncate(interval))
+}
@@ -0,0 +1,461 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store collection of triggers on live chats.
+const chatTriggersCollection = "chat_triggers"
+
+// Event type of fired triggers, delivered to webhooks targeting the chat or the trigger.
+const chatTriggerEvent = "chat.trigger"
+
+// How many fired triggers are buffered for each notification stream before further ones are dropped.
+const triggerNotificationBuffer = 100
+
+// Types of triggers. Commands match messages starting with the command, patterns match the text written by users,
+// superchats match super chats of at least an amount, and new members match new memberships.
+var chatTriggerTypes = map[string]bool{
+	"command":    true,
+	"regex":      true,
+	"superchat":  true,
+	"new_member": true,
+}
+
+// Triggers evaluates rules registered on live chats against every event relayed from them, and fires webhooks and
+// notifications with the matched event and the arguments captured from it. Each chat with triggers is followed
+// through the relay using the key of the newest trigger, until the chat ends or its last trigger is deleted. Each
+// trigger only fires once per user within its cooldown. Triggers are managed with the API key they were created
+// with, and are only visible to requests using that key.
+type Triggers struct {
+	mutex     sync.Mutex
+	input     Inputs
+	store     Store
+	watchers  map[string]*triggerWatcher
+	listeners map[string]map[*triggerListener]bool
+}
+
+// A trigger as stored, including its chat and the key managing it, which is never sent back, and whether its chat
+// ended or could no longer be polled, after which it is not followed again.
+type storedChatTrigger struct {
+	Trigger ChatTrigger `json:"trigger"`
+	ChatId  string      `json:"chat_id"`
+	Key     string      `json:"key"`
+	Ended   bool        `json:"ended,omitempty"`
+}
+
+// A trigger ready to be evaluated, with its pattern compiled.
+type compiledTrigger struct {
+	stored  storedChatTrigger
+	pattern *regexp.Regexp
+}
+
+// A chat followed for its triggers, the triggers evaluated, and when each trigger last fired for each user. Events
+// published before the chat was followed are skipped, so that the events of the first page polled do not fire.
+type triggerWatcher struct {
+	chatId       string
+	key          string
+	since        time.Time
+	subscription *chatSubscription
+	triggers     []compiledTrigger
+	cooldowns    map[string]time.Time
+}
+
+// A client receiving the triggers fired on a chat that were created with its key.
+type triggerListener struct {
+	key    string
+	events chan relayedEvent
+}
+
+// NewTriggers creates triggers persisted in the given store, following chats through the relay of the inputs and
+// delivering webhooks through their dispatcher.
+func NewTriggers(input Inputs, store Store) *Triggers {
+	return &Triggers{
+		input:     input,
+		store:     store,
+		watchers:  make(map[string]*triggerWatcher),
+		listeners: make(map[string]map[*triggerListener]bool),
+	}
+}
+
+// Checks the definition of a trigger, giving back the status message describing what is wrong with it, or "".
+func validateChatTrigger(trigger ChatTrigger) string {
+	if !chatTriggerTypes[trigger.Type] {
+		return "triggerTypeInvalid"
+	}
+	if trigger.Type == "command" && (trigger.Command == "" || len(strings.Fields(trigger.Command)) != 1) {
+		return "triggerCommandInvalid"
+	}
+	if trigger.Type == "regex" {
+		if _, err := regexp.Compile(trigger.Pattern); err != nil || trigger.Pattern == "" {
+			return "triggerPatternInvalid"
+		}
+	}
+	if trigger.MinAmount < 0 {
+		return "triggerAmountInvalid"
+	}
+	if trigger.Currency != "" && len(trigger.Currency) != 3 {
+		return "currencyInvalid"
+	}
+	if trigger.Cooldown < 0 {
+		return "triggerCooldownInvalid"
+	}
+	return ""
+}
+
+// Compiles a stored trigger for evaluation.
+func compileChatTrigger(stored storedChatTrigger) compiledTrigger {
+	compiled := compiledTrigger{stored: stored}
+	if stored.Trigger.Type == "regex" {
+		compiled.pattern, _ = regexp.Compile(stored.Trigger.Pattern)
+	}
+	return compiled
+}
+
+// Evaluates a trigger against a chat event parsed by ChatParser, published at the given time. Gives back the
+// arguments captured from the event, and whether it matched. Commands capture the words after the command, and
+// patterns capture their groups. Amounts of super chats are converted into the currency of the trigger if it has one.
+func (c compiledTrigger) match(eventType string, event interface{}, at time.Time, rates *ExchangeRates) ([]string,
+	bool) {
+	trigger := c.stored.Trigger
+	switch trigger.Type {
+	case "command":
+		words := strings.Fields(chatEventMessage(event))
+		if !chatMessageTypes[eventType] || len(words) == 0 || !strings.EqualFold(words[0], trigger.Command) {
+			return nil, false
+		}
+		return append([]string{}, words[1:]...), true
+	case "regex":
+		message := chatEventMessage(event)
+		if message == "" || c.pattern == nil {
+			return nil, false
+		}
+		groups := c.pattern.FindStringSubmatch(message)
+		if groups == nil {
+			return nil, false
+		}
+		return append([]string{}, groups[1:]...), true
+	case "superchat":
+		superChat, ok := event.(ChatSuperChat)
+		if !ok {
+			return nil, false
+		}
+		amount := superChat.Amount
+		if trigger.Currency != "" {
+			amount, ok = rates.convert(superChat.Amount, superChat.Currency, trigger.Currency, at)
+			if !ok {
+				return nil, false
+			}
+		}
+		return []string{}, amount >= trigger.MinAmount
+	case "new_member":
+		return []string{}, eventType == "new_member"
+	}
+	return nil, false
+}
+
+// Gives the stored triggers of a chat, or of all chats if no chat is given, in the order they were created.
+func (t *Triggers) storedTriggers(chatId string) ([]storedChatTrigger, error) {
+	ids, err := t.store.Keys(chatTriggersCollection)
+	if err != nil {
+		return nil, err
+	}
+	var triggers []storedChatTrigger
+	for _, id := range ids {
+		var stored storedChatTrigger
+		found, err := t.store.Get(chatTriggersCollection, id, &stored)
+		if err != nil {
+			return nil, err
+		}
+		if found && (chatId == "" || stored.ChatId == chatId) {
+			triggers = append(triggers, stored)
+		}
+	}
+	return triggers, nil
+}
+
+// Starts following a chat for its stored triggers that have not ended using the key of its newest trigger, or
+// updates the triggers evaluated and the key polled with if it is already followed. Stops following the chat if it
+// has no such triggers left. Must be called with the mutex held.
+func (t *Triggers) watch(chatId string) error {
+	all, err := t.storedTriggers(chatId)
+	if err != nil {
+		return err
+	}
+	var stored []storedChatTrigger
+	for _, trigger := range all {
+		if !trigger.Ended {
+			stored = append(stored, trigger)
+		}
+	}
+	watcher, ok := t.watchers[chatId]
+	if len(stored) == 0 {
+		if ok {
+			delete(t.watchers, chatId)
+			watcher.subscription.close()
+		}
+		return nil
+	}
+	triggers := make([]compiledTrigger, len(stored))
+	for i, trigger := range stored {
+		triggers[i] = compileChatTrigger(trigger)
+	}
+	key := stored[len(stored)-1].Key
+	if ok {
+		watcher.triggers = triggers
+		if watcher.key != key {
+			watcher.key = key
+			watcher.subscription.useKey(key)
+		}
+		return nil
+	}
+	watcher = &triggerWatcher{
+		chatId:       chatId,
+		key:          key,
+		since:        time.Now().UTC(),
+		subscription: t.input.Relay.subscribe(chatId, key, "", ""),
+		triggers:     triggers,
+		cooldowns:    make(map[string]time.Time),
+	}
+	t.watchers[chatId] = watcher
+	go t.run(watcher)
+	return nil
+}
+
+// Evaluates the triggers of a followed chat against each of its events until the chat ends, polling fails, or the
+// chat is no longer followed. If the relay drops the watcher for falling behind, the chat is followed again from the
+// last event evaluated. The triggers of a chat that ended or failed are marked as ended. Notification streams of the
+// chat are closed unless the chat is followed again.
+func (t *Triggers) run(watcher *triggerWatcher) {
+	ended := false
+	subscription := watcher.subscription
+	var position chatPosition
+	for {
+		event, ok := <-subscription.events
+		if !ok {
+			t.mutex.Lock()
+			dropped := !ended && t.watchers[watcher.chatId] == watcher
+			if dropped {
+				log.Printf("Following chat %s again for its triggers after falling behind.", watcher.chatId)
+				subscription = t.input.Relay.subscribe(watcher.chatId, watcher.key, position.page,
+					position.lastEventId)
+				watcher.subscription = subscription
+			}
+			t.mutex.Unlock()
+			if dropped {
+				continue
+			}
+			break
+		}
+		if event.Type == relayErrorEvent {
+			status, _ := event.Event.(StatusCodeOutbound)
+			log.Printf("Stopped evaluating triggers on chat %s: %s", watcher.chatId, status.StatusMessage)
+			ended = true
+			break
+		}
+		ended = ended || event.Type == "chat_ended"
+		position.advance(event)
+		if event.Time.Before(watcher.since) {
+			continue
+		}
+		t.mutex.Lock()
+		triggers := watcher.triggers
+		t.mutex.Unlock()
+		for _, trigger := range triggers {
+			args, ok := trigger.match(event.Type, event.Event, event.Time, t.input.Rates)
+			if ok {
+				t.fire(watcher, trigger, event, args)
+			}
+		}
+	}
+	subscription.close()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.watchers[watcher.chatId] == watcher {
+		delete(t.watchers, watcher.chatId)
+		if ended {
+			t.end(watcher.chatId)
+		}
+	}
+	if _, ok := t.watchers[watcher.chatId]; ok {
+		return
+	}
+	for listener := range t.listeners[watcher.chatId] {
+		close(listener.events)
+	}
+	delete(t.listeners, watcher.chatId)
+}
+
+// Marks the triggers of a chat as ended. Must be called with the mutex held.
+func (t *Triggers) end(chatId string) {
+	stored, err := t.storedTriggers(chatId)
+	if err != nil {
+		log.Printf("Failed to end triggers on chat %s: %v", chatId, err)
+		return
+	}
+	for _, trigger := range stored {
+		if trigger.Ended {
+			continue
+		}
+		trigger.Ended = true
+		if err := t.store.Put(chatTriggersCollection, trigger.Trigger.Id, trigger); err != nil {
+			log.Printf("Failed to end trigger %s: %v", trigger.Trigger.Id, err)
+		}
+	}
+}
+
+// Fires a trigger on a chat event, unless it already fired for the user who caused the event within its cooldown.
+// The fired trigger is delivered to the webhooks targeting the chat or the trigger and to the notification streams
+// of the chat, as far as they use the key of the trigger.
+func (t *Triggers) fire(watcher *triggerWatcher, trigger compiledTrigger, event relayedEvent, args []string) {
+	author, _ := chatEventAuthor(event.Event)
+	cooldownKey := trigger.stored.Trigger.Id + "/" + author.UserId
+	cooldown := time.Duration(trigger.stored.Trigger.Cooldown) * time.Second
+	if last, ok := watcher.cooldowns[cooldownKey]; ok && event.Time.Sub(last) < cooldown {
+		return
+	}
+	watcher.cooldowns[cooldownKey] = event.Time
+	fired := ChatTriggerEvent{
+		ChatId:      watcher.chatId,
+		TriggerId:   trigger.stored.Trigger.Id,
+		TriggerType: trigger.stored.Trigger.Type,
+		Args:        args,
+		Event:       event.Event,
+	}
+	err := t.input.Dispatcher.emit(chatTriggerEvent, trigger.stored.Key, []string{watcher.chatId, fired.TriggerId},
+		fired, chatEventMessage(event.Event))
+	if err != nil {
+		log.Printf("Failed to emit trigger %s: %v", fired.TriggerId, err)
+	}
+	data, err := json.Marshal(fired)
+	if err != nil {
+		return
+	}
+	notification := relayedEvent{Id: fmt.Sprintf("%s/%s", event.Id, fired.TriggerId), Type: "trigger", Data: data}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for listener := range t.listeners[watcher.chatId] {
+		if listener.key != trigger.stored.Key {
+			continue
+		}
+		select {
+		case listener.events <- notification:
+		default:
+			log.Printf("Dropped trigger notification for a stream falling behind on chat %s.", watcher.chatId)
+		}
+	}
+}
+
+// Resume starts following all chats with stored triggers that have not ended, using the key of the newest trigger
+// of each chat.
+func (t *Triggers) Resume() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	stored, err := t.storedTriggers("")
+	if err != nil {
+		return err
+	}
+	followed := make(map[string]bool)
+	for _, trigger := range stored {
+		if trigger.Ended || followed[trigger.ChatId] {
+			continue
+		}
+		followed[trigger.ChatId] = true
+		if err := t.watch(trigger.ChatId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTrigger validates and stores a new trigger on a chat managed with the given key, and starts following the
+// chat with the key. Gives back the trigger, or a status message describing why it is invalid.
+func (t *Triggers) CreateTrigger(chatId string, trigger ChatTrigger, key string) (ChatTrigger, string, error) {
+	trigger.Currency = strings.ToUpper(trigger.Currency)
+	if msg := validateChatTrigger(trigger); msg != "" {
+		return trigger, msg, nil
+	}
+	now := time.Now().UTC()
+	id, err := newDeliveryId(now)
+	if err != nil {
+		return trigger, "", err
+	}
+	trigger.Id = id
+	trigger.CreatedAt = now.Format(time.RFC3339)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	err = t.store.Put(chatTriggersCollection, id, storedChatTrigger{Trigger: trigger, ChatId: chatId, Key: key})
+	if err != nil {
+		return trigger, "", err
+	}
+	return trigger, "", t.watch(chatId)
+}
+
+// ChatTriggers gives the triggers on a chat managed with the given key, and whether the chat is currently followed.
+func (t *Triggers) ChatTriggers(chatId string, key string) ([]ChatTrigger, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	stored, err := t.storedTriggers(chatId)
+	if err != nil {
+		return nil, false, err
+	}
+	triggers := []ChatTrigger{}
+	for _, trigger := range stored {
+		if trigger.Key == key {
+			triggers = append(triggers, trigger.Trigger)
+		}
+	}
+	_, watching := t.watchers[chatId]
+	return triggers, watching, nil
+}
+
+// DeleteTrigger deletes a trigger on a chat managed with the given key, reporting whether it existed. The chat is
+// followed with the key of the newest trigger left, and no longer followed once its last trigger is deleted.
+func (t *Triggers) DeleteTrigger(chatId string, id string, key string) (ChatTrigger, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var stored storedChatTrigger
+	found, err := t.store.Get(chatTriggersCollection, id, &stored)
+	if err != nil || !found || stored.ChatId != chatId || stored.Key != key {
+		return ChatTrigger{}, false, err
+	}
+	if err := t.store.Delete(chatTriggersCollection, id); err != nil {
+		return stored.Trigger, true, err
+	}
+	if _, ok := t.watchers[chatId]; !ok {
+		return stored.Trigger, true, nil
+	}
+	return stored.Trigger, true, t.watch(chatId)
+}
+
+// Starts receiving the triggers fired on a chat created with the given key. Gives back false if the chat is not
+// currently followed.
+func (t *Triggers) listen(chatId string, key string) (*triggerListener, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.watchers[chatId]; !ok {
+		return nil, false
+	}
+	listener := &triggerListener{key: key, events: make(chan relayedEvent, triggerNotificationBuffer)}
+	if t.listeners[chatId] == nil {
+		t.listeners[chatId] = make(map[*triggerListener]bool)
+	}
+	t.listeners[chatId][listener] = true
+	return listener, true
+}
+
+// Stops receiving triggers fired on a chat.
+func (t *Triggers) unlisten(chatId string, listener *triggerListener) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.listeners[chatId][listener] {
+		delete(t.listeners[chatId], listener)
+		close(listener.events)
+	}
+}
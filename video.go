@@ -2,11 +2,10 @@ package yt_stats
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
+	"time"
 )
 
 // VideoHandler is the handler for the video endpoint. /ytstats/v1/video/
@@ -18,8 +17,6 @@ func VideoHandler(input Inputs) http.Handler {
 		case http.MethodGet:
 
 			// Check user input and fail if input is incorrect or missing.
-			var youtubeStatus StatusCodeOutbound
-			videoInbound := make([]VideoInbound, 1)
 			key := getKey(r)
 			if key == "" {
 				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
@@ -41,18 +38,9 @@ func VideoHandler(input Inputs) http.Handler {
 			}
 
 			// Query youtube videos endpoint and handle errors.
-			resp, err := http.Get(fmt.Sprintf("%s&id=%s&key=%s", input.VideosRoot, url.QueryEscape(ids), key))
-			if err != nil {
-				sendStatusCode(w, quota, http.StatusInternalServerError, "failedToQueryYouTubeAPI")
-				return
-			}
-			defer resp.Body.Close()
-			quota++
-			youtubeStatus = ErrorParser(resp.Body, &videoInbound[0])
+			videoInboundPage, youtubeStatus, cost := queryVideos(input, ids, key)
+			quota += cost
 			if youtubeStatus.StatusCode != http.StatusOK {
-				if youtubeStatus.StatusMessage == "keyInvalid" { // Quota cannot be deducted from invalid keys.
-					quota--
-				}
 				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
 				return
 			}
@@ -60,7 +48,7 @@ func VideoHandler(input Inputs) http.Handler {
 			// Parse videos endpoint response and provide response.
 			var tempPlaylistObject Playlist
 			var videoOutbound VideoOutbound
-			err = VideoParser(videoInbound, &tempPlaylistObject, statsFlag == "true", true)
+			err := VideoParser([]VideoInbound{videoInboundPage}, &tempPlaylistObject, statsFlag == "true", true)
 			if err != nil {
 				sendStatusCode(w, quota, http.StatusInternalServerError, "failedParsingYouTubeResponse")
 			}
@@ -80,3 +68,168 @@ func VideoHandler(input Inputs) http.Handler {
 	}
 	return http.HandlerFunc(video)
 }
+
+// VideoHistoryHandler is the handler for the video history endpoint. /ytstats/v1/video/{id}/history/
+// Provides snapshots of the statistics of a watched video over time, with the rate of views, likes and comments per
+// hour and the acceleration of views. Watching a video is started with POST, which takes the first snapshot, and
+// stopped with DELETE. Videos stop being watched on their own after the watch age configured on the server.
+func VideoHistoryHandler(input Inputs) http.Handler {
+	videoHistory := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/video/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "videoIdMissing")
+				return
+			}
+			if input.Tracker == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			since, err := parseDate(r.URL.Query().Get("since"), false)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			until, err := parseDate(r.URL.Query().Get("until"), true)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusBadRequest, "dateInvalid")
+				return
+			}
+			var interval time.Duration
+			if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+				interval, err = ParseInterval(intervalParam)
+				if err != nil || interval <= 0 {
+					sendStatusCode(w, quota, http.StatusBadRequest, "intervalInvalid")
+					return
+				}
+			}
+
+			// Start or stop watching the video. Starting takes a snapshot to make sure the video exists.
+			switch r.Method {
+			case http.MethodPost:
+				youtubeStatus, cost, found, err := input.Tracker.WatchVideo(id, key)
+				quota += cost
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if youtubeStatus.StatusCode != http.StatusOK {
+					sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+					return
+				}
+				if !found {
+					sendStatusCode(w, quota, http.StatusNotFound, "videoNotFound")
+					return
+				}
+			case http.MethodDelete:
+				unwatched, err := input.Tracker.UnwatchVideo(id, key)
+				if err != nil {
+					sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+					return
+				}
+				if !unwatched {
+					sendStatusCode(w, quota, http.StatusNotFound, "videoNotWatched")
+					return
+				}
+			}
+
+			// Read the history from the store.
+			watched, watchedUntil, err := input.Tracker.VideoWatched(id)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			history, err := input.Tracker.VideoHistory(id, since, until, interval)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if r.Method == http.MethodGet && !watched && len(history) == 0 {
+				sendStatusCode(w, quota, http.StatusNotFound, "videoNotWatched")
+				return
+			}
+
+			// Provide response.
+			videoHistoryOutbound := VideoHistoryOutbound{
+				QuotaUsage: quota,
+				VideoId:    id,
+				Watched:    watched,
+				History:    history,
+			}
+			if watched && !watchedUntil.IsZero() {
+				videoHistoryOutbound.WatchedUntil = watchedUntil.Format(time.RFC3339)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(videoHistoryOutbound)
+			if err != nil {
+				log.Println("Failed to respond to video history endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(videoHistory)
+}
+
+// VideoEmotesHandler is the handler for the video emotes endpoint. /ytstats/v1/video/{id}/emotes/
+// Provides frequency tables of the words, Unicode emoji and emote shortcodes in all comments and replies of a video,
+// optionally limited to a time range, and per interval if one is given.
+func VideoEmotesHandler(input Inputs) http.Handler {
+	videoEmotes := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/video/")
+			if id == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "videoIdMissing")
+				return
+			}
+			since, until, interval, limit, msg := parseEmotesQuery(r)
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+
+			// Query youtube for all comments and replies, and check responses for errors.
+			comments, youtubeStatus, cost := queryComments(input, id, key)
+			quota += cost
+			if youtubeStatus.StatusCode != http.StatusOK {
+				sendStatusCode(w, quota, youtubeStatus.StatusCode, youtubeStatus.StatusMessage)
+				return
+			}
+
+			// Tabulate comments and replies, and provide response.
+			emotesOutbound := commentEmotes(comments, since, until, interval, limit)
+			emotesOutbound.QuotaUsage = quota
+			emotesOutbound.VideoId = id
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(emotesOutbound)
+			if err != nil {
+				log.Println("Failed to respond to video emotes endpoint.")
+			}
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(videoEmotes)
+}
@@ -0,0 +1,129 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// How long before their scheduled start scheduled streams are polled for viewers, to catch them going live.
+const viewersLeadTime = 10 * time.Minute
+
+// The parts of a stream snapshot needed for viewer samples, as stored by the tracker.
+type viewerSnapshot struct {
+	Time   time.Time `json:"time"`
+	Stream struct {
+		Status            string `json:"status"`
+		StartTime         string `json:"start_time"`
+		EndTime           string `json:"end_time"`
+		ConcurrentViewers *int   `json:"concurrent_viewers"`
+	} `json:"stream"`
+}
+
+// Gives the IDs of all streams last known to be live, or scheduled to start before the lead time has passed.
+func (t *Tracker) activeStreamIds(now time.Time) ([]string, error) {
+	ids, err := t.store.Keys(streamStatesCollection)
+	if err != nil {
+		return nil, err
+	}
+	var active []string
+	for _, id := range ids {
+		var state streamState
+		found, err := t.store.Get(streamStatesCollection, id, &state)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		scheduled, err := time.Parse(time.RFC3339, state.ScheduledStartTime)
+		startingSoon := state.Status == "scheduled" && err == nil && scheduled.Before(now.Add(viewersLeadTime))
+		if state.Status == "live" || startingSoon {
+			active = append(active, id)
+		}
+	}
+	return active, nil
+}
+
+// RecordStream takes a snapshot of a stream using the given key, after which it is polled for viewers while it is
+// scheduled or live. Gives back the status of the query, the quota used, and whether the video is a stream.
+func (t *Tracker) RecordStream(id string, key string) (StatusCodeOutbound, int, bool, error) {
+	streamInbound, youtubeStatus, quota := queryStreams(t.input, id, key)
+	if youtubeStatus.StatusCode != http.StatusOK {
+		return youtubeStatus, quota, false, nil
+	}
+	streams := StreamParser(streamInbound).Streams
+	if len(streams) == 0 || streamStatus(streams[0]) == "video" {
+		return youtubeStatus, quota, false, nil
+	}
+	return youtubeStatus, quota, true, t.recordStream(id, "", streams[0], time.Now().UTC())
+}
+
+// StreamStatus gives the last known status of a stream, or "" if the stream is not known.
+func (t *Tracker) StreamStatus(id string) (string, error) {
+	var state streamState
+	_, err := t.store.Get(streamStatesCollection, id, &state)
+	return state.Status, err
+}
+
+// StreamViewers gives the concurrent viewers of a stream sampled while it was live within a time range, and a summary
+// of them. If an interval is given, only the highest sample within each interval is kept, while the summary is always
+// of all samples. The live duration runs until the end of the stream, or the last snapshot if it has not ended.
+func (t *Tracker) StreamViewers(id string, since time.Time, until time.Time,
+	interval time.Duration) (ViewerSummary, []ViewerSample, error) {
+	raw, err := t.store.Range(streamSnapshotsSeries, id, since, until)
+	if err != nil {
+		return ViewerSummary{}, nil, err
+	}
+	var summary ViewerSummary
+	samples := []ViewerSample{}
+	var sampleTimes []time.Time
+	var last viewerSnapshot
+	total := 0
+	for _, r := range raw {
+		var snapshot viewerSnapshot
+		if err := json.Unmarshal(r, &snapshot); err != nil {
+			return ViewerSummary{}, nil, err
+		}
+		last = snapshot
+		if snapshot.Stream.Status != "live" || snapshot.Stream.ConcurrentViewers == nil ||
+			*snapshot.Stream.ConcurrentViewers < 0 {
+			continue
+		}
+		viewers := *snapshot.Stream.ConcurrentViewers
+		sample := ViewerSample{Time: snapshot.Time.Format(time.RFC3339), ConcurrentViewers: viewers}
+		summary.Samples++
+		total += viewers
+		if summary.Samples == 1 || viewers > summary.PeakViewers {
+			summary.PeakViewers = viewers
+			summary.PeakTime = sample.Time
+		}
+		if n := len(samples); n > 0 && sameInterval(sampleTimes[n-1], snapshot.Time, interval) {
+			if viewers > samples[n-1].ConcurrentViewers {
+				samples[n-1] = sample
+			}
+			continue
+		}
+		samples = append(samples, sample)
+		sampleTimes = append(sampleTimes, snapshot.Time)
+	}
+	if summary.Samples > 0 {
+		summary.AverageViewers = float64(total) / float64(summary.Samples)
+	}
+
+	// Work out how long the stream was live from its start and end times.
+	summary.StartTime = last.Stream.StartTime
+	summary.EndTime = last.Stream.EndTime
+	start, err := time.Parse(time.RFC3339, summary.StartTime)
+	if err != nil {
+		return summary, samples, nil
+	}
+	end := last.Time
+	if parsedEnd, err := time.Parse(time.RFC3339, summary.EndTime); err == nil {
+		end = parsedEnd
+	}
+	if end.After(start) {
+		summary.DurationLive = int(end.Sub(start).Seconds())
+	}
+	return summary, samples, nil
+}
@@ -0,0 +1,194 @@
+package yt_stats
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Sends webhooks as the response of the webhooks endpoints.
+func sendWebhooks(w http.ResponseWriter, webhooks []Webhook) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(WebhooksOutbound{Webhooks: webhooks})
+	if err != nil {
+		log.Println("Failed to respond to webhooks endpoint.")
+	}
+}
+
+// Sends deliveries of a webhook as the response of the webhook deliveries and ping endpoints.
+func sendDeliveries(w http.ResponseWriter, id string, deliveries []WebhookDelivery) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(WebhookDeliveriesOutbound{WebhookId: id, Deliveries: deliveries})
+	if err != nil {
+		log.Println("Failed to respond to webhook deliveries endpoint.")
+	}
+}
+
+// WebhooksHandler is the handler for the webhooks endpoint. /ytstats/v1/webhooks/
+// Lists and creates webhooks with GET and POST, and gives or deletes one webhook with GET and DELETE on
+// /ytstats/v1/webhooks/{id}/. Webhooks are only visible when using the key used to create them.
+func WebhooksHandler(input Inputs) http.Handler {
+	webhooks := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+
+		// Check user input and fail if input is incorrect or missing.
+		switch r.Method {
+		case http.MethodGet, http.MethodPost, http.MethodDelete:
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+		key := getKey(r)
+		if key == "" {
+			sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+			return
+		}
+		if input.Dispatcher == nil {
+			sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+			return
+		}
+		id := getPathId(r, "/ytstats/v1/webhooks/")
+
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			webhooks, err := input.Dispatcher.Webhooks(key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			sendWebhooks(w, webhooks)
+		case r.Method == http.MethodGet:
+			webhook, found, err := input.Dispatcher.Webhook(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "webhookNotFound")
+				return
+			}
+			sendWebhooks(w, []Webhook{webhook})
+		case r.Method == http.MethodPost && id == "":
+			var webhook Webhook
+			r.Body = http.MaxBytesReader(w, r.Body, 1048576) // Read max 1 MB
+			webhookErr := json.NewDecoder(r.Body).Decode(&webhook)
+			if webhookErr != nil && webhookErr.Error() == "http: request body too large" {
+				sendStatusCode(w, quota, http.StatusRequestEntityTooLarge, "webhookBodyTooLarge")
+				return
+			} else if webhookErr != nil && webhookErr != io.EOF {
+				sendStatusCode(w, quota, http.StatusBadRequest, "webhookBodyInvalid")
+				return
+			}
+			webhook, msg, err := input.Dispatcher.CreateWebhook(webhook, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if msg != "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, msg)
+				return
+			}
+			sendWebhooks(w, []Webhook{webhook})
+		case r.Method == http.MethodDelete && id != "":
+			webhook, found, err := input.Dispatcher.Webhook(id, key)
+			if err == nil && found {
+				found, err = input.Dispatcher.DeleteWebhook(id, key)
+			}
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "webhookNotFound")
+				return
+			}
+			sendWebhooks(w, []Webhook{webhook})
+		case r.Method == http.MethodDelete:
+			sendStatusCode(w, quota, http.StatusBadRequest, "webhookIdMissing")
+		default:
+			unsupportedRequestType(w)
+		}
+	}
+	return http.HandlerFunc(webhooks)
+}
+
+// WebhookDeliveriesHandler is the handler for the webhook deliveries endpoint. /ytstats/v1/webhooks/{id}/deliveries/
+// Gives the delivery log of a webhook, newest first, including pending, delivered and failed deliveries.
+func WebhookDeliveriesHandler(input Inputs) http.Handler {
+	deliveries := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodGet:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			if input.Dispatcher == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/webhooks/")
+
+			// Read the delivery log and provide response.
+			deliveries, found, err := input.Dispatcher.Deliveries(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "webhookNotFound")
+				return
+			}
+			sendDeliveries(w, id, deliveries)
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(deliveries)
+}
+
+// WebhookPingHandler is the handler for the webhook ping endpoint. /ytstats/v1/webhooks/{id}/ping/
+// Queues a ping event to a webhook with POST, to test that it receives and verifies deliveries.
+func WebhookPingHandler(input Inputs) http.Handler {
+	ping := func(w http.ResponseWriter, r *http.Request) {
+		quota := 0
+		switch r.Method {
+		case http.MethodPost:
+
+			// Check user input and fail if input is incorrect or missing.
+			key := getKey(r)
+			if key == "" {
+				sendStatusCode(w, quota, http.StatusBadRequest, "keyMissing")
+				return
+			}
+			if input.Dispatcher == nil {
+				sendStatusCode(w, quota, http.StatusServiceUnavailable, "trackingDisabled")
+				return
+			}
+			id := getPathId(r, "/ytstats/v1/webhooks/")
+
+			// Queue the ping and provide response.
+			delivery, found, err := input.Dispatcher.Ping(id, key)
+			if err != nil {
+				sendStatusCode(w, quota, http.StatusInternalServerError, "failedAccessingStore")
+				return
+			}
+			if !found {
+				sendStatusCode(w, quota, http.StatusNotFound, "webhookNotFound")
+				return
+			}
+			sendDeliveries(w, id, []WebhookDelivery{delivery})
+			return
+		default:
+			unsupportedRequestType(w)
+			return
+		}
+	}
+	return http.HandlerFunc(ping)
+}